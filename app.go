@@ -7,6 +7,9 @@ import (
 	"io"
 	"os"
 	"path"
+	"strconv"
+	"sync"
+	"time"
 
 	leveldb "github.com/ipfs/go-ds-leveldb"
 	logging "github.com/ipfs/go-log/v2"
@@ -14,10 +17,15 @@ import (
 	"github.com/ipld/go-ipld-prime/codec/dagjson"
 	"github.com/ipld/go-ipld-prime/datamodel"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/p2p"
 	"github.com/storacha/fam/store"
+	"github.com/storacha/fam/syncer"
 	"github.com/storacha/go-ucanto/core/delegation"
 	"github.com/storacha/go-ucanto/did"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 var log = logging.Logger("app")
@@ -30,11 +38,20 @@ type NodeBuilder interface {
 type App struct {
 	ctx      context.Context
 	userdata *store.UserDataStore
+	stopSync context.CancelFunc
+	// progressEmitted is when progress was last emitted, per bucket and remote
+	progressEmitted map[string]time.Time
+	progressMutex   sync.Mutex
 }
 
+// LocalNetworkEnv is the environment variable that, if true, makes the app
+// listen for connections on all interfaces and discover peers holding the same
+// buckets on the local network with mDNS. It is off by default.
+const LocalNetworkEnv = "FAM_LOCAL_NETWORK"
+
 // NewApp creates a new App application struct
 func NewApp() *App {
-	return &App{}
+	return &App{progressEmitted: map[string]time.Time{}}
 }
 
 // startup is called when the app starts. The context is saved
@@ -57,15 +74,55 @@ func (a *App) startup(ctx context.Context) {
 		log.Fatalln("creating datastore: %w", err)
 	}
 
-	userdata, err := store.NewUserDataStore(ctx, dstore)
+	// listening on all interfaces and announcing ourselves with mDNS exposes
+	// the agent to everyone on the network, so it must be opted in to
+	localNetwork, _ := strconv.ParseBool(os.Getenv(LocalNetworkEnv))
+	var options []store.Option
+	if localNetwork {
+		options = append(options, store.WithHostOptions(libp2p.ListenAddrStrings("/ip4/0.0.0.0/tcp/0")))
+	}
+	userdata, err := store.NewUserDataStore(ctx, dstore, options...)
 	if err != nil {
 		log.Fatalln(err)
 	}
 
 	a.userdata = userdata
+
+	syncCtx, stopSync := context.WithCancel(ctx)
+	a.stopSync = stopSync
+	s := syncer.New(userdata, syncer.WithProgress(a.emitProgress), syncer.WithNotify(func(r syncer.Result) {
+		runtime.EventsEmit(ctx, "sync", r.Bucket.String(), r.Remote)
+		a.emitConflicts(r.Bucket, r.Remote, r.Conflicts)
+	}))
+	go s.Run(syncCtx)
+
+	h, err := userdata.Host(ctx)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	id, err := userdata.ID(ctx)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	// heads pushed or announced by peers are merged too, and may conflict
+	conflicts := p2p.WithConflictHandler(func(id did.DID, from peer.ID, conflicts []bucket.Conflict) {
+		a.emitConflicts(id, from.String(), conflicts)
+	})
+	p2p.NewHandler(id, userdata.Replica, conflicts).Register(h)
+	err = userdata.StartGossip(syncCtx, conflicts)
+	if err != nil {
+		log.Errorln(err)
+	}
+	if localNetwork {
+		err = userdata.StartDiscovery(syncCtx)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
 }
 
 func (a *App) shutdown(ctx context.Context) {
+	a.stopSync()
 	err := a.userdata.Close()
 	if err != nil {
 		log.Errorln(err)
@@ -228,6 +285,119 @@ func (a *App) Entries(params string) (string, error) {
 	return marshalJSON(entries[start:end])
 }
 
+func (a *App) Status(params string) (string, error) {
+	id, err := unmarshalStatusParams(params)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	bk, err := a.userdata.Bucket(a.ctx, id)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	nbk, ok := bk.(bucket.Networker)
+	if !ok {
+		err := fmt.Errorf("bucket is not a networker: %s", id)
+		log.Error(err)
+		return "", err
+	}
+
+	tracker, ok := bk.(bucket.Tracker)
+	if !ok {
+		err := fmt.Errorf("bucket is not a tracker: %s", id)
+		log.Error(err)
+		return "", err
+	}
+
+	rems, err := nbk.Remotes(a.ctx)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	var names []string
+	for e, err := range rems.Entries(a.ctx) {
+		if err != nil {
+			log.Error(err)
+			return "", err
+		}
+		names = append(names, e.Key)
+	}
+	// peers found on the local network are included
+	if dbk, ok := bk.(bucket.Discoverer); ok {
+		discovered, err := dbk.Discovered(a.ctx)
+		if err != nil {
+			log.Error(err)
+			return "", err
+		}
+		for name := range discovered {
+			names = append(names, name)
+		}
+	}
+
+	statuses := Statuses{}
+	for _, name := range names {
+		if _, ok := statuses[name]; ok {
+			continue
+		}
+		status, err := nbk.Status(a.ctx, name)
+		if err != nil {
+			log.Error(err)
+			return "", err
+		}
+		state, err := tracker.SyncState(a.ctx, name)
+		if err != nil {
+			log.Error(err)
+			return "", err
+		}
+		statuses[name] = RemoteStatus{status, state}
+	}
+
+	return marshalJSON(statuses)
+}
+
+// Pull fetches and merges changes from a remote of a bucket. It returns the new
+// local head and the keys that were modified both locally and on the remote.
+func (a *App) Pull(params string) (string, error) {
+	id, name, err := unmarshalPullParams(params)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	bk, err := a.userdata.Bucket(a.ctx, id)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	nbk, ok := bk.(bucket.Networker)
+	if !ok {
+		err := fmt.Errorf("bucket is not a networker: %s", id)
+		log.Error(err)
+		return "", err
+	}
+
+	remote, err := nbk.Remote(a.ctx, name)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	res, err := remote.Pull(a.ctx, bucket.WithProgress(func(p bucket.Progress) {
+		a.emitProgress(id, name, p)
+	}))
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	return marshalJSON(MergeResult(res))
+}
+
 type Bytes []byte
 
 func (a Bytes) ToIPLD() (datamodel.Node, error) {
@@ -315,6 +485,21 @@ func unmarshalRootParams(input string) (did.DID, error) {
 	return did.Decode(b)
 }
 
+func unmarshalStatusParams(input string) (did.DID, error) {
+	np := basicnode.Prototype.Bytes
+	nb := np.NewBuilder()
+	err := dagjson.Decode(nb, bytes.NewReader([]byte(input)))
+	if err != nil {
+		return did.Undef, fmt.Errorf("decoding params: %w", err)
+	}
+	n := nb.Build()
+	b, err := n.AsBytes()
+	if err != nil {
+		return did.Undef, err
+	}
+	return did.Decode(b)
+}
+
 func unmarshalPutParams(input string) (did.DID, string, ipld.Link, error) {
 	np := basicnode.Prototype.Any
 	nb := np.NewBuilder()
@@ -358,6 +543,512 @@ func unmarshalPutParams(input string) (did.DID, string, ipld.Link, error) {
 	return id, key, value, nil
 }
 
+// RemoteStatus is the status of a remote along with the state of background
+// syncing with it.
+type RemoteStatus struct {
+	bucket.RemoteStatus
+	Sync bucket.SyncState
+}
+
+// Statuses are the statuses of the remotes of a bucket, keyed by remote name.
+type Statuses map[string]RemoteStatus
+
+func (s Statuses) ToIPLD() (datamodel.Node, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	ma, err := nb.BeginMap(int64(len(s)))
+	if err != nil {
+		return nil, err
+	}
+	for name, status := range s {
+		err = ma.AssembleKey().AssignString(name)
+		if err != nil {
+			return nil, err
+		}
+		sa, err := ma.AssembleValue().BeginMap(5)
+		if err != nil {
+			return nil, err
+		}
+		err = sa.AssembleKey().AssignString("head")
+		if err != nil {
+			return nil, err
+		}
+		la, err := sa.AssembleValue().BeginList(int64(len(status.Head)))
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range status.Head {
+			err = la.AssembleValue().AssignLink(l)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = la.Finish()
+		if err != nil {
+			return nil, err
+		}
+		err = sa.AssembleKey().AssignString("ahead")
+		if err != nil {
+			return nil, err
+		}
+		err = sa.AssembleValue().AssignInt(int64(status.Ahead))
+		if err != nil {
+			return nil, err
+		}
+		err = sa.AssembleKey().AssignString("behind")
+		if err != nil {
+			return nil, err
+		}
+		err = sa.AssembleValue().AssignInt(int64(status.Behind))
+		if err != nil {
+			return nil, err
+		}
+		err = sa.AssembleKey().AssignString("lastSync")
+		if err != nil {
+			return nil, err
+		}
+		var last int64
+		if !status.Sync.LastSync.IsZero() {
+			last = status.Sync.LastSync.UnixMilli()
+		}
+		err = sa.AssembleValue().AssignInt(last)
+		if err != nil {
+			return nil, err
+		}
+		err = sa.AssembleKey().AssignString("lastError")
+		if err != nil {
+			return nil, err
+		}
+		err = sa.AssembleValue().AssignString(status.Sync.LastError)
+		if err != nil {
+			return nil, err
+		}
+		err = sa.Finish()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
+
+// Diff returns the keys that differ between two states of a bucket. Each state
+// is a list of event links making a head, or a single pail root link. The to
+// state defaults to the current head, and the from state to the head before
+// the last change.
+func (a *App) Diff(params string) (string, error) {
+	id, from, to, err := unmarshalDiffParams(params)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	replica, err := a.userdata.Replica(a.ctx, id)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	blocks := replica.Blocks()
+
+	if to == nil {
+		to, err = replica.Head(a.ctx)
+		if err != nil {
+			log.Error(err)
+			return "", err
+		}
+		if from == nil {
+			from, err = bucket.Parents(a.ctx, blocks, to)
+			if err != nil {
+				log.Error(err)
+				return "", err
+			}
+		}
+	}
+	aroot, err := bucket.ResolveRoot(a.ctx, blocks, from)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+	broot, err := bucket.ResolveRoot(a.ctx, blocks, to)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	changes := Changes{}
+	for change, err := range bucket.Diff(a.ctx, blocks, aroot, broot) {
+		if err != nil {
+			log.Error(err)
+			return "", err
+		}
+		changes = append(changes, change)
+	}
+	return marshalJSON(changes)
+}
+
+// emitConflicts tells the frontend about the conflicts found when merging a
+// head received from the named remote or peer, if there are any.
+func (a *App) emitConflicts(id did.DID, remote string, conflicts []bucket.Conflict) {
+	if len(conflicts) == 0 {
+		return
+	}
+	data, err := marshalJSON(Conflicts(conflicts))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	runtime.EventsEmit(a.ctx, "conflicts", id.String(), remote, data)
+}
+
+// emitProgress emits the progress of a transfer with a remote of a bucket to
+// the frontend. Progress is emitted at most every 100ms per transfer, except
+// when all known blocks are transferred and when the transfer is done.
+func (a *App) emitProgress(id did.DID, remote string, p bucket.Progress) {
+	key := id.String() + "/" + remote
+	a.progressMutex.Lock()
+	if !p.Done && p.Pending > 0 && time.Since(a.progressEmitted[key]) < 100*time.Millisecond {
+		a.progressMutex.Unlock()
+		return
+	}
+	if p.Done {
+		delete(a.progressEmitted, key)
+	} else {
+		a.progressEmitted[key] = time.Now()
+	}
+	a.progressMutex.Unlock()
+
+	progress, err := marshalJSON(Progress(p))
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	runtime.EventsEmit(a.ctx, "progress", id.String(), remote, progress)
+}
+
+func unmarshalPullParams(input string) (did.DID, string, error) {
+	np := basicnode.Prototype.Map
+	nb := np.NewBuilder()
+	err := dagjson.Decode(nb, bytes.NewReader([]byte(input)))
+	if err != nil {
+		return did.Undef, "", fmt.Errorf("decoding params: %w", err)
+	}
+	n := nb.Build()
+
+	idn, err := n.LookupByString("id")
+	if err != nil {
+		return did.Undef, "", fmt.Errorf("looking up id: %w", err)
+	}
+	idBytes, err := idn.AsBytes()
+	if err != nil {
+		return did.Undef, "", fmt.Errorf("decoding id as bytes: %w", err)
+	}
+	id, err := did.Decode(idBytes)
+	if err != nil {
+		return did.Undef, "", fmt.Errorf("decoding id as DID: %w", err)
+	}
+
+	name := store.DefaultRemoteName
+	rn, err := n.LookupByString("remote")
+	if err == nil {
+		name, err = rn.AsString()
+		if err != nil {
+			return did.Undef, "", fmt.Errorf("decoding remote as string: %w", err)
+		}
+	}
+
+	return id, name, nil
+}
+
+func unmarshalDiffParams(input string) (did.DID, []ipld.Link, []ipld.Link, error) {
+	np := basicnode.Prototype.Map
+	nb := np.NewBuilder()
+	err := dagjson.Decode(nb, bytes.NewReader([]byte(input)))
+	if err != nil {
+		return did.Undef, nil, nil, fmt.Errorf("decoding params: %w", err)
+	}
+	n := nb.Build()
+
+	idn, err := n.LookupByString("id")
+	if err != nil {
+		return did.Undef, nil, nil, fmt.Errorf("looking up id: %w", err)
+	}
+	idBytes, err := idn.AsBytes()
+	if err != nil {
+		return did.Undef, nil, nil, fmt.Errorf("decoding id as bytes: %w", err)
+	}
+	id, err := did.Decode(idBytes)
+	if err != nil {
+		return did.Undef, nil, nil, fmt.Errorf("decoding id as DID: %w", err)
+	}
+
+	links := func(key string) ([]ipld.Link, error) {
+		ln, err := n.LookupByString(key)
+		if err != nil {
+			return nil, nil
+		}
+		var links []ipld.Link
+		it := ln.ListIterator()
+		if it == nil {
+			return nil, fmt.Errorf("%s is not a list", key)
+		}
+		for !it.Done() {
+			_, v, err := it.Next()
+			if err != nil {
+				return nil, fmt.Errorf("iterating %s: %w", key, err)
+			}
+			l, err := v.AsLink()
+			if err != nil {
+				return nil, fmt.Errorf("decoding %s as link: %w", key, err)
+			}
+			links = append(links, l)
+		}
+		return links, nil
+	}
+	from, err := links("from")
+	if err != nil {
+		return did.Undef, nil, nil, err
+	}
+	to, err := links("to")
+	if err != nil {
+		return did.Undef, nil, nil, err
+	}
+
+	return id, from, to, nil
+}
+
+// Changes are the differences between two states of a bucket. The old value of
+// an added key and the new value of a removed key are null.
+type Changes []bucket.Change
+
+func (c Changes) ToIPLD() (datamodel.Node, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	la, err := nb.BeginList(int64(len(c)))
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range c {
+		ma, err := la.AssembleValue().BeginMap(4)
+		if err != nil {
+			return nil, err
+		}
+		err = ma.AssembleKey().AssignString("type")
+		if err != nil {
+			return nil, err
+		}
+		err = ma.AssembleValue().AssignString(string(change.Type))
+		if err != nil {
+			return nil, err
+		}
+		err = ma.AssembleKey().AssignString("key")
+		if err != nil {
+			return nil, err
+		}
+		err = ma.AssembleValue().AssignString(change.Key)
+		if err != nil {
+			return nil, err
+		}
+		values := []struct {
+			name  string
+			value ipld.Link
+		}{
+			{"old", change.Old},
+			{"new", change.New},
+		}
+		for _, v := range values {
+			err = ma.AssembleKey().AssignString(v.name)
+			if err != nil {
+				return nil, err
+			}
+			if v.value == nil {
+				err = ma.AssembleValue().AssignNull()
+			} else {
+				err = ma.AssembleValue().AssignLink(v.value)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = ma.Finish()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = la.Finish()
+	if err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
+
+// Progress is the progress of a transfer with a remote. Durations are in
+// milliseconds.
+type Progress bucket.Progress
+
+func (p Progress) ToIPLD() (datamodel.Node, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	ma, err := nb.BeginMap(9)
+	if err != nil {
+		return nil, err
+	}
+	values := []struct {
+		name  string
+		value int64
+	}{
+		{"events", int64(p.Events)},
+		{"blocks", int64(p.Blocks)},
+		{"bytes", p.Bytes},
+		{"resumed", int64(p.Resumed)},
+		{"pending", int64(p.Pending)},
+		{"elapsed", p.Elapsed.Milliseconds()},
+		{"eta", p.ETA.Milliseconds()},
+	}
+	for _, v := range values {
+		err = ma.AssembleKey().AssignString(v.name)
+		if err != nil {
+			return nil, err
+		}
+		err = ma.AssembleValue().AssignInt(v.value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = ma.AssembleKey().AssignString("done")
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleValue().AssignBool(p.Done)
+	if err != nil {
+		return nil, err
+	}
+	var msg string
+	if p.Err != nil {
+		msg = p.Err.Error()
+	}
+	err = ma.AssembleKey().AssignString("error")
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleValue().AssignString(msg)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
+
+// MergeResult is the outcome of merging changes from a remote.
+type MergeResult bucket.MergeResult
+
+func (m MergeResult) ToIPLD() (datamodel.Node, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	ma, err := nb.BeginMap(2)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("head")
+	if err != nil {
+		return nil, err
+	}
+	la, err := ma.AssembleValue().BeginList(int64(len(m.Head)))
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range m.Head {
+		err = la.AssembleValue().AssignLink(l)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = la.Finish()
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("conflicts")
+	if err != nil {
+		return nil, err
+	}
+	cn, err := Conflicts(m.Conflicts).ToIPLD()
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleValue().AssignNode(cn)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
+
+// Conflicts are keys modified both locally and on a remote. Deleted values are
+// null.
+type Conflicts []bucket.Conflict
+
+func (c Conflicts) ToIPLD() (datamodel.Node, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	la, err := nb.BeginList(int64(len(c)))
+	if err != nil {
+		return nil, err
+	}
+	for _, conflict := range c {
+		ma, err := la.AssembleValue().BeginMap(4)
+		if err != nil {
+			return nil, err
+		}
+		err = ma.AssembleKey().AssignString("key")
+		if err != nil {
+			return nil, err
+		}
+		err = ma.AssembleValue().AssignString(conflict.Key)
+		if err != nil {
+			return nil, err
+		}
+		values := []struct {
+			name  string
+			value ipld.Link
+		}{
+			{"local", conflict.Local},
+			{"remote", conflict.Remote},
+			{"resolved", conflict.Resolved},
+		}
+		for _, v := range values {
+			err = ma.AssembleKey().AssignString(v.name)
+			if err != nil {
+				return nil, err
+			}
+			if v.value == nil {
+				err = ma.AssembleValue().AssignNull()
+			} else {
+				err = ma.AssembleValue().AssignLink(v.value)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = ma.Finish()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = la.Finish()
+	if err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
+
 type EntriesOptions struct {
 	Size               int64
 	Page               int64
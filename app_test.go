@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/fam/store"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal/ed25519/signer"
+	"github.com/stretchr/testify/require"
+)
+
+func randomDID(t *testing.T) did.DID {
+	t.Helper()
+	id, err := signer.Generate()
+	require.NoError(t, err)
+	return id.DID()
+}
+
+// encodeParams encodes the params of an app method as the frontend does.
+func encodeParams(t *testing.T, fn func(ma datamodel.MapAssembler)) string {
+	t.Helper()
+	n, err := qp.BuildMap(basicnode.Prototype.Any, -1, fn)
+	require.NoError(t, err)
+	buf := bytes.NewBuffer([]byte{})
+	require.NoError(t, dagjson.Encode(n, buf))
+	return buf.String()
+}
+
+// decodeResult decodes the result of an app method as the frontend does.
+func decodeResult(t *testing.T, data NodeBuilder) datamodel.Node {
+	t.Helper()
+	s, err := marshalJSON(data)
+	require.NoError(t, err)
+	nb := basicnode.Prototype.Any.NewBuilder()
+	require.NoError(t, dagjson.Decode(nb, bytes.NewReader([]byte(s))))
+	return nb.Build()
+}
+
+// lookup returns the node at the path of map keys.
+func lookup(t *testing.T, n datamodel.Node, path ...string) datamodel.Node {
+	t.Helper()
+	for _, k := range path {
+		var err error
+		n, err = n.LookupByString(k)
+		require.NoError(t, err)
+	}
+	return n
+}
+
+func TestStatuses(t *testing.T) {
+	head := []ipld.Link{testutil.RandomLink(t)}
+	n := decodeResult(t, Statuses{
+		"origin": {RemoteStatus: bucket.RemoteStatus{Head: head, Ahead: 2, Behind: 3}},
+		"never":  {},
+	})
+
+	ahead, err := lookup(t, n, "origin", "ahead").AsInt()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), ahead)
+	behind, err := lookup(t, n, "origin", "behind").AsInt()
+	require.NoError(t, err)
+	require.Equal(t, int64(3), behind)
+	hn, err := lookup(t, n, "origin", "head").LookupByIndex(0)
+	require.NoError(t, err)
+	l, err := hn.AsLink()
+	require.NoError(t, err)
+	require.Equal(t, head[0], l)
+	require.Equal(t, int64(0), lookup(t, n, "never", "head").Length())
+}
+
+func TestStatusesSyncState(t *testing.T) {
+	last := time.UnixMilli(1700000000000)
+	n := decodeResult(t, Statuses{
+		"origin": {Sync: bucket.SyncState{LastSync: last, LastError: "dial failed"}},
+		"never":  {},
+	})
+
+	ms, err := lookup(t, n, "origin", "lastSync").AsInt()
+	require.NoError(t, err)
+	require.Equal(t, last.UnixMilli(), ms)
+	msg, err := lookup(t, n, "origin", "lastError").AsString()
+	require.NoError(t, err)
+	require.Equal(t, "dial failed", msg)
+
+	// never synced in the background
+	ms, err = lookup(t, n, "never", "lastSync").AsInt()
+	require.NoError(t, err)
+	require.Zero(t, ms)
+}
+
+func TestPullParams(t *testing.T) {
+	id := randomDID(t)
+
+	t.Run("default remote", func(t *testing.T) {
+		params := encodeParams(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "id", qp.Bytes(id.Bytes()))
+		})
+		gotID, remote, err := unmarshalPullParams(params)
+		require.NoError(t, err)
+		require.Equal(t, id, gotID)
+		require.Equal(t, store.DefaultRemoteName, remote)
+	})
+
+	t.Run("named remote", func(t *testing.T) {
+		params := encodeParams(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "id", qp.Bytes(id.Bytes()))
+			qp.MapEntry(ma, "remote", qp.String("backup"))
+		})
+		_, remote, err := unmarshalPullParams(params)
+		require.NoError(t, err)
+		require.Equal(t, "backup", remote)
+	})
+}
+
+func TestMergeResult(t *testing.T) {
+	head := []ipld.Link{testutil.RandomLink(t), testutil.RandomLink(t)}
+	local, remote := testutil.RandomLink(t), testutil.RandomLink(t)
+	n := decodeResult(t, MergeResult{
+		Head:      head,
+		Conflicts: []bucket.Conflict{{Key: "k", Local: local, Remote: remote, Resolved: remote}},
+	})
+
+	require.Equal(t, int64(2), lookup(t, n, "head").Length())
+	cn, err := lookup(t, n, "conflicts").LookupByIndex(0)
+	require.NoError(t, err)
+	k, err := lookup(t, cn, "key").AsString()
+	require.NoError(t, err)
+	require.Equal(t, "k", k)
+	for name, want := range map[string]ipld.Link{"local": local, "remote": remote, "resolved": remote} {
+		l, err := lookup(t, cn, name).AsLink()
+		require.NoError(t, err)
+		require.Equal(t, want, l)
+	}
+
+	// deleted values are null
+	n = decodeResult(t, Conflicts{{Key: "k", Local: local}})
+	cn, err = n.LookupByIndex(0)
+	require.NoError(t, err)
+	require.True(t, lookup(t, cn, "remote").IsNull())
+	require.True(t, lookup(t, cn, "resolved").IsNull())
+}
+
+func TestProgress(t *testing.T) {
+	n := decodeResult(t, Progress{
+		Events:  2,
+		Blocks:  5,
+		Bytes:   1024,
+		Resumed: 1,
+		Pending: 3,
+		Elapsed: 1500 * time.Millisecond,
+		ETA:     2 * time.Second,
+	})
+	for name, want := range map[string]int64{
+		"events":  2,
+		"blocks":  5,
+		"bytes":   1024,
+		"resumed": 1,
+		"pending": 3,
+		"elapsed": 1500,
+		"eta":     2000,
+	} {
+		v, err := lookup(t, n, name).AsInt()
+		require.NoError(t, err)
+		require.Equal(t, want, v, name)
+	}
+	done, err := lookup(t, n, "done").AsBool()
+	require.NoError(t, err)
+	require.False(t, done)
+
+	n = decodeResult(t, Progress{Done: true, Err: errors.New("connection reset")})
+	done, err = lookup(t, n, "done").AsBool()
+	require.NoError(t, err)
+	require.True(t, done)
+	msg, err := lookup(t, n, "error").AsString()
+	require.NoError(t, err)
+	require.Equal(t, "connection reset", msg)
+}
+
+func TestDiffParams(t *testing.T) {
+	id := randomDID(t)
+
+	t.Run("from and to", func(t *testing.T) {
+		from, to := []ipld.Link{testutil.RandomLink(t), testutil.RandomLink(t)}, []ipld.Link{testutil.RandomLink(t)}
+		params := encodeParams(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "id", qp.Bytes(id.Bytes()))
+			qp.MapEntry(ma, "from", qp.List(-1, func(la datamodel.ListAssembler) {
+				for _, l := range from {
+					qp.ListEntry(la, qp.Link(l))
+				}
+			}))
+			qp.MapEntry(ma, "to", qp.List(-1, func(la datamodel.ListAssembler) {
+				for _, l := range to {
+					qp.ListEntry(la, qp.Link(l))
+				}
+			}))
+		})
+		gotID, gotFrom, gotTo, err := unmarshalDiffParams(params)
+		require.NoError(t, err)
+		require.Equal(t, id, gotID)
+		require.Equal(t, from, gotFrom)
+		require.Equal(t, to, gotTo)
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		params := encodeParams(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "id", qp.Bytes(id.Bytes()))
+		})
+		_, from, to, err := unmarshalDiffParams(params)
+		require.NoError(t, err)
+		require.Nil(t, from)
+		require.Nil(t, to)
+	})
+
+	t.Run("not a list", func(t *testing.T) {
+		params := encodeParams(t, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "id", qp.Bytes(id.Bytes()))
+			qp.MapEntry(ma, "to", qp.Link(testutil.RandomLink(t)))
+		})
+		_, _, _, err := unmarshalDiffParams(params)
+		require.Error(t, err)
+	})
+}
+
+func TestChanges(t *testing.T) {
+	v := testutil.RandomLink(t)
+	n := decodeResult(t, Changes{{Type: bucket.ChangeAdded, Key: "k", New: v}})
+	cn, err := n.LookupByIndex(0)
+	require.NoError(t, err)
+	typ, err := lookup(t, cn, "type").AsString()
+	require.NoError(t, err)
+	require.Equal(t, string(bucket.ChangeAdded), typ)
+	k, err := lookup(t, cn, "key").AsString()
+	require.NoError(t, err)
+	require.Equal(t, "k", k)
+	require.True(t, lookup(t, cn, "old").IsNull())
+	l, err := lookup(t, cn, "new").AsLink()
+	require.NoError(t, err)
+	require.Equal(t, v, l)
+}
@@ -14,8 +14,18 @@ type DsBlockstore struct {
 	data datastore.Datastore
 }
 
+// Key is the key a block is stored at in the datastore of a [DsBlockstore].
+func Key(link ipld.Link) datastore.Key {
+	return datastore.NewKey(link.String())
+}
+
+// Datastore is the datastore the blocks are stored in, see [Key].
+func (bs *DsBlockstore) Datastore() datastore.Datastore {
+	return bs.data
+}
+
 func (bs *DsBlockstore) Get(ctx context.Context, link ipld.Link) (block.Block, error) {
-	b, err := bs.data.Get(ctx, datastore.NewKey(link.String()))
+	b, err := bs.data.Get(ctx, Key(link))
 	if err != nil {
 		if errors.Is(err, datastore.ErrNotFound) {
 			return nil, fmt.Errorf("getting block: %s: %w", link, ErrNotFound)
@@ -26,7 +36,7 @@ func (bs *DsBlockstore) Get(ctx context.Context, link ipld.Link) (block.Block, e
 }
 
 func (bs *DsBlockstore) Put(ctx context.Context, block block.Block) error {
-	err := bs.data.Put(ctx, datastore.NewKey(block.Link().String()), block.Bytes())
+	err := bs.data.Put(ctx, Key(block.Link()), block.Bytes())
 	if err != nil {
 		return fmt.Errorf("putting block: %w", err)
 	}
@@ -40,7 +50,7 @@ func (bs *DsBlockstore) PutBatch(ctx context.Context, blocks []block.Block) erro
 			return fmt.Errorf("creating batch: %w", err)
 		}
 		for _, b := range blocks {
-			err := batch.Put(ctx, datastore.NewKey(b.Link().String()), b.Bytes())
+			err := batch.Put(ctx, Key(b.Link()), b.Bytes())
 			if err != nil {
 				return err
 			}
@@ -61,7 +71,7 @@ func (bs *DsBlockstore) PutBatch(ctx context.Context, blocks []block.Block) erro
 }
 
 func (bs *DsBlockstore) Del(ctx context.Context, link ipld.Link) error {
-	err := bs.data.Delete(ctx, datastore.NewKey(link.String()))
+	err := bs.data.Delete(ctx, Key(link))
 	if err != nil {
 		return fmt.Errorf("deleting block: %w", err)
 	}
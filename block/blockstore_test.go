@@ -0,0 +1,57 @@
+package block_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/internal/testutil"
+	pail "github.com/storacha/go-pail"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDsBlockstore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("put, get and delete", func(t *testing.T) {
+		bs := block.NewDsBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+		b := testutil.RandomBlock(t)
+		require.NoError(t, bs.Put(ctx, b))
+		got, err := bs.Get(ctx, b.Link())
+		require.NoError(t, err)
+		require.Equal(t, b.Bytes(), got.Bytes())
+
+		require.NoError(t, bs.Del(ctx, b.Link()))
+		_, err = bs.Get(ctx, b.Link())
+		require.ErrorIs(t, err, block.ErrNotFound)
+	})
+
+	t.Run("missing blocks are not missing keys", func(t *testing.T) {
+		bs := block.NewDsBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+		_, err := bs.Get(ctx, testutil.RandomBlock(t).Link())
+		require.ErrorIs(t, err, block.ErrNotFound)
+		require.NotErrorIs(t, err, pail.ErrNotFound)
+	})
+
+	t.Run("put batch", func(t *testing.T) {
+		bs := block.NewDsBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+		blocks := []block.Block{testutil.RandomBlock(t), testutil.RandomBlock(t), testutil.RandomBlock(t)}
+		require.NoError(t, bs.PutBatch(ctx, blocks))
+		for _, b := range blocks {
+			_, err := bs.Get(ctx, b.Link())
+			require.NoError(t, err)
+		}
+	})
+	t.Run("blocks are stored at their key", func(t *testing.T) {
+		dstore := dssync.MutexWrap(datastore.NewMapDatastore())
+		bs := block.NewDsBlockstore(dstore)
+		require.Equal(t, dstore, bs.Datastore())
+		b := testutil.RandomBlock(t)
+		require.NoError(t, dstore.Put(ctx, block.Key(b.Link()), b.Bytes()))
+		got, err := bs.Get(ctx, b.Link())
+		require.NoError(t, err)
+		require.Equal(t, b.Bytes(), got.Bytes())
+	})
+}
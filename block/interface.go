@@ -4,15 +4,18 @@ import (
 	"context"
 
 	"github.com/ipld/go-ipld-prime"
-	"github.com/storacha/go-pail"
 	"github.com/storacha/go-pail/block"
 )
 
-var ErrNotFound = pail.ErrNotFound
+// ErrNotFound is returned when a block is not available. It is distinct from
+// the error returned for a key that is not in a bucket, so that reading a key
+// whose shards are not available is not mistaken for the key not existing.
+var ErrNotFound = block.ErrNotFound
 
 type Block = block.Block
 type Fetcher = block.Fetcher
 
+var New = block.New
 var NewMapBlockstore = block.NewMapBlockstore
 var NewTieredBlockFetcher = block.NewTieredBlockFetcher
 
@@ -0,0 +1,25 @@
+package block
+
+import (
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+)
+
+// Verify ensures the passed bytes hash to the passed link and returns them as a
+// block.
+func Verify(link ipld.Link, b []byte) (Block, error) {
+	cl, ok := link.(cidlink.Link)
+	if !ok {
+		return nil, fmt.Errorf("unsupported link type: %s", link)
+	}
+	c, err := cl.Cid.Prefix().Sum(b)
+	if err != nil {
+		return nil, fmt.Errorf("hashing block: %w", err)
+	}
+	if !c.Equals(cl.Cid) {
+		return nil, fmt.Errorf("block bytes do not match link: %s", link)
+	}
+	return New(link, b), nil
+}
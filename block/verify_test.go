@@ -0,0 +1,36 @@
+package block_test
+
+import (
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	t.Run("matching bytes", func(t *testing.T) {
+		b := testutil.RandomBlock(t)
+		got, err := block.Verify(b.Link(), b.Bytes())
+		require.NoError(t, err)
+		require.Equal(t, b.Link(), got.Link())
+		require.Equal(t, b.Bytes(), got.Bytes())
+	})
+
+	t.Run("tampered bytes", func(t *testing.T) {
+		b := testutil.RandomBlock(t)
+		_, err := block.Verify(b.Link(), testutil.RandomBlock(t).Bytes())
+		require.Error(t, err)
+	})
+
+	t.Run("unsupported link", func(t *testing.T) {
+		_, err := block.Verify(unsupportedLink{}, testutil.RandomBlock(t).Bytes())
+		require.Error(t, err)
+	})
+}
+
+// unsupportedLink is a link that is not a CID.
+type unsupportedLink struct{ ipld.Link }
+
+func (unsupportedLink) String() string { return "unsupported" }
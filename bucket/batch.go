@@ -0,0 +1,204 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/storacha/fam/block"
+	pail "github.com/storacha/go-pail"
+	pblock "github.com/storacha/go-pail/block"
+	"github.com/storacha/go-pail/clock/event"
+	"github.com/storacha/go-pail/crdt"
+	"github.com/storacha/go-pail/crdt/operation"
+	"github.com/storacha/go-pail/shard"
+)
+
+// TypeBatch is the operation type of batch events. A batch event makes several
+// changes to the bucket at once, so that they are written, synced and
+// announced as a single event.
+const TypeBatch = "batch"
+
+// opsKey is the field of a batch event holding the list of its changes, see
+// [BatchOp]. It is covered by the signature.
+const opsKey = "ops"
+
+// BatchOp is a change made by a batch event: a put of the value for the key,
+// or a delete of the key if the value is nil.
+type BatchOp struct {
+	Key   string
+	Value ipld.Link
+}
+
+// batchOp is the operation of a batch event.
+type batchOp struct {
+	root ipld.Link
+	ops  []BatchOp
+}
+
+func (op batchOp) Root() ipld.Link  { return op.root }
+func (op batchOp) Type() string     { return TypeBatch }
+func (op batchOp) Key() string      { return "" }
+func (op batchOp) Value() ipld.Link { return nil }
+
+// keys returns the keys modified by the event.
+func (e clockEvent) keys() []string {
+	switch e.Data().Type() {
+	case TypeCheckpoint:
+		return nil
+	case TypeBatch:
+		var keys []string
+		for _, op := range e.Ops {
+			keys = append(keys, op.Key)
+		}
+		return keys
+	default:
+		return []string{e.Data().Key()}
+	}
+}
+
+// clockBatch makes the passed changes at the passed head as a single event,
+// see [TypeBatch]. No event is created if none of them changed the pail.
+func clockBatch(ctx context.Context, blocks block.Fetcher, head []ipld.Link, ops []BatchOp) (crdt.Result, error) {
+	return clockWrite(ctx, blocks, head, func(blocks block.Fetcher, root ipld.Link) (ipld.Link, shard.Diff, operation.Operation, error) {
+		root, diff, err := applyOps(ctx, blocks, root, ops)
+		if err != nil {
+			return nil, shard.Diff{}, nil, err
+		}
+		return root, diff, batchOp{root, ops}, nil
+	})
+}
+
+// applyOps applies the changes of a batch to the pail root in order. Deleting
+// a key that is not set is not an error, it may have been deleted by a
+// concurrent event. The returned diff holds the shards created and replaced
+// by the batch as a whole.
+func applyOps(ctx context.Context, blocks block.Fetcher, root ipld.Link, ops []BatchOp) (ipld.Link, shard.Diff, error) {
+	mblocks := block.NewMapBlockstore()
+	blocks = block.NewTieredBlockFetcher(mblocks, blocks)
+	diffs := newDiffSet()
+	for _, op := range ops {
+		var diff shard.Diff
+		var err error
+		if op.Value == nil {
+			var droot ipld.Link
+			droot, diff, err = pail.Del(ctx, blocks, root, op.Key)
+			if err != nil {
+				if !errors.Is(err, ErrNotFound) {
+					return nil, shard.Diff{}, fmt.Errorf("deleting %s from pail: %w", op.Key, err)
+				}
+				continue
+			}
+			root = droot
+		} else {
+			root, diff, err = pail.Put(ctx, blocks, root, op.Key, op.Value)
+			if err != nil {
+				return nil, shard.Diff{}, fmt.Errorf("putting %s to pail: %w", op.Key, err)
+			}
+		}
+		for _, a := range diff.Additions {
+			_ = mblocks.Put(ctx, a)
+		}
+		diffs.add(diff)
+	}
+	return root, diffs.diff(), nil
+}
+
+// withOps adds the changes of a batch to its event block, see [opsKey].
+func withOps(evt pblock.BlockView[event.Event[operation.Operation]], ops []BatchOp) (pblock.BlockView[event.Event[operation.Operation]], error) {
+	nd, err := decodeEvent(evt)
+	if err != nil {
+		return nil, err
+	}
+	on, err := encodeOps(ops)
+	if err != nil {
+		return nil, err
+	}
+	b, err := encodeEvent(nd, map[string]datamodel.Node{opsKey: on})
+	if err != nil {
+		return nil, err
+	}
+	return pblock.NewBlockView(b.Link(), b.Bytes(), evt.Value()), nil
+}
+
+// encodeOps encodes the changes of a batch as a list of maps, with the value
+// omitted for a delete, like the operation of a "del" event.
+func encodeOps(ops []BatchOp) (datamodel.Node, error) {
+	nb := basicnode.Prototype.List.NewBuilder()
+	la, err := nb.BeginList(int64(len(ops)))
+	if err != nil {
+		return nil, fmt.Errorf("beginning ops list: %w", err)
+	}
+	for _, op := range ops {
+		size := int64(1)
+		if op.Value != nil {
+			size = 2
+		}
+		ma, err := la.AssembleValue().BeginMap(size)
+		if err != nil {
+			return nil, fmt.Errorf("beginning op map: %w", err)
+		}
+		err = ma.AssembleKey().AssignString("key")
+		if err != nil {
+			return nil, fmt.Errorf("assembling op key: %w", err)
+		}
+		err = ma.AssembleValue().AssignString(op.Key)
+		if err != nil {
+			return nil, fmt.Errorf("assembling op key: %w", err)
+		}
+		if op.Value != nil {
+			err = ma.AssembleKey().AssignString("value")
+			if err != nil {
+				return nil, fmt.Errorf("assembling op value: %w", err)
+			}
+			err = ma.AssembleValue().AssignLink(op.Value)
+			if err != nil {
+				return nil, fmt.Errorf("assembling op value: %w", err)
+			}
+		}
+		err = ma.Finish()
+		if err != nil {
+			return nil, fmt.Errorf("finishing op map: %w", err)
+		}
+	}
+	err = la.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("finishing ops list: %w", err)
+	}
+	return nb.Build(), nil
+}
+
+// decodeOps decodes the changes of a batch event, see [encodeOps].
+func decodeOps(nd datamodel.Node) ([]BatchOp, error) {
+	var ops []BatchOp
+	it := nd.ListIterator()
+	if it == nil {
+		return nil, errors.New("ops is not a list")
+	}
+	for !it.Done() {
+		_, on, err := it.Next()
+		if err != nil {
+			return nil, fmt.Errorf("iterating ops: %w", err)
+		}
+		kn, err := on.LookupByString("key")
+		if err != nil {
+			return nil, fmt.Errorf("looking up op key: %w", err)
+		}
+		k, err := kn.AsString()
+		if err != nil {
+			return nil, fmt.Errorf("decoding op key: %w", err)
+		}
+		op := BatchOp{Key: k}
+		if vn, err := on.LookupByString("value"); err == nil {
+			op.Value, err = vn.AsLink()
+			if err != nil {
+				return nil, fmt.Errorf("decoding op value: %w", err)
+			}
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
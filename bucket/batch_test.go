@@ -0,0 +1,110 @@
+package bucket
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("writes a single event", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		prev := putHeads(t, bk, "k", 3)
+		a, b := testutil.RandomLink(t), testutil.RandomLink(t)
+		require.NoError(t, bk.Batch(ctx, []BatchOp{
+			{Key: "k0"},
+			{Key: "k1", Value: a},
+			{Key: "new", Value: b},
+		}))
+
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		require.Len(t, head, 1)
+		evt, err := getClockEvent(ctx, bk.Blocks(), head[0])
+		require.NoError(t, err)
+		require.Equal(t, TypeBatch, evt.Data().Type())
+		require.Equal(t, prev[2:], evt.Parents())
+		require.Equal(t, []string{"k0", "k1", "new"}, evt.keys())
+
+		entries := collectEntries(t, bk)
+		require.Len(t, entries, 3)
+		require.NotContains(t, entries, "k0")
+		require.Equal(t, a, entries["k1"])
+		require.Equal(t, b, entries["new"])
+	})
+
+	t.Run("no event without changes", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "k", 1)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		require.NoError(t, bk.Batch(ctx, []BatchOp{{Key: "missing"}}))
+		hd, err := bk.Head(ctx)
+		require.NoError(t, err)
+		require.Equal(t, head, hd)
+	})
+
+	t.Run("on an empty bucket", func(t *testing.T) {
+		bk := newTestBucket(t)
+		v := testutil.RandomLink(t)
+		require.NoError(t, bk.Batch(ctx, []BatchOp{{Key: "a", Value: v}, {Key: "b", Value: v}}))
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		evt, err := getClockEvent(ctx, bk.Blocks(), head[0])
+		require.NoError(t, err)
+		require.Empty(t, evt.Parents())
+		require.Len(t, collectEntries(t, bk), 2)
+	})
+
+	t.Run("replays concurrent batches", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "shared", 3)
+		branch, err := bk.Fork(ctx, "other")
+		require.NoError(t, err)
+		a, b := testutil.RandomLink(t), testutil.RandomLink(t)
+		require.NoError(t, bk.Batch(ctx, []BatchOp{{Key: "a", Value: a}, {Key: "shared0"}}))
+		require.NoError(t, branch.(Batcher).Batch(ctx, []BatchOp{{Key: "b", Value: b}, {Key: "shared0"}}))
+		_, err = MergeBranch(ctx, bk, "other")
+		require.NoError(t, err)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		require.Len(t, head, 2)
+
+		root, _, err := clockRoot(ctx, bk.Blocks(), head)
+		require.NoError(t, err)
+		reversed, _, err := clockRoot(ctx, bk.Blocks(), []ipld.Link{head[1], head[0]})
+		require.NoError(t, err)
+		require.Equal(t, root, reversed)
+		entries := collectEntries(t, bk)
+		require.Equal(t, map[string]ipld.Link{
+			"a":       a,
+			"b":       b,
+			"shared1": entries["shared1"],
+			"shared2": entries["shared2"],
+		}, entries)
+	})
+
+	t.Run("ops are signed and synced", func(t *testing.T) {
+		bk, replica := newSignedBucket(t), newTestBucket(t, WithHistory())
+		putN(t, bk, "k", 2)
+		require.NoError(t, bk.Batch(ctx, []BatchOp{{Key: "k0"}, {Key: "k1", Value: testutil.RandomLink(t)}}))
+		syncTo(t, bk, replica)
+		require.Equal(t, collectEntries(t, bk), collectEntries(t, replica))
+
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		for evt, err := range History(ctx, bk.Blocks(), head, WithAuthors(verifyIssuer)) {
+			require.NoError(t, err)
+			require.NoError(t, evt.AuthorErr)
+			require.Equal(t, TypeBatch, evt.Type)
+			require.Len(t, evt.Changes(), 2)
+			require.Nil(t, evt.Changes()[0].Value)
+			break
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/bucket/head"
+)
+
+// MainBranch is the name of the branch of a bucket that is synced with its
+// remotes. Other branches are local, see [Brancher].
+const MainBranch = "main"
+
+// branchesKey is the prefix of the keys the heads of branches are stored at,
+// next to [headKey].
+var branchesKey = datastore.NewKey("branches")
+
+// branchHeadKey is the key the head of the named branch is stored at.
+func branchHeadKey(name string) (datastore.Key, error) {
+	if name == MainBranch {
+		return headKey, nil
+	}
+	if name == "" || datastore.NewKey(name).String() != "/"+name {
+		return datastore.Key{}, fmt.Errorf("invalid branch name: %q", name)
+	}
+	return branchesKey.ChildString(name).ChildString("head"), nil
+}
+
+// Fork creates the named branch at the current head of the bucket, and returns
+// the bucket on the new branch.
+func (bucket *DsClockBucket) Fork(ctx context.Context, name string) (ClockBucket[ipld.Link], error) {
+	bucket.mutex.RLock()
+	defer bucket.mutex.RUnlock()
+
+	key, err := branchHeadKey(name)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := bucket.data.Has(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("getting branch head: %w", err)
+	}
+	if ok {
+		return nil, fmt.Errorf("branch already exists: %s", name)
+	}
+	hbytes, err := head.Marshal(bucket.head)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling head: %w", err)
+	}
+	err = bucket.data.Put(ctx, key, hbytes)
+	if err != nil {
+		return nil, fmt.Errorf("putting branch head: %w", err)
+	}
+	return bucket.open(key, name)
+}
+
+// Branch returns the bucket on the named branch, which shares its blockstore
+// with this bucket.
+func (bucket *DsClockBucket) Branch(ctx context.Context, name string) (ClockBucket[ipld.Link], error) {
+	key, err := branchHeadKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if name != MainBranch {
+		ok, err := bucket.data.Has(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("getting branch head: %w", err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("getting branch: %s: %w", name, ErrNotFound)
+		}
+	}
+	return bucket.open(key, name)
+}
+
+func (bucket *DsClockBucket) open(key datastore.Key, name string) (*DsClockBucket, error) {
+	return NewDsClockBucket(bucket.blocks, bucket.data, WithEventSigner(bucket.sign), func(b *DsClockBucket) {
+		b.headKey = key
+		b.branch = name
+		b.history = bucket.history
+	})
+}
+
+// Branches iterates the heads of the branches forked from the bucket, in name
+// order. The main branch is not included.
+func (bucket *DsClockBucket) Branches(ctx context.Context) iter.Seq2[Entry[[]ipld.Link], error] {
+	return func(yield func(Entry[[]ipld.Link], error) bool) {
+		results, err := bucket.data.Query(ctx, query.Query{
+			Prefix: branchesKey.String(),
+			Orders: []query.Order{query.OrderByKey{}},
+		})
+		if err != nil {
+			yield(Entry[[]ipld.Link]{}, fmt.Errorf("querying branches: %w", err))
+			return
+		}
+		defer results.Close()
+		for r := range results.Next() {
+			if r.Error != nil {
+				yield(Entry[[]ipld.Link]{}, fmt.Errorf("iterating branches: %w", r.Error))
+				return
+			}
+			name := strings.TrimPrefix(r.Key, branchesKey.String()+"/")
+			name = strings.TrimSuffix(name, "/head")
+			hd, err := head.Unmarshal(r.Value)
+			if err != nil {
+				yield(Entry[[]ipld.Link]{}, fmt.Errorf("unmarshalling branch head: %s: %w", name, err))
+				return
+			}
+			if !yield(Entry[[]ipld.Link]{name, hd}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// DeleteBranch deletes the named branch. Its events are no longer kept when the
+// bucket is pruned, unless they were merged.
+func (bucket *DsClockBucket) DeleteBranch(ctx context.Context, name string) error {
+	if name == MainBranch {
+		return errors.New("cannot delete the main branch")
+	}
+	if name == bucket.branch {
+		return fmt.Errorf("cannot delete the branch of the bucket: %s", name)
+	}
+	key, err := branchHeadKey(name)
+	if err != nil {
+		return err
+	}
+	ok, err := bucket.data.Has(ctx, key)
+	if err != nil {
+		return fmt.Errorf("getting branch head: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("deleting branch: %s: %w", name, ErrNotFound)
+	}
+	err = bucket.data.Delete(ctx, key)
+	if err != nil {
+		return fmt.Errorf("deleting branch head: %w", err)
+	}
+	return nil
+}
+
+// branchHeads returns the heads of every branch of the bucket, including the
+// main branch, as stored.
+func (bucket *DsClockBucket) branchHeads(ctx context.Context) ([][]ipld.Link, error) {
+	var heads [][]ipld.Link
+	b, err := bucket.data.Get(ctx, headKey)
+	if err == nil {
+		hd, err := head.Unmarshal(b)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling head: %w", err)
+		}
+		heads = append(heads, hd)
+	} else if !errors.Is(err, datastore.ErrNotFound) {
+		return nil, fmt.Errorf("getting head: %w", err)
+	}
+	for e, err := range bucket.Branches(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		heads = append(heads, e.Value)
+	}
+	return heads, nil
+}
+
+// MergeBranch advances the merkle clock of the replica with the head of the
+// named branch, see [Brancher]. It returns the new head and the keys modified
+// differently on both branches since they forked.
+func MergeBranch(ctx context.Context, replica Replica, name string) (MergeResult, error) {
+	br, ok := replica.(Brancher)
+	if !ok {
+		return MergeResult{}, errors.New("bucket is not a brancher")
+	}
+	bk, err := br.Branch(ctx, name)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	bhead, err := bk.Head(ctx)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("getting branch head: %w", err)
+	}
+	return Merge(ctx, replica, bhead, nil)
+}
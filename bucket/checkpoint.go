@@ -0,0 +1,674 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/storacha/fam/block"
+	pail "github.com/storacha/go-pail"
+	"github.com/storacha/go-pail/clock/event"
+	"github.com/storacha/go-pail/crdt/operation"
+	"github.com/storacha/go-pail/shard"
+)
+
+// TypeCheckpoint is the operation type of checkpoint events. A checkpoint
+// event snapshots the pail root at its parents, and lists every event in its
+// past that is kept, so that the events in its past are not needed to
+// determine the root of the clock, and may be pruned.
+const TypeCheckpoint = "checkpoint"
+
+// pastKey is the field of a checkpoint event holding the root of a pail whose
+// keys are the CIDs of the events in its past. It is covered by the signature.
+const pastKey = "past"
+
+// sinceKey is the field of a checkpoint event created after the events in the
+// past of its base checkpoint were pruned. The pruned events are not listed in
+// its past again, it links to the base checkpoint instead, whose past lists
+// them for as long as it is kept. It is covered by the signature.
+const sinceKey = "since"
+
+// checkpointOp is the operation of a checkpoint event.
+type checkpointOp struct {
+	root ipld.Link
+}
+
+func (op checkpointOp) Root() ipld.Link  { return op.root }
+func (op checkpointOp) Type() string     { return TypeCheckpoint }
+func (op checkpointOp) Key() string      { return "" }
+func (op checkpointOp) Value() ipld.Link { return nil }
+
+// clockEvent is a decoded merkle clock event.
+type clockEvent struct {
+	event.Event[operation.Operation]
+	// Past is the root of the pail listing the events in the past of a
+	// checkpoint event, nil for other events.
+	Past ipld.Link
+	// Since is the checkpoint whose past continues the past of a checkpoint
+	// event, nil if its past lists every event kept before it.
+	Since ipld.Link
+	// Ops are the changes made by a batch event, see [TypeBatch], nil for
+	// other events.
+	Ops []BatchOp
+}
+
+// roots returns the roots of the pails the event refers to.
+func (e clockEvent) roots() []ipld.Link {
+	if e.Past != nil {
+		return []ipld.Link{e.Data().Root(), e.Past}
+	}
+	return []ipld.Link{e.Data().Root()}
+}
+
+func decodeClockEvent(b block.Block) (clockEvent, error) {
+	evt, err := event.Unmarshal(b.Bytes(), operationBinder)
+	if err != nil {
+		return clockEvent{}, fmt.Errorf("decoding event: %s: %w", b.Link(), err)
+	}
+	if evt.Data().Type() != TypeCheckpoint && evt.Data().Type() != TypeBatch {
+		return clockEvent{Event: evt}, nil
+	}
+	nd, err := decodeEvent(b)
+	if err != nil {
+		return clockEvent{}, err
+	}
+	if evt.Data().Type() == TypeBatch {
+		on, err := nd.LookupByString(opsKey)
+		if err != nil {
+			return clockEvent{}, fmt.Errorf("looking up batch ops: %s: %w", b.Link(), err)
+		}
+		ops, err := decodeOps(on)
+		if err != nil {
+			return clockEvent{}, fmt.Errorf("decoding batch ops: %s: %w", b.Link(), err)
+		}
+		return clockEvent{Event: evt, Ops: ops}, nil
+	}
+	pn, err := nd.LookupByString(pastKey)
+	if err != nil {
+		return clockEvent{}, fmt.Errorf("looking up checkpoint past: %s: %w", b.Link(), err)
+	}
+	past, err := pn.AsLink()
+	if err != nil {
+		return clockEvent{}, fmt.Errorf("decoding checkpoint past: %s: %w", b.Link(), err)
+	}
+	var since ipld.Link
+	if sn, err := nd.LookupByString(sinceKey); err == nil {
+		since, err = sn.AsLink()
+		if err != nil {
+			return clockEvent{}, fmt.Errorf("decoding checkpoint since: %s: %w", b.Link(), err)
+		}
+	}
+	return clockEvent{Event: evt, Past: past, Since: since}, nil
+}
+
+// getClockEvent gets and decodes a merkle clock event. The error wraps
+// [block.ErrNotFound] if the event is not available.
+func getClockEvent(ctx context.Context, blocks block.Fetcher, l ipld.Link) (clockEvent, error) {
+	b, err := blocks.Get(ctx, l)
+	if err != nil {
+		return clockEvent{}, fmt.Errorf("getting event: %s: %w", l, err)
+	}
+	return decodeClockEvent(b)
+}
+
+// checkpoints maps the links of the checkpoint events found when traversing a
+// merkle clock to the events.
+type checkpoints map[ipld.Link]clockEvent
+
+// covers reports whether the event is in the past of one of the checkpoints.
+func (cps checkpoints) covers(ctx context.Context, blocks block.Fetcher, l ipld.Link) (bool, error) {
+	for _, evt := range cps {
+		for past, err := range pastOfCheckpoint(ctx, blocks, evt) {
+			if err != nil {
+				return false, err
+			}
+			_, err := pail.Get(ctx, blocks, past, l.String())
+			if err == nil {
+				return true, nil
+			}
+			if !errors.Is(err, ErrNotFound) {
+				return false, fmt.Errorf("looking up event in checkpoint past: %w", err)
+			}
+		}
+	}
+	return false, nil
+}
+
+// pastOfCheckpoint iterates the roots of the pails listing the past of a
+// checkpoint event: its own, and those of the checkpoints it continues that are
+// still kept, see [clockEvent.Since].
+func pastOfCheckpoint(ctx context.Context, blocks block.Fetcher, evt clockEvent) iter.Seq2[ipld.Link, error] {
+	return func(yield func(ipld.Link, error) bool) {
+		for {
+			if !yield(evt.Past, nil) || evt.Since == nil {
+				return
+			}
+			var err error
+			evt, err = getClockEvent(ctx, blocks, evt.Since)
+			if err != nil {
+				// pruned with the events in its past
+				if !errors.Is(err, block.ErrNotFound) {
+					yield(nil, err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// base returns the checkpoint the root of a head is determined from: of the
+// checkpoints not in the past of another, the one with the lowest CID. The
+// other checkpoints not in the past of another are concurrent with it, and the
+// events in their past that are not in the past of the base are replayed on its
+// root. The base is nil if there are no checkpoints.
+func (cps checkpoints) base(ctx context.Context, blocks block.Fetcher) (ipld.Link, []ipld.Link, error) {
+	var latest []ipld.Link
+	for l := range cps {
+		others := maps.Clone(cps)
+		delete(others, l)
+		ok, err := others.covers(ctx, blocks, l)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			latest = append(latest, l)
+		}
+	}
+	if len(latest) == 0 {
+		return nil, nil, nil
+	}
+	slices.SortFunc(latest, compareLinks)
+	return latest[0], latest[1:], nil
+}
+
+// only returns the checkpoints restricted to the passed checkpoint.
+func (cps checkpoints) only(l ipld.Link) checkpoints {
+	return checkpoints{l: cps[l]}
+}
+
+// compareLinks orders links by their string form, which is how concurrent
+// events are ordered when replayed.
+func compareLinks(a, b ipld.Link) int {
+	return strings.Compare(a.String(), b.String())
+}
+
+// findCheckpoints finds the latest checkpoints of a merkle clock, walking back
+// from the head until a checkpoint is found on every path. Events that are not
+// available are skipped.
+func findCheckpoints(ctx context.Context, blocks block.Fetcher, head []ipld.Link) (checkpoints, error) {
+	cps := checkpoints{}
+	err := walk(head, func(l ipld.Link) ([]ipld.Link, error) {
+		ok, err := cps.covers(ctx, blocks, l)
+		if err != nil || ok {
+			return nil, err
+		}
+		evt, err := getClockEvent(ctx, blocks, l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if evt.Past != nil {
+			cps[l] = evt
+			return nil, nil
+		}
+		return evt.Parents(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cps, nil
+}
+
+// clockWalk decides which events to follow when traversing a merkle clock to
+// transfer or verify it. The parents of checkpoint events are not followed,
+// nor are events in the past of the checkpoints found, since they are not
+// needed to determine the root of the clock. If the clock has concurrent
+// checkpoints, the events in the past of those that are not in the past of
+// the base checkpoint are needed, and are traversed in a second pass, see
+// [clockWalk.behind].
+type clockWalk struct {
+	blocks block.Fetcher
+	found  checkpoints
+	// base is the base checkpoint in the second pass
+	base ipld.Link
+	// unavailable are the events not available in the first pass
+	unavailable []ipld.Link
+}
+
+func newClockWalk(blocks block.Fetcher, found checkpoints) *clockWalk {
+	if found == nil {
+		found = checkpoints{}
+	}
+	return &clockWalk{blocks: blocks, found: found}
+}
+
+// next returns the parents of the event to follow.
+func (w *clockWalk) next(ctx context.Context, l ipld.Link, evt clockEvent) ([]ipld.Link, error) {
+	if w.base == nil && evt.Past != nil {
+		w.found[l] = evt
+		return nil, nil
+	}
+	if l == w.base {
+		return nil, nil
+	}
+	return w.filter(ctx, evt.Parents())
+}
+
+// filter returns the links that are not in the past of a checkpoint found, or
+// of the base checkpoint in the second pass.
+func (w *clockWalk) filter(ctx context.Context, links []ipld.Link) ([]ipld.Link, error) {
+	cps := w.found
+	if w.base != nil {
+		cps = w.found.only(w.base)
+	}
+	var follow []ipld.Link
+	for _, l := range links {
+		ok, err := cps.covers(ctx, w.blocks, l)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			follow = append(follow, l)
+		}
+	}
+	return follow, nil
+}
+
+// behind starts the second pass, returning the links to traverse: the parents
+// of the checkpoints concurrent with the base checkpoint that are not in the
+// past of the base. It returns nothing if there are no concurrent checkpoints.
+func (w *clockWalk) behind(ctx context.Context) ([]ipld.Link, error) {
+	base, others, err := w.found.base(ctx, w.blocks)
+	if err != nil || len(others) == 0 {
+		return nil, err
+	}
+	w.base = base
+	var links []ipld.Link
+	for _, l := range others {
+		evt, err := getClockEvent(ctx, w.blocks, l)
+		if err != nil {
+			return nil, err
+		}
+		ls, err := w.filter(ctx, evt.Parents())
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, ls...)
+	}
+	return links, nil
+}
+
+// missing records an event that is not available. In the first pass it may be
+// in the past of a checkpoint found later, see [clockWalk.check], but in the
+// second pass it is needed.
+func (w *clockWalk) missing(l ipld.Link) error {
+	if w.base != nil {
+		return fmt.Errorf("missing event: %s", l)
+	}
+	w.unavailable = append(w.unavailable, l)
+	return nil
+}
+
+// check returns an error for the first event that was not available in the
+// first pass and is not in the past of a checkpoint found, since an event in
+// the past of a checkpoint may have been pruned.
+func (w *clockWalk) check(ctx context.Context) error {
+	for _, l := range w.unavailable {
+		ok, err := w.found.covers(ctx, w.blocks, l)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("missing event: %s", l)
+		}
+	}
+	return nil
+}
+
+// newCheckpoint creates a checkpoint event for the passed head, whose pail root
+// is root. It returns the event and the blocks of the pail listing its past
+// that are not available from blocks.
+func newCheckpoint(ctx context.Context, blocks block.Fetcher, head []ipld.Link, root ipld.Link) (block.Block, []block.Block, error) {
+	past, since, additions, err := pastOf(ctx, blocks, head)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing past events: %w", err)
+	}
+	evt, err := event.MarshalBlock(event.NewEvent[operation.Operation](checkpointOp{root}, head), operationUnbinder)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshalling checkpoint event: %w", err)
+	}
+	nd, err := decodeEvent(evt)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := map[string]datamodel.Node{pastKey: basicnode.NewLink(past)}
+	if since != nil {
+		fields[sinceKey] = basicnode.NewLink(since)
+	}
+	b, err := encodeEvent(nd, fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, additions, nil
+}
+
+// pastOf builds the pail listing the events reachable from the head. It is
+// built on the past of the base checkpoint, so only the events since are added,
+// unless the events in the past of the base were pruned. The pruned events are
+// then not listed again, so the past does not grow with the whole history of
+// the clock, and the returned since is the checkpoint the past continues, see
+// [clockEvent.Since].
+func pastOf(ctx context.Context, blocks block.Fetcher, head []ipld.Link) (ipld.Link, ipld.Link, []block.Block, error) {
+	cps, err := findCheckpoints(ctx, blocks, head)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	base, _, err := cps.base(ctx, blocks)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	mblocks := block.NewMapBlockstore()
+	blocks = block.NewTieredBlockFetcher(mblocks, blocks)
+	additions := map[ipld.Link]block.Block{}
+	removals := map[ipld.Link]struct{}{}
+	var root, since ipld.Link
+	if base != nil {
+		pruned, err := prunedBefore(ctx, blocks, cps[base])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if pruned {
+			since = base
+		} else {
+			root, since = cps[base].Past, cps[base].Since
+		}
+	}
+	if root == nil {
+		empty, err := pail.New()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("creating pail: %w", err)
+		}
+		_ = mblocks.Put(ctx, empty)
+		additions[empty.Link()] = empty
+		root = empty.Link()
+	}
+	add := func(l ipld.Link) error {
+		var diff shard.Diff
+		var err error
+		root, diff, err = pail.Put(ctx, blocks, root, l.String(), l)
+		if err != nil {
+			return fmt.Errorf("putting past event: %w", err)
+		}
+		for _, a := range diff.Additions {
+			_ = mblocks.Put(ctx, a)
+			additions[a.Link()] = a
+		}
+		for _, r := range diff.Removals {
+			removals[r.Link()] = struct{}{}
+		}
+		return nil
+	}
+
+	bcps := cps.only(base)
+	err = walk(head, func(l ipld.Link) ([]ipld.Link, error) {
+		if base != nil {
+			ok, err := bcps.covers(ctx, blocks, l)
+			if err != nil || ok {
+				return nil, err
+			}
+		}
+		err := add(l)
+		if err != nil {
+			return nil, err
+		}
+		if l == base {
+			return nil, nil
+		}
+		evt, err := getClockEvent(ctx, blocks, l)
+		if err != nil {
+			return nil, err
+		}
+		if evt.Past == nil {
+			return evt.Parents(), nil
+		}
+		// a checkpoint concurrent with the base lists the rest of its past
+		for past, err := range pastOfCheckpoint(ctx, blocks, evt) {
+			if err != nil {
+				return nil, err
+			}
+			for e, err := range pail.Entries(ctx, blocks, past) {
+				if err != nil {
+					return nil, fmt.Errorf("listing checkpoint past: %w", err)
+				}
+				if base != nil {
+					ok, err := bcps.covers(ctx, blocks, e.Value)
+					if err != nil {
+						return nil, err
+					}
+					if ok {
+						continue
+					}
+				}
+				err = add(e.Value)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var bs []block.Block
+	for l, b := range additions {
+		if _, ok := removals[l]; !ok {
+			bs = append(bs, b)
+		}
+	}
+	return root, since, bs, nil
+}
+
+// prunedBefore reports whether the events in the past of the checkpoint were
+// pruned, which removes its parents.
+func prunedBefore(ctx context.Context, blocks block.Fetcher, cp clockEvent) (bool, error) {
+	for _, p := range cp.Parents() {
+		_, err := blocks.Get(ctx, p)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				return true, nil
+			}
+			return false, fmt.Errorf("getting checkpoint parent: %w", err)
+		}
+	}
+	return false, nil
+}
+
+// RetentionPolicy decides which events a bucket keeps when its merkle clock is
+// pruned, see [Checkpointer].
+type RetentionPolicy struct {
+	// MinAge is how old a checkpoint must be before the events in its past are
+	// pruned. A replica that has not synced since before the checkpoint may need
+	// them to merge changes made concurrently with it, so it should be longer
+	// than the time between syncs of every replica.
+	MinAge time.Duration
+}
+
+// PruneResult describes what was removed by pruning a merkle clock.
+type PruneResult struct {
+	// Checkpoint is the checkpoint the events in the past of were pruned, nil if
+	// nothing was pruned.
+	Checkpoint ipld.Link
+	// Events is the number of events removed.
+	Events int
+	// Shards is the number of pail shards removed.
+	Shards int
+}
+
+// retentionCheckpoint finds the latest checkpoint in the history of head that
+// is older than the policy allows. Checkpoints without a time are old enough
+// only if the policy has no minimum age. It returns nil if there is no such
+// checkpoint, or if concurrent checkpoints were found before it, since pruning
+// behind one of them could remove events needed to merge them.
+func retentionCheckpoint(ctx context.Context, blocks block.Fetcher, head []ipld.Link, policy RetentionPolicy) (ipld.Link, error) {
+	before := time.Now().Add(-policy.MinAge)
+	links := head
+	for len(links) > 0 {
+		cps, err := findCheckpoints(ctx, blocks, links)
+		if err != nil {
+			return nil, err
+		}
+		base, others, err := cps.base(ctx, blocks)
+		if err != nil || base == nil || len(others) > 0 {
+			return nil, err
+		}
+		b, err := blocks.Get(ctx, base)
+		if err != nil {
+			return nil, fmt.Errorf("getting checkpoint: %w", err)
+		}
+		t, err := EventTime(b)
+		if err != nil {
+			return nil, err
+		}
+		if policy.MinAge == 0 || (!t.IsZero() && !t.After(before)) {
+			return base, nil
+		}
+		evt, err := decodeClockEvent(b)
+		if err != nil {
+			return nil, err
+		}
+		links = evt.Parents()
+	}
+	return nil, nil
+}
+
+// prune deletes from the blockstore the events in the past of the passed
+// checkpoint, and the shards referred to only by them. The events of the passed
+// tags, and the shards they and the tags refer to, are kept.
+func prune(ctx context.Context, blocks block.Blockstore, head []ipld.Link, checkpoint ipld.Link, tags []Tag) (PruneResult, error) {
+	cevt, err := getClockEvent(ctx, blocks, checkpoint)
+	if err != nil {
+		return PruneResult{}, err
+	}
+	cps := checkpoints{checkpoint: cevt}
+
+	// the shards referred to by the events that are kept
+	var roots []ipld.Link
+	err = walk(head, func(l ipld.Link) ([]ipld.Link, error) {
+		ok, err := cps.covers(ctx, blocks, l)
+		if err != nil || ok {
+			return nil, err
+		}
+		evt, err := getClockEvent(ctx, blocks, l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		roots = append(roots, evt.roots()...)
+		if l == checkpoint {
+			return nil, nil
+		}
+		return evt.Parents(), nil
+	})
+	if err != nil {
+		return PruneResult{}, fmt.Errorf("finding kept events: %w", err)
+	}
+	tagged, troots := tagRoots(tags)
+	roots = append(roots, troots...)
+	for _, l := range tagged {
+		evt, err := getClockEvent(ctx, blocks, l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				continue
+			}
+			return PruneResult{}, err
+		}
+		roots = append(roots, evt.roots()...)
+	}
+	kept := map[ipld.Link]struct{}{}
+	err = walk(roots, func(l ipld.Link) ([]ipld.Link, error) {
+		kept[l] = struct{}{}
+		b, err := blocks.Get(ctx, l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("getting shard: %w", err)
+		}
+		return shardLinks(b)
+	})
+	if err != nil {
+		return PruneResult{}, fmt.Errorf("finding kept shards: %w", err)
+	}
+
+	var events []ipld.Link
+	seen := map[ipld.Link]struct{}{}
+	var pasts []ipld.Link
+	for past, err := range pastOfCheckpoint(ctx, blocks, cevt) {
+		if err != nil {
+			return PruneResult{}, err
+		}
+		pasts = append(pasts, past)
+	}
+	roots = nil
+	for _, past := range pasts {
+		for e, err := range pail.Entries(ctx, blocks, past) {
+			if err != nil {
+				return PruneResult{}, fmt.Errorf("listing checkpoint past: %w", err)
+			}
+			if _, ok := seen[e.Value]; ok || slices.Contains(tagged, e.Value) {
+				continue
+			}
+			seen[e.Value] = struct{}{}
+			evt, err := getClockEvent(ctx, blocks, e.Value)
+			if err != nil {
+				if errors.Is(err, block.ErrNotFound) {
+					continue
+				}
+				return PruneResult{}, err
+			}
+			events = append(events, e.Value)
+			roots = append(roots, evt.roots()...)
+		}
+	}
+	var shards []ipld.Link
+	err = walk(roots, func(l ipld.Link) ([]ipld.Link, error) {
+		if _, ok := kept[l]; ok {
+			return nil, nil
+		}
+		b, err := blocks.Get(ctx, l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("getting shard: %w", err)
+		}
+		shards = append(shards, l)
+		return shardLinks(b)
+	})
+	if err != nil {
+		return PruneResult{}, fmt.Errorf("finding pruned shards: %w", err)
+	}
+
+	for _, l := range slices.Concat(events, shards) {
+		err := blocks.Del(ctx, l)
+		if err != nil {
+			return PruneResult{}, fmt.Errorf("deleting block: %s: %w", l, err)
+		}
+	}
+	return PruneResult{Checkpoint: checkpoint, Events: len(events), Shards: len(shards)}, nil
+}
@@ -0,0 +1,138 @@
+package bucket
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	pail "github.com/storacha/go-pail"
+	"github.com/stretchr/testify/require"
+)
+
+// syncTo advances the replica with the events and shards of the bucket it does
+// not have.
+func syncTo(t *testing.T, bk, replica *DsClockBucket) {
+	t.Helper()
+	since, err := replica.Head(context.Background())
+	require.NoError(t, err)
+	events, blocks := received(t, bk, since)
+	_, err = replica.AdvanceMany(context.Background(), events, blocks)
+	require.NoError(t, err)
+}
+
+// collectEntries returns the entries of the bucket.
+func collectEntries(t *testing.T, bk Bucket[ipld.Link]) map[string]ipld.Link {
+	t.Helper()
+	entries := map[string]ipld.Link{}
+	for e, err := range bk.Entries(context.Background()) {
+		require.NoError(t, err)
+		entries[e.Key] = e.Value
+	}
+	return entries
+}
+
+// pastLen counts the events listed in the past of a checkpoint event.
+func pastLen(t *testing.T, bk *DsClockBucket, l ipld.Link) int {
+	t.Helper()
+	evt, err := getClockEvent(context.Background(), bk.Blocks(), l)
+	require.NoError(t, err)
+	n := 0
+	for _, err := range pail.Entries(context.Background(), bk.Blocks(), evt.Past) {
+		require.NoError(t, err)
+		n++
+	}
+	return n
+}
+
+func TestCheckpoint(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sync across a checkpoint", func(t *testing.T) {
+		writer, replica := newTestBucket(t, WithHistory()), newTestBucket(t, WithHistory())
+		putN(t, writer, "shared", 5)
+		syncTo(t, writer, replica)
+
+		_, err := writer.Checkpoint(ctx)
+		require.NoError(t, err)
+		putN(t, writer, "w", 3)
+		putN(t, replica, "r", 3)
+		syncTo(t, writer, replica)
+		syncTo(t, replica, writer)
+
+		whead, err := writer.Head(ctx)
+		require.NoError(t, err)
+		rhead, err := replica.Head(ctx)
+		require.NoError(t, err)
+		require.ElementsMatch(t, whead, rhead)
+		entries := collectEntries(t, writer)
+		require.Len(t, entries, 11)
+		require.Equal(t, entries, collectEntries(t, replica))
+	})
+
+	t.Run("pruning", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		old := putHeads(t, bk, "old", 10)
+		first, err := bk.Checkpoint(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 10, pastLen(t, bk, first))
+		putN(t, bk, "new", 5)
+
+		res, err := bk.Prune(ctx, RetentionPolicy{})
+		require.NoError(t, err)
+		require.Equal(t, first, res.Checkpoint)
+		require.Equal(t, 10, res.Events)
+		for _, l := range old {
+			_, err := bk.Blocks().Get(ctx, l)
+			require.ErrorIs(t, err, block.ErrNotFound)
+		}
+		require.Len(t, collectEntries(t, bk), 15)
+
+		// the pruned events are not listed again
+		second, err := bk.Checkpoint(ctx)
+		require.NoError(t, err)
+		evt, err := getClockEvent(ctx, bk.Blocks(), second)
+		require.NoError(t, err)
+		require.Equal(t, first, evt.Since)
+		require.Equal(t, 6, pastLen(t, bk, second))
+		ok, err := checkpoints{second: evt}.covers(ctx, bk.Blocks(), old[0])
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		res, err = bk.Prune(ctx, RetentionPolicy{})
+		require.NoError(t, err)
+		require.Equal(t, second, res.Checkpoint)
+		require.Equal(t, 6, res.Events)
+		_, err = bk.Blocks().Get(ctx, first)
+		require.ErrorIs(t, err, block.ErrNotFound)
+		require.Len(t, collectEntries(t, bk), 15)
+	})
+
+	t.Run("reads after pruning", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "k", 10)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		root, err := bk.Root(ctx)
+		require.NoError(t, err)
+		putN(t, bk, "more", 1)
+		_, err = bk.Checkpoint(ctx)
+		require.NoError(t, err)
+		require.NoError(t, bk.Del(ctx, "k0"))
+		_, err = bk.Prune(ctx, RetentionPolicy{})
+		require.NoError(t, err)
+
+		// pruned state is not mistaken for deleted keys
+		_, err = bk.At(ctx, head)
+		require.ErrorIs(t, err, block.ErrNotFound)
+		require.NotErrorIs(t, err, ErrNotFound)
+		_, err = NewRootSnapshot(ctx, bk.Blocks(), root)
+		require.ErrorIs(t, err, block.ErrNotFound)
+		require.NotErrorIs(t, err, ErrNotFound)
+
+		_, err = bk.Get(ctx, "k0")
+		require.ErrorIs(t, err, ErrNotFound)
+		_, err = bk.Get(ctx, "k1")
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,135 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+)
+
+// Conflict is a key that was modified differently on both branches of a merge
+// since they diverged. Values are nil where the key was deleted.
+type Conflict struct {
+	Key string
+	// Local is the value at the local head before the merge.
+	Local ipld.Link
+	// Remote is the value at the merged remote head.
+	Remote ipld.Link
+	// Resolved is the value picked by the CRDT when merging.
+	Resolved ipld.Link
+}
+
+// MergeResult is the outcome of merging a remote head into the local merkle
+// clock.
+type MergeResult struct {
+	// Head is the new local head.
+	Head []ipld.Link
+	// Conflicts are the keys modified on both branches with different values.
+	Conflicts []Conflict
+}
+
+// Merge advances the merkle clock of the replica with a head received from a
+// remote or peer, whose events and shards are stored by the replica or among
+// the passed blocks, see [AdvanceHead]. It returns the new head and the keys
+// modified differently on the local and received heads since they diverged.
+func Merge(ctx context.Context, replica Replica, head []ipld.Link, blocks []block.Block) (MergeResult, error) {
+	lhead, err := replica.Head(ctx)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("getting local head: %w", err)
+	}
+	hd, err := AdvanceHead(ctx, replica, head, blocks)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("advancing clock: %w", err)
+	}
+	conflicts, err := Conflicts(ctx, replica.Blocks(), lhead, head, hd)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("finding conflicts: %w", err)
+	}
+	return MergeResult{Head: hd, Conflicts: conflicts}, nil
+}
+
+// Conflicts finds the keys that were modified both by the events reachable
+// only from the local head and by the events reachable only from the remote
+// head, and that have different values at the two heads. The merged head is
+// the result of advancing the local head with the remote head, and gives the
+// resolved values. Only the history since the common ancestors of the heads is
+// walked, see [divergent]. Conflicts are sorted by key.
+func Conflicts(ctx context.Context, blocks block.Fetcher, local, remote, merged []ipld.Link) ([]Conflict, error) {
+	events := newEventFetcher(blocks)
+	lonly, ronly, err := divergent(ctx, events, local, remote)
+	if err != nil {
+		return nil, err
+	}
+	// keys modified by the events
+	modified := func(evts map[ipld.Link]struct{}) (map[string]struct{}, error) {
+		keys := map[string]struct{}{}
+		for l := range evts {
+			evt, err := getClockEvent(ctx, blocks, l)
+			if err != nil {
+				if errors.Is(err, block.ErrNotFound) {
+					continue
+				}
+				return nil, err
+			}
+			for _, k := range evt.keys() {
+				keys[k] = struct{}{}
+			}
+		}
+		return keys, nil
+	}
+	lkeys, err := modified(lonly)
+	if err != nil {
+		return nil, err
+	}
+	rkeys, err := modified(ronly)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for k := range lkeys {
+		if _, ok := rkeys[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	var conflicts []Conflict
+	for _, k := range keys {
+		lv, err := valueAt(ctx, blocks, local, k)
+		if err != nil {
+			return nil, err
+		}
+		rv, err := valueAt(ctx, blocks, remote, k)
+		if err != nil {
+			return nil, err
+		}
+		if lv == rv {
+			continue
+		}
+		mv, err := valueAt(ctx, blocks, merged, k)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, Conflict{Key: k, Local: lv, Remote: rv, Resolved: mv})
+	}
+	return conflicts, nil
+}
+
+// valueAt gets the value of the key at the head, or nil if it is not set.
+func valueAt(ctx context.Context, blocks block.Fetcher, head []ipld.Link, key string) (ipld.Link, error) {
+	if len(head) == 0 {
+		return nil, nil
+	}
+	v, err := clockGet(ctx, blocks, head, key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("getting %s: %w", key, err)
+	}
+	return v, nil
+}
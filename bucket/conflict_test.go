@@ -0,0 +1,119 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// countingFetcher counts the distinct blocks fetched.
+type countingFetcher struct {
+	block.Fetcher
+	fetched map[ipld.Link]struct{}
+}
+
+func (f *countingFetcher) Get(ctx context.Context, l ipld.Link) (block.Block, error) {
+	f.fetched[l] = struct{}{}
+	return f.Fetcher.Get(ctx, l)
+}
+
+func putN(t *testing.T, bk Bucket[ipld.Link], prefix string, n int) {
+	t.Helper()
+	for i := range n {
+		require.NoError(t, bk.Put(context.Background(), fmt.Sprintf("%s%d", prefix, i), testutil.RandomLink(t)))
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	ctx := context.Background()
+
+	bk := newTestBucket(t, WithHistory())
+	putN(t, bk, "shared", 50)
+	branch, err := bk.Fork(ctx, "other")
+	require.NoError(t, err)
+
+	same, local, remote := testutil.RandomLink(t), testutil.RandomLink(t), testutil.RandomLink(t)
+	require.NoError(t, bk.Put(ctx, "k", local))
+	require.NoError(t, bk.Put(ctx, "same", same))
+	require.NoError(t, bk.Put(ctx, "x", testutil.RandomLink(t)))
+	require.NoError(t, branch.Put(ctx, "k", remote))
+	require.NoError(t, branch.Put(ctx, "same", same))
+	require.NoError(t, branch.Put(ctx, "y", testutil.RandomLink(t)))
+	lhead, err := bk.Head(ctx)
+	require.NoError(t, err)
+	bhead, err := branch.Head(ctx)
+	require.NoError(t, err)
+
+	res, err := MergeBranch(ctx, bk, "other")
+	require.NoError(t, err)
+	require.Len(t, res.Head, 2)
+	resolved, err := bk.Get(ctx, "k")
+	require.NoError(t, err)
+	require.Equal(t, []Conflict{{Key: "k", Local: local, Remote: remote, Resolved: resolved}}, res.Conflicts)
+
+	t.Run("stops at the common ancestor", func(t *testing.T) {
+		f := &countingFetcher{bk.Blocks(), map[ipld.Link]struct{}{}}
+		_, _, err := divergent(ctx, newEventFetcher(f), lhead, bhead)
+		require.NoError(t, err)
+		// the six divergent events and the fork point, not the shared history
+		require.Less(t, len(f.fetched), 10)
+	})
+
+	t.Run("merged head has no conflicts", func(t *testing.T) {
+		conflicts, err := Conflicts(ctx, bk.Blocks(), res.Head, bhead, res.Head)
+		require.NoError(t, err)
+		require.Empty(t, conflicts)
+	})
+}
+
+func TestDivergence(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("behind", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "a", 50)
+		before, err := bk.Head(ctx)
+		require.NoError(t, err)
+		putN(t, bk, "b", 4)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+
+		f := &countingFetcher{bk.Blocks(), map[ipld.Link]struct{}{}}
+		ahead, behind, err := Divergence(ctx, f, before, head)
+		require.NoError(t, err)
+		require.Equal(t, 0, ahead)
+		require.Equal(t, 4, behind)
+		// the four new events and as many of the shared history
+		require.LessOrEqual(t, len(f.fetched), 8)
+	})
+
+	t.Run("branches of different lengths", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "shared", 3)
+		branch, err := bk.Fork(ctx, "other")
+		require.NoError(t, err)
+		putN(t, branch, "long", 20)
+		require.NoError(t, bk.Put(ctx, "short", testutil.RandomLink(t)))
+
+		// the long branch is merged and written on top of, while the branch
+		// moves on
+		_, err = MergeBranch(ctx, bk, "other")
+		require.NoError(t, err)
+		require.NoError(t, bk.Put(ctx, "after", testutil.RandomLink(t)))
+		putN(t, branch, "more", 2)
+
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		bhead, err := branch.Head(ctx)
+		require.NoError(t, err)
+		ahead, behind, err := Divergence(ctx, bk.Blocks(), head, bhead)
+		require.NoError(t, err)
+		require.Equal(t, 2, ahead)
+		require.Equal(t, 2, behind)
+	})
+}
@@ -0,0 +1,552 @@
+package bucket
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	pail "github.com/storacha/go-pail"
+	"github.com/storacha/go-pail/clock/event"
+	"github.com/storacha/go-pail/crdt"
+	"github.com/storacha/go-pail/crdt/operation"
+	"github.com/storacha/go-pail/shard"
+)
+
+// The functions in this file are the pail CRDT operations of [crdt], extended
+// for merkle clocks with checkpoint events, see [TypeCheckpoint], whose history
+// may have been pruned. They mirror go-pail v0.0.0-20250114110711-547618938b52,
+// whose crdt package cannot be used directly: it fails when the history of the
+// head was pruned, it cannot replay batch and checkpoint events, it fails to
+// replay the delete of a key a concurrent event deleted, and the order it
+// replays events in by weight does not always put an event after its parents.
+
+// clockRoot determines the pail root at the passed head, see [crdt.Root]. The
+// events since the common ancestor of the head are replayed on its root, in
+// the order of the clock and, for concurrent events, of their CIDs. If the
+// common ancestor is not available, because the history was pruned, the
+// events since the base checkpoint are replayed on its root instead. The
+// returned diff holds the shards created by replaying.
+func clockRoot(ctx context.Context, blocks block.Fetcher, head []ipld.Link) (ipld.Link, shard.Diff, error) {
+	if len(head) == 0 {
+		return nil, shard.Diff{}, errors.New("cannot determine root of headless clock")
+	}
+	if len(head) == 1 {
+		evt, err := getClockEvent(ctx, blocks, head[0])
+		if err != nil {
+			return nil, shard.Diff{}, fmt.Errorf("getting head event: %w", err)
+		}
+		return evt.Data().Root(), shard.Diff{}, nil
+	}
+
+	root, evts, aerr := sinceAncestor(ctx, blocks, head)
+	if aerr == nil {
+		return replay(ctx, blocks, root, evts)
+	}
+	if !errors.Is(aerr, block.ErrNotFound) {
+		return nil, shard.Diff{}, aerr
+	}
+
+	cps, err := findCheckpoints(ctx, blocks, head)
+	if err != nil {
+		return nil, shard.Diff{}, fmt.Errorf("finding checkpoints: %w", err)
+	}
+	base, _, err := cps.base(ctx, blocks)
+	if err != nil {
+		return nil, shard.Diff{}, fmt.Errorf("finding base checkpoint: %w", err)
+	}
+	if base == nil {
+		return nil, shard.Diff{}, aerr
+	}
+	bcps := cps.only(base)
+	evts, err = eventsSince(ctx, blocks, head, func(l ipld.Link) (bool, error) {
+		if l == base {
+			return true, nil
+		}
+		return bcps.covers(ctx, blocks, l)
+	})
+	if err != nil {
+		return nil, shard.Diff{}, fmt.Errorf("finding events since checkpoint: %w", err)
+	}
+	return replay(ctx, blocks, cps[base].Data().Root(), evts)
+}
+
+// sinceAncestor returns the pail root at the common ancestor of the head, and
+// the events since. The error wraps [block.ErrNotFound] if an event needed is
+// not available.
+func sinceAncestor(ctx context.Context, blocks block.Fetcher, head []ipld.Link) (ipld.Link, map[ipld.Link]clockEvent, error) {
+	ancestor, err := commonAncestor(ctx, blocks, head, map[ipld.Link]ipld.Link{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("finding common ancestor: %w", err)
+	}
+	aevt, err := getClockEvent(ctx, blocks, ancestor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting ancestor event: %w", err)
+	}
+	evts, err := eventsSince(ctx, blocks, head, func(l ipld.Link) (bool, error) {
+		return l == ancestor, nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("finding events since common ancestor: %w", err)
+	}
+	return aevt.Data().Root(), evts, nil
+}
+
+// commonAncestor finds the latest event every path back from the passed events
+// leads through. It follows each event back through its ancestors that every
+// path leads through, finding those of an event with several parents
+// recursively, until one is reached from every event. The ancestors found are
+// memoized in ancestors. The error wraps [block.ErrNotFound] if an event on
+// the way is not available.
+func commonAncestor(ctx context.Context, blocks block.Fetcher, links []ipld.Link, ancestors map[ipld.Link]ipld.Link) (ipld.Link, error) {
+	// the ancestors every path from each event leads through, in order
+	paths := make([][]ipld.Link, len(links))
+	reached := make([]map[ipld.Link]struct{}, len(links))
+	for i, l := range links {
+		paths[i] = []ipld.Link{l}
+		reached[i] = map[ipld.Link]struct{}{l: {}}
+	}
+	common := func(l ipld.Link) bool {
+		for _, r := range reached {
+			if _, ok := r[l]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+	for _, l := range links {
+		if common(l) {
+			return l, nil
+		}
+	}
+	for {
+		var changed bool
+		for i, path := range paths {
+			l := path[len(path)-1]
+			next, ok := ancestors[l]
+			if !ok {
+				evt, err := getClockEvent(ctx, blocks, l)
+				if err != nil {
+					return nil, err
+				}
+				switch len(evt.Parents()) {
+				case 0:
+				case 1:
+					next = evt.Parents()[0]
+				default:
+					next, err = commonAncestor(ctx, blocks, evt.Parents(), ancestors)
+					if err != nil {
+						return nil, err
+					}
+				}
+				ancestors[l] = next
+			}
+			if next == nil {
+				continue
+			}
+			changed = true
+			paths[i] = append(path, next)
+			reached[i][next] = struct{}{}
+			if common(next) {
+				return next, nil
+			}
+		}
+		if !changed {
+			return nil, errors.New("events have no common ancestor")
+		}
+	}
+}
+
+// eventsSince walks back from the head and returns the events found before
+// those for which stop returns true.
+func eventsSince(ctx context.Context, blocks block.Fetcher, head []ipld.Link, stop func(l ipld.Link) (bool, error)) (map[ipld.Link]clockEvent, error) {
+	evts := map[ipld.Link]clockEvent{}
+	err := walk(head, func(l ipld.Link) ([]ipld.Link, error) {
+		ok, err := stop(l)
+		if err != nil || ok {
+			return nil, err
+		}
+		evt, err := getClockEvent(ctx, blocks, l)
+		if err != nil {
+			return nil, err
+		}
+		evts[l] = evt
+		return evt.Parents(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return evts, nil
+}
+
+// replay applies the operations of the events to the pail root, see
+// [sortEvents] for the order they are applied in. The returned diff holds the
+// shards created.
+func replay(ctx context.Context, blocks block.Fetcher, root ipld.Link, evts map[ipld.Link]clockEvent) (ipld.Link, shard.Diff, error) {
+	mblocks := block.NewMapBlockstore()
+	blocks = block.NewTieredBlockFetcher(mblocks, blocks)
+	diffs := newDiffSet()
+	for _, evt := range sortEvents(evts) {
+		op := evt.Data()
+		var diff shard.Diff
+		var err error
+		switch op.Type() {
+		case operation.TypePut:
+			root, diff, err = pail.Put(ctx, blocks, root, op.Key(), op.Value())
+			if err != nil {
+				return nil, shard.Diff{}, fmt.Errorf("replaying put: %w", err)
+			}
+		case operation.TypeDel:
+			var droot ipld.Link
+			droot, diff, err = pail.Del(ctx, blocks, root, op.Key())
+			if err != nil {
+				// the key may have been deleted by a concurrent event
+				if !errors.Is(err, ErrNotFound) {
+					return nil, shard.Diff{}, fmt.Errorf("replaying del: %w", err)
+				}
+				continue
+			}
+			root = droot
+		case TypeBatch:
+			root, diff, err = applyOps(ctx, blocks, root, evt.Ops)
+			if err != nil {
+				return nil, shard.Diff{}, fmt.Errorf("replaying batch: %w", err)
+			}
+		case TypeCheckpoint:
+		default:
+			return nil, shard.Diff{}, fmt.Errorf("unknown operation: %s", op.Type())
+		}
+		for _, a := range diff.Additions {
+			_ = mblocks.Put(ctx, a)
+		}
+		diffs.add(diff)
+	}
+	return root, diffs.diff(), nil
+}
+
+// sortEvents orders events so that every event follows its parents, and
+// concurrent events are ordered by CID.
+func sortEvents(evts map[ipld.Link]clockEvent) []clockEvent {
+	var sorted []clockEvent
+	for _, l := range sortLinks(evts) {
+		sorted = append(sorted, evts[l])
+	}
+	return sorted
+}
+
+// sortLinks returns the links of the events in the order of [sortEvents].
+func sortLinks(evts map[ipld.Link]clockEvent) []ipld.Link {
+	// pending counts the parents of each event that have not been ordered yet
+	pending := map[ipld.Link]int{}
+	children := map[ipld.Link][]ipld.Link{}
+	ready := &linkQueue{}
+	for l, evt := range evts {
+		for _, p := range evt.Parents() {
+			if _, ok := evts[p]; ok {
+				pending[l]++
+				children[p] = append(children[p], l)
+			}
+		}
+		if pending[l] == 0 {
+			ready.links = append(ready.links, l)
+		}
+	}
+	heap.Init(ready)
+	var sorted []ipld.Link
+	for ready.Len() > 0 {
+		l := heap.Pop(ready).(ipld.Link)
+		sorted = append(sorted, l)
+		for _, c := range children[l] {
+			pending[c]--
+			if pending[c] == 0 {
+				heap.Push(ready, c)
+			}
+		}
+	}
+	return sorted
+}
+
+// linkQueue is a heap of the events whose parents have all been ordered by
+// [sortLinks], in the order of their CIDs.
+type linkQueue struct {
+	links []ipld.Link
+}
+
+func (q *linkQueue) Len() int { return len(q.links) }
+
+func (q *linkQueue) Less(i, j int) bool { return compareLinks(q.links[i], q.links[j]) < 0 }
+
+func (q *linkQueue) Swap(i, j int) { q.links[i], q.links[j] = q.links[j], q.links[i] }
+
+func (q *linkQueue) Push(x any) { q.links = append(q.links, x.(ipld.Link)) }
+
+func (q *linkQueue) Pop() any {
+	l := q.links[len(q.links)-1]
+	q.links = q.links[:len(q.links)-1]
+	return l
+}
+
+// diffSet accumulates the diffs of successive writes to a pail into the diff
+// of the writes as a whole. A block removed by a later write is no longer
+// added, and a block added again by a later write is no longer removed, so
+// shards recreated by a later write are kept.
+type diffSet struct {
+	additions map[ipld.Link]shard.BlockView
+	removals  map[ipld.Link]shard.BlockView
+}
+
+func newDiffSet() *diffSet {
+	return &diffSet{map[ipld.Link]shard.BlockView{}, map[ipld.Link]shard.BlockView{}}
+}
+
+// add adds the diff of the next write.
+func (s *diffSet) add(diff shard.Diff) {
+	for _, r := range diff.Removals {
+		delete(s.additions, r.Link())
+		s.removals[r.Link()] = r
+	}
+	for _, a := range diff.Additions {
+		delete(s.removals, a.Link())
+		s.additions[a.Link()] = a
+	}
+}
+
+// diff returns the diff of the writes added.
+func (s *diffSet) diff() shard.Diff {
+	return shard.Diff{
+		Additions: slices.Collect(maps.Values(s.additions)),
+		Removals:  slices.Collect(maps.Values(s.removals)),
+	}
+}
+
+// clockGet gets the value of the key at the passed head, see [crdt.Get].
+func clockGet(ctx context.Context, blocks block.Fetcher, head []ipld.Link, key string) (ipld.Link, error) {
+	if len(head) == 0 {
+		return nil, ErrNotFound
+	}
+	mblocks := block.NewMapBlockstore()
+	blocks = block.NewTieredBlockFetcher(mblocks, blocks)
+	root, diff, err := clockRoot(ctx, blocks, head)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range diff.Additions {
+		_ = mblocks.Put(ctx, a)
+	}
+	return pail.Get(ctx, blocks, root, key)
+}
+
+// clockEntries lists the entries at the passed head, see [crdt.Entries].
+func clockEntries(ctx context.Context, blocks block.Fetcher, head []ipld.Link, opts ...EntriesOption) iter.Seq2[pail.Entry, error] {
+	return func(yield func(pail.Entry, error) bool) {
+		if len(head) == 0 {
+			return
+		}
+		mblocks := block.NewMapBlockstore()
+		blocks := block.NewTieredBlockFetcher(mblocks, blocks)
+		root, diff, err := clockRoot(ctx, blocks, head)
+		if err != nil {
+			yield(pail.Entry{}, err)
+			return
+		}
+		for _, a := range diff.Additions {
+			_ = mblocks.Put(ctx, a)
+		}
+		for e, err := range pail.Entries(ctx, blocks, root, opts...) {
+			if !yield(e, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// clockPut puts a value for the key at the passed head, see [crdt.Put].
+func clockPut(ctx context.Context, blocks block.Fetcher, head []ipld.Link, key string, value ipld.Link) (crdt.Result, error) {
+	if len(head) == 0 {
+		return crdt.Put(ctx, blocks, head, key, value)
+	}
+	return clockWrite(ctx, blocks, head, func(blocks block.Fetcher, root ipld.Link) (ipld.Link, shard.Diff, operation.Operation, error) {
+		root, diff, err := pail.Put(ctx, blocks, root, key, value)
+		if err != nil {
+			return nil, shard.Diff{}, nil, fmt.Errorf("putting to pail: %w", err)
+		}
+		return root, diff, operation.NewPut(root, key, value), nil
+	})
+}
+
+// clockDel deletes the key at the passed head, see [crdt.Del].
+func clockDel(ctx context.Context, blocks block.Fetcher, head []ipld.Link, key string) (crdt.Result, error) {
+	if len(head) == 0 {
+		return crdt.Del(ctx, blocks, head, key)
+	}
+	return clockWrite(ctx, blocks, head, func(blocks block.Fetcher, root ipld.Link) (ipld.Link, shard.Diff, operation.Operation, error) {
+		root, diff, err := pail.Del(ctx, blocks, root, key)
+		if err != nil {
+			return nil, shard.Diff{}, nil, fmt.Errorf("deleting from pail: %w", err)
+		}
+		return root, diff, operation.NewDel(root, key), nil
+	})
+}
+
+// clockWrite applies a write to the pail root at the passed head, and creates
+// an event for it whose parents are the head. No event is created if the write
+// did not change the pail.
+func clockWrite(ctx context.Context, blocks block.Fetcher, head []ipld.Link, apply func(blocks block.Fetcher, root ipld.Link) (ipld.Link, shard.Diff, operation.Operation, error)) (crdt.Result, error) {
+	mblocks := block.NewMapBlockstore()
+	blocks = block.NewTieredBlockFetcher(mblocks, blocks)
+	var root ipld.Link
+	var diff shard.Diff
+	if len(head) == 0 {
+		// the first event of the clock writes to an empty pail, see [crdt.Put]
+		rblock, err := shard.MarshalBlock(shard.NewRoot(nil))
+		if err != nil {
+			return crdt.Result{}, fmt.Errorf("marshalling shard: %w", err)
+		}
+		_ = mblocks.Put(ctx, rblock)
+		root = rblock.Link()
+	} else {
+		var err error
+		root, diff, err = clockRoot(ctx, blocks, head)
+		if err != nil {
+			return crdt.Result{}, fmt.Errorf("determining pail root: %w", err)
+		}
+	}
+
+	diffs := newDiffSet()
+	for _, a := range diff.Additions {
+		_ = mblocks.Put(ctx, a)
+	}
+	diffs.add(diff)
+
+	root, diff, op, err := apply(blocks, root)
+	if err != nil {
+		return crdt.Result{}, err
+	}
+	if len(diff.Additions) == 0 {
+		return crdt.Result{Root: root, Head: head}, nil
+	}
+	diffs.add(diff)
+
+	eblock, err := event.MarshalBlock(event.NewEvent(op, head), operationUnbinder)
+	if err != nil {
+		return crdt.Result{}, fmt.Errorf("marshalling event block: %w", err)
+	}
+	if bop, ok := op.(batchOp); ok {
+		eblock, err = withOps(eblock, bop.ops)
+		if err != nil {
+			return crdt.Result{}, fmt.Errorf("adding batch ops: %w", err)
+		}
+	}
+	return crdt.Result{
+		Diff:  diffs.diff(),
+		Root:  root,
+		Head:  []ipld.Link{eblock.Link()},
+		Event: eblock,
+	}, nil
+}
+
+// clockAdvance advances the merkle clock with the passed event, see
+// [clock.Advance]. Events that are not available, because they were pruned,
+// are not traversed, and an event is known to be in the history of a
+// checkpoint if it is in its past.
+func clockAdvance(ctx context.Context, blocks block.Fetcher, head []ipld.Link, evt ipld.Link) ([]ipld.Link, error) {
+	if slices.Contains(head, evt) {
+		return head, nil
+	}
+
+	// does event contain the clock?
+	var next []ipld.Link
+	var changed bool
+	// the history of the event may be incomplete if the clock contains it
+	var incomplete error
+	for _, h := range head {
+		ok, err := contains(ctx, blocks, evt, h)
+		if err != nil {
+			if !errors.Is(err, block.ErrNotFound) {
+				return nil, err
+			}
+			incomplete = err
+		}
+		if ok {
+			changed = true
+			continue
+		}
+		next = append(next, h)
+	}
+	if changed && incomplete == nil {
+		return append(next, evt), nil
+	}
+
+	// does clock contain the event?
+	for _, h := range head {
+		ok, err := contains(ctx, blocks, h, evt)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return head, nil
+		}
+	}
+	if incomplete != nil {
+		return nil, incomplete
+	}
+	return append(head, evt), nil
+}
+
+// contains reports whether event b is in the history of event a. Event b
+// need not be available, but the events walked back from a must be, up to the
+// checkpoints found, whose past is looked up instead. The error wraps
+// [block.ErrNotFound] if one is missing.
+func contains(ctx context.Context, blocks block.Fetcher, a, b ipld.Link) (bool, error) {
+	if a == b {
+		return true, nil
+	}
+	var bparents []ipld.Link
+	bevt, err := getClockEvent(ctx, blocks, b)
+	if err == nil {
+		bparents = bevt.Parents()
+	} else if !errors.Is(err, block.ErrNotFound) {
+		return false, err
+	}
+
+	links := []ipld.Link{a}
+	seen := map[ipld.Link]struct{}{}
+	for len(links) > 0 {
+		l := links[0]
+		links = links[1:]
+		if _, ok := seen[l]; ok {
+			continue
+		}
+		seen[l] = struct{}{}
+		// an event in the past of a checkpoint may have been pruned, but the
+		// walk stops at checkpoints, so any other missing event means the
+		// answer is unknown
+		evt, err := getClockEvent(ctx, blocks, l)
+		if err != nil {
+			return false, err
+		}
+		if evt.Past != nil {
+			ok, err := checkpoints{l: evt}.covers(ctx, blocks, b)
+			if err != nil || ok {
+				return ok, err
+			}
+			continue
+		}
+		for _, p := range evt.Parents() {
+			if p == b {
+				return true, nil
+			}
+			// b cannot be in the history of one of its parents
+			if slices.Contains(bparents, p) {
+				continue
+			}
+			links = append(links, p)
+		}
+	}
+	return false, nil
+}
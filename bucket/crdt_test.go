@@ -0,0 +1,265 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/internal/testutil"
+	pail "github.com/storacha/go-pail"
+	"github.com/storacha/go-pail/shard"
+	"github.com/stretchr/testify/require"
+)
+
+// hidingFetcher reports the hidden blocks as not found, as if they were
+// pruned.
+type hidingFetcher struct {
+	block.Fetcher
+	hidden map[ipld.Link]struct{}
+}
+
+func (f *hidingFetcher) Get(ctx context.Context, l ipld.Link) (block.Block, error) {
+	if _, ok := f.hidden[l]; ok {
+		return nil, fmt.Errorf("getting block: %s: %w", l, block.ErrNotFound)
+	}
+	return f.Fetcher.Get(ctx, l)
+}
+
+// putHeads puts n keys with the passed prefix, and returns the head event
+// after each put.
+func putHeads(t *testing.T, bk *DsClockBucket, prefix string, n int) []ipld.Link {
+	t.Helper()
+	var heads []ipld.Link
+	for i := range n {
+		require.NoError(t, bk.Put(context.Background(), fmt.Sprintf("%s%d", prefix, i), testutil.RandomLink(t)))
+		head, err := bk.Head(context.Background())
+		require.NoError(t, err)
+		require.Len(t, head, 1)
+		heads = append(heads, head[0])
+	}
+	return heads
+}
+
+// forked puts n keys to the bucket and to a branch forked from it, and merges
+// the branch, leaving the bucket with a head of two concurrent events.
+func forked(t *testing.T, bk *DsClockBucket, n int) []ipld.Link {
+	t.Helper()
+	ctx := context.Background()
+	branch, err := bk.Fork(ctx, "other")
+	require.NoError(t, err)
+	putN(t, bk, "a", n)
+	putN(t, branch, "b", n)
+	_, err = MergeBranch(ctx, bk, "other")
+	require.NoError(t, err)
+	head, err := bk.Head(ctx)
+	require.NoError(t, err)
+	require.Len(t, head, 2)
+	return head
+}
+
+func TestClockRoot(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("replays since the common ancestor", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		shared := putHeads(t, bk, "shared", 50)
+		head := forked(t, bk, 3)
+
+		f := &countingFetcher{bk.Blocks(), map[ipld.Link]struct{}{}}
+		root, diff, err := clockRoot(ctx, f, head)
+		require.NoError(t, err)
+		require.Contains(t, f.fetched, shared[49])
+		require.NotContains(t, f.fetched, shared[48])
+
+		mblocks := block.NewMapBlockstore()
+		for _, b := range diff.Additions {
+			require.NoError(t, mblocks.Put(ctx, b))
+		}
+		n := 0
+		for _, err := range pail.Entries(ctx, block.NewTieredBlockFetcher(mblocks, bk.Blocks()), root) {
+			require.NoError(t, err)
+			n++
+		}
+		require.Equal(t, 56, n)
+	})
+
+	t.Run("concurrent writes to the same key", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "shared", 5)
+		branch, err := bk.Fork(ctx, "other")
+		require.NoError(t, err)
+		a, b := testutil.RandomLink(t), testutil.RandomLink(t)
+		require.NoError(t, bk.Put(ctx, "k", a))
+		require.NoError(t, branch.Put(ctx, "k", b))
+		_, err = MergeBranch(ctx, bk, "other")
+		require.NoError(t, err)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+
+		root, _, err := clockRoot(ctx, bk.Blocks(), head)
+		require.NoError(t, err)
+		reversed, _, err := clockRoot(ctx, bk.Blocks(), []ipld.Link{head[1], head[0]})
+		require.NoError(t, err)
+		require.Equal(t, root, reversed)
+		v, err := bk.Get(ctx, "k")
+		require.NoError(t, err)
+		require.Contains(t, []ipld.Link{a, b}, v)
+	})
+
+	t.Run("concurrent deletes of the same key", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "shared", 5)
+		branch, err := bk.Fork(ctx, "other")
+		require.NoError(t, err)
+		require.NoError(t, bk.Del(ctx, "shared0"))
+		putN(t, branch, "b", 1)
+		require.NoError(t, branch.Del(ctx, "shared0"))
+		_, err = MergeBranch(ctx, bk, "other")
+		require.NoError(t, err)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		require.Len(t, head, 2)
+
+		entries := collectEntries(t, bk)
+		require.Len(t, entries, 5)
+		require.NotContains(t, entries, "shared0")
+	})
+
+	t.Run("across a checkpoint", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		shared := putHeads(t, bk, "shared", 20)
+		cp, err := bk.Checkpoint(ctx)
+		require.NoError(t, err)
+		head := forked(t, bk, 3)
+
+		f := &countingFetcher{bk.Blocks(), map[ipld.Link]struct{}{}}
+		_, _, err = clockRoot(ctx, f, head)
+		require.NoError(t, err)
+		require.Contains(t, f.fetched, cp)
+		require.NotContains(t, f.fetched, shared[19])
+		for _, k := range []string{"shared0", "a2", "b2"} {
+			_, err := bk.Get(ctx, k)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("pruned common ancestor", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		shared := putHeads(t, bk, "shared", 10)
+		branch, err := bk.Fork(ctx, "other")
+		require.NoError(t, err)
+		_, err = bk.Checkpoint(ctx)
+		require.NoError(t, err)
+		putN(t, bk, "a", 2)
+		putN(t, branch, "b", 2)
+		_, err = MergeBranch(ctx, bk, "other")
+		require.NoError(t, err)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+
+		want, _, err := clockRoot(ctx, bk.Blocks(), head)
+		require.NoError(t, err)
+		// the fork is in the past of the checkpoint, it is replayed from there
+		f := &hidingFetcher{bk.Blocks(), map[ipld.Link]struct{}{}}
+		for _, l := range shared {
+			f.hidden[l] = struct{}{}
+		}
+		root, _, err := clockRoot(ctx, f, head)
+		require.NoError(t, err)
+		require.Equal(t, want, root)
+	})
+}
+
+func TestClockAdvance(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ancestors, descendants and concurrent events", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		evts := putHeads(t, bk, "k", 3)
+
+		head, err := clockAdvance(ctx, bk.Blocks(), evts[2:], evts[1])
+		require.NoError(t, err)
+		require.Equal(t, evts[2:], head)
+
+		head, err = clockAdvance(ctx, bk.Blocks(), evts[:1], evts[2])
+		require.NoError(t, err)
+		require.Equal(t, evts[2:], head)
+
+		concurrent := forked(t, bk, 2)
+		head, err = clockAdvance(ctx, bk.Blocks(), concurrent[:1], concurrent[1])
+		require.NoError(t, err)
+		require.ElementsMatch(t, concurrent, head)
+	})
+
+	t.Run("missing events are reported", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		evts := putHeads(t, bk, "k", 5)
+		f := &hidingFetcher{bk.Blocks(), map[ipld.Link]struct{}{evts[2]: {}}}
+
+		_, err := contains(ctx, f, evts[4], evts[0])
+		require.ErrorIs(t, err, block.ErrNotFound)
+		_, err = clockAdvance(ctx, f, evts[4:], evts[0])
+		require.ErrorIs(t, err, block.ErrNotFound)
+	})
+
+	t.Run("events in the past of a checkpoint", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		evts := putHeads(t, bk, "k", 5)
+		_, err := bk.Checkpoint(ctx)
+		require.NoError(t, err)
+		putN(t, bk, "more", 1)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+
+		// pruned, the past of the checkpoint lists them
+		f := &hidingFetcher{bk.Blocks(), map[ipld.Link]struct{}{}}
+		for _, l := range evts[:4] {
+			f.hidden[l] = struct{}{}
+		}
+		ok, err := contains(ctx, f, head[0], evts[0])
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		// the history of an old event is incomplete, but it is known
+		hd, err := clockAdvance(ctx, f, head, evts[4])
+		require.NoError(t, err)
+		require.Equal(t, head, hd)
+		require.False(t, slices.Contains(hd, evts[4]))
+	})
+}
+
+func TestDiffSet(t *testing.T) {
+	ctx := context.Background()
+	blocks := block.NewMapBlockstore()
+	empty, err := pail.New()
+	require.NoError(t, err)
+	require.NoError(t, blocks.Put(ctx, empty))
+
+	diffs := newDiffSet()
+	write := func(root ipld.Link, diff shard.Diff, err error) ipld.Link {
+		require.NoError(t, err)
+		for _, a := range diff.Additions {
+			require.NoError(t, blocks.Put(ctx, a))
+		}
+		diffs.add(diff)
+		return root
+	}
+	v := testutil.RandomLink(t)
+	a := write(pail.Put(ctx, blocks, empty.Link(), "a", v))
+	b := write(pail.Put(ctx, blocks, a, "b", v))
+	// deleting b recreates the shard of a, which is kept
+	root := write(pail.Del(ctx, blocks, b, "b"))
+	require.Equal(t, a, root)
+
+	diff := diffs.diff()
+	require.Len(t, diff.Additions, 1)
+	require.Equal(t, a, diff.Additions[0].Link())
+	var removed []ipld.Link
+	for _, r := range diff.Removals {
+		removed = append(removed, r.Link())
+	}
+	require.ElementsMatch(t, []ipld.Link{empty.Link(), b}, removed)
+}
@@ -5,29 +5,69 @@ import (
 	"errors"
 	"fmt"
 	"iter"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/keytransform"
+	"github.com/ipfs/go-datastore/namespace"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipld/go-ipld-prime"
 	"github.com/storacha/fam/block"
 	"github.com/storacha/fam/bucket/head"
 	pail "github.com/storacha/go-pail"
-	"github.com/storacha/go-pail/clock"
-	"github.com/storacha/go-pail/crdt"
-	"github.com/storacha/go-pail/crdt/operation"
-	"github.com/storacha/go-pail/ipld/node"
+	"github.com/storacha/go-pail/shard"
 )
 
 var log = logging.Logger("datastore")
 
 var headKey = datastore.NewKey("head")
 
+// remoteHeadKey is the key the last known head of the named remote is stored
+// at, next to [headKey].
+func remoteHeadKey(name string) datastore.Key {
+	return datastore.NewKey("remotes").ChildString(name).ChildString("head")
+}
+
+// stagedKey is the prefix of the blocks of incomplete fetches, see [Stager].
+var stagedKey = datastore.NewKey("staged")
+
 type DsClockBucket struct {
 	mutex  sync.RWMutex
 	head   []ipld.Link
 	data   datastore.Datastore
 	blocks block.Blockstore
+	staged block.Blockstore
+	sign   EventSigner
+	// headKey is the key the head is stored at, [headKey] unless the bucket is
+	// a branch, see [Brancher].
+	headKey datastore.Key
+	branch  string
+	history bool
+}
+
+// DsClockBucketOption is an option configuring a [DsClockBucket].
+type DsClockBucketOption func(bucket *DsClockBucket)
+
+// WithEventSigner signs the clock events created by writes to the bucket, and
+// stamps them with the time they were written, see [SignEvent].
+func WithEventSigner(sign EventSigner) DsClockBucketOption {
+	return func(bucket *DsClockBucket) {
+		bucket.sign = sign
+	}
+}
+
+// WithHistory keeps the shards replaced by writes to the bucket, so that the
+// pail roots of past events can still be read. Merging events from a remote
+// replays them from the root of a common ancestor, so a bucket that is synced
+// with remotes must keep its history. Reads at past heads, diffs, reverts, tags
+// and branches need it too. Old shards are deleted by [DsClockBucket.Prune]
+// instead.
+func WithHistory() DsClockBucketOption {
+	return func(bucket *DsClockBucket) {
+		bucket.history = true
+	}
 }
 
 func (bucket *DsClockBucket) Head(ctx context.Context) ([]ipld.Link, error) {
@@ -37,41 +77,105 @@ func (bucket *DsClockBucket) Head(ctx context.Context) ([]ipld.Link, error) {
 }
 
 func (bucket *DsClockBucket) Advance(ctx context.Context, evt block.Block) ([]ipld.Link, error) {
+	return bucket.AdvanceMany(ctx, []block.Block{evt}, nil)
+}
+
+// AdvanceMany advances the merkle clock with the passed events, ordered so that
+// every event follows its parents. The events and the passed blocks, such as
+// the shards the events refer to, are written in a single batch along with
+// the new head. The resulting head is the same as advancing the clock with
+// each event in turn.
+func (bucket *DsClockBucket) AdvanceMany(ctx context.Context, events []block.Block, blocks []block.Block) ([]ipld.Link, error) {
+	return bucket.AdvanceChecked(ctx, events, blocks, nil)
+}
+
+// AdvanceChecked is [DsClockBucket.AdvanceMany], calling check, if not nil,
+// with the head before advancing it.
+func (bucket *DsClockBucket) AdvanceChecked(ctx context.Context, events []block.Block, blocks []block.Block, check func(head []ipld.Link) error) ([]ipld.Link, error) {
 	bucket.mutex.Lock()
 	defer bucket.mutex.Unlock()
 
-	for _, l := range bucket.head {
-		if l == evt.Link() {
-			return bucket.head, nil
+	if check != nil {
+		err := check(bucket.head)
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	mblocks := block.NewMapBlockstore()
-	_ = mblocks.Put(ctx, evt)
+	for _, b := range slices.Concat(events, blocks) {
+		_ = mblocks.Put(ctx, b)
+	}
+	fetcher := block.NewTieredBlockFetcher(mblocks, bucket.blocks)
+
+	hd := bucket.head
+	var writes []block.Block
+	for _, evt := range events {
+		if slices.Contains(hd, evt.Link()) {
+			continue
+		}
+		var err error
+		hd, err = clockAdvance(ctx, fetcher, hd, evt.Link())
+		if err != nil {
+			return nil, fmt.Errorf("advancing merkle clock: %s: %w", evt.Link(), err)
+		}
+		writes = append(writes, evt)
+	}
+	if len(writes) == 0 && len(blocks) == 0 {
+		return bucket.head, nil
+	}
 
-	hd, err := clock.Advance(ctx, block.NewTieredBlockFetcher(mblocks, bucket.blocks), node.BinderFunc[operation.Operation](operation.Bind), bucket.head, evt.Link())
+	// permanently write the new event blocks along with the new head
+	err := bucket.commit(ctx, slices.Concat(writes, blocks), hd)
 	if err != nil {
 		return nil, fmt.Errorf("advancing merkle clock: %w", err)
 	}
+	bucket.head = hd
+	return hd, nil
+}
 
-	// permanently write the new event block
-	err = bucket.blocks.Put(ctx, evt)
+// Blocks is the blockstore holding the clock events and pail shards.
+func (bucket *DsClockBucket) Blocks() block.Blockstore {
+	return bucket.blocks
+}
+
+// Staged is the blockstore holding the blocks of incomplete fetches.
+func (bucket *DsClockBucket) Staged() block.Blockstore {
+	return bucket.staged
+}
+
+func (bucket *DsClockBucket) RemoteHead(ctx context.Context, name string) ([]ipld.Link, error) {
+	b, err := bucket.data.Get(ctx, remoteHeadKey(name))
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("getting remote head: %w", err)
+	}
+	hd, err := head.Unmarshal(b)
 	if err != nil {
-		return nil, fmt.Errorf("putting merkle clock event: %w", err)
+		return nil, fmt.Errorf("unmarshalling remote head: %w", err)
 	}
+	return hd, nil
+}
 
+func (bucket *DsClockBucket) SetRemoteHead(ctx context.Context, name string, hd []ipld.Link) error {
+	if len(hd) == 0 {
+		err := bucket.data.Delete(ctx, remoteHeadKey(name))
+		if err != nil {
+			return fmt.Errorf("deleting remote head: %w", err)
+		}
+		return nil
+	}
 	hbytes, err := head.Marshal(hd)
 	if err != nil {
-		return nil, fmt.Errorf("marshalling head: %w", err)
+		return fmt.Errorf("marshalling remote head: %w", err)
 	}
-
-	err = bucket.data.Put(ctx, headKey, hbytes)
+	err = bucket.data.Put(ctx, remoteHeadKey(name), hbytes)
 	if err != nil {
-		return nil, fmt.Errorf("updating head: %w", err)
+		return fmt.Errorf("updating remote head: %w", err)
 	}
-
-	bucket.head = hd
-	return hd, nil
+	return nil
 }
 
 func (bucket *DsClockBucket) Root(ctx context.Context) (ipld.Link, error) {
@@ -86,51 +190,47 @@ func (bucket *DsClockBucket) Root(ctx context.Context) (ipld.Link, error) {
 		return b.Link(), nil
 	}
 
-	root, _, err := crdt.Root(ctx, bucket.blocks, bucket.head)
+	root, _, err := clockRoot(ctx, bucket.blocks, bucket.head)
 	if err != nil {
 		return nil, err
 	}
 	return root, nil
 }
 
+func (bucket *DsClockBucket) At(ctx context.Context, head []ipld.Link) (Bucket[ipld.Link], error) {
+	return NewSnapshot(ctx, bucket.blocks, head)
+}
+
 func (bucket *DsClockBucket) Put(ctx context.Context, key string, value ipld.Link) error {
 	bucket.mutex.Lock()
 	defer bucket.mutex.Unlock()
 
-	res, err := crdt.Put(ctx, bucket.blocks, bucket.head, key, value)
+	res, err := clockPut(ctx, bucket.blocks, bucket.head, key, value)
 	if err != nil {
 		return fmt.Errorf("putting %s: %w", key, err)
 	}
 
+	evt, hd, err := bucket.signEvent(ctx, res.Event, res.Head)
+	if err != nil {
+		return err
+	}
+
 	var additions []block.Block
-	if res.Event != nil {
-		additions = append(additions, res.Event)
+	if evt != nil {
+		additions = append(additions, evt)
 	}
 	for _, b := range res.Additions {
 		additions = append(additions, b)
 	}
-	err = bucket.blocks.PutBatch(ctx, additions)
+	err = bucket.commit(ctx, additions, hd)
 	if err != nil {
-		return fmt.Errorf("putting diff addition: %w", err)
-	}
-
-	hbytes, err := head.Marshal(res.Head)
-	if err != nil {
-		return fmt.Errorf("marshalling head: %w", err)
+		return err
 	}
+	bucket.head = hd
 
-	err = bucket.data.Put(ctx, headKey, hbytes)
+	err = bucket.deleteRemovals(ctx, res.Removals)
 	if err != nil {
-		return fmt.Errorf("updating head: %w", err)
-	}
-	bucket.head = res.Head
-
-	for _, b := range res.Removals {
-		log.Debugf("deleting put diff removal: %s", b.Link())
-		err = bucket.blocks.Del(ctx, b.Link())
-		if err != nil {
-			return fmt.Errorf("deleting diff removal: %w", err)
-		}
+		return fmt.Errorf("deleting put diff removal: %w", err)
 	}
 
 	return nil
@@ -140,7 +240,7 @@ func (bucket *DsClockBucket) Get(ctx context.Context, key string) (ipld.Link, er
 	bucket.mutex.RLock()
 	defer bucket.mutex.RUnlock()
 
-	value, err := crdt.Get(ctx, bucket.blocks, bucket.head, key)
+	value, err := clockGet(ctx, bucket.blocks, bucket.head, key)
 	if err != nil {
 		return nil, fmt.Errorf("getting %s: %w", key, err)
 	}
@@ -152,7 +252,7 @@ func (bucket *DsClockBucket) Entries(ctx context.Context, opts ...EntriesOption)
 		bucket.mutex.RLock()
 		defer bucket.mutex.RUnlock()
 
-		for e, err := range crdt.Entries(ctx, bucket.blocks, bucket.head, opts...) {
+		for e, err := range clockEntries(ctx, bucket.blocks, bucket.head, opts...) {
 			if err != nil {
 				yield(Entry[ipld.Link]{}, err)
 				return
@@ -168,48 +268,289 @@ func (bucket *DsClockBucket) Del(ctx context.Context, key string) error {
 	bucket.mutex.Lock()
 	defer bucket.mutex.Unlock()
 
-	res, err := crdt.Del(ctx, bucket.blocks, bucket.head, key)
+	res, err := clockDel(ctx, bucket.blocks, bucket.head, key)
 	if err != nil {
 		return fmt.Errorf("deleting %s: %w", key, err)
 	}
 
+	evt, hd, err := bucket.signEvent(ctx, res.Event, res.Head)
+	if err != nil {
+		return err
+	}
+
 	var additions []block.Block
-	if res.Event != nil {
-		additions = append(additions, res.Event)
+	if evt != nil {
+		additions = append(additions, evt)
+	}
+	for _, b := range res.Additions {
+		additions = append(additions, b)
+	}
+	err = bucket.commit(ctx, additions, hd)
+	if err != nil {
+		return err
 	}
+	bucket.head = hd
+
+	err = bucket.deleteRemovals(ctx, res.Removals)
+	if err != nil {
+		return fmt.Errorf("deleting del diff removal: %w", err)
+	}
+
+	return nil
+}
+
+// Batch makes the passed changes to the bucket as a single event, see
+// [Batcher].
+func (bucket *DsClockBucket) Batch(ctx context.Context, ops []BatchOp) error {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	res, err := clockBatch(ctx, bucket.blocks, bucket.head, ops)
+	if err != nil {
+		return fmt.Errorf("writing batch: %w", err)
+	}
+	if res.Event == nil {
+		return nil
+	}
+
+	evt, hd, err := bucket.signEvent(ctx, res.Event, res.Head)
+	if err != nil {
+		return err
+	}
+
+	additions := []block.Block{evt}
 	for _, b := range res.Additions {
 		additions = append(additions, b)
 	}
-	err = bucket.blocks.PutBatch(ctx, additions)
+	err = bucket.commit(ctx, additions, hd)
 	if err != nil {
-		return fmt.Errorf("putting diff addition: %w", err)
+		return err
 	}
+	bucket.head = hd
 
-	hbytes, err := head.Marshal(res.Head)
+	err = bucket.deleteRemovals(ctx, res.Removals)
+	if err != nil {
+		return fmt.Errorf("deleting batch diff removal: %w", err)
+	}
+
+	return nil
+}
+
+// commit writes the blocks and the new head in a single batch, so that the
+// head is never stored without the blocks it refers to. The blocks are only
+// written in the same batch if they are stored in a [block.DsBlockstore] whose
+// datastore and the datastore of the bucket are namespaces of the same batching
+// datastore, see [namespace.Wrap]. Otherwise the head is written after the
+// blocks.
+func (bucket *DsClockBucket) commit(ctx context.Context, blocks []block.Block, hd []ipld.Link) error {
+	hbytes, err := head.Marshal(hd)
 	if err != nil {
 		return fmt.Errorf("marshalling head: %w", err)
 	}
 
-	err = bucket.data.Put(ctx, headKey, hbytes)
+	dsblocks, ok := bucket.blocks.(*block.DsBlockstore)
+	if !ok {
+		return bucket.commitSeparately(ctx, blocks, hbytes)
+	}
+	broot, bkey := unwrapNamespaces(dsblocks.Datastore())
+	droot, dkey := unwrapNamespaces(bucket.data)
+	bds, ok := broot.(datastore.Batching)
+	if !ok || broot != droot {
+		return bucket.commitSeparately(ctx, blocks, hbytes)
+	}
+
+	batch, err := bds.Batch(ctx)
+	if err != nil {
+		return fmt.Errorf("creating batch: %w", err)
+	}
+	for _, b := range blocks {
+		err := batch.Put(ctx, bkey(block.Key(b.Link())), b.Bytes())
+		if err != nil {
+			return fmt.Errorf("putting block: %w", err)
+		}
+	}
+	err = batch.Put(ctx, dkey(bucket.headKey), hbytes)
 	if err != nil {
 		return fmt.Errorf("updating head: %w", err)
 	}
-	bucket.head = res.Head
+	err = batch.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("committing batch: %w", err)
+	}
+	return nil
+}
 
-	for _, b := range res.Removals {
-		log.Debugf("deleting delete diff removal: %s", b.Link())
-		err = bucket.blocks.Del(ctx, b.Link())
-		if err != nil {
-			return fmt.Errorf("deleting diff removal: %w", err)
+// commitSeparately writes the blocks and then the head, see [DsClockBucket.commit].
+func (bucket *DsClockBucket) commitSeparately(ctx context.Context, blocks []block.Block, hbytes []byte) error {
+	err := bucket.blocks.PutBatch(ctx, blocks)
+	if err != nil {
+		return fmt.Errorf("putting blocks: %w", err)
+	}
+	err = bucket.data.Put(ctx, bucket.headKey, hbytes)
+	if err != nil {
+		return fmt.Errorf("updating head: %w", err)
+	}
+	return nil
+}
+
+// unwrapNamespaces returns the datastore wrapped by the namespaces, or other
+// key transforms, of the passed datastore, and the function converting its
+// keys to keys of the wrapped datastore.
+func unwrapNamespaces(ds datastore.Datastore) (datastore.Datastore, func(datastore.Key) datastore.Key) {
+	convert := func(k datastore.Key) datastore.Key { return k }
+	for {
+		kt, ok := ds.(*keytransform.Datastore)
+		if !ok {
+			return ds, convert
 		}
+		prev := convert
+		convert = func(k datastore.Key) datastore.Key { return kt.ConvertKey(prev(k)) }
+		ds = kt.Children()[0]
 	}
+}
 
+// deleteRemovals deletes the shards replaced by a write, unless the bucket
+// keeps its history, see [WithHistory].
+func (bucket *DsClockBucket) deleteRemovals(ctx context.Context, removals []shard.BlockView) error {
+	if bucket.history {
+		return nil
+	}
+	for _, b := range removals {
+		log.Debugf("deleting diff removal: %s", b.Link())
+		err := bucket.blocks.Del(ctx, b.Link())
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func NewDsClockBucket(blocks block.Blockstore, dstore datastore.Datastore) (*DsClockBucket, error) {
-	var hd []ipld.Link
-	b, err := dstore.Get(context.Background(), headKey)
+// Checkpoint adds a checkpoint event to the merkle clock, see
+// [TypeCheckpoint]. It returns the link of the event, or the current head if
+// it is already a single checkpoint.
+func (bucket *DsClockBucket) Checkpoint(ctx context.Context) (ipld.Link, error) {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	if len(bucket.head) == 0 {
+		return nil, errors.New("cannot checkpoint an empty bucket")
+	}
+	if len(bucket.head) == 1 {
+		evt, err := getClockEvent(ctx, bucket.blocks, bucket.head[0])
+		if err != nil {
+			return nil, err
+		}
+		if evt.Past != nil {
+			return bucket.head[0], nil
+		}
+	}
+
+	root, diff, err := clockRoot(ctx, bucket.blocks, bucket.head)
+	if err != nil {
+		return nil, fmt.Errorf("determining pail root: %w", err)
+	}
+	mblocks := block.NewMapBlockstore()
+	for _, b := range diff.Additions {
+		_ = mblocks.Put(ctx, b)
+	}
+	evt, past, err := newCheckpoint(ctx, block.NewTieredBlockFetcher(mblocks, bucket.blocks), bucket.head, root)
+	if err != nil {
+		return nil, err
+	}
+	evt, hd, err := bucket.signEvent(ctx, evt, []ipld.Link{evt.Link()})
+	if err != nil {
+		return nil, err
+	}
+
+	additions := append([]block.Block{evt}, past...)
+	for _, b := range diff.Additions {
+		additions = append(additions, b)
+	}
+	err = bucket.commit(ctx, additions, hd)
+	if err != nil {
+		return nil, fmt.Errorf("putting checkpoint: %w", err)
+	}
+	bucket.head = hd
+	return evt.Link(), nil
+}
+
+// Prune deletes the events in the past of the latest checkpoint allowed by the
+// policy, and the shards referred to only by them. The events and shards of
+// tags and of the heads of branches are kept.
+func (bucket *DsClockBucket) Prune(ctx context.Context, policy RetentionPolicy) (PruneResult, error) {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	checkpoint, err := retentionCheckpoint(ctx, bucket.blocks, bucket.head, policy)
+	if err != nil {
+		return PruneResult{}, fmt.Errorf("finding retention checkpoint: %w", err)
+	}
+	if checkpoint == nil {
+		return PruneResult{}, nil
+	}
+	var tags []Tag
+	for e, err := range bucket.Tags(ctx) {
+		if err != nil {
+			return PruneResult{}, fmt.Errorf("listing tags: %w", err)
+		}
+		tags = append(tags, e.Value)
+	}
+	// the events of every branch are kept, and their heads like tags, as they
+	// may have been merged into the history of the checkpoint
+	keep := bucket.head
+	heads, err := bucket.branchHeads(ctx)
+	if err != nil {
+		return PruneResult{}, fmt.Errorf("listing branch heads: %w", err)
+	}
+	for _, hd := range heads {
+		keep = slices.Concat(keep, hd)
+		tags = append(tags, Tag{Head: hd})
+	}
+	res, err := prune(ctx, bucket.blocks, keep, checkpoint, tags)
+	if err != nil {
+		return PruneResult{}, fmt.Errorf("pruning: %w", err)
+	}
+	log.Debugf("pruned %d events and %d shards behind checkpoint %s", res.Events, res.Shards, checkpoint)
+	return res, nil
+}
+
+// signEvent replaces the event created by a write with an event stamped with
+// the current time and signed, in the event and in the new head, if the bucket
+// has a signer.
+func (bucket *DsClockBucket) signEvent(ctx context.Context, evt block.Block, hd []ipld.Link) (block.Block, []ipld.Link, error) {
+	if bucket.sign == nil || evt == nil {
+		return evt, hd, nil
+	}
+	unsigned, err := StampEvent(evt, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	auth, err := bucket.sign(ctx, unsigned.Link())
+	if err != nil {
+		return nil, nil, fmt.Errorf("signing event: %w", err)
+	}
+	signed, err := SignEvent(unsigned, auth)
+	if err != nil {
+		return nil, nil, err
+	}
+	var shd []ipld.Link
+	for _, l := range hd {
+		if l == evt.Link() {
+			l = signed.Link()
+		}
+		shd = append(shd, l)
+	}
+	return signed, shd, nil
+}
+
+func NewDsClockBucket(blocks block.Blockstore, dstore datastore.Datastore, options ...DsClockBucketOption) (*DsClockBucket, error) {
+	staged := block.NewDsBlockstore(namespace.Wrap(dstore, stagedKey))
+	bucket := &DsClockBucket{data: dstore, blocks: blocks, staged: staged, headKey: headKey, branch: MainBranch}
+	for _, opt := range options {
+		opt(bucket)
+	}
+
+	b, err := dstore.Get(context.Background(), bucket.headKey)
 	if err != nil {
 		if errors.Is(err, datastore.ErrNotFound) {
 			log.Warnln("bucket head not found, creating new bucket...")
@@ -217,11 +558,11 @@ func NewDsClockBucket(blocks block.Blockstore, dstore datastore.Datastore) (*DsC
 			return nil, fmt.Errorf("getting root: %w", err)
 		}
 	} else {
-		hd, err = head.Unmarshal(b)
+		bucket.head, err = head.Unmarshal(b)
 		if err != nil {
 			return nil, fmt.Errorf("unmarshalling head: %w", err)
 		}
 	}
-	log.Debugf("loading bucket with head: %s", hd)
-	return &DsClockBucket{head: hd, data: dstore, blocks: blocks}, nil
+	log.Debugf("loading bucket with head: %s", bucket.head)
+	return bucket, nil
 }
@@ -0,0 +1,173 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingDatastore records the writes made outside of a batch, and the keys
+// written by each committed batch.
+type recordingDatastore struct {
+	datastore.Batching
+	puts    []datastore.Key
+	commits [][]datastore.Key
+}
+
+func (ds *recordingDatastore) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	ds.puts = append(ds.puts, key)
+	return ds.Batching.Put(ctx, key, value)
+}
+
+func (ds *recordingDatastore) Batch(ctx context.Context) (datastore.Batch, error) {
+	b, err := ds.Batching.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingBatch{Batch: b, ds: ds}, nil
+}
+
+type recordingBatch struct {
+	datastore.Batch
+	ds   *recordingDatastore
+	keys []datastore.Key
+}
+
+func (b *recordingBatch) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	b.keys = append(b.keys, key)
+	return b.Batch.Put(ctx, key, value)
+}
+
+func (b *recordingBatch) Commit(ctx context.Context) error {
+	b.ds.commits = append(b.ds.commits, b.keys)
+	return b.Batch.Commit(ctx)
+}
+
+func newTestBlockstore() block.Blockstore {
+	return block.NewDsBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+}
+
+func newTestBucket(t *testing.T, options ...DsClockBucketOption) *DsClockBucket {
+	t.Helper()
+	dstore := dssync.MutexWrap(datastore.NewMapDatastore())
+	blocks := block.NewDsBlockstore(namespace.Wrap(dstore, datastore.NewKey("blocks")))
+	bk, err := NewDsClockBucket(blocks, namespace.Wrap(dstore, datastore.NewKey("shards")), options...)
+	require.NoError(t, err)
+	return bk
+}
+
+func TestDsClockBucket(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("put, get and delete", func(t *testing.T) {
+		bk := newTestBucket(t)
+		v := testutil.RandomLink(t)
+		require.NoError(t, bk.Put(ctx, "a", v))
+
+		got, err := bk.Get(ctx, "a")
+		require.NoError(t, err)
+		require.Equal(t, v, got)
+
+		require.NoError(t, bk.Del(ctx, "a"))
+		_, err = bk.Get(ctx, "a")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("deletes replaced shards", func(t *testing.T) {
+		bk := newTestBucket(t)
+		require.NoError(t, bk.Put(ctx, "a", testutil.RandomLink(t)))
+		root, err := bk.Root(ctx)
+		require.NoError(t, err)
+
+		require.NoError(t, bk.Put(ctx, "b", testutil.RandomLink(t)))
+		_, err = bk.Blocks().Get(ctx, root)
+		require.ErrorIs(t, err, block.ErrNotFound)
+	})
+
+	t.Run("keeps replaced shards with history", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		v := testutil.RandomLink(t)
+		require.NoError(t, bk.Put(ctx, "a", v))
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+
+		require.NoError(t, bk.Put(ctx, "a", testutil.RandomLink(t)))
+		past, err := bk.At(ctx, head)
+		require.NoError(t, err)
+		got, err := past.Get(ctx, "a")
+		require.NoError(t, err)
+		require.Equal(t, v, got)
+	})
+	t.Run("advances with many events in a single batch", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "k", 3)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		var events, blocks []block.Block
+		for b, err := range Export(ctx, bk.Blocks(), head, nil) {
+			require.NoError(t, err)
+			if _, err := decodeClockEvent(b); err == nil {
+				events = append(events, b)
+			} else {
+				blocks = append(blocks, b)
+			}
+		}
+		slices.Reverse(events)
+		require.Len(t, events, 3)
+
+		dstore := &recordingDatastore{Batching: dssync.MutexWrap(datastore.NewMapDatastore())}
+		replica, err := NewDsClockBucket(
+			block.NewDsBlockstore(namespace.Wrap(dstore, datastore.NewKey("blocks"))),
+			namespace.Wrap(dstore, datastore.NewKey("shards")),
+			WithHistory(),
+		)
+		require.NoError(t, err)
+		hd, err := replica.AdvanceMany(ctx, events, blocks)
+		require.NoError(t, err)
+		require.Equal(t, head, hd)
+
+		// the events, the shards and the head are written by a single commit
+		require.Empty(t, dstore.puts)
+		require.Len(t, dstore.commits, 1)
+		require.Len(t, dstore.commits[0], len(events)+len(blocks)+1)
+		require.Contains(t, dstore.commits[0], datastore.NewKey("shards").Child(headKey))
+		for _, evt := range events {
+			require.Contains(t, dstore.commits[0], datastore.NewKey("blocks").Child(block.Key(evt.Link())))
+		}
+		require.Equal(t, collectEntries(t, bk), collectEntries(t, replica))
+	})
+
+	t.Run("checks the head before advancing", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "k", 1)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		evt, err := bk.Blocks().Get(ctx, head[0])
+		require.NoError(t, err)
+
+		replica := newTestBucket(t, WithHistory())
+		putN(t, replica, "other", 1)
+		prev, err := replica.Head(ctx)
+		require.NoError(t, err)
+		errCheck := errors.New("check failed")
+		var checked []ipld.Link
+		_, err = replica.AdvanceChecked(ctx, []block.Block{evt}, nil, func(head []ipld.Link) error {
+			checked = head
+			return errCheck
+		})
+		require.ErrorIs(t, err, errCheck)
+		require.Equal(t, prev, checked)
+		hd, err := replica.Head(ctx)
+		require.NoError(t, err)
+		require.Equal(t, prev, hd)
+	})
+}
@@ -0,0 +1,14 @@
+package bucket
+
+import (
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/go-ucanto/did"
+)
+
+func NewDIDBucket(bucket Bucket[ipld.Link]) Bucket[did.DID] {
+	return NewIdentityBucket(bucket, func(id did.DID) ([]byte, error) {
+		return id.Bytes(), nil
+	}, func(b []byte) (did.DID, error) {
+		return did.Decode(b)
+	})
+}
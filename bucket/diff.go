@@ -0,0 +1,303 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	pail "github.com/storacha/go-pail"
+	"github.com/storacha/go-pail/shard"
+)
+
+// ChangeType is the type of change made to a key.
+type ChangeType string
+
+const (
+	ChangeAdded   ChangeType = "added"
+	ChangeRemoved ChangeType = "removed"
+	ChangeChanged ChangeType = "changed"
+)
+
+// Change is a difference in the value of a key between two pail roots.
+type Change struct {
+	Type ChangeType
+	Key  string
+	// Old is the value in the first root, nil if the key was added.
+	Old ipld.Link
+	// New is the value in the second root, nil if the key was removed.
+	New ipld.Link
+}
+
+// Diff iterates the keys whose values differ between pail roots a and b, in key
+// order. Shards that are linked from the same key prefix in both roots are
+// identical and are not traversed.
+func Diff(ctx context.Context, blocks block.Fetcher, a, b ipld.Link) iter.Seq2[Change, error] {
+	return func(yield func(Change, error) bool) {
+		if a.String() == b.String() {
+			return
+		}
+		// the empty pail root may not be stored, since empty buckets have no
+		// events
+		empty, err := pail.New()
+		if err != nil {
+			yield(Change{}, fmt.Errorf("creating pail: %w", err))
+			return
+		}
+		shards := shard.NewFetcher(block.NewTieredBlockFetcher(mapFetcher{empty.Link(): empty}, blocks))
+
+		ac, err := newDiffCursor(ctx, shards, a)
+		if err != nil {
+			yield(Change{}, err)
+			return
+		}
+		bc, err := newDiffCursor(ctx, shards, b)
+		if err != nil {
+			yield(Change{}, err)
+			return
+		}
+
+		for {
+			ai, aok := ac.peek()
+			bi, bok := bc.peek()
+			if !aok && !bok {
+				return
+			}
+
+			var change *Change
+			switch {
+			case !bok:
+				err = ac.next(func(i diffItem) { change = &Change{ChangeRemoved, i.key, i.value, nil} })
+			case !aok:
+				err = bc.next(func(i diffItem) { change = &Change{ChangeAdded, i.key, nil, i.value} })
+			case ai.shard != nil && bi.shard != nil && ai.key == bi.key:
+				if ai.shard.String() == bi.shard.String() {
+					ac.skip()
+					bc.skip()
+					continue
+				}
+				err = ac.expand()
+				if err == nil {
+					err = bc.expand()
+				}
+			case ai.shard != nil && bi.key > ai.key:
+				// b's next key may be in a's shard
+				err = ac.expand()
+			case bi.shard != nil && ai.key > bi.key:
+				err = bc.expand()
+			case ai.shard != nil:
+				// b's key is before everything in a's shard
+				err = bc.next(func(i diffItem) { change = &Change{ChangeAdded, i.key, nil, i.value} })
+			case bi.shard != nil:
+				err = ac.next(func(i diffItem) { change = &Change{ChangeRemoved, i.key, i.value, nil} })
+			case ai.key < bi.key:
+				err = ac.next(func(i diffItem) { change = &Change{ChangeRemoved, i.key, i.value, nil} })
+			case bi.key < ai.key:
+				err = bc.next(func(i diffItem) { change = &Change{ChangeAdded, i.key, nil, i.value} })
+			default:
+				ac.skip()
+				bc.skip()
+				if ai.value.String() != bi.value.String() {
+					change = &Change{ChangeChanged, ai.key, ai.value, bi.value}
+				}
+			}
+			if err != nil {
+				yield(Change{}, err)
+				return
+			}
+			if change != nil && !yield(*change, nil) {
+				return
+			}
+		}
+	}
+}
+
+// diffItem is a value or a shard at a key in a pail. Only one of value or
+// shard is set.
+type diffItem struct {
+	key   string
+	value ipld.Link
+	shard ipld.Link
+}
+
+// diffCursor iterates the items of a pail in key order, expanding shards on
+// demand.
+type diffCursor struct {
+	ctx    context.Context
+	shards *shard.Fetcher
+	// stack of items left to visit in each shard being traversed, the top is
+	// the deepest shard
+	stack [][]diffItem
+}
+
+func newDiffCursor(ctx context.Context, shards *shard.Fetcher, root ipld.Link) (*diffCursor, error) {
+	rs, err := shards.GetRoot(ctx, root)
+	if err != nil {
+		return nil, fmt.Errorf("getting root: %s: %w", root, err)
+	}
+	c := &diffCursor{ctx: ctx, shards: shards}
+	c.push(rs.Value())
+	return c, nil
+}
+
+// push adds the items of a shard to the top of the stack. An entry with both a
+// value and a shard is a value at its key followed by a shard of longer keys.
+func (c *diffCursor) push(s shard.Shard) {
+	var items []diffItem
+	for _, e := range s.Entries() {
+		key := s.Prefix() + e.Key()
+		if e.Value().Value() != nil {
+			items = append(items, diffItem{key: key, value: e.Value().Value()})
+		}
+		if e.Value().Shard() != nil {
+			items = append(items, diffItem{key: key, shard: e.Value().Shard()})
+		}
+	}
+	c.stack = append(c.stack, items)
+}
+
+// peek returns the next item without consuming it.
+func (c *diffCursor) peek() (diffItem, bool) {
+	for len(c.stack) > 0 {
+		top := c.stack[len(c.stack)-1]
+		if len(top) > 0 {
+			return top[0], true
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+	return diffItem{}, false
+}
+
+// skip consumes the next item, without expanding it if it is a shard.
+func (c *diffCursor) skip() {
+	if _, ok := c.peek(); ok {
+		c.stack[len(c.stack)-1] = c.stack[len(c.stack)-1][1:]
+	}
+}
+
+// expand replaces the next item, which must be a shard, with its items.
+func (c *diffCursor) expand() error {
+	item, _ := c.peek()
+	c.skip()
+	s, err := c.shards.Get(c.ctx, item.shard)
+	if err != nil {
+		return fmt.Errorf("getting shard: %s: %w", item.shard, err)
+	}
+	if !strings.HasPrefix(s.Value().Prefix(), item.key) {
+		return fmt.Errorf("shard %s has prefix %q, not under %q", item.shard, s.Value().Prefix(), item.key)
+	}
+	c.push(s.Value())
+	return nil
+}
+
+// next consumes the next value, expanding shards until one is found, and
+// passes it to the visit function.
+func (c *diffCursor) next(visit func(diffItem)) error {
+	for {
+		item, ok := c.peek()
+		if !ok {
+			return nil
+		}
+		if item.shard == nil {
+			c.skip()
+			visit(item)
+			return nil
+		}
+		err := c.expand()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// HeadRoot returns the pail root of the bucket at the passed head. The root of
+// an empty head is the root of an empty pail.
+func HeadRoot(ctx context.Context, blocks block.Fetcher, head []ipld.Link) (ipld.Link, error) {
+	if len(head) == 0 {
+		empty, err := pail.New()
+		if err != nil {
+			return nil, fmt.Errorf("creating pail: %w", err)
+		}
+		return empty.Link(), nil
+	}
+	root, _, err := clockRoot(ctx, blocks, head)
+	if err != nil {
+		return nil, fmt.Errorf("getting root: %w", err)
+	}
+	return root, nil
+}
+
+// ResolveRoot returns the pail root for the passed links, which are either the
+// events of a head, or a single pail root.
+func ResolveRoot(ctx context.Context, blocks block.Fetcher, links []ipld.Link) (ipld.Link, error) {
+	events := newEventFetcher(blocks)
+	for _, l := range links {
+		_, err := events.Get(ctx, l)
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, block.ErrNotFound) {
+			return nil, fmt.Errorf("block not found: %s", l)
+		}
+		if len(links) > 1 {
+			return nil, fmt.Errorf("not an event: %s", l)
+		}
+		_, err = shard.NewFetcher(blocks).GetRoot(ctx, l)
+		if err != nil {
+			return nil, fmt.Errorf("not an event or a pail root: %s", l)
+		}
+		return l, nil
+	}
+	return HeadRoot(ctx, blocks, links)
+}
+
+// Parents returns the parents of the events of the passed head, that is, the
+// head before the last change. Parents that are ancestors of other parents are
+// omitted.
+func Parents(ctx context.Context, blocks block.Fetcher, head []ipld.Link) ([]ipld.Link, error) {
+	events := newEventFetcher(blocks)
+	var parents []ipld.Link
+	for _, l := range head {
+		evt, err := events.Get(ctx, l)
+		if err != nil {
+			return nil, fmt.Errorf("getting event: %s: %w", l, err)
+		}
+		for _, p := range evt.Value().Parents() {
+			if !slices.Contains(parents, p) {
+				parents = append(parents, p)
+			}
+		}
+	}
+	if len(parents) < 2 {
+		return parents, nil
+	}
+	var redundant map[ipld.Link]struct{}
+	for _, p := range parents {
+		evt, err := events.Get(ctx, p)
+		if err != nil {
+			return nil, fmt.Errorf("getting event: %s: %w", p, err)
+		}
+		anc, err := ancestors(ctx, events, evt.Value().Parents())
+		if err != nil {
+			return nil, err
+		}
+		if redundant == nil {
+			redundant = anc
+		} else {
+			for a := range anc {
+				redundant[a] = struct{}{}
+			}
+		}
+	}
+	var minimal []ipld.Link
+	for _, p := range parents {
+		if _, ok := redundant[p]; !ok {
+			minimal = append(minimal, p)
+		}
+	}
+	return minimal, nil
+}
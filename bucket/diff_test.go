@@ -0,0 +1,94 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func collectChanges(t *testing.T, blocks block.Fetcher, a, b ipld.Link) []Change {
+	t.Helper()
+	var changes []Change
+	for change, err := range Diff(context.Background(), blocks, a, b) {
+		require.NoError(t, err)
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("identical roots", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "k", 20)
+		root, err := bk.Root(ctx)
+		require.NoError(t, err)
+
+		f := &countingFetcher{bk.Blocks(), map[ipld.Link]struct{}{}}
+		require.Empty(t, collectChanges(t, f, root, root))
+		require.Empty(t, f.fetched)
+	})
+
+	t.Run("disjoint roots", func(t *testing.T) {
+		a, b := newTestBucket(t), newTestBucket(t)
+		var want []Change
+		for i := range 3 {
+			k, v := fmt.Sprintf("a%d", i), testutil.RandomLink(t)
+			require.NoError(t, a.Put(ctx, k, v))
+			want = append(want, Change{ChangeRemoved, k, v, nil})
+		}
+		for i := range 3 {
+			k, v := fmt.Sprintf("b%d", i), testutil.RandomLink(t)
+			require.NoError(t, b.Put(ctx, k, v))
+			want = append(want, Change{ChangeAdded, k, nil, v})
+		}
+		aroot, err := a.Root(ctx)
+		require.NoError(t, err)
+		broot, err := b.Root(ctx)
+		require.NoError(t, err)
+
+		blocks := block.NewTieredBlockFetcher(a.Blocks(), b.Blocks())
+		require.Equal(t, want, collectChanges(t, blocks, aroot, broot))
+	})
+
+	t.Run("changes between heads", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		for i := range 200 {
+			require.NoError(t, bk.Put(ctx, fmt.Sprintf("dir%d/file%d", i%4, i), testutil.RandomLink(t)))
+		}
+		before, err := bk.Head(ctx)
+		require.NoError(t, err)
+
+		old, err := bk.Get(ctx, "dir1/file1")
+		require.NoError(t, err)
+		removed, err := bk.Get(ctx, "dir2/file2")
+		require.NoError(t, err)
+		added, changed := testutil.RandomLink(t), testutil.RandomLink(t)
+		require.NoError(t, bk.Put(ctx, "dir1/file1", changed))
+		require.NoError(t, bk.Del(ctx, "dir2/file2"))
+		require.NoError(t, bk.Put(ctx, "dir3/new", added))
+		after, err := bk.Head(ctx)
+		require.NoError(t, err)
+
+		a, err := ResolveRoot(ctx, bk.Blocks(), before)
+		require.NoError(t, err)
+		b, err := ResolveRoot(ctx, bk.Blocks(), after)
+		require.NoError(t, err)
+		require.Equal(t, []Change{
+			{ChangeChanged, "dir1/file1", old, changed},
+			{ChangeRemoved, "dir2/file2", removed, nil},
+			{ChangeAdded, "dir3/new", nil, added},
+		}, collectChanges(t, bk.Blocks(), a, b))
+
+		// a pail root resolves to itself
+		root, err := ResolveRoot(ctx, bk.Blocks(), []ipld.Link{b})
+		require.NoError(t, err)
+		require.Equal(t, b, root)
+	})
+}
@@ -0,0 +1,175 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/go-pail/clock/event"
+	"github.com/storacha/go-pail/crdt/operation"
+	"github.com/storacha/go-pail/ipld/node"
+)
+
+// operationBinder binds the data of merkle clock events to pail operations.
+var operationBinder = node.BinderFunc[operation.Operation](operation.Bind)
+
+// operationUnbinder encodes pail operations as the data of merkle clock events.
+var operationUnbinder = node.UnbinderFunc[operation.Operation](operation.Unbind)
+
+// newEventFetcher creates a fetcher for merkle clock events whose data is a
+// pail operation.
+func newEventFetcher(blocks block.Fetcher) *event.Fetcher[operation.Operation] {
+	return event.NewFetcher(blocks, operationBinder)
+}
+
+// VerifyEvents checks that the events reachable from the passed head, and the
+// pail shards they refer to, are available locally or among the received
+// blocks, and returns the received blocks that are needed. A block available
+// locally is assumed to be complete, since a replica only stores a block along
+// with the DAG below it, so only received blocks are traversed and checked
+// against their links. Events in base (typically the current head of the
+// replica) are not traversed either. Events in the past of a checkpoint are not
+// needed, so they may be missing.
+func VerifyEvents(ctx context.Context, local block.Fetcher, received block.Fetcher, head []ipld.Link, base []ipld.Link) ([]block.Block, error) {
+	var used []block.Block
+	// get returns the received block for the link, or nil if it is available
+	// locally
+	get := func(l ipld.Link) (block.Block, error) {
+		_, err := local.Get(ctx, l)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, block.ErrNotFound) {
+			return nil, fmt.Errorf("getting local block: %s: %w", l, err)
+		}
+		b, err := received.Get(ctx, l)
+		if err != nil {
+			return nil, err
+		}
+		b, err = block.Verify(l, b.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		used = append(used, b)
+		return b, nil
+	}
+
+	found, err := findCheckpoints(ctx, local, base)
+	if err != nil {
+		return nil, fmt.Errorf("finding checkpoints: %w", err)
+	}
+	w := newClockWalk(block.NewTieredBlockFetcher(local, received), found)
+	var roots []ipld.Link
+	visit := func(l ipld.Link) ([]ipld.Link, error) {
+		if slices.Contains(base, l) {
+			return nil, nil
+		}
+		b, err := get(l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				return nil, w.missing(l)
+			}
+			return nil, err
+		}
+		if b == nil {
+			return nil, nil
+		}
+		evt, err := decodeClockEvent(b)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, evt.roots()...)
+		return w.next(ctx, l, evt)
+	}
+	err = walk(head, visit)
+	if err != nil {
+		return nil, err
+	}
+	// the events behind checkpoints concurrent with the base checkpoint are
+	// needed to determine the root
+	behind, err := w.behind(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = walk(behind, visit)
+	if err != nil {
+		return nil, err
+	}
+	err = w.check(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = walk(roots, func(l ipld.Link) ([]ipld.Link, error) {
+		b, err := get(l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				return nil, fmt.Errorf("missing shard: %s", l)
+			}
+			return nil, fmt.Errorf("getting shard: %s: %w", l, err)
+		}
+		if b == nil {
+			return nil, nil
+		}
+		return shardLinks(b)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return used, nil
+}
+
+// AdvanceHead advances the replica with every event reachable from the passed
+// head that is not in the past of its current head, ordered so that every event
+// follows its parents, see [Replica.AdvanceMany]. The events, and the shards
+// they refer to, are stored by the replica or among the passed blocks, which
+// are written in the same batch as the events, see [VerifyEvents]. Events that
+// are not available, such as those in the past of a checkpoint, are left out.
+func AdvanceHead(ctx context.Context, replica Replica, head []ipld.Link, blocks []block.Block) ([]ipld.Link, error) {
+	base, err := replica.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting head: %w", err)
+	}
+	received := block.NewMapBlockstore()
+	for _, b := range blocks {
+		_ = received.Put(ctx, b)
+	}
+	fetcher := block.NewTieredBlockFetcher(received, replica.Blocks())
+
+	_, added, err := divergent(ctx, newEventFetcher(fetcher), base, head)
+	if err != nil {
+		return nil, fmt.Errorf("finding new events: %w", err)
+	}
+	evts := map[ipld.Link]clockEvent{}
+	eblocks := map[ipld.Link]block.Block{}
+	for l := range added {
+		b, err := fetcher.Get(ctx, l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("getting event: %s: %w", l, err)
+		}
+		evt, err := decodeClockEvent(b)
+		if err != nil {
+			return nil, err
+		}
+		evts[l] = evt
+		eblocks[l] = b
+	}
+	if len(evts) == 0 {
+		return base, nil
+	}
+
+	var events []block.Block
+	for _, l := range sortLinks(evts) {
+		events = append(events, eblocks[l])
+	}
+	rest := slices.DeleteFunc(slices.Clone(blocks), func(b block.Block) bool {
+		_, ok := eblocks[b.Link()]
+		return ok
+	})
+	return replica.AdvanceMany(ctx, events, rest)
+}
@@ -0,0 +1,173 @@
+package bucket
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// exportTo copies the blocks needed to advance a replica at since to head into
+// a new blockstore.
+func exportTo(t *testing.T, blocks block.Fetcher, head []ipld.Link, since []ipld.Link) block.Blockstore {
+	t.Helper()
+	ctx := context.Background()
+	bs := newTestBlockstore()
+	for b, err := range Export(ctx, blocks, head, since) {
+		require.NoError(t, err)
+		require.NoError(t, bs.Put(ctx, b))
+	}
+	return bs
+}
+
+func TestVerifyEvents(t *testing.T) {
+	ctx := context.Background()
+
+	// setup returns the blocks of a replica at base, and the blocks received to
+	// advance it to head, where head has one more write than base
+	setup := func(t *testing.T) (local block.Blockstore, received block.Blockstore, head []ipld.Link, base []ipld.Link) {
+		bk := newTestBucket(t, WithHistory())
+		for _, k := range []string{"a", "b", "c"} {
+			require.NoError(t, bk.Put(ctx, k, testutil.RandomLink(t)))
+		}
+		base, err := bk.Head(ctx)
+		require.NoError(t, err)
+		local = exportTo(t, bk.Blocks(), base, nil)
+
+		require.NoError(t, bk.Put(ctx, "d", testutil.RandomLink(t)))
+		head, err = bk.Head(ctx)
+		require.NoError(t, err)
+		received = exportTo(t, bk.Blocks(), head, base)
+		return local, received, head, base
+	}
+
+	t.Run("uses only received blocks", func(t *testing.T) {
+		local, received, head, base := setup(t)
+		used, err := VerifyEvents(ctx, local, received, head, base)
+		require.NoError(t, err)
+		for _, b := range used {
+			_, err := received.Get(ctx, b.Link())
+			require.NoError(t, err)
+		}
+		evt, err := received.Get(ctx, head[0])
+		require.NoError(t, err)
+		require.Contains(t, used, evt)
+	})
+
+	t.Run("does not traverse local blocks", func(t *testing.T) {
+		local, received, head, base := setup(t)
+		// the parent of the base event is not needed, it is only reachable
+		// through a block the replica already has
+		evt, err := getClockEvent(ctx, local, base[0])
+		require.NoError(t, err)
+		for _, p := range evt.Parents() {
+			require.NoError(t, local.Del(ctx, p))
+		}
+		_, err = VerifyEvents(ctx, local, received, head, nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("missing shard", func(t *testing.T) {
+		local, received, head, base := setup(t)
+		evt, err := getClockEvent(ctx, received, head[0])
+		require.NoError(t, err)
+		require.NoError(t, received.Del(ctx, evt.Data().Root()))
+		_, err = VerifyEvents(ctx, local, received, head, base)
+		require.ErrorContains(t, err, "missing shard")
+	})
+
+	t.Run("missing event", func(t *testing.T) {
+		local, received, head, base := setup(t)
+		_, err := VerifyEvents(ctx, newTestBlockstore(), received, head, nil)
+		require.ErrorContains(t, err, "missing event")
+		_, err = VerifyEvents(ctx, local, newTestBlockstore(), head, base)
+		require.ErrorContains(t, err, "missing event")
+	})
+
+	t.Run("tampered block", func(t *testing.T) {
+		local, received, head, base := setup(t)
+		evt, err := getClockEvent(ctx, received, head[0])
+		require.NoError(t, err)
+		root := evt.Data().Root()
+		b, err := received.Get(ctx, root)
+		require.NoError(t, err)
+		tampered := append([]byte{}, b.Bytes()...)
+		tampered[len(tampered)-1] ^= 0xff
+		require.NoError(t, received.Put(ctx, block.New(root, tampered)))
+		_, err = VerifyEvents(ctx, local, received, head, base)
+		require.Error(t, err)
+	})
+}
+
+// recordingReplica records the events the bucket is advanced with.
+type recordingReplica struct {
+	*DsClockBucket
+	events []ipld.Link
+}
+
+func (r *recordingReplica) AdvanceMany(ctx context.Context, events []block.Block, blocks []block.Block) ([]ipld.Link, error) {
+	for _, evt := range events {
+		r.events = append(r.events, evt.Link())
+	}
+	return r.DsClockBucket.AdvanceMany(ctx, events, blocks)
+}
+
+func TestAdvanceHead(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("advances with every new event in order", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "old", 2)
+		since, err := bk.Head(ctx)
+		require.NoError(t, err)
+		replica := &recordingReplica{DsClockBucket: newTestBucket(t, WithHistory())}
+		syncTo(t, bk, replica.DsClockBucket)
+		evts := putHeads(t, bk, "k", 3)
+
+		var blocks []block.Block
+		for b, err := range Export(ctx, bk.Blocks(), evts[2:], since) {
+			require.NoError(t, err)
+			blocks = append(blocks, b)
+		}
+		hd, err := AdvanceHead(ctx, replica, evts[2:], blocks)
+		require.NoError(t, err)
+		require.Equal(t, evts[2:], hd)
+		require.Equal(t, evts, replica.events)
+		require.Equal(t, collectEntries(t, bk), collectEntries(t, replica))
+	})
+
+	t.Run("concurrent events follow their parents", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		head := forked(t, bk, 2)
+		replica := &recordingReplica{DsClockBucket: newTestBucket(t, WithHistory())}
+		var blocks []block.Block
+		for b, err := range Export(ctx, bk.Blocks(), head, nil) {
+			require.NoError(t, err)
+			blocks = append(blocks, b)
+		}
+		hd, err := AdvanceHead(ctx, replica, head, blocks)
+		require.NoError(t, err)
+		require.ElementsMatch(t, head, hd)
+		require.Len(t, replica.events, 4)
+		for i, l := range replica.events {
+			evt, err := getClockEvent(ctx, replica.Blocks(), l)
+			require.NoError(t, err)
+			for _, p := range evt.Parents() {
+				require.Contains(t, replica.events[:i], p)
+			}
+		}
+	})
+
+	t.Run("nothing new", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		evts := putHeads(t, bk, "k", 2)
+		replica := &recordingReplica{DsClockBucket: bk}
+		hd, err := AdvanceHead(ctx, replica, evts[:1], nil)
+		require.NoError(t, err)
+		require.Equal(t, evts[1:], hd)
+		require.Empty(t, replica.events)
+	})
+}
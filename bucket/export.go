@@ -0,0 +1,138 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+)
+
+// Export iterates the events reachable from head that are not reachable from
+// since, followed by the pail shards they refer to that are not referred to by
+// the since events. Pass an empty since to export the entire history.
+//
+// A replica that has the since events can be advanced with head using just the
+// exported blocks, see [Import].
+func Export(ctx context.Context, blocks block.Fetcher, head []ipld.Link, since []ipld.Link) iter.Seq2[block.Block, error] {
+	return func(yield func(block.Block, error) bool) {
+		// the events and shards the importer is expected to already have
+		known := map[ipld.Link]struct{}{}
+		var knownRoots []ipld.Link
+		err := walk(since, func(l ipld.Link) ([]ipld.Link, error) {
+			evt, err := getClockEvent(ctx, blocks, l)
+			if err != nil {
+				if errors.Is(err, block.ErrNotFound) {
+					return nil, nil
+				}
+				return nil, err
+			}
+			known[l] = struct{}{}
+			knownRoots = append(knownRoots, evt.roots()...)
+			if evt.Past != nil {
+				return nil, nil
+			}
+			return evt.Parents(), nil
+		})
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		err = walk(knownRoots, func(l ipld.Link) ([]ipld.Link, error) {
+			known[l] = struct{}{}
+			b, err := blocks.Get(ctx, l)
+			if err != nil {
+				return nil, fmt.Errorf("getting shard: %s: %w", l, err)
+			}
+			return shardLinks(b)
+		})
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		// errStop signals that the consumer stopped iterating
+		errStop := errors.New("stop")
+		// events in the past of a checkpoint are not exported
+		w := newClockWalk(blocks, nil)
+		var roots []ipld.Link
+		visit := func(l ipld.Link) ([]ipld.Link, error) {
+			if _, ok := known[l]; ok {
+				return nil, nil
+			}
+			b, err := blocks.Get(ctx, l)
+			if err != nil {
+				if errors.Is(err, block.ErrNotFound) {
+					return nil, w.missing(l)
+				}
+				return nil, fmt.Errorf("getting event: %s: %w", l, err)
+			}
+			evt, err := decodeClockEvent(b)
+			if err != nil {
+				return nil, err
+			}
+			if !yield(b, nil) {
+				return nil, errStop
+			}
+			roots = append(roots, evt.roots()...)
+			return w.next(ctx, l, evt)
+		}
+		err = walk(head, visit)
+		if err == nil {
+			var behind []ipld.Link
+			behind, err = w.behind(ctx)
+			if err == nil {
+				err = walk(behind, visit)
+			}
+		}
+		if err == nil {
+			err = w.check(ctx)
+		}
+		if err == nil {
+			err = walk(roots, func(l ipld.Link) ([]ipld.Link, error) {
+				if _, ok := known[l]; ok {
+					return nil, nil
+				}
+				b, err := blocks.Get(ctx, l)
+				if err != nil {
+					return nil, fmt.Errorf("getting shard: %s: %w", l, err)
+				}
+				if !yield(b, nil) {
+					return nil, errStop
+				}
+				return shardLinks(b)
+			})
+		}
+		if err != nil && !errors.Is(err, errStop) {
+			yield(nil, err)
+		}
+	}
+}
+
+// Import stores the blocks needed to advance the replica with the passed head
+// events, taking them from the passed fetcher, and then advances the replica.
+// Events and shards the replica already has are assumed to be complete and are
+// not traversed, see [VerifyEvents]. It returns the new head of the replica.
+func Import(ctx context.Context, replica Replica, head []ipld.Link, blocks block.Fetcher) ([]ipld.Link, error) {
+	local := replica.Blocks()
+	// events in the past of a checkpoint are not exported, and may have been
+	// pruned locally
+	hd, err := replica.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting head: %w", err)
+	}
+	used, err := VerifyEvents(ctx, local, blocks, head, hd)
+	if err != nil {
+		return nil, err
+	}
+
+	// the blocks are written in the same batch the clock is advanced with
+	log.Debugf("importing %d blocks", len(used))
+	hd, err = AdvanceHead(ctx, replica, head, used)
+	if err != nil {
+		return nil, fmt.Errorf("advancing clock: %w", err)
+	}
+	return hd, nil
+}
@@ -0,0 +1,66 @@
+package bucket
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+
+	src := newTestBucket(t, WithHistory())
+	values := map[string]ipld.Link{}
+	for _, k := range []string{"a", "b", "c"} {
+		values[k] = testutil.RandomLink(t)
+		require.NoError(t, src.Put(ctx, k, values[k]))
+	}
+	since, err := src.Head(ctx)
+	require.NoError(t, err)
+
+	dst := newTestBucket(t, WithHistory())
+
+	t.Run("entire history", func(t *testing.T) {
+		hd, err := Import(ctx, dst, since, exportTo(t, src.Blocks(), since, nil))
+		require.NoError(t, err)
+		require.Equal(t, since, hd)
+		for k, v := range values {
+			got, err := dst.Get(ctx, k)
+			require.NoError(t, err)
+			require.Equal(t, v, got)
+		}
+	})
+
+	t.Run("incremental", func(t *testing.T) {
+		values["d"] = testutil.RandomLink(t)
+		require.NoError(t, src.Put(ctx, "d", values["d"]))
+		require.NoError(t, src.Del(ctx, "a"))
+		head, err := src.Head(ctx)
+		require.NoError(t, err)
+
+		blocks := exportTo(t, src.Blocks(), head, since)
+		_, err = blocks.Get(ctx, since[0])
+		require.ErrorIs(t, err, block.ErrNotFound)
+
+		hd, err := Import(ctx, dst, head, blocks)
+		require.NoError(t, err)
+		require.Equal(t, head, hd)
+		got, err := dst.Get(ctx, "d")
+		require.NoError(t, err)
+		require.Equal(t, values["d"], got)
+		_, err = dst.Get(ctx, "a")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("missing blocks", func(t *testing.T) {
+		require.NoError(t, src.Put(ctx, "e", testutil.RandomLink(t)))
+		head, err := src.Head(ctx)
+		require.NoError(t, err)
+		_, err = Import(ctx, newTestBucket(t, WithHistory()), head, exportTo(t, src.Blocks(), head, since))
+		require.Error(t, err)
+	})
+}
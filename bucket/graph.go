@@ -0,0 +1,190 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+)
+
+// GraphFormat is a text format the merkle clock event DAG can be rendered in.
+type GraphFormat string
+
+const (
+	// GraphDOT renders a Graphviz digraph.
+	GraphDOT GraphFormat = "dot"
+	// GraphMermaid renders a Mermaid flowchart.
+	GraphMermaid GraphFormat = "mermaid"
+)
+
+// graphEvent is an event to render, along with the heads pointing at it.
+type graphEvent struct {
+	Event
+	// Head is set if the event is in the local head.
+	Head bool
+	// Missing is set if the event is not available locally, it was pruned or
+	// not fetched.
+	Missing bool
+}
+
+// Graph renders the merkle clock event DAG reachable from the head and from
+// the passed remote-tracking heads, keyed by remote name, one line at a time.
+// Events are labelled with their operation, events in the head are
+// highlighted and remotes point at their heads. Events that are not available
+// locally are drawn dashed, without their ancestors.
+func Graph(ctx context.Context, blocks block.Fetcher, head []ipld.Link, remotes map[string][]ipld.Link, format GraphFormat) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		var render func(evts []graphEvent, names []string, remotes map[string][]ipld.Link) []string
+		switch format {
+		case GraphDOT:
+			render = renderDOT
+		case GraphMermaid:
+			render = renderMermaid
+		default:
+			yield("", fmt.Errorf("unknown graph format: %s", format))
+			return
+		}
+
+		heads := slices.Clone(head)
+		names := slices.Sorted(maps.Keys(remotes))
+		for _, name := range names {
+			for _, l := range remotes[name] {
+				if !slices.Contains(heads, l) {
+					heads = append(heads, l)
+				}
+			}
+		}
+
+		var evts []graphEvent
+		found := map[ipld.Link]struct{}{}
+		for evt, err := range History(ctx, blocks, heads) {
+			if err != nil {
+				yield("", err)
+				return
+			}
+			found[evt.Link] = struct{}{}
+			evts = append(evts, graphEvent{Event: evt, Head: slices.Contains(head, evt.Link)})
+		}
+		// events that are referenced but not available
+		var missing []graphEvent
+		refs := slices.Clone(heads)
+		for _, evt := range evts {
+			refs = append(refs, evt.Parents...)
+		}
+		for _, l := range refs {
+			if _, ok := found[l]; ok {
+				continue
+			}
+			found[l] = struct{}{}
+			missing = append(missing, graphEvent{Event: Event{Link: l}, Head: slices.Contains(head, l), Missing: true})
+		}
+
+		for _, line := range render(append(evts, missing...), names, remotes) {
+			if !yield(line, nil) {
+				return
+			}
+		}
+	}
+}
+
+func renderDOT(evts []graphEvent, names []string, remotes map[string][]ipld.Link) []string {
+	lines := []string{
+		"digraph clock {",
+		"  node [shape=box fontname=Courier];",
+	}
+	for _, evt := range evts {
+		attrs := fmt.Sprintf("label=%s", dotQuote(graphLabel(evt, "\n")))
+		if evt.Missing {
+			attrs += " style=dashed"
+		} else if evt.Head {
+			attrs += ` style="bold,filled" fillcolor=lightblue`
+		}
+		lines = append(lines, fmt.Sprintf("  %s [%s];", dotQuote(evt.Link.String()), attrs))
+	}
+	for _, evt := range evts {
+		for _, p := range evt.Parents {
+			lines = append(lines, fmt.Sprintf("  %s -> %s;", dotQuote(evt.Link.String()), dotQuote(p.String())))
+		}
+	}
+	for _, name := range names {
+		id := dotQuote("remote/" + name)
+		lines = append(lines, fmt.Sprintf("  %s [label=%s shape=cds style=filled fillcolor=lightyellow];", id, dotQuote(name)))
+		for _, l := range remotes[name] {
+			lines = append(lines, fmt.Sprintf("  %s -> %s [style=dashed];", id, dotQuote(l.String())))
+		}
+	}
+	return append(lines, "}")
+}
+
+func renderMermaid(evts []graphEvent, names []string, remotes map[string][]ipld.Link) []string {
+	lines := []string{"flowchart TB"}
+	var heads, missing []string
+	for _, evt := range evts {
+		id := evt.Link.String()
+		lines = append(lines, fmt.Sprintf("  %s[%s]", id, mermaidQuote(graphLabel(evt, "<br/>"))))
+		if evt.Missing {
+			missing = append(missing, id)
+		} else if evt.Head {
+			heads = append(heads, id)
+		}
+	}
+	for _, evt := range evts {
+		for _, p := range evt.Parents {
+			lines = append(lines, fmt.Sprintf("  %s --> %s", evt.Link, p))
+		}
+	}
+	for i, name := range names {
+		id := fmt.Sprintf("remote%d", i)
+		lines = append(lines, fmt.Sprintf("  %s{{%s}}", id, mermaidQuote(name)))
+		for _, l := range remotes[name] {
+			lines = append(lines, fmt.Sprintf("  %s -.-> %s", id, l))
+		}
+	}
+	lines = append(lines,
+		"  classDef head fill:#add8e6,stroke-width:3px",
+		"  classDef missing stroke-dasharray:5 5",
+	)
+	if len(heads) > 0 {
+		lines = append(lines, fmt.Sprintf("  class %s head", strings.Join(heads, ",")))
+	}
+	if len(missing) > 0 {
+		lines = append(lines, fmt.Sprintf("  class %s missing", strings.Join(missing, ",")))
+	}
+	return lines
+}
+
+// graphLabel is the label of an event: its shortened CID and operation,
+// separated by sep.
+func graphLabel(evt graphEvent, sep string) string {
+	s := evt.Link.String()
+	if len(s) > 16 {
+		s = s[:4] + ".." + s[len(s)-8:]
+	}
+	switch {
+	case evt.Missing:
+		return s + sep + "(not available)"
+	case evt.Type == TypeCheckpoint:
+		return s + sep + evt.Type
+	case evt.Type == TypeBatch:
+		return fmt.Sprintf("%s%s%s of %d", s, sep, evt.Type, len(evt.Ops))
+	default:
+		return s + sep + evt.Type + " " + evt.Key
+	}
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+func mermaidQuote(s string) string {
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	return `"` + s + `"`
+}
@@ -0,0 +1,225 @@
+package bucket
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"time"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/go-ucanto/did"
+)
+
+// Event is a decoded merkle clock event of a bucket.
+type Event struct {
+	// Link is the CID of the event.
+	Link ipld.Link
+	// Parents are the events that preceded the event.
+	Parents []ipld.Link
+	// Type is the type of the operation, "put", "del", or one of [TypeBatch]
+	// and [TypeCheckpoint].
+	Type string
+	// Key is the key that was operated on, empty for a batch.
+	Key string
+	// Value is the value that was put, nil for a "del".
+	Value ipld.Link
+	// Ops are the changes made by a batch event, nil for other events.
+	Ops []BatchOp
+	// Root is the root shard of the pail after the operation, as seen by the
+	// author of the event.
+	Root ipld.Link
+	// Author is the DID of the writer that signed the event, once verified.
+	// It is undefined for events written before events were signed, when the
+	// history is walked without a verifier, or when the event could not be
+	// verified.
+	Author did.DID
+	// AuthorErr is why the time or authorization of the event could not be
+	// read or verified, nil if it was verified or if the event is not signed.
+	AuthorErr error
+	// Time is when the event was written according to its author, zero if it
+	// was not recorded.
+	Time time.Time
+}
+
+// Changes returns the changes made by the event: the put or del of its key, or
+// the changes of a batch event. A checkpoint event makes none.
+func (e Event) Changes() []BatchOp {
+	switch e.Type {
+	case TypeCheckpoint:
+		return nil
+	case TypeBatch:
+		return e.Ops
+	default:
+		return []BatchOp{{Key: e.Key, Value: e.Value}}
+	}
+}
+
+// History iterates the events reachable from the head, newest first. The
+// history is walked back from the head as events are yielded, so only the
+// events yielded and the events next in line are fetched. An event is only
+// yielded after every event found so far that follows it. Of the events next
+// in line, the one written last according to its author is yielded first, so
+// events are in topological order as long as the times recorded by their
+// authors, to the millisecond, follow the order they were written in. Events
+// with the same time, or without one, are yielded in the order they are found
+// walking back from the head, after those with a later time.
+// Events that are not available locally are skipped, along with their
+// ancestors. Authors are only set if the history is walked with a verifier,
+// see [WithAuthors].
+func History(ctx context.Context, blocks block.Fetcher, head []ipld.Link, options ...HistoryOption) iter.Seq2[Event, error] {
+	var cfg historyConfig
+	for _, opt := range options {
+		opt(&cfg)
+	}
+	return func(yield func(Event, error) bool) {
+		fetched := map[ipld.Link]Event{}
+		seen := map[ipld.Link]struct{}{}
+		yielded := map[ipld.Link]struct{}{}
+		// following counts the fetched events that follow each event and have
+		// not been yielded yet
+		following := map[ipld.Link]int{}
+		queue := &historyQueue{}
+		fetch := func(l ipld.Link) (bool, error) {
+			if _, ok := seen[l]; ok {
+				_, ok := fetched[l]
+				return ok, nil
+			}
+			seen[l] = struct{}{}
+			evt, err := readEvent(ctx, blocks, l, cfg.verify)
+			if err != nil {
+				if errors.Is(err, block.ErrNotFound) {
+					return false, nil
+				}
+				return false, err
+			}
+			fetched[l] = evt
+			for _, p := range evt.Parents {
+				following[p]++
+			}
+			return true, nil
+		}
+
+		for _, l := range head {
+			_, err := fetch(l)
+			if err != nil {
+				yield(Event{}, err)
+				return
+			}
+		}
+		for _, l := range head {
+			if evt, ok := fetched[l]; ok && following[l] == 0 {
+				queue.push(evt)
+			}
+		}
+		for queue.Len() > 0 {
+			evt := heap.Pop(queue).(historyItem).Event
+			// an event queued again, or found to follow another event after
+			// it was queued, is yielded once the events following it are
+			if _, ok := yielded[evt.Link]; ok || following[evt.Link] > 0 {
+				continue
+			}
+			yielded[evt.Link] = struct{}{}
+			if !yield(evt, nil) {
+				return
+			}
+			for _, p := range evt.Parents {
+				ok, err := fetch(p)
+				if err != nil {
+					yield(Event{}, err)
+					return
+				}
+				following[p]--
+				if ok && following[p] == 0 {
+					queue.push(fetched[p])
+				}
+			}
+		}
+	}
+}
+
+type historyConfig struct {
+	verify EventVerifier
+}
+
+// HistoryOption configures how [History] reads events.
+type HistoryOption func(*historyConfig)
+
+// WithAuthors verifies the authorization of signed events with the passed
+// verifier, and sets the author of those that pass. Events that fail are still
+// yielded, with the reason set as their [Event.AuthorErr].
+func WithAuthors(verify EventVerifier) HistoryOption {
+	return func(cfg *historyConfig) {
+		cfg.verify = verify
+	}
+}
+
+// readEvent fetches and decodes the clock event with the passed link. The
+// author is only verified and set if verify is not nil.
+func readEvent(ctx context.Context, blocks block.Fetcher, l ipld.Link, verify EventVerifier) (Event, error) {
+	b, err := blocks.Get(ctx, l)
+	if err != nil {
+		return Event{}, fmt.Errorf("getting event: %w", err)
+	}
+	evt, err := decodeClockEvent(b)
+	if err != nil {
+		return Event{}, err
+	}
+	op := evt.Data()
+	e := Event{
+		Link:    l,
+		Parents: evt.Parents(),
+		Type:    op.Type(),
+		Key:     op.Key(),
+		Value:   op.Value(),
+		Ops:     evt.Ops,
+		Root:    op.Root(),
+	}
+	// a malformed time or authorization marks the event, it does not stop the
+	// history from being read
+	e.Time, e.AuthorErr = EventTime(b)
+	if e.AuthorErr == nil && verify != nil {
+		e.Author, e.AuthorErr = EventAuthor(ctx, b, verify)
+	}
+	return e, nil
+}
+
+type historyItem struct {
+	Event
+	// seq is the order the event was queued in
+	seq int
+}
+
+// historyQueue is a heap of the events next in line to be yielded by
+// [History], latest first, then in the order they were queued.
+type historyQueue struct {
+	items []historyItem
+	seq   int
+}
+
+func (q *historyQueue) push(evt Event) {
+	heap.Push(q, historyItem{evt, q.seq})
+	q.seq++
+}
+
+func (q *historyQueue) Len() int { return len(q.items) }
+
+func (q *historyQueue) Less(i, j int) bool {
+	a, b := q.items[i], q.items[j]
+	if !a.Time.Equal(b.Time) {
+		return a.Time.After(b.Time)
+	}
+	return a.seq < b.seq
+}
+
+func (q *historyQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *historyQueue) Push(x any) { q.items = append(q.items, x.(historyItem)) }
+
+func (q *historyQueue) Pop() any {
+	item := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return item
+}
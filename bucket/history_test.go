@@ -0,0 +1,180 @@
+package bucket
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal/ed25519/signer"
+	"github.com/storacha/go-ucanto/ucan"
+	"github.com/stretchr/testify/require"
+)
+
+// newSignedBucket creates a bucket whose events are stamped with the time they
+// are written and signed by a new writer.
+func newSignedBucket(t *testing.T) *DsClockBucket {
+	t.Helper()
+	id, err := signer.Generate()
+	require.NoError(t, err)
+	sign := func(ctx context.Context, event ipld.Link) ([]byte, error) {
+		d, err := delegation.Delegate(id, id, []ucan.Capability[ucan.NoCaveats]{
+			ucan.NewCapability("clock/advance", id.DID().String(), ucan.NoCaveats{}),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(d.Archive())
+	}
+	return newTestBucket(t, WithHistory(), WithEventSigner(sign))
+}
+
+// verifyIssuer is an event verifier that trusts the issuer of any
+// authorization that can be extracted.
+func verifyIssuer(ctx context.Context, event ipld.Link, signed time.Time, auth []byte) (did.DID, error) {
+	inv, err := delegation.Extract(auth)
+	if err != nil {
+		return did.Undef, err
+	}
+	return inv.Issuer().DID(), nil
+}
+
+// putSpaced puts n keys with the passed prefix, far enough apart for their
+// events to be stamped with different times.
+func putSpaced(t *testing.T, bk Bucket[ipld.Link], prefix string, n int) {
+	t.Helper()
+	for range n {
+		time.Sleep(2 * time.Millisecond)
+		putN(t, bk, prefix, 1)
+		prefix += "'"
+	}
+}
+
+// requireTopological checks that every event is yielded after the events that
+// follow it, and returns the yielded events.
+func requireTopological(t *testing.T, blocks *countingFetcher, head []ipld.Link, options ...HistoryOption) []Event {
+	t.Helper()
+	var evts []Event
+	yielded := map[ipld.Link]struct{}{}
+	for evt, err := range History(context.Background(), blocks, head, options...) {
+		require.NoError(t, err)
+		_, ok := yielded[evt.Link]
+		require.False(t, ok, "event yielded twice: %s", evt.Link)
+		for _, p := range evt.Parents {
+			_, ok := yielded[p]
+			require.False(t, ok, "event yielded before a child: %s", p)
+		}
+		yielded[evt.Link] = struct{}{}
+		evts = append(evts, evt)
+	}
+	return evts
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("yields while walking", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "k", 100)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+
+		f := &countingFetcher{bk.Blocks(), map[ipld.Link]struct{}{}}
+		n := 0
+		for _, err := range History(ctx, f, head) {
+			require.NoError(t, err)
+			n++
+			if n == 5 {
+				break
+			}
+		}
+		// the yielded events and the next in line
+		require.LessOrEqual(t, len(f.fetched), 6)
+
+		f = &countingFetcher{bk.Blocks(), map[ipld.Link]struct{}{}}
+		require.Len(t, requireTopological(t, f, head), 100)
+	})
+
+	t.Run("branches of different lengths", func(t *testing.T) {
+		bk := newSignedBucket(t)
+		putSpaced(t, bk, "shared", 3)
+		branch, err := bk.Fork(ctx, "other")
+		require.NoError(t, err)
+		putSpaced(t, bk, "short", 1)
+		putSpaced(t, branch, "long", 5)
+		_, err = MergeBranch(ctx, bk, "other")
+		require.NoError(t, err)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		require.Len(t, head, 2)
+
+		f := &countingFetcher{bk.Blocks(), map[ipld.Link]struct{}{}}
+		evts := requireTopological(t, f, head, WithAuthors(verifyIssuer))
+		require.Len(t, evts, 9)
+		for i := 1; i < len(evts); i++ {
+			require.False(t, evts[i].Time.After(evts[i-1].Time))
+		}
+		require.NotEqual(t, did.Undef, evts[0].Author)
+		require.NoError(t, evts[0].AuthorErr)
+	})
+
+	t.Run("unverified authors are marked", func(t *testing.T) {
+		writer, err := signer.Generate()
+		require.NoError(t, err)
+		verify := func(ctx context.Context, event ipld.Link, signed time.Time, auth []byte) (did.DID, error) {
+			if string(auth) != "ok" {
+				return did.Undef, errForged
+			}
+			return writer.DID(), nil
+		}
+		auth := "ok"
+		bk := newSigningBucket(t, &auth)
+		putN(t, bk, "before", 2)
+		auth = "malformed"
+		putN(t, bk, "malformed", 1)
+		auth = "ok"
+		putN(t, bk, "after", 2)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+
+		f := &countingFetcher{bk.Blocks(), map[ipld.Link]struct{}{}}
+		evts := requireTopological(t, f, head, WithAuthors(verify))
+		require.Len(t, evts, 5)
+		for _, evt := range evts {
+			if evt.Key == "malformed0" {
+				require.ErrorIs(t, evt.AuthorErr, errForged)
+				require.Equal(t, did.Undef, evt.Author)
+			} else {
+				require.NoError(t, evt.AuthorErr)
+				require.Equal(t, writer.DID(), evt.Author)
+			}
+		}
+
+		// authors are not shown unless verified
+		f = &countingFetcher{bk.Blocks(), map[ipld.Link]struct{}{}}
+		for _, evt := range requireTopological(t, f, head) {
+			require.Equal(t, did.Undef, evt.Author)
+		}
+	})
+
+	t.Run("missing events are skipped", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "k", 5)
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		evt, err := getClockEvent(ctx, bk.Blocks(), head[0])
+		require.NoError(t, err)
+		blocks := newTestBlockstore()
+		b, err := bk.Blocks().Get(ctx, head[0])
+		require.NoError(t, err)
+		require.NoError(t, blocks.Put(ctx, b))
+
+		f := &countingFetcher{blocks, map[ipld.Link]struct{}{}}
+		evts := requireTopological(t, f, head)
+		require.Len(t, evts, 1)
+		require.Equal(t, evt.Parents(), evts[0].Parents)
+	})
+}
@@ -3,11 +3,13 @@ package bucket
 import (
 	"context"
 	"iter"
+	"time"
 
 	"github.com/ipld/go-ipld-prime"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/storacha/fam/block"
 	"github.com/storacha/go-pail"
-	"github.com/storacha/go-pail/block"
+	"github.com/storacha/go-ucanto/did"
 )
 
 var ErrNotFound = pail.ErrNotFound
@@ -39,12 +41,100 @@ type Bucket[T any] interface {
 type Clock interface {
 	Head(ctx context.Context) ([]ipld.Link, error)
 	Advance(ctx context.Context, event block.Block) ([]ipld.Link, error)
+	// AdvanceMany advances the clock with the passed events, ordered so that
+	// every event follows its parents, storing them along with the passed
+	// blocks and the new head in a single write. The resulting head is the
+	// same as advancing with each event in turn. See [AdvanceHead] to advance
+	// with every new event reachable from a head.
+	AdvanceMany(ctx context.Context, events []block.Block, blocks []block.Block) ([]ipld.Link, error)
+}
+
+// Replica is a merkle clock whose blocks are stored locally and can be read
+// and written directly, allowing it to be synced with a remote.
+type Replica interface {
+	Clock
+	// Blocks is the blockstore holding the clock events and pail shards.
+	Blocks() block.Blockstore
+}
+
+// Stager is a replica that keeps the blocks of fetches that have not completed,
+// so that an interrupted fetch resumes without transferring them again, and
+// the blocks pushed to it until the clock is advanced with them.
+type Stager interface {
+	// Staged is the blockstore holding blocks fetched by incomplete fetches, or
+	// pushed by a remote. Blocks are moved to [Replica.Blocks] once the whole
+	// DAG below them has been fetched or verified.
+	Staged() block.Blockstore
+}
+
+// CheckedAdvancer is a clock that checks the events it is advanced with against
+// its head while holding it, so that the head cannot change between the check
+// and the advance.
+type CheckedAdvancer interface {
+	// AdvanceChecked is [Clock.AdvanceMany], calling check with the current
+	// head first. The clock is not advanced if the check fails.
+	AdvanceChecked(ctx context.Context, events []block.Block, blocks []block.Block, check func(head []ipld.Link) error) ([]ipld.Link, error)
 }
 
 // ClockBucket is a bucket backed by a merkle clock.
 type ClockBucket[T any] interface {
 	Clock
 	Bucket[T]
+	// At returns a read-only view of the bucket at the passed head, which may be
+	// any set of events of the merkle clock, to read historical state.
+	At(ctx context.Context, head []ipld.Link) (Bucket[T], error)
+}
+
+// Checkpointer is a bucket whose merkle clock can be checkpointed, so that the
+// history before a checkpoint can be pruned.
+type Checkpointer interface {
+	// Checkpoint adds a checkpoint event summarizing the current head to the
+	// merkle clock, and returns its link.
+	Checkpoint(ctx context.Context) (ipld.Link, error)
+	// Prune deletes the events older than the latest checkpoint allowed by the
+	// policy, and the shards only they refer to. Tagged events and shards are
+	// kept, see [Tagger].
+	Prune(ctx context.Context, policy RetentionPolicy) (PruneResult, error)
+}
+
+// Batcher is a bucket that can make several changes as a single event, see
+// [TypeBatch].
+type Batcher interface {
+	// Batch makes the passed changes in order, as a single event. No event is
+	// made if none of them changes the bucket.
+	Batch(ctx context.Context, ops []BatchOp) error
+}
+
+// Tagger is a bucket whose states can be named by tags, see [Tag]. Tags are
+// local to the replica, they are not synced.
+type Tagger interface {
+	// Tag points the named tag at the passed head, or at the current head if
+	// none is passed.
+	Tag(ctx context.Context, name string, head []ipld.Link) (Tag, error)
+	// TagRoot points the named tag at the passed pail root.
+	TagRoot(ctx context.Context, name string, root ipld.Link) (Tag, error)
+	// GetTag retrieves the named tag.
+	GetTag(ctx context.Context, name string) (Tag, error)
+	// Tags iterates the tags, in name order.
+	Tags(ctx context.Context) iter.Seq2[Entry[Tag], error]
+	// Untag deletes the named tag.
+	Untag(ctx context.Context, name string) error
+}
+
+// Brancher is a bucket whose head can be forked into named branches, which
+// share its blockstore but have their own head, so that writes to a branch do
+// not change the bucket until it is merged, see [MergeBranch]. Only the
+// [MainBranch] is synced with remotes.
+type Brancher interface {
+	// Fork creates the named branch at the current head, and returns the
+	// bucket on it.
+	Fork(ctx context.Context, name string) (ClockBucket[ipld.Link], error)
+	// Branch returns the bucket on the named branch.
+	Branch(ctx context.Context, name string) (ClockBucket[ipld.Link], error)
+	// Branches iterates the heads of the forked branches, in name order.
+	Branches(ctx context.Context) iter.Seq2[Entry[[]ipld.Link], error]
+	// DeleteBranch deletes the named branch.
+	DeleteBranch(ctx context.Context, name string) error
 }
 
 // Networker allows for syncing state with remote servers.
@@ -53,13 +143,123 @@ type Networker interface {
 	Remotes(ctx context.Context) (Bucket[peer.AddrInfo], error)
 	// Remote returns a named instance of a remote.
 	Remote(ctx context.Context, name string) (Remote, error)
+	// Status compares the local merkle clock with the last known head of the
+	// named remote. It does not contact the remote.
+	Status(ctx context.Context, name string) (RemoteStatus, error)
+}
+
+// Discoverer is a [Networker] that can also sync with remotes discovered at
+// runtime, such as peers on the local network. Discovered remotes are not
+// persisted, and are shadowed by configured remotes with the same name.
+type Discoverer interface {
+	Networker
+	// Discovered returns the discovered remotes, keyed by name.
+	Discovered(ctx context.Context) (map[string]peer.AddrInfo, error)
+	// AddDiscovered adds or updates a discovered remote.
+	AddDiscovered(ctx context.Context, name string, addr peer.AddrInfo) error
+	// RemoveDiscovered removes a discovered remote.
+	RemoveDiscovered(ctx context.Context, name string) error
+}
+
+// Tracker records what is known about each remote: the last known head of its
+// merkle clock, like git's remote-tracking branches, and the state of syncing
+// with it in the background.
+type Tracker interface {
+	// RemoteHead retrieves the last known head of the named remote. It is empty
+	// if the remote has never been synced.
+	RemoteHead(ctx context.Context, name string) ([]ipld.Link, error)
+	// SetRemoteHead records the last known head of the named remote. Passing an
+	// empty head forgets it.
+	SetRemoteHead(ctx context.Context, name string, head []ipld.Link) error
+	// SyncState retrieves the background sync state of the named remote.
+	SyncState(ctx context.Context, name string) (SyncState, error)
+	// SetSyncState records the background sync state of the named remote.
+	// Passing a zero state forgets it.
+	SetSyncState(ctx context.Context, name string, state SyncState) error
+}
+
+// RemoteStatus describes how the local merkle clock relates to the last known
+// head of a remote.
+type RemoteStatus struct {
+	// Head is the last known head of the remote. It is empty if the remote has
+	// never been synced.
+	Head []ipld.Link
+	// Ahead is the number of local events the remote does not have.
+	Ahead int
+	// Behind is the number of remote events not merged locally.
+	Behind int
 }
 
 type Remote interface {
 	// Address is the network address of the remote.
 	Address(ctx context.Context) (peer.AddrInfo, error)
-	// Push local state to the remote.
-	Push(ctx context.Context) error
-	// Pull remote state from the remote.
-	Pull(ctx context.Context) error
+	// Push local state to the remote. It returns the head of the remote merkle
+	// clock after the push, which is recorded as the last known head of the
+	// remote only if all of its events are stored locally.
+	Push(ctx context.Context, options ...TransferOption) ([]ipld.Link, error)
+	// Pull remote state from the remote. It is a [Remote.Fetch] followed by a
+	// [Remote.Merge].
+	Pull(ctx context.Context, options ...TransferOption) (MergeResult, error)
+	// Fetch stores the events and blocks of the remote locally and records the
+	// remote head, without advancing the local merkle clock. It returns the head
+	// of the remote merkle clock. An interrupted fetch resumes from the blocks
+	// it already stored if the replica is a [Stager].
+	Fetch(ctx context.Context, options ...TransferOption) ([]ipld.Link, error)
+	// Merge advances the local merkle clock with the last fetched head of the
+	// remote. It returns the new local head and the keys modified differently
+	// on both sides since they diverged.
+	Merge(ctx context.Context) (MergeResult, error)
+}
+
+// ClockService is a merkle clock for a single bucket, hosted by a remote peer.
+type ClockService interface {
+	// Head retrieves the current head of the remote merkle clock.
+	Head(ctx context.Context) ([]ipld.Link, error)
+	// Blocks retrieves the blocks for the passed links from the remote. Blocks
+	// the remote does not have are omitted.
+	Blocks(ctx context.Context, links []ipld.Link) iter.Seq2[block.Block, error]
+	// Has returns the subset of the passed links the remote has blocks for.
+	Has(ctx context.Context, links []ipld.Link) ([]ipld.Link, error)
+	// Advance sends the passed blocks to the remote and advances the remote
+	// merkle clock with the passed head events. The blocks must include every
+	// event and shard reachable from the head that the remote does not have. It
+	// returns the new head of the remote merkle clock.
+	Advance(ctx context.Context, head []ipld.Link, blocks []block.Block) ([]ipld.Link, error)
 }
+
+// BlockSender is implemented by clock services that send the blocks of an
+// advance to the remote in batches, so that pushes can report progress as the
+// blocks are sent rather than once the remote has advanced.
+type BlockSender interface {
+	// AdvanceSent is [ClockService.Advance], calling sent with the blocks of
+	// each batch once the remote has received them.
+	AdvanceSent(ctx context.Context, head []ipld.Link, blocks []block.Block, sent func(blocks []block.Block)) ([]ipld.Link, error)
+}
+
+// Resolver finds the local replica of the bucket with the passed DID.
+type Resolver func(ctx context.Context, id did.DID) (Replica, error)
+
+// Dialer creates a connection to the clock service at the passed address.
+type Dialer func(ctx context.Context, addr peer.AddrInfo) (ClockService, error)
+
+// Announcer tells peers about a new head of the local replica, after a local
+// write.
+type Announcer func(ctx context.Context, head []ipld.Link) error
+
+// EventSigner authorizes a clock event created by a local write. It returns
+// the authorization, an archived UCAN invocation, for the event with the passed
+// link. See [SignEvent].
+type EventSigner func(ctx context.Context, event ipld.Link) ([]byte, error)
+
+// EventVerifier checks that the authorization of the clock event with the
+// passed link was issued by a writer of the bucket, and returns the DID of the
+// writer. The writer must have been authorized at the passed time, when the
+// event was signed according to the time stamped on it, see [StampEvent]. The
+// time is zero if the event was not stamped. The time is chosen by the writer,
+// it is only bounded by the time the event is received and the times stamped
+// on its parents, see [MaxClockSkew].
+//
+// Delegations are not checked for revocation: there is no revocation store,
+// so revoking a writer means waiting for its delegation to expire, which
+// delegations shared without an expiration never do.
+type EventVerifier func(ctx context.Context, event ipld.Link, signed time.Time, auth []byte) (did.DID, error)
@@ -2,16 +2,35 @@ package bucket
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"iter"
+	"maps"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/ipld/go-ipld-prime"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/storacha/fam/block"
 )
 
+// MaxClockSkew is how far the time stamped on a received clock event may be
+// ahead of the time it is received, or behind the time stamped on its parents,
+// allowing for the clocks of writers to differ.
+const MaxClockSkew = 5 * time.Minute
+
 type NetworkClockBucket[T any] struct {
-	bucket  ClockBucket[T]
-	remotes Bucket[peer.AddrInfo]
+	bucket    ClockBucket[T]
+	blocks    block.Blockstore
+	remotes   Bucket[peer.AddrInfo]
+	tracker   Tracker
+	dial      Dialer
+	announcer Announcer
+	verify    EventVerifier
+	mutex     sync.RWMutex
+	// discovered are remotes found at runtime, see [Discoverer]
+	discovered map[string]peer.AddrInfo
 }
 
 func (cb *NetworkClockBucket[T]) Remotes(ctx context.Context) (Bucket[peer.AddrInfo], error) {
@@ -19,46 +38,499 @@ func (cb *NetworkClockBucket[T]) Remotes(ctx context.Context) (Bucket[peer.AddrI
 }
 
 func (cb *NetworkClockBucket[T]) Remote(ctx context.Context, name string) (Remote, error) {
-	rems, err := cb.Remotes(ctx)
+	info, err := cb.lookup(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	info, err := rems.Get(ctx, name)
+	return &ClockRemote{cb, name, info, cb.tracker, cb.dial}, nil
+}
+
+// lookup finds the address of a configured or discovered remote.
+func (cb *NetworkClockBucket[T]) lookup(ctx context.Context, name string) (peer.AddrInfo, error) {
+	info, err := cb.remotes.Get(ctx, name)
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		return info, err
+	}
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	info, ok := cb.discovered[name]
+	if !ok {
+		return peer.AddrInfo{}, err
+	}
+	return info, nil
+}
+
+func (cb *NetworkClockBucket[T]) Discovered(ctx context.Context) (map[string]peer.AddrInfo, error) {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return maps.Clone(cb.discovered), nil
+}
+
+func (cb *NetworkClockBucket[T]) AddDiscovered(ctx context.Context, name string, addr peer.AddrInfo) error {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.discovered[name] = addr
+	return nil
+}
+
+// RemoveDiscovered removes a discovered remote. Its sync state is forgotten, so
+// that it is synced as soon as it is discovered again, but the last known head
+// is kept.
+func (cb *NetworkClockBucket[T]) RemoveDiscovered(ctx context.Context, name string) error {
+	cb.mutex.Lock()
+	delete(cb.discovered, name)
+	cb.mutex.Unlock()
+	return cb.tracker.SetSyncState(ctx, name, SyncState{})
+}
+
+func (cb *NetworkClockBucket[T]) Status(ctx context.Context, name string) (RemoteStatus, error) {
+	_, err := cb.lookup(ctx, name)
+	if err != nil {
+		return RemoteStatus{}, err
+	}
+	rhead, err := cb.tracker.RemoteHead(ctx, name)
 	if err != nil {
-		return nil, err
+		return RemoteStatus{}, err
+	}
+	head, err := cb.bucket.Head(ctx)
+	if err != nil {
+		return RemoteStatus{}, fmt.Errorf("getting local head: %w", err)
 	}
-	return &ClockRemote{cb.bucket, info}, nil
+	ahead, behind, err := Divergence(ctx, cb.blocks, head, rhead)
+	if err != nil {
+		return RemoteStatus{}, err
+	}
+	return RemoteStatus{Head: rhead, Ahead: ahead, Behind: behind}, nil
+}
+
+func (cb *NetworkClockBucket[T]) RemoteHead(ctx context.Context, name string) ([]ipld.Link, error) {
+	return cb.tracker.RemoteHead(ctx, name)
+}
+
+func (cb *NetworkClockBucket[T]) SetRemoteHead(ctx context.Context, name string, head []ipld.Link) error {
+	return cb.tracker.SetRemoteHead(ctx, name, head)
+}
+
+func (cb *NetworkClockBucket[T]) SyncState(ctx context.Context, name string) (SyncState, error) {
+	return cb.tracker.SyncState(ctx, name)
+}
+
+func (cb *NetworkClockBucket[T]) SetSyncState(ctx context.Context, name string, state SyncState) error {
+	return cb.tracker.SetSyncState(ctx, name, state)
+}
+
+// Blocks is the blockstore holding the clock events and pail shards.
+func (cb *NetworkClockBucket[T]) Blocks() block.Blockstore {
+	return cb.blocks
+}
+
+// Staged is the blockstore holding the blocks of incomplete fetches, or nil if
+// the underlying bucket is not a [Stager].
+func (cb *NetworkClockBucket[T]) Staged() block.Blockstore {
+	if s, ok := cb.bucket.(Stager); ok {
+		return s.Staged()
+	}
+	return nil
 }
 
 func (cb *NetworkClockBucket[T]) Head(ctx context.Context) ([]ipld.Link, error) {
 	return cb.bucket.Head(ctx)
 }
 
+// Advance advances the clock with an event received from a remote or a peer.
+// Received events are not announced, only local writes are, so announcements
+// do not echo between peers.
 func (cb *NetworkClockBucket[T]) Advance(ctx context.Context, evt block.Block) ([]ipld.Link, error) {
-	return cb.bucket.Advance(ctx, evt)
+	return cb.AdvanceMany(ctx, []block.Block{evt}, nil)
+}
+
+// AdvanceMany advances the clock with events received from a remote or a peer,
+// once they are verified, see [NetworkClockBucket.verifyEvents]. They are
+// verified against the head they advance, unless the underlying clock is not a
+// [CheckedAdvancer] and it changes in between.
+func (cb *NetworkClockBucket[T]) AdvanceMany(ctx context.Context, events []block.Block, blocks []block.Block) ([]ipld.Link, error) {
+	check := func(head []ipld.Link) error {
+		return cb.verifyEvents(ctx, head, events, blocks)
+	}
+	if ca, ok := cb.bucket.(CheckedAdvancer); ok {
+		return ca.AdvanceChecked(ctx, events, blocks, check)
+	}
+	prev, err := cb.bucket.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting head: %w", err)
+	}
+	err = check(prev)
+	if err != nil {
+		return nil, err
+	}
+	return cb.bucket.AdvanceMany(ctx, events, blocks)
+}
+
+// verifyEvents checks that the events the clock is advanced with, and every
+// ancestor of them that is not in the history of the local head, were signed
+// by a writer of the bucket, if the bucket has a verifier. The passed events
+// are verified first, so that events signed by anyone else are rejected
+// without walking the history, unless they are stored locally and may be in
+// it. Events in the history of the local head were verified when the clock was
+// advanced with them, and are not verified again, so that merging a remote
+// that is behind does not fail on events written before events were signed.
+// Only the history since the common ancestors is walked to find the events
+// that are not. Ancestors are read from the passed blocks, or the blockstore
+// of the bucket.
+func (cb *NetworkClockBucket[T]) verifyEvents(ctx context.Context, head []ipld.Link, events []block.Block, blocks []block.Block) error {
+	if cb.verify == nil {
+		return nil
+	}
+	received := mapFetcher{}
+	for _, b := range slices.Concat(blocks, events) {
+		received[b.Link()] = b
+	}
+	fetcher := block.NewTieredBlockFetcher(received, cb.blocks)
+	var links []ipld.Link
+	var failed []error
+	for _, evt := range events {
+		links = append(links, evt.Link())
+		if slices.Contains(head, evt.Link()) {
+			continue
+		}
+		err := cb.verifyEvent(ctx, fetcher, evt)
+		if err == nil {
+			continue
+		}
+		// an event that is not stored locally is not in the local history
+		_, gerr := cb.blocks.Get(ctx, evt.Link())
+		if errors.Is(gerr, block.ErrNotFound) {
+			return err
+		}
+		failed = append(failed, err)
+	}
+	_, added, err := divergent(ctx, newEventFetcher(fetcher), head, links)
+	if err != nil {
+		return fmt.Errorf("finding new events: %w", err)
+	}
+	// events that failed are only accepted if they are in the local history
+	for _, err := range failed {
+		var verr *eventError
+		if errors.As(err, &verr) {
+			if _, ok := added[verr.event]; !ok {
+				continue
+			}
+		}
+		return err
+	}
+	for l := range added {
+		if slices.Contains(links, l) {
+			continue
+		}
+		evt, err := fetcher.Get(ctx, l)
+		if err != nil {
+			// events that are not available, like those in the past of a
+			// checkpoint, are not stored with the clock either
+			if errors.Is(err, block.ErrNotFound) {
+				continue
+			}
+			return fmt.Errorf("getting event: %s: %w", l, err)
+		}
+		err = cb.verifyEvent(ctx, fetcher, evt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyEvent checks that the event was signed by a writer of the bucket, who
+// was authorized when the event was signed. Its parents are read from the
+// passed blocks to check the time stamped on it, see [checkEventTime].
+func (cb *NetworkClockBucket[T]) verifyEvent(ctx context.Context, blocks block.Fetcher, evt block.Block) error {
+	unsigned, auth, err := SplitEvent(evt)
+	if err != nil {
+		return err
+	}
+	if auth == nil {
+		return &eventError{evt.Link(), ErrUnsigned}
+	}
+	nd, err := decodeEvent(unsigned)
+	if err != nil {
+		return err
+	}
+	t, err := eventTime(nd)
+	if err != nil {
+		return err
+	}
+	if !t.IsZero() {
+		err = checkEventTime(ctx, blocks, evt, t, time.Now())
+		if err != nil {
+			return &eventError{evt.Link(), err}
+		}
+	}
+	_, err = cb.verify(ctx, unsigned.Link(), t, auth)
+	if err != nil {
+		return &eventError{evt.Link(), err}
+	}
+	return nil
+}
+
+// checkEventTime checks that the time stamped on an event is neither ahead of
+// the time it was received, nor behind the time stamped on any of its parents,
+// by more than [MaxClockSkew]. Events are verified at the time stamped on them
+// by their writer, so this stops a writer whose authorization has expired
+// from stamping a new event with a time when it was still valid, unless it
+// writes on top of events that old. Parents that are not available are not
+// checked.
+func checkEventTime(ctx context.Context, blocks block.Fetcher, evt block.Block, t time.Time, received time.Time) error {
+	if t.After(received.Add(MaxClockSkew)) {
+		return fmt.Errorf("event stamped at %s is ahead of the time it was received", t.Format(time.RFC3339))
+	}
+	e, err := newEventFetcher(mapFetcher{evt.Link(): evt}).Get(ctx, evt.Link())
+	if err != nil {
+		return fmt.Errorf("decoding event: %w", err)
+	}
+	for _, p := range e.Value().Parents() {
+		pb, err := blocks.Get(ctx, p)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				continue
+			}
+			return fmt.Errorf("getting parent: %s: %w", p, err)
+		}
+		pt, err := EventTime(pb)
+		if err != nil {
+			return err
+		}
+		if t.Before(pt.Add(-MaxClockSkew)) {
+			return fmt.Errorf("event stamped at %s is behind its parent %s stamped at %s", t.Format(time.RFC3339), p, pt.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// eventError is an event that failed verification.
+type eventError struct {
+	event ipld.Link
+	err   error
+}
+
+func (e *eventError) Error() string {
+	return fmt.Sprintf("verifying event: %s: %s", e.event, e.err)
+}
+
+func (e *eventError) Unwrap() error {
+	return e.err
 }
 
 func (cb *NetworkClockBucket[T]) Root(ctx context.Context) (ipld.Link, error) {
 	return cb.bucket.Root(ctx)
 }
 
+func (cb *NetworkClockBucket[T]) At(ctx context.Context, head []ipld.Link) (Bucket[T], error) {
+	return cb.bucket.At(ctx, head)
+}
+
 func (cb *NetworkClockBucket[T]) Get(ctx context.Context, key string) (T, error) {
 	return cb.bucket.Get(ctx, key)
 }
 
 func (cb *NetworkClockBucket[T]) Put(ctx context.Context, key string, value T) error {
-	return cb.bucket.Put(ctx, key, value)
+	err := cb.bucket.Put(ctx, key, value)
+	if err != nil {
+		return err
+	}
+	cb.announce(ctx)
+	return nil
 }
 
 func (cb *NetworkClockBucket[T]) Del(ctx context.Context, key string) error {
-	return cb.bucket.Del(ctx, key)
+	err := cb.bucket.Del(ctx, key)
+	if err != nil {
+		return err
+	}
+	cb.announce(ctx)
+	return nil
+}
+
+// Batch makes the passed changes as a single event and announces it, see
+// [Batcher]. It fails if the underlying bucket is not a batcher.
+func (cb *NetworkClockBucket[T]) Batch(ctx context.Context, ops []BatchOp) error {
+	b, ok := cb.bucket.(Batcher)
+	if !ok {
+		return errors.New("bucket is not a batcher")
+	}
+	prev, err := cb.bucket.Head(ctx)
+	if err != nil {
+		return fmt.Errorf("getting head: %w", err)
+	}
+	err = b.Batch(ctx, ops)
+	if err != nil {
+		return err
+	}
+	hd, err := cb.bucket.Head(ctx)
+	if err != nil {
+		return fmt.Errorf("getting head: %w", err)
+	}
+	if !slices.Equal(prev, hd) {
+		cb.announce(ctx)
+	}
+	return nil
 }
 
 func (cb *NetworkClockBucket[T]) Entries(ctx context.Context, opts ...EntriesOption) iter.Seq2[Entry[T], error] {
 	return cb.bucket.Entries(ctx, opts...)
 }
 
-// NewNetworkClockBucket creates a new [ClockBucket[T]] that is also a [Networker].
-func NewNetworkClockBucket[T any](bucket ClockBucket[T], remotes Bucket[peer.AddrInfo]) (*NetworkClockBucket[T], error) {
-	return &NetworkClockBucket[T]{bucket, remotes}, nil
+// Checkpoint adds a checkpoint event to the merkle clock and announces it, see
+// [Checkpointer]. It fails if the underlying bucket is not a checkpointer.
+func (cb *NetworkClockBucket[T]) Checkpoint(ctx context.Context) (ipld.Link, error) {
+	cp, ok := cb.bucket.(Checkpointer)
+	if !ok {
+		return nil, errors.New("bucket is not a checkpointer")
+	}
+	prev, err := cb.bucket.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting head: %w", err)
+	}
+	l, err := cp.Checkpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Equal(prev, []ipld.Link{l}) {
+		cb.announce(ctx)
+	}
+	return l, nil
+}
+
+// Prune prunes the merkle clock of the underlying bucket, see [Checkpointer].
+func (cb *NetworkClockBucket[T]) Prune(ctx context.Context, policy RetentionPolicy) (PruneResult, error) {
+	cp, ok := cb.bucket.(Checkpointer)
+	if !ok {
+		return PruneResult{}, errors.New("bucket is not a checkpointer")
+	}
+	return cp.Prune(ctx, policy)
+}
+
+// Tag tags a head of the underlying bucket, see [Tagger]. It fails if the
+// underlying bucket is not a tagger.
+func (cb *NetworkClockBucket[T]) Tag(ctx context.Context, name string, head []ipld.Link) (Tag, error) {
+	tg, ok := cb.bucket.(Tagger)
+	if !ok {
+		return Tag{}, errors.New("bucket is not a tagger")
+	}
+	return tg.Tag(ctx, name, head)
+}
+
+// TagRoot tags a pail root in the underlying bucket, see [Tagger].
+func (cb *NetworkClockBucket[T]) TagRoot(ctx context.Context, name string, root ipld.Link) (Tag, error) {
+	tg, ok := cb.bucket.(Tagger)
+	if !ok {
+		return Tag{}, errors.New("bucket is not a tagger")
+	}
+	return tg.TagRoot(ctx, name, root)
+}
+
+// GetTag retrieves a tag of the underlying bucket, see [Tagger].
+func (cb *NetworkClockBucket[T]) GetTag(ctx context.Context, name string) (Tag, error) {
+	tg, ok := cb.bucket.(Tagger)
+	if !ok {
+		return Tag{}, errors.New("bucket is not a tagger")
+	}
+	return tg.GetTag(ctx, name)
+}
+
+// Tags iterates the tags of the underlying bucket, see [Tagger].
+func (cb *NetworkClockBucket[T]) Tags(ctx context.Context) iter.Seq2[Entry[Tag], error] {
+	tg, ok := cb.bucket.(Tagger)
+	if !ok {
+		return func(yield func(Entry[Tag], error) bool) {
+			yield(Entry[Tag]{}, errors.New("bucket is not a tagger"))
+		}
+	}
+	return tg.Tags(ctx)
+}
+
+// Untag deletes a tag of the underlying bucket, see [Tagger].
+func (cb *NetworkClockBucket[T]) Untag(ctx context.Context, name string) error {
+	tg, ok := cb.bucket.(Tagger)
+	if !ok {
+		return errors.New("bucket is not a tagger")
+	}
+	return tg.Untag(ctx, name)
+}
+
+// Fork forks the underlying bucket, see [Brancher]. The bucket on the new
+// branch is local, its writes are not announced. It fails if the underlying
+// bucket is not a brancher.
+func (cb *NetworkClockBucket[T]) Fork(ctx context.Context, name string) (ClockBucket[ipld.Link], error) {
+	br, ok := cb.bucket.(Brancher)
+	if !ok {
+		return nil, errors.New("bucket is not a brancher")
+	}
+	return br.Fork(ctx, name)
+}
+
+// Branch returns a branch of the underlying bucket, see [Brancher].
+func (cb *NetworkClockBucket[T]) Branch(ctx context.Context, name string) (ClockBucket[ipld.Link], error) {
+	br, ok := cb.bucket.(Brancher)
+	if !ok {
+		return nil, errors.New("bucket is not a brancher")
+	}
+	return br.Branch(ctx, name)
+}
+
+// Branches iterates the branches of the underlying bucket, see [Brancher].
+func (cb *NetworkClockBucket[T]) Branches(ctx context.Context) iter.Seq2[Entry[[]ipld.Link], error] {
+	br, ok := cb.bucket.(Brancher)
+	if !ok {
+		return func(yield func(Entry[[]ipld.Link], error) bool) {
+			yield(Entry[[]ipld.Link]{}, errors.New("bucket is not a brancher"))
+		}
+	}
+	return br.Branches(ctx)
+}
+
+// DeleteBranch deletes a branch of the underlying bucket, see [Brancher].
+func (cb *NetworkClockBucket[T]) DeleteBranch(ctx context.Context, name string) error {
+	br, ok := cb.bucket.(Brancher)
+	if !ok {
+		return errors.New("bucket is not a brancher")
+	}
+	return br.DeleteBranch(ctx, name)
+}
+
+// announce tells peers about the current head, if there is an announcer. The
+// change has already been made locally, so failing to announce it is not an
+// error.
+func (cb *NetworkClockBucket[T]) announce(ctx context.Context) {
+	if cb.announcer == nil {
+		return
+	}
+	head, err := cb.bucket.Head(ctx)
+	if err != nil {
+		log.Warnf("getting head to announce: %s", err)
+		return
+	}
+	err = cb.announcer(ctx, head)
+	if err != nil {
+		log.Warnf("announcing head: %s", err)
+	}
+}
+
+// NewNetworkClockBucket creates a new [ClockBucket[T]] that is also a
+// [Networker]. The passed blockstore must be the one that backs the clock
+// bucket, the tracker records the last known head of each remote and the
+// dialer is used to connect to remotes. The announcer, which may be nil, is
+// called with the new head after every local write to the bucket. The verifier,
+// which may be nil, checks the signature of every new event the clock is
+// advanced with, and unsigned events or events from unauthorized writers are
+// rejected.
+func NewNetworkClockBucket[T any](bucket ClockBucket[T], blocks block.Blockstore, remotes Bucket[peer.AddrInfo], tracker Tracker, dial Dialer, announcer Announcer, verify EventVerifier) (*NetworkClockBucket[T], error) {
+	return &NetworkClockBucket[T]{
+		bucket:     bucket,
+		blocks:     blocks,
+		remotes:    remotes,
+		tracker:    tracker,
+		dial:       dial,
+		announcer:  announcer,
+		verify:     verify,
+		discovered: map[string]peer.AddrInfo{},
+	}, nil
 }
@@ -0,0 +1,181 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/stretchr/testify/require"
+)
+
+var errForged = errors.New("forged")
+
+// newVerifiedBucket creates a bucket that only accepts events whose
+// authorization is "ok", and records the events it verified.
+func newVerifiedBucket(t *testing.T, verified map[ipld.Link]struct{}) *NetworkClockBucket[ipld.Link] {
+	t.Helper()
+	bk := newTestBucket(t, WithHistory())
+	verify := func(ctx context.Context, event ipld.Link, signed time.Time, auth []byte) (did.DID, error) {
+		verified[event] = struct{}{}
+		if string(auth) != "ok" {
+			return did.Undef, errForged
+		}
+		return did.Undef, nil
+	}
+	nbk, err := NewNetworkClockBucket(bk, bk.Blocks(), NewRemoteBucket(bk, newTestBucket(t)), bk, nil, nil, verify)
+	require.NoError(t, err)
+	return nbk
+}
+
+// newSigningBucket creates a bucket that signs events with the current value
+// of auth.
+func newSigningBucket(t *testing.T, auth *string) *DsClockBucket {
+	t.Helper()
+	sign := func(ctx context.Context, event ipld.Link) ([]byte, error) {
+		return []byte(*auth), nil
+	}
+	return newTestBucket(t, WithHistory(), WithEventSigner(sign))
+}
+
+// received returns the head event of the bucket, and the other blocks needed
+// to advance a replica at since to it.
+func received(t *testing.T, bk *DsClockBucket, since []ipld.Link) ([]block.Block, []block.Block) {
+	t.Helper()
+	ctx := context.Background()
+	head, err := bk.Head(ctx)
+	require.NoError(t, err)
+	var events, blocks []block.Block
+	for b, err := range Export(ctx, bk.Blocks(), head, since) {
+		require.NoError(t, err)
+		if slices.Contains(head, b.Link()) {
+			events = append(events, b)
+		} else {
+			blocks = append(blocks, b)
+		}
+	}
+	return events, blocks
+}
+
+func TestNetworkClockBucketVerify(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("verifies every new event", func(t *testing.T) {
+		auth := "ok"
+		writer := newSigningBucket(t, &auth)
+		putN(t, writer, "before", 2)
+		auth = "forged"
+		putN(t, writer, "forged", 1)
+		auth = "ok"
+		putN(t, writer, "after", 2)
+
+		verified := map[ipld.Link]struct{}{}
+		events, blocks := received(t, writer, nil)
+		_, err := newVerifiedBucket(t, verified).AdvanceMany(ctx, events, blocks)
+		// the head is signed, the forged event is one of its ancestors
+		require.ErrorIs(t, err, errForged)
+		require.Greater(t, len(verified), 1)
+	})
+
+	t.Run("rejects head without walking", func(t *testing.T) {
+		auth := "ok"
+		writer := newSigningBucket(t, &auth)
+		putN(t, writer, "k", 5)
+		auth = "forged"
+		putN(t, writer, "forged", 1)
+
+		verified := map[ipld.Link]struct{}{}
+		events, blocks := received(t, writer, nil)
+		_, err := newVerifiedBucket(t, verified).AdvanceMany(ctx, events, blocks)
+		require.ErrorIs(t, err, errForged)
+		require.Len(t, verified, 1)
+	})
+
+	t.Run("verifies only events since the local head", func(t *testing.T) {
+		auth := "ok"
+		writer := newSigningBucket(t, &auth)
+		putN(t, writer, "k", 5)
+		since, err := writer.Head(ctx)
+		require.NoError(t, err)
+
+		verified := map[ipld.Link]struct{}{}
+		replica := newVerifiedBucket(t, verified)
+		events, blocks := received(t, writer, nil)
+		_, err = replica.AdvanceMany(ctx, events, blocks)
+		require.NoError(t, err)
+
+		putN(t, writer, "more", 2)
+		clear(verified)
+		events, blocks = received(t, writer, since)
+		_, err = replica.AdvanceMany(ctx, events, blocks)
+		require.NoError(t, err)
+		require.Len(t, verified, 2)
+	})
+
+	t.Run("events in the local history are not verified again", func(t *testing.T) {
+		// written before events were signed
+		writer := newTestBucket(t, WithHistory())
+		putN(t, writer, "k", 3)
+		behind, err := writer.Head(ctx)
+		require.NoError(t, err)
+		putN(t, writer, "more", 1)
+
+		replica := newVerifiedBucket(t, map[ipld.Link]struct{}{})
+		events, blocks := received(t, writer, nil)
+		require.NoError(t, replica.bucket.(*DsClockBucket).Blocks().PutBatch(ctx, append(events, blocks...)))
+		_, err = replica.bucket.AdvanceMany(ctx, events, blocks)
+		require.NoError(t, err)
+
+		// a remote that is behind
+		var old []block.Block
+		for _, l := range behind {
+			b, err := writer.Blocks().Get(ctx, l)
+			require.NoError(t, err)
+			old = append(old, b)
+		}
+		_, err = replica.AdvanceMany(ctx, old, nil)
+		require.NoError(t, err)
+	})
+}
+
+func TestCheckEventTime(t *testing.T) {
+	ctx := context.Background()
+	auth := "ok"
+	writer := newSigningBucket(t, &auth)
+	putN(t, writer, "k", 2)
+	head, err := writer.Head(ctx)
+	require.NoError(t, err)
+	evt, err := writer.Blocks().Get(ctx, head[0])
+	require.NoError(t, err)
+	now := time.Now()
+
+	stamped := func(t *testing.T, at time.Time) block.Block {
+		t.Helper()
+		b, err := StampEvent(evt, at)
+		require.NoError(t, err)
+		return b
+	}
+
+	t.Run("stamped when received", func(t *testing.T) {
+		require.NoError(t, checkEventTime(ctx, writer.Blocks(), stamped(t, now), now, now))
+	})
+
+	t.Run("stamped ahead of receipt", func(t *testing.T) {
+		at := now.Add(time.Hour)
+		require.ErrorContains(t, checkEventTime(ctx, writer.Blocks(), stamped(t, at), at, now), "ahead")
+	})
+
+	t.Run("stamped behind its parent", func(t *testing.T) {
+		at := now.Add(-time.Hour)
+		require.ErrorContains(t, checkEventTime(ctx, writer.Blocks(), stamped(t, at), at, now), "behind its parent")
+	})
+
+	t.Run("parent not available", func(t *testing.T) {
+		at := now.Add(-time.Hour)
+		require.NoError(t, checkEventTime(ctx, mapFetcher{}, stamped(t, at), at, now))
+	})
+}
@@ -0,0 +1,115 @@
+package bucket
+
+import (
+	"time"
+
+	"github.com/storacha/fam/block"
+)
+
+// Progress describes how far a transfer with a remote has got.
+type Progress struct {
+	// Events is the number of clock events walked.
+	Events int
+	// Blocks is the number of blocks transferred.
+	Blocks int
+	// Bytes is the number of bytes transferred.
+	Bytes int64
+	// Resumed is the number of blocks that were not transferred because an
+	// earlier, interrupted transfer had already stored them.
+	Resumed int
+	// Pending is the number of blocks known to be missing that have not been
+	// transferred yet. More may be found as the transfer walks the DAG.
+	Pending int
+	// Elapsed is the time since the transfer started.
+	Elapsed time.Duration
+	// ETA is the estimated time until the pending blocks are transferred, from
+	// the transfer rate so far. It is zero if unknown.
+	ETA time.Duration
+	// Done is set on the last progress reported for a transfer, once it has
+	// finished or failed.
+	Done bool
+	// Err is the error the transfer failed with, if it failed.
+	Err error
+}
+
+// TransferOption is an option configuring a transfer with a remote.
+type TransferOption func(cfg *transferConfig)
+
+type transferConfig struct {
+	progress func(Progress)
+}
+
+// WithProgress calls the passed function whenever a transfer makes progress,
+// and once more when it finishes or fails, see [Progress.Done]. It is called
+// from the goroutine doing the transfer, and should not block.
+func WithProgress(progress func(Progress)) TransferOption {
+	return func(cfg *transferConfig) {
+		cfg.progress = progress
+	}
+}
+
+// transfer tracks and reports the progress of a transfer.
+type transfer struct {
+	progress func(Progress)
+	start    time.Time
+	state    Progress
+}
+
+func newTransfer(options []TransferOption) *transfer {
+	cfg := transferConfig{}
+	for _, opt := range options {
+		opt(&cfg)
+	}
+	return &transfer{progress: cfg.progress, start: time.Now()}
+}
+
+// event records that a clock event was walked.
+func (t *transfer) event() {
+	t.state.Events++
+	t.report()
+}
+
+// pending records that blocks were found to be missing.
+func (t *transfer) pending(n int) {
+	t.state.Pending += n
+	t.report()
+}
+
+// transferred records that blocks were transferred.
+func (t *transfer) transferred(blocks ...block.Block) {
+	for _, b := range blocks {
+		t.state.Blocks++
+		t.state.Bytes += int64(len(b.Bytes()))
+		if t.state.Pending > 0 {
+			t.state.Pending--
+		}
+	}
+	t.report()
+}
+
+// resumed records that a block was read from an interrupted transfer.
+func (t *transfer) resumed() {
+	t.state.Resumed++
+	t.state.Pending--
+	t.report()
+}
+
+// finish records that the transfer finished, or failed with the passed error.
+func (t *transfer) finish(err error) {
+	t.state.Done = true
+	t.state.Err = err
+	t.state.Pending = 0
+	t.report()
+}
+
+func (t *transfer) report() {
+	if t.progress == nil {
+		return
+	}
+	t.state.Elapsed = time.Since(t.start)
+	t.state.ETA = 0
+	if t.state.Blocks > 0 && t.state.Pending > 0 {
+		t.state.ETA = t.state.Elapsed / time.Duration(t.state.Blocks) * time.Duration(t.state.Pending)
+	}
+	t.progress(t.state)
+}
@@ -4,28 +4,493 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/ipld/go-ipld-prime"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/storacha/fam/block"
 )
 
 type ClockRemote struct {
-	clock Clock
-	addr  peer.AddrInfo
+	replica Replica
+	name    string
+	addr    peer.AddrInfo
+	tracker Tracker
+	dial    Dialer
 }
 
 func (r *ClockRemote) Address(ctx context.Context) (peer.AddrInfo, error) {
 	return r.addr, nil
 }
 
-func (r *ClockRemote) Push(ctx context.Context) error {
-	return errors.New("not implemented")
+func (r *ClockRemote) Push(ctx context.Context, options ...TransferOption) ([]ipld.Link, error) {
+	t := newTransfer(options)
+	head, err := r.push(ctx, t)
+	t.finish(err)
+	return head, err
 }
 
-func (r *ClockRemote) Pull(ctx context.Context) error {
-	return errors.New("not implemented")
+func (r *ClockRemote) push(ctx context.Context, t *transfer) ([]ipld.Link, error) {
+	svc, err := r.dial(ctx, r.addr)
+	if err != nil {
+		return nil, fmt.Errorf("dialing remote: %w", err)
+	}
+
+	rhead, err := svc.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting remote head: %w", err)
+	}
+	head, err := r.replica.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting local head: %w", err)
+	}
+	log.Debugf("pushing local head: %s to remote head: %s", head, rhead)
+
+	blocks := r.replica.Blocks()
+
+	// find the events the remote has that are also available locally
+	known := map[ipld.Link]struct{}{}
+	err = walk(rhead, func(l ipld.Link) ([]ipld.Link, error) {
+		evt, err := getClockEvent(ctx, blocks, l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		known[l] = struct{}{}
+		if evt.Past != nil {
+			return nil, nil
+		}
+		return evt.Parents(), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("finding remote events: %w", err)
+	}
+
+	// collect the local events the remote does not have, asking the remote
+	// about events not known to be on it. Events in the past of a checkpoint are
+	// not needed, and may have been pruned.
+	// The checkpoints of the remote are included, since the remote needs the
+	// events behind local checkpoints concurrent with them.
+	found, err := findCheckpoints(ctx, blocks, slices.Concat(head, rhead))
+	if err != nil {
+		return nil, fmt.Errorf("finding checkpoints: %w", err)
+	}
+	w := newClockWalk(blocks, found)
+	var send []block.Block
+	var roots []ipld.Link
+	visit := func(l ipld.Link) ([]ipld.Link, error) {
+		b, err := blocks.Get(ctx, l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				return nil, w.missing(l)
+			}
+			return nil, fmt.Errorf("getting event: %w", err)
+		}
+		evt, err := decodeClockEvent(b)
+		if err != nil {
+			return nil, err
+		}
+		send = append(send, b)
+		roots = append(roots, evt.roots()...)
+		t.event()
+		return w.next(ctx, l, evt)
+	}
+	err = walkMissing(ctx, svc, head, known, visit)
+	if err == nil {
+		var behind []ipld.Link
+		behind, err = w.behind(ctx)
+		if err == nil {
+			err = walkMissing(ctx, svc, behind, known, visit)
+		}
+	}
+	if err == nil {
+		err = w.check(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("finding local events: %w", err)
+	}
+	if len(send) == 0 {
+		log.Debugf("remote is up to date")
+		err = r.track(ctx, rhead)
+		if err != nil {
+			return nil, fmt.Errorf("tracking remote head: %w", err)
+		}
+		return rhead, nil
+	}
+
+	// collect the shards of the new events the remote does not have. Unchanged
+	// subtrees are shared with events the remote has, so they are pruned.
+	nevents := len(send)
+	err = walkMissing(ctx, svc, roots, nil, func(l ipld.Link) ([]ipld.Link, error) {
+		b, err := blocks.Get(ctx, l)
+		if err != nil {
+			return nil, fmt.Errorf("getting shard: %w", err)
+		}
+		send = append(send, b)
+		return shardLinks(b)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("finding local shards: %w", err)
+	}
+	log.Debugf("negotiated %d missing events and %d missing shards", nevents, len(send)-nevents)
+
+	log.Debugf("pushing %d blocks to remote", len(send))
+	t.pending(len(send))
+	if bs, ok := svc.(BlockSender); ok {
+		rhead, err = bs.AdvanceSent(ctx, head, send, func(blocks []block.Block) {
+			for _, b := range blocks {
+				t.transferred(b)
+			}
+		})
+	} else {
+		rhead, err = svc.Advance(ctx, head, send)
+		if err == nil {
+			t.transferred(send...)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("advancing remote clock: %w", err)
+	}
+	err = r.track(ctx, rhead)
+	if err != nil {
+		return nil, fmt.Errorf("tracking remote head: %w", err)
+	}
+	return rhead, nil
+}
+
+// track records the head of the remote after a push, if its events are stored
+// locally, since merging and status need them. Otherwise the head includes
+// remote events that have not been fetched yet, and the last known head is
+// kept until the next fetch.
+func (r *ClockRemote) track(ctx context.Context, head []ipld.Link) error {
+	for _, l := range head {
+		_, err := r.replica.Blocks().Get(ctx, l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				log.Debugf("not tracking remote head with unfetched event: %s", l)
+				return nil
+			}
+			return fmt.Errorf("getting event: %w", err)
+		}
+	}
+	return r.tracker.SetRemoteHead(ctx, r.name, head)
+}
+
+func (r *ClockRemote) Pull(ctx context.Context, options ...TransferOption) (MergeResult, error) {
+	_, err := r.Fetch(ctx, options...)
+	if err != nil {
+		return MergeResult{}, err
+	}
+	return r.Merge(ctx)
+}
+
+func (r *ClockRemote) Fetch(ctx context.Context, options ...TransferOption) ([]ipld.Link, error) {
+	t := newTransfer(options)
+	head, err := r.fetch(ctx, t)
+	t.finish(err)
+	return head, err
+}
+
+func (r *ClockRemote) fetch(ctx context.Context, t *transfer) ([]ipld.Link, error) {
+	svc, err := r.dial(ctx, r.addr)
+	if err != nil {
+		return nil, fmt.Errorf("dialing remote: %w", err)
+	}
+
+	head, err := svc.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting remote head: %w", err)
+	}
+	log.Debugf("fetching remote head: %s", head)
+
+	err = fetchHead(ctx, r.replica, svc, head, t)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.tracker.SetRemoteHead(ctx, r.name, head)
+	if err != nil {
+		return nil, fmt.Errorf("tracking remote head: %w", err)
+	}
+	return head, nil
+}
+
+func (r *ClockRemote) Merge(ctx context.Context) (MergeResult, error) {
+	rhead, err := r.tracker.RemoteHead(ctx, r.name)
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("getting remote head: %w", err)
+	}
+	log.Debugf("merging remote head: %s", rhead)
+	return Merge(ctx, r.replica, rhead, nil)
+}
+
+// FetchHead fetches the events reachable from the passed head, and the shards
+// they refer to, from the clock service and stores them in the replica's
+// blockstore. Blocks the replica already has are not fetched. The replica is
+// not advanced. If the replica is a [Stager], blocks fetched by an earlier,
+// interrupted call are not fetched again.
+func FetchHead(ctx context.Context, replica Replica, svc ClockService, head []ipld.Link, options ...TransferOption) error {
+	t := newTransfer(options)
+	err := fetchHead(ctx, replica, svc, head, t)
+	t.finish(err)
+	return err
+}
+
+func fetchHead(ctx context.Context, replica Replica, svc ClockService, head []ipld.Link, t *transfer) error {
+	// blocks are collected in memory and written in a single batch once all
+	// events and shards have been fetched, so that an interrupted fetch never
+	// leaves an event in the local blockstore without the shards it refers to.
+	// Meanwhile they are staged, to resume from if the fetch is interrupted.
+	fetched := map[ipld.Link]block.Block{}
+	var staged block.Blockstore
+	if s, ok := replica.(Stager); ok {
+		staged = s.Staged()
+	}
+
+	// events in the past of a local checkpoint are not needed, and neither are
+	// those in the past of a fetched checkpoint, which the remote may have pruned
+	lhead, err := replica.Head(ctx)
+	if err != nil {
+		return fmt.Errorf("getting local head: %w", err)
+	}
+	found, err := findCheckpoints(ctx, replica.Blocks(), lhead)
+	if err != nil {
+		return fmt.Errorf("finding checkpoints: %w", err)
+	}
+	w := newClockWalk(block.NewTieredBlockFetcher(mapFetcher(fetched), replica.Blocks()), found)
+	var roots []ipld.Link
+	next := func(b block.Block) ([]ipld.Link, error) {
+		evt, err := decodeClockEvent(b)
+		if err != nil {
+			return nil, err
+		}
+		t.event()
+		// an event of the remote head may be in the past of a local checkpoint
+		ok, err := w.found.covers(ctx, w.blocks, b.Link())
+		if err != nil || ok {
+			return nil, err
+		}
+		roots = append(roots, evt.roots()...)
+		return w.next(ctx, b.Link(), evt)
+	}
+	err = fetchEvents(ctx, w, head, func(links []ipld.Link) ([]ipld.Link, error) {
+		return fetch(ctx, replica, staged, svc, t, fetched, links, next)
+	})
+	if err != nil {
+		return fmt.Errorf("fetching events: %w", err)
+	}
+
+	missing, err := fetch(ctx, replica, staged, svc, t, fetched, roots, shardLinks)
+	if err == nil && len(missing) > 0 {
+		err = fmt.Errorf("block not found on remote: %s", missing[0])
+	}
+	if err != nil {
+		return fmt.Errorf("fetching shards: %w", err)
+	}
+
+	log.Debugf("fetched %d blocks from remote", len(fetched))
+	err = replica.Blocks().PutBatch(ctx, slices.Collect(maps.Values(fetched)))
+	if err != nil {
+		return fmt.Errorf("putting fetched blocks: %w", err)
+	}
+	if staged != nil {
+		for l := range fetched {
+			err := staged.Del(ctx, l)
+			if err != nil {
+				log.Warnf("removing staged block: %s", err)
+			}
+		}
+	}
+	return nil
+}
+
+// fetchEvents fetches the events reachable from the head, in the two passes of
+// the passed walk. The passed function fetches from the passed links and returns
+// those the remote does not have.
+func fetchEvents(ctx context.Context, w *clockWalk, head []ipld.Link, fetch func(links []ipld.Link) ([]ipld.Link, error)) error {
+	record := func(missing []ipld.Link, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, l := range missing {
+			err := w.missing(l)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := record(fetch(head))
+	if err != nil {
+		return err
+	}
+	behind, err := w.behind(ctx)
+	if err != nil {
+		return err
+	}
+	err = record(fetch(behind))
+	if err != nil {
+		return err
+	}
+	return w.check(ctx)
+}
+
+// walkMissing traverses a DAG breadth first from the passed links, visiting
+// only the blocks the remote does not have. The remote is asked which blocks it
+// has once per level of the DAG, except for links in known, which the remote
+// is already known to have. A block the remote has is not followed, since a
+// replica only stores a block once it has the whole DAG below it: blocks of
+// incomplete pushes and fetches are staged, not stored, see [Stager].
+func walkMissing(ctx context.Context, svc ClockService, links []ipld.Link, known map[ipld.Link]struct{}, visit func(l ipld.Link) ([]ipld.Link, error)) error {
+	seen := map[ipld.Link]struct{}{}
+	for len(links) > 0 {
+		var unknown []ipld.Link
+		for _, l := range links {
+			if _, ok := seen[l]; ok {
+				continue
+			}
+			seen[l] = struct{}{}
+			if _, ok := known[l]; ok {
+				continue
+			}
+			unknown = append(unknown, l)
+		}
+		if len(unknown) == 0 {
+			break
+		}
+		have, err := svc.Has(ctx, unknown)
+		if err != nil {
+			return fmt.Errorf("negotiating missing blocks: %w", err)
+		}
+		present := map[ipld.Link]struct{}{}
+		for _, l := range have {
+			present[l] = struct{}{}
+		}
+		var next []ipld.Link
+		for _, l := range unknown {
+			if _, ok := present[l]; ok {
+				continue
+			}
+			ls, err := visit(l)
+			if err != nil {
+				return err
+			}
+			next = append(next, ls...)
+		}
+		links = next
+	}
+	return nil
+}
+
+// fetch walks a DAG breadth first from the passed links, fetching blocks that
+// are not available locally from the remote. The passed function is called for
+// each fetched block and returns the links to follow. Links to blocks that are
+// available locally are not followed. Blocks are read from the staged
+// blockstore, if any, before asking the remote, and blocks fetched from the
+// remote are staged. Blocks the remote sends that were not requested are
+// dropped. It returns the links of the blocks the remote does not have.
+func fetch(ctx context.Context, replica Replica, staged block.Blockstore, svc ClockService, t *transfer, fetched map[ipld.Link]block.Block, links []ipld.Link, next func(b block.Block) ([]ipld.Link, error)) ([]ipld.Link, error) {
+	var unavailable []ipld.Link
+	skip := map[ipld.Link]struct{}{}
+	for len(links) > 0 {
+		var missing []ipld.Link
+		for _, l := range links {
+			if _, ok := fetched[l]; ok {
+				continue
+			}
+			if _, ok := skip[l]; ok {
+				continue
+			}
+			_, err := replica.Blocks().Get(ctx, l)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, block.ErrNotFound) {
+				return nil, fmt.Errorf("getting block: %w", err)
+			}
+			skip[l] = struct{}{}
+			missing = append(missing, l)
+		}
+
+		t.pending(len(missing))
+
+		links = nil
+		// the DAG below a staged block may be incomplete, so its links are
+		// followed like those of a block fetched from the remote
+		var request []ipld.Link
+		for _, l := range missing {
+			if staged == nil {
+				request = append(request, l)
+				continue
+			}
+			b, err := staged.Get(ctx, l)
+			if err != nil {
+				if !errors.Is(err, block.ErrNotFound) {
+					return nil, fmt.Errorf("getting staged block: %w", err)
+				}
+				request = append(request, l)
+				continue
+			}
+			fetched[l] = b
+			t.resumed()
+			ls, err := next(b)
+			if err != nil {
+				return nil, err
+			}
+			links = append(links, ls...)
+		}
+		if len(request) == 0 {
+			continue
+		}
+
+		requested := map[ipld.Link]struct{}{}
+		for _, l := range request {
+			requested[l] = struct{}{}
+		}
+		for b, err := range svc.Blocks(ctx, request) {
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := requested[b.Link()]; !ok {
+				log.Warnf("dropping block not requested from remote: %s", b.Link())
+				continue
+			}
+			delete(requested, b.Link())
+			if staged != nil {
+				err = staged.Put(ctx, b)
+				if err != nil {
+					return nil, fmt.Errorf("staging block: %w", err)
+				}
+			}
+			fetched[b.Link()] = b
+			t.transferred(b)
+			ls, err := next(b)
+			if err != nil {
+				return nil, err
+			}
+			links = append(links, ls...)
+		}
+		for _, l := range request {
+			if _, ok := requested[l]; ok {
+				unavailable = append(unavailable, l)
+			}
+		}
+	}
+	return unavailable, nil
+}
+
+type mapFetcher map[ipld.Link]block.Block
+
+func (m mapFetcher) Get(ctx context.Context, link ipld.Link) (block.Block, error) {
+	if b, ok := m[link]; ok {
+		return b, nil
+	}
+	return nil, block.ErrNotFound
 }
 
 // NewRemoteBucket creates a new bucket that stores remote address info.
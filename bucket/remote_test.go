@@ -0,0 +1,49 @@
+package bucket
+
+import (
+	"context"
+	"iter"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// sendingService is a clock service that sends the same blocks whatever links
+// are requested.
+type sendingService struct {
+	ClockService
+	blocks []block.Block
+}
+
+func (s sendingService) Blocks(ctx context.Context, links []ipld.Link) iter.Seq2[block.Block, error] {
+	return func(yield func(block.Block, error) bool) {
+		for _, b := range s.blocks {
+			if !yield(b, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	ctx := context.Background()
+	requested, unrequested := testutil.RandomBlock(t), testutil.RandomBlock(t)
+	missing := testutil.RandomLink(t)
+	svc := sendingService{blocks: []block.Block{requested, unrequested, requested}}
+
+	fetched := map[ipld.Link]block.Block{}
+	var followed []ipld.Link
+	next := func(b block.Block) ([]ipld.Link, error) {
+		followed = append(followed, b.Link())
+		return nil, nil
+	}
+	unavailable, err := fetch(ctx, newTestBucket(t), nil, svc, newTransfer(nil), fetched, []ipld.Link{requested.Link(), missing}, next)
+	require.NoError(t, err)
+	require.Equal(t, []ipld.Link{missing}, unavailable)
+	require.Equal(t, []ipld.Link{requested.Link()}, followed)
+	require.Len(t, fetched, 1)
+	require.Contains(t, fetched, requested.Link())
+}
@@ -0,0 +1,109 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+)
+
+// Revert computes the changes to the bucket at the passed head that restore
+// the keys modified by the events reachable from `to` but not from `from` to
+// their values at `from`. An event is reverted on its own by passing its
+// parents as `from`, see [Parents]. Keys that already have their value at
+// `from` are omitted, so later changes to other keys are kept, but later
+// changes to the same keys are overwritten. Changes are sorted by key.
+func Revert(ctx context.Context, blocks block.Fetcher, head, from, to []ipld.Link) ([]Change, error) {
+	events := newEventFetcher(blocks)
+	hset, err := ancestors(ctx, events, head)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range to {
+		if _, ok := hset[l]; !ok {
+			return nil, fmt.Errorf("event is not in the history of the bucket: %s", l)
+		}
+	}
+	tset, err := ancestors(ctx, events, to)
+	if err != nil {
+		return nil, err
+	}
+	fset, err := ancestors(ctx, events, from)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]struct{}{}
+	for l := range tset {
+		if _, ok := fset[l]; ok {
+			continue
+		}
+		evt, err := getClockEvent(ctx, blocks, l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				return nil, fmt.Errorf("missing event: %s", l)
+			}
+			return nil, err
+		}
+		for _, k := range evt.keys() {
+			keys[k] = struct{}{}
+		}
+	}
+
+	var changes []Change
+	for _, k := range slices.Sorted(maps.Keys(keys)) {
+		prev, err := valueAt(ctx, blocks, from, k)
+		if err != nil {
+			return nil, err
+		}
+		curr, err := valueAt(ctx, blocks, head, k)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case prev == curr:
+			continue
+		case prev == nil:
+			changes = append(changes, Change{Type: ChangeRemoved, Key: k, Old: curr})
+		case curr == nil:
+			changes = append(changes, Change{Type: ChangeAdded, Key: k, New: prev})
+		default:
+			changes = append(changes, Change{Type: ChangeChanged, Key: k, Old: curr, New: prev})
+		}
+	}
+	return changes, nil
+}
+
+// Apply makes the passed changes to the bucket. If the bucket is a [Batcher]
+// they are written as a single event, so applied changes sync like any other
+// write, and are announced once. Otherwise each change is written as a new
+// event.
+func Apply(ctx context.Context, bk Bucket[ipld.Link], changes []Change) error {
+	if b, ok := bk.(Batcher); ok {
+		var ops []BatchOp
+		for _, c := range changes {
+			ops = append(ops, BatchOp{Key: c.Key, Value: c.New})
+		}
+		err := b.Batch(ctx, ops)
+		if err != nil {
+			return fmt.Errorf("applying changes: %w", err)
+		}
+		return nil
+	}
+	for _, c := range changes {
+		var err error
+		if c.New == nil {
+			err = bk.Del(ctx, c.Key)
+		} else {
+			err = bk.Put(ctx, c.Key, c.New)
+		}
+		if err != nil {
+			return fmt.Errorf("applying change to %s: %w", c.Key, err)
+		}
+	}
+	return nil
+}
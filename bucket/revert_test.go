@@ -0,0 +1,67 @@
+package bucket
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevert(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("applies the changes as a single event", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "k", 3)
+		before := collectEntries(t, bk)
+		from, err := bk.Head(ctx)
+		require.NoError(t, err)
+		putN(t, bk, "new", 1)
+		require.NoError(t, bk.Put(ctx, "k0", testutil.RandomLink(t)))
+		require.NoError(t, bk.Del(ctx, "k1"))
+		to, err := bk.Head(ctx)
+		require.NoError(t, err)
+
+		announced := 0
+		announce := func(ctx context.Context, head []ipld.Link) error {
+			announced++
+			return nil
+		}
+		nbk, err := NewNetworkClockBucket(bk, bk.Blocks(), NewRemoteBucket(bk, newTestBucket(t)), bk, nil, announce, nil)
+		require.NoError(t, err)
+
+		changes, err := Revert(ctx, bk.Blocks(), to, from, to)
+		require.NoError(t, err)
+		require.Len(t, changes, 3)
+		require.NoError(t, Apply(ctx, nbk, changes))
+		require.Equal(t, 1, announced)
+
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		require.Len(t, head, 1)
+		evt, err := getClockEvent(ctx, bk.Blocks(), head[0])
+		require.NoError(t, err)
+		require.Equal(t, TypeBatch, evt.Data().Type())
+		require.Equal(t, to, evt.Parents())
+		require.Equal(t, before, collectEntries(t, bk))
+	})
+
+	t.Run("reverts every key of a batch", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "k", 3)
+		before := collectEntries(t, bk)
+		require.NoError(t, bk.Batch(ctx, []BatchOp{{Key: "k0"}, {Key: "k1", Value: testutil.RandomLink(t)}}))
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+
+		evt, err := getClockEvent(ctx, bk.Blocks(), head[0])
+		require.NoError(t, err)
+		changes, err := Revert(ctx, bk.Blocks(), head, evt.Parents(), head)
+		require.NoError(t, err)
+		require.Len(t, changes, 2)
+		require.NoError(t, Apply(ctx, bk, changes))
+		require.Equal(t, before, collectEntries(t, bk))
+	})
+}
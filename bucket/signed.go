@@ -0,0 +1,204 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/go-ucanto/did"
+)
+
+// ErrUnsigned is returned when advancing a bucket that verifies its writers
+// with an event that carries no authorization.
+var ErrUnsigned = errors.New("event is not signed")
+
+// authKey is the field of a signed clock event holding its authorization.
+// Pail ignores fields of an event other than its parents and data, so a signed
+// event is still a valid merkle clock event.
+const authKey = "auth"
+
+// timeKey is the field of a clock event holding the time it was written, in
+// milliseconds since the Unix epoch. It is covered by the signature.
+const timeKey = "time"
+
+// SignEvent adds the passed authorization to a clock event. The authorization
+// refers to the link of the event without it, see [SplitEvent].
+func SignEvent(evt block.Block, auth []byte) (block.Block, error) {
+	nd, err := decodeEvent(evt)
+	if err != nil {
+		return nil, err
+	}
+	return encodeEvent(nd, map[string]datamodel.Node{authKey: basicnode.NewBytes(auth)})
+}
+
+// StampEvent sets the time a clock event was written. It must be stamped
+// before it is signed.
+func StampEvent(evt block.Block, t time.Time) (block.Block, error) {
+	nd, err := decodeEvent(evt)
+	if err != nil {
+		return nil, err
+	}
+	return encodeEvent(nd, map[string]datamodel.Node{timeKey: basicnode.NewInt(t.UnixMilli())})
+}
+
+// EventAuthor returns the DID of the writer that signed a clock event, once
+// its authorization has been verified with verify at the time stamped on the
+// event. The DID is undefined if the event is not signed.
+func EventAuthor(ctx context.Context, evt block.Block, verify EventVerifier) (did.DID, error) {
+	t, err := EventTime(evt)
+	if err != nil {
+		return did.Undef, err
+	}
+	unsigned, auth, err := SplitEvent(evt)
+	if err != nil {
+		return did.Undef, err
+	}
+	if auth == nil {
+		return did.Undef, nil
+	}
+	author, err := verify(ctx, unsigned.Link(), t, auth)
+	if err != nil {
+		return did.Undef, fmt.Errorf("verifying event %s: %w", evt.Link(), err)
+	}
+	return author, nil
+}
+
+// EventTime returns the time a clock event was written according to its
+// writer, zero if it was not stamped.
+func EventTime(evt block.Block) (time.Time, error) {
+	nd, err := decodeEvent(evt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return eventTime(nd)
+}
+
+// eventTime returns the time stamped on a decoded clock event, zero if it was
+// not stamped.
+func eventTime(nd datamodel.Node) (time.Time, error) {
+	tn, err := nd.LookupByString(timeKey)
+	if err != nil {
+		return time.Time{}, nil
+	}
+	ms, err := tn.AsInt()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("decoding event time: %w", err)
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// SplitEvent separates a signed clock event into the event without its
+// authorization, which is what the authorization refers to, and the
+// authorization. The authorization is nil if the event is not signed.
+func SplitEvent(evt block.Block) (block.Block, []byte, error) {
+	nd, err := decodeEvent(evt)
+	if err != nil {
+		return nil, nil, err
+	}
+	an, err := nd.LookupByString(authKey)
+	if err != nil {
+		return evt, nil, nil
+	}
+	auth, err := an.AsBytes()
+	if err != nil {
+		return nil, nil, fmt.Errorf("decoding event authorization: %w", err)
+	}
+	unsigned, err := encodeEvent(nd, map[string]datamodel.Node{authKey: nil})
+	if err != nil {
+		return nil, nil, err
+	}
+	return unsigned, auth, nil
+}
+
+func decodeEvent(evt block.Block) (datamodel.Node, error) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	err := dagcbor.Decode(nb, bytes.NewReader(evt.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("decoding event: %s: %w", evt.Link(), err)
+	}
+	nd := nb.Build()
+	if nd.Kind() != datamodel.Kind_Map {
+		return nil, fmt.Errorf("event is not a map: %s", evt.Link())
+	}
+	return nd, nil
+}
+
+// encodeEvent encodes the event with its fields replaced by the passed fields.
+// Fields with a nil value are removed.
+func encodeEvent(nd datamodel.Node, fields map[string]datamodel.Node) (block.Block, error) {
+	nb := basicnode.Prototype.Map.NewBuilder()
+	ma, err := nb.BeginMap(nd.Length() + int64(len(fields)))
+	if err != nil {
+		return nil, fmt.Errorf("beginning map: %w", err)
+	}
+	assign := func(k string, v datamodel.Node) error {
+		err := ma.AssembleKey().AssignString(k)
+		if err != nil {
+			return fmt.Errorf("assembling %s key: %w", k, err)
+		}
+		err = ma.AssembleValue().AssignNode(v)
+		if err != nil {
+			return fmt.Errorf("assembling %s value: %w", k, err)
+		}
+		return nil
+	}
+	it := nd.MapIterator()
+	for !it.Done() {
+		k, v, err := it.Next()
+		if err != nil {
+			return nil, fmt.Errorf("iterating event: %w", err)
+		}
+		ks, err := k.AsString()
+		if err != nil {
+			return nil, fmt.Errorf("decoding event key: %w", err)
+		}
+		if _, ok := fields[ks]; ok {
+			continue
+		}
+		err = assign(ks, v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, k := range slices.Sorted(maps.Keys(fields)) {
+		if fields[k] == nil {
+			continue
+		}
+		err = assign(k, fields[k])
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("finishing map: %w", err)
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	err = dagcbor.Encode(nb.Build(), buf)
+	if err != nil {
+		return nil, fmt.Errorf("CBOR encoding: %w", err)
+	}
+	c, err := cid.Prefix{
+		Version:  1,
+		Codec:    uint64(multicodec.DagCbor),
+		MhType:   multihash.SHA2_256,
+		MhLength: -1,
+	}.Sum(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("hashing event: %w", err)
+	}
+	return block.New(cidlink.Link{Cid: c}, buf.Bytes()), nil
+}
@@ -0,0 +1,150 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	pail "github.com/storacha/go-pail"
+	"github.com/storacha/go-pail/shard"
+)
+
+// ErrReadOnly is returned when writing to a read-only view of a bucket.
+var ErrReadOnly = errors.New("bucket is read-only")
+
+// Snapshot is a read-only view of a clock bucket pinned to a head, which may be
+// any set of events of its merkle clock.
+type Snapshot struct {
+	head   []ipld.Link
+	blocks block.Fetcher
+}
+
+// Head is the head the snapshot is pinned to.
+func (s *Snapshot) Head(ctx context.Context) ([]ipld.Link, error) {
+	return s.head, nil
+}
+
+func (s *Snapshot) Root(ctx context.Context) (ipld.Link, error) {
+	if len(s.head) == 0 {
+		b, err := pail.New()
+		if err != nil {
+			return nil, fmt.Errorf("creating pail: %w", err)
+		}
+		return b.Link(), nil
+	}
+	root, _, err := clockRoot(ctx, s.blocks, s.head)
+	if err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func (s *Snapshot) Get(ctx context.Context, key string) (ipld.Link, error) {
+	if len(s.head) == 0 {
+		return nil, fmt.Errorf("getting %s: %w", key, ErrNotFound)
+	}
+	value, err := clockGet(ctx, s.blocks, s.head, key)
+	if err != nil {
+		return nil, fmt.Errorf("getting %s: %w", key, err)
+	}
+	return value, nil
+}
+
+func (s *Snapshot) Put(ctx context.Context, key string, value ipld.Link) error {
+	return ErrReadOnly
+}
+
+func (s *Snapshot) Del(ctx context.Context, key string) error {
+	return ErrReadOnly
+}
+
+func (s *Snapshot) Entries(ctx context.Context, opts ...EntriesOption) iter.Seq2[Entry[ipld.Link], error] {
+	return func(yield func(Entry[ipld.Link], error) bool) {
+		if len(s.head) == 0 {
+			return
+		}
+		for e, err := range clockEntries(ctx, s.blocks, s.head, opts...) {
+			if err != nil {
+				yield(Entry[ipld.Link]{}, err)
+				return
+			}
+			if !yield(Entry[ipld.Link]{e.Key, e.Value}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// NewSnapshot creates a read-only view of the bucket whose blocks are in the
+// passed fetcher, at the passed head. The events of the head must be available
+// from the fetcher.
+func NewSnapshot(ctx context.Context, blocks block.Fetcher, head []ipld.Link) (*Snapshot, error) {
+	events := newEventFetcher(blocks)
+	for _, l := range head {
+		_, err := events.Get(ctx, l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				return nil, fmt.Errorf("event not found, it may have been pruned: %s: %w", l, err)
+			}
+			return nil, fmt.Errorf("getting event: %s: %w", l, err)
+		}
+	}
+	return &Snapshot{head: head, blocks: blocks}, nil
+}
+
+// RootSnapshot is a read-only view of a pail root, such as the root of a
+// [Tag], independent of the merkle clock events that led to it.
+type RootSnapshot struct {
+	root   ipld.Link
+	blocks block.Fetcher
+}
+
+func (s *RootSnapshot) Root(ctx context.Context) (ipld.Link, error) {
+	return s.root, nil
+}
+
+func (s *RootSnapshot) Get(ctx context.Context, key string) (ipld.Link, error) {
+	value, err := pail.Get(ctx, s.blocks, s.root, key)
+	if err != nil {
+		return nil, fmt.Errorf("getting %s: %w", key, err)
+	}
+	return value, nil
+}
+
+func (s *RootSnapshot) Put(ctx context.Context, key string, value ipld.Link) error {
+	return ErrReadOnly
+}
+
+func (s *RootSnapshot) Del(ctx context.Context, key string) error {
+	return ErrReadOnly
+}
+
+func (s *RootSnapshot) Entries(ctx context.Context, opts ...EntriesOption) iter.Seq2[Entry[ipld.Link], error] {
+	return func(yield func(Entry[ipld.Link], error) bool) {
+		for e, err := range pail.Entries(ctx, s.blocks, s.root, opts...) {
+			if err != nil {
+				yield(Entry[ipld.Link]{}, err)
+				return
+			}
+			if !yield(Entry[ipld.Link]{e.Key, e.Value}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// NewRootSnapshot creates a read-only view of the pail root whose shards are in
+// the passed fetcher. The root shard must be available from the fetcher.
+func NewRootSnapshot(ctx context.Context, blocks block.Fetcher, root ipld.Link) (*RootSnapshot, error) {
+	_, err := shard.NewFetcher(blocks).GetRoot(ctx, root)
+	if err != nil {
+		if errors.Is(err, block.ErrNotFound) {
+			return nil, fmt.Errorf("pail root not found, it may have been pruned: %s: %w", root, err)
+		}
+		return nil, fmt.Errorf("getting pail root: %s: %w", root, err)
+	}
+	return &RootSnapshot{root: root, blocks: blocks}, nil
+}
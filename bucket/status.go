@@ -0,0 +1,146 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/go-pail/clock/event"
+	"github.com/storacha/go-pail/crdt/operation"
+)
+
+// Divergence counts the events reachable from head a that are not reachable
+// from head b (ahead), and the events reachable from b that are not reachable
+// from a (behind). Events that are not available locally are counted, but
+// their ancestors are not. See [divergent] for how much history is walked.
+func Divergence(ctx context.Context, blocks block.Fetcher, a, b []ipld.Link) (int, int, error) {
+	aonly, bonly, err := divergent(ctx, newEventFetcher(blocks), a, b)
+	if err != nil {
+		return 0, 0, err
+	}
+	return len(aonly), len(bonly), nil
+}
+
+const (
+	fromA = 1 << iota
+	fromB
+	fromBoth = fromA | fromB
+)
+
+// divergent returns the events reachable only from head a and only from head
+// b. Events are walked breadth first from both heads at once, marking each
+// with the heads it is reachable from. When an event already visited is
+// reached from the other head, the mark is passed on to its visited ancestors
+// straight away, and the walk stops once every event left to visit is
+// reachable from both heads, so history before the common ancestors is not
+// walked. An event reachable from both heads through branches of different
+// lengths may first be reached from one head only. If the walk from one head
+// alone reaches the start of the history, the rest of the history is walked so
+// that such events are marked correctly, otherwise an event that the other
+// head only reaches through a branch longer than the history walked may be
+// returned as reachable from one head only. Events that are not available
+// locally are included, but their ancestors are not.
+func divergent(ctx context.Context, events *event.Fetcher[operation.Operation], a, b []ipld.Link) (map[ipld.Link]struct{}, map[ipld.Link]struct{}, error) {
+	// marks and parents of the visited events
+	marks := map[ipld.Link]int{}
+	parents := map[ipld.Link][]ipld.Link{}
+	// marks of the events to visit next
+	pending := map[ipld.Link]int{}
+	for _, l := range a {
+		pending[l] |= fromA
+	}
+	for _, l := range b {
+		pending[l] |= fromB
+	}
+
+	// mark adds the marks to the event, and to its visited ancestors
+	var mark func(l ipld.Link, m int)
+	mark = func(l ipld.Link, m int) {
+		old, ok := marks[l]
+		if !ok {
+			pending[l] |= m
+			return
+		}
+		if old|m == old {
+			return
+		}
+		marks[l] = old | m
+		for _, p := range parents[l] {
+			mark(p, old|m)
+		}
+	}
+	// done reports whether no visit left would change the marks of an event
+	// already visited or reach an event from only one head
+	done := func() bool {
+		for l, m := range pending {
+			old, ok := marks[l]
+			if ok && old|m != old || !ok && m != fromBoth {
+				return false
+			}
+		}
+		return true
+	}
+
+	// exhaust is set once the walk from one head alone reaches the start of
+	// the history
+	exhaust := false
+	for len(pending) > 0 && (exhaust || !done()) {
+		visits := pending
+		pending = map[ipld.Link]int{}
+		for l, m := range visits {
+			if _, ok := marks[l]; ok {
+				mark(l, m)
+				continue
+			}
+			// marks passed on while this level was being visited
+			m |= pending[l]
+			delete(pending, l)
+			marks[l] = m
+			evt, err := events.Get(ctx, l)
+			if err != nil {
+				if errors.Is(err, block.ErrNotFound) {
+					continue
+				}
+				return nil, nil, fmt.Errorf("getting event: %w", err)
+			}
+			parents[l] = evt.Value().Parents()
+			if len(parents[l]) == 0 && m != fromBoth {
+				exhaust = true
+			}
+			for _, p := range parents[l] {
+				mark(p, marks[l])
+			}
+		}
+	}
+	aonly, bonly := map[ipld.Link]struct{}{}, map[ipld.Link]struct{}{}
+	for l, m := range marks {
+		switch m {
+		case fromA:
+			aonly[l] = struct{}{}
+		case fromB:
+			bonly[l] = struct{}{}
+		}
+	}
+	return aonly, bonly, nil
+}
+
+// ancestors returns the events reachable from the head, including the head
+// events. Events that are not available locally are included, but their
+// ancestors are not.
+func ancestors(ctx context.Context, events *event.Fetcher[operation.Operation], head []ipld.Link) (map[ipld.Link]struct{}, error) {
+	seen := map[ipld.Link]struct{}{}
+	err := walk(head, func(l ipld.Link) ([]ipld.Link, error) {
+		seen[l] = struct{}{}
+		evt, err := events.Get(ctx, l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("getting event: %w", err)
+		}
+		return evt.Value().Parents(), nil
+	})
+	return seen, err
+}
@@ -0,0 +1,172 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+)
+
+// SyncState is the state of background syncing with a remote.
+type SyncState struct {
+	// Interval is the time between syncs. Zero means the syncer's default.
+	Interval time.Duration
+	// LastSync is the time of the last sync attempt. It is zero if the remote
+	// has never been synced in the background.
+	LastSync time.Time
+	// LastError describes why the last sync attempt failed. It is empty if the
+	// attempt succeeded.
+	LastError string
+	// Failures is the number of consecutive failed sync attempts.
+	Failures int
+}
+
+// syncStateKey is the key the sync state of the named remote is stored at.
+func syncStateKey(name string) datastore.Key {
+	return datastore.NewKey("remotes").ChildString(name).ChildString("sync")
+}
+
+func (bucket *DsClockBucket) SyncState(ctx context.Context, name string) (SyncState, error) {
+	b, err := bucket.data.Get(ctx, syncStateKey(name))
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return SyncState{}, nil
+		}
+		return SyncState{}, fmt.Errorf("getting sync state: %w", err)
+	}
+	state, err := unmarshalSyncState(b)
+	if err != nil {
+		return SyncState{}, fmt.Errorf("unmarshalling sync state: %w", err)
+	}
+	return state, nil
+}
+
+func (bucket *DsClockBucket) SetSyncState(ctx context.Context, name string, state SyncState) error {
+	if state == (SyncState{}) {
+		err := bucket.data.Delete(ctx, syncStateKey(name))
+		if err != nil {
+			return fmt.Errorf("deleting sync state: %w", err)
+		}
+		return nil
+	}
+	b, err := marshalSyncState(state)
+	if err != nil {
+		return fmt.Errorf("marshalling sync state: %w", err)
+	}
+	err = bucket.data.Put(ctx, syncStateKey(name), b)
+	if err != nil {
+		return fmt.Errorf("updating sync state: %w", err)
+	}
+	return nil
+}
+
+func marshalSyncState(state SyncState) ([]byte, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	ma, err := nb.BeginMap(4)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("interval")
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleValue().AssignInt(int64(state.Interval))
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("lastSync")
+	if err != nil {
+		return nil, err
+	}
+	var last int64
+	if !state.LastSync.IsZero() {
+		last = state.LastSync.UnixMilli()
+	}
+	err = ma.AssembleValue().AssignInt(last)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("lastError")
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleValue().AssignString(state.LastError)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("failures")
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleValue().AssignInt(int64(state.Failures))
+	if err != nil {
+		return nil, err
+	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer([]byte{})
+	err = dagcbor.Encode(nb.Build(), buf)
+	if err != nil {
+		return nil, fmt.Errorf("CBOR encoding: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func unmarshalSyncState(b []byte) (SyncState, error) {
+	var state SyncState
+	np := basicnode.Prototype.Map
+	nb := np.NewBuilder()
+	err := dagcbor.Decode(nb, bytes.NewReader(b))
+	if err != nil {
+		return state, fmt.Errorf("CBOR decoding: %w", err)
+	}
+	n := nb.Build()
+
+	interval, err := lookupInt(n, "interval")
+	if err != nil {
+		return state, err
+	}
+	state.Interval = time.Duration(interval)
+	last, err := lookupInt(n, "lastSync")
+	if err != nil {
+		return state, err
+	}
+	if last != 0 {
+		state.LastSync = time.UnixMilli(last)
+	}
+	en, err := n.LookupByString("lastError")
+	if err != nil {
+		return state, fmt.Errorf("looking up lastError: %w", err)
+	}
+	state.LastError, err = en.AsString()
+	if err != nil {
+		return state, fmt.Errorf("decoding lastError as string: %w", err)
+	}
+	failures, err := lookupInt(n, "failures")
+	if err != nil {
+		return state, err
+	}
+	state.Failures = int(failures)
+	return state, nil
+}
+
+func lookupInt(n ipld.Node, key string) (int64, error) {
+	vn, err := n.LookupByString(key)
+	if err != nil {
+		return 0, fmt.Errorf("looking up %s: %w", key, err)
+	}
+	v, err := vn.AsInt()
+	if err != nil {
+		return 0, fmt.Errorf("decoding %s as int: %w", key, err)
+	}
+	return v, nil
+}
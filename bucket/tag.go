@@ -0,0 +1,319 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"strings"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/storacha/fam/block"
+	pail "github.com/storacha/go-pail"
+	"github.com/storacha/go-pail/shard"
+)
+
+// Tag is a named pointer to a state of a bucket, like a git tag. The events
+// and shards of a tag are kept when the bucket is pruned, see [Tagger].
+type Tag struct {
+	// Head is the set of events the tag points at. It is empty for a tag of a
+	// pail root.
+	Head []ipld.Link
+	// Root is the pail root at the head, or the pail root the tag points at.
+	Root ipld.Link
+}
+
+// tagsKey is the prefix of the keys tags are stored at, next to [headKey].
+var tagsKey = datastore.NewKey("tags")
+
+// tagKey is the key the named tag is stored at.
+func tagKey(name string) (datastore.Key, error) {
+	if name == "" || datastore.NewKey(name).String() != "/"+name {
+		return datastore.Key{}, fmt.Errorf("invalid tag name: %q", name)
+	}
+	return tagsKey.ChildString(name), nil
+}
+
+// Tag points the named tag at the passed head, or at the current head if none
+// is passed, replacing any existing tag with the name. The pail root at the
+// head is stored with the tag.
+func (bucket *DsClockBucket) Tag(ctx context.Context, name string, hd []ipld.Link) (Tag, error) {
+	bucket.mutex.Lock()
+	defer bucket.mutex.Unlock()
+
+	if len(hd) == 0 {
+		hd = bucket.head
+	}
+	if len(hd) == 0 {
+		return Tag{}, errors.New("cannot tag an empty bucket")
+	}
+	for _, l := range hd {
+		_, err := getClockEvent(ctx, bucket.blocks, l)
+		if err != nil {
+			return Tag{}, fmt.Errorf("getting tagged event: %w", err)
+		}
+	}
+	root, diff, err := clockRoot(ctx, bucket.blocks, hd)
+	if err != nil {
+		return Tag{}, fmt.Errorf("determining pail root: %w", err)
+	}
+	// the root of a multi-event head may only exist in memory
+	var additions []block.Block
+	for _, b := range diff.Additions {
+		additions = append(additions, b)
+	}
+	err = bucket.blocks.PutBatch(ctx, additions)
+	if err != nil {
+		return Tag{}, fmt.Errorf("putting pail root: %w", err)
+	}
+
+	tag := Tag{Head: hd, Root: root}
+	err = bucket.putTag(ctx, name, tag)
+	if err != nil {
+		return Tag{}, err
+	}
+	return tag, nil
+}
+
+// TagRoot points the named tag at the passed pail root, replacing any existing
+// tag with the name. The root shard must be available locally.
+func (bucket *DsClockBucket) TagRoot(ctx context.Context, name string, root ipld.Link) (Tag, error) {
+	_, err := shard.NewFetcher(bucket.blocks).GetRoot(ctx, root)
+	if err != nil {
+		return Tag{}, fmt.Errorf("getting tagged pail root: %w", err)
+	}
+	tag := Tag{Root: root}
+	err = bucket.putTag(ctx, name, tag)
+	if err != nil {
+		return Tag{}, err
+	}
+	return tag, nil
+}
+
+func (bucket *DsClockBucket) putTag(ctx context.Context, name string, tag Tag) error {
+	key, err := tagKey(name)
+	if err != nil {
+		return err
+	}
+	b, err := marshalTag(tag)
+	if err != nil {
+		return fmt.Errorf("marshalling tag: %w", err)
+	}
+	err = bucket.data.Put(ctx, key, b)
+	if err != nil {
+		return fmt.Errorf("putting tag: %w", err)
+	}
+	return nil
+}
+
+// GetTag retrieves the named tag.
+func (bucket *DsClockBucket) GetTag(ctx context.Context, name string) (Tag, error) {
+	key, err := tagKey(name)
+	if err != nil {
+		return Tag{}, err
+	}
+	b, err := bucket.data.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return Tag{}, fmt.Errorf("getting tag: %s: %w", name, ErrNotFound)
+		}
+		return Tag{}, fmt.Errorf("getting tag: %w", err)
+	}
+	tag, err := unmarshalTag(b)
+	if err != nil {
+		return Tag{}, fmt.Errorf("unmarshalling tag: %s: %w", name, err)
+	}
+	return tag, nil
+}
+
+// Tags iterates the tags of the bucket, in name order.
+func (bucket *DsClockBucket) Tags(ctx context.Context) iter.Seq2[Entry[Tag], error] {
+	return func(yield func(Entry[Tag], error) bool) {
+		results, err := bucket.data.Query(ctx, query.Query{
+			Prefix: tagsKey.String(),
+			Orders: []query.Order{query.OrderByKey{}},
+		})
+		if err != nil {
+			yield(Entry[Tag]{}, fmt.Errorf("querying tags: %w", err))
+			return
+		}
+		defer results.Close()
+		for r := range results.Next() {
+			if r.Error != nil {
+				yield(Entry[Tag]{}, fmt.Errorf("iterating tags: %w", r.Error))
+				return
+			}
+			name := strings.TrimPrefix(r.Key, tagsKey.String()+"/")
+			tag, err := unmarshalTag(r.Value)
+			if err != nil {
+				yield(Entry[Tag]{}, fmt.Errorf("unmarshalling tag: %s: %w", name, err))
+				return
+			}
+			if !yield(Entry[Tag]{name, tag}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Untag deletes the named tag. Its events and shards are no longer kept when
+// the bucket is pruned.
+func (bucket *DsClockBucket) Untag(ctx context.Context, name string) error {
+	key, err := tagKey(name)
+	if err != nil {
+		return err
+	}
+	_, err = bucket.data.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, datastore.ErrNotFound) {
+			return fmt.Errorf("deleting tag: %s: %w", name, ErrNotFound)
+		}
+		return fmt.Errorf("getting tag: %w", err)
+	}
+	err = bucket.data.Delete(ctx, key)
+	if err != nil {
+		return fmt.Errorf("deleting tag: %w", err)
+	}
+	return nil
+}
+
+// Restore computes the changes to the bucket at the passed head that restore
+// every key to its value at the passed pail root, such as the root of a [Tag].
+// Apply them with [Apply] to restore the bucket with a single new event, so the
+// restore syncs like any other write. Changes are sorted by key.
+func Restore(ctx context.Context, blocks block.Fetcher, head []ipld.Link, root ipld.Link) ([]Change, error) {
+	mblocks := block.NewMapBlockstore()
+	blocks = block.NewTieredBlockFetcher(mblocks, blocks)
+	var curr ipld.Link
+	if len(head) == 0 {
+		empty, err := pail.New()
+		if err != nil {
+			return nil, fmt.Errorf("creating pail: %w", err)
+		}
+		_ = mblocks.Put(ctx, empty)
+		curr = empty.Link()
+	} else {
+		var diff shard.Diff
+		var err error
+		curr, diff, err = clockRoot(ctx, blocks, head)
+		if err != nil {
+			return nil, fmt.Errorf("determining pail root: %w", err)
+		}
+		for _, b := range diff.Additions {
+			_ = mblocks.Put(ctx, b)
+		}
+	}
+
+	var changes []Change
+	for c, err := range Diff(ctx, blocks, curr, root) {
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// tagRoots returns the events of the passed tags and the pail roots they point
+// at, which are kept when pruning.
+func tagRoots(tags []Tag) ([]ipld.Link, []ipld.Link) {
+	var events, roots []ipld.Link
+	for _, t := range tags {
+		events = append(events, t.Head...)
+		if t.Root != nil {
+			roots = append(roots, t.Root)
+		}
+	}
+	return events, roots
+}
+
+func marshalTag(tag Tag) ([]byte, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	ma, err := nb.BeginMap(2)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("head")
+	if err != nil {
+		return nil, err
+	}
+	la, err := ma.AssembleValue().BeginList(int64(len(tag.Head)))
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range tag.Head {
+		err = la.AssembleValue().AssignLink(l)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = la.Finish()
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("root")
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleValue().AssignLink(tag.Root)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer([]byte{})
+	err = dagcbor.Encode(nb.Build(), buf)
+	if err != nil {
+		return nil, fmt.Errorf("CBOR encoding: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func unmarshalTag(b []byte) (Tag, error) {
+	var tag Tag
+	np := basicnode.Prototype.Map
+	nb := np.NewBuilder()
+	err := dagcbor.Decode(nb, bytes.NewReader(b))
+	if err != nil {
+		return tag, fmt.Errorf("CBOR decoding: %w", err)
+	}
+	n := nb.Build()
+
+	hn, err := n.LookupByString("head")
+	if err != nil {
+		return tag, fmt.Errorf("looking up head: %w", err)
+	}
+	if hn.Kind() != datamodel.Kind_List {
+		return tag, errors.New("head is not a list")
+	}
+	it := hn.ListIterator()
+	for !it.Done() {
+		_, ln, err := it.Next()
+		if err != nil {
+			return tag, fmt.Errorf("iterating head: %w", err)
+		}
+		l, err := ln.AsLink()
+		if err != nil {
+			return tag, fmt.Errorf("decoding head event as link: %w", err)
+		}
+		tag.Head = append(tag.Head, l)
+	}
+	rn, err := n.LookupByString("root")
+	if err != nil {
+		return tag, fmt.Errorf("looking up root: %w", err)
+	}
+	tag.Root, err = rn.AsLink()
+	if err != nil {
+		return tag, fmt.Errorf("decoding root as link: %w", err)
+	}
+	return tag, nil
+}
@@ -0,0 +1,56 @@
+package bucket
+
+import (
+	"context"
+	"testing"
+
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTag(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("restores a tag as a single event", func(t *testing.T) {
+		bk := newTestBucket(t, WithHistory())
+		putN(t, bk, "k", 3)
+		tag, err := bk.Tag(ctx, "v1", nil)
+		require.NoError(t, err)
+		before := collectEntries(t, bk)
+		putN(t, bk, "new", 1)
+		require.NoError(t, bk.Put(ctx, "k0", testutil.RandomLink(t)))
+		require.NoError(t, bk.Del(ctx, "k1"))
+		prev, err := bk.Head(ctx)
+		require.NoError(t, err)
+
+		changes, err := Restore(ctx, bk.Blocks(), prev, tag.Root)
+		require.NoError(t, err)
+		require.Len(t, changes, 3)
+		require.NoError(t, Apply(ctx, bk, changes))
+
+		head, err := bk.Head(ctx)
+		require.NoError(t, err)
+		require.Len(t, head, 1)
+		evt, err := getClockEvent(ctx, bk.Blocks(), head[0])
+		require.NoError(t, err)
+		require.Equal(t, TypeBatch, evt.Data().Type())
+		require.Equal(t, prev, evt.Parents())
+		require.Equal(t, before, collectEntries(t, bk))
+		root, err := bk.Root(ctx)
+		require.NoError(t, err)
+		require.Equal(t, tag.Root, root)
+	})
+
+	t.Run("restores an empty bucket", func(t *testing.T) {
+		src := newTestBucket(t, WithHistory())
+		putN(t, src, "k", 2)
+		root, err := src.Root(ctx)
+		require.NoError(t, err)
+
+		bk := newTestBucket(t, WithHistory())
+		changes, err := Restore(ctx, src.Blocks(), nil, root)
+		require.NoError(t, err)
+		require.NoError(t, Apply(ctx, bk, changes))
+		require.Equal(t, collectEntries(t, src), collectEntries(t, bk))
+	})
+}
@@ -0,0 +1,48 @@
+package bucket
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/go-pail/shard"
+)
+
+// walk traverses a DAG breadth first from the passed links. The passed function
+// is called once for each distinct link and returns the links to follow.
+func walk(links []ipld.Link, visit func(l ipld.Link) ([]ipld.Link, error)) error {
+	seen := map[ipld.Link]struct{}{}
+	for len(links) > 0 {
+		var next []ipld.Link
+		for _, l := range links {
+			if _, ok := seen[l]; ok {
+				continue
+			}
+			seen[l] = struct{}{}
+			ls, err := visit(l)
+			if err != nil {
+				return err
+			}
+			next = append(next, ls...)
+		}
+		links = next
+	}
+	return nil
+}
+
+// shardLinks decodes the passed pail shard and returns the links to its child
+// shards.
+func shardLinks(b block.Block) ([]ipld.Link, error) {
+	s, err := shard.Unmarshal(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("decoding shard: %w", err)
+	}
+	var links []ipld.Link
+	for _, e := range s.Entries() {
+		if e.Value().Shard() != nil && !slices.Contains(links, e.Value().Shard()) {
+			links = append(links, e.Value().Shard())
+		}
+	}
+	return links, nil
+}
@@ -0,0 +1,186 @@
+package clock
+
+import (
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/storacha/go-ucanto/core/result/failure"
+	ucschema "github.com/storacha/go-ucanto/core/schema"
+	"github.com/storacha/go-ucanto/ucan"
+	"github.com/storacha/go-ucanto/validator"
+)
+
+const (
+	// HeadAbility is the ability to read the head of a merkle clock.
+	HeadAbility = "clock/head"
+	// AdvanceAbility is the ability to advance a merkle clock with an event.
+	AdvanceAbility = "clock/advance"
+)
+
+var typeSystem = mustLoadSchema(`
+	type HeadCaveats struct {}
+	type AdvanceCaveats struct {
+		event optional Link
+	}
+	type HeadOk struct {
+		head [Link]
+	}
+	type AdvanceOk struct {
+		head [Link]
+	}
+`)
+
+func mustLoadSchema(src string) *schema.TypeSystem {
+	ts, err := ipld.LoadSchemaBytes([]byte(src))
+	if err != nil {
+		panic(fmt.Errorf("loading clock schema: %w", err))
+	}
+	return ts
+}
+
+// HeadOkType is the IPLD schema type of a successful [Head] result.
+func HeadOkType() schema.Type {
+	return typeSystem.TypeByName("HeadOk")
+}
+
+// AdvanceOkType is the IPLD schema type of a successful [Advance] result.
+func AdvanceOkType() schema.Type {
+	return typeSystem.TypeByName("AdvanceOk")
+}
+
+// FailureType is the IPLD schema type of a failed invocation result. Failures
+// are not bound to a specific structure, but typically have a "name" and a
+// "message".
+func FailureType() schema.Type {
+	return typeSystem.TypeByName("Any")
+}
+
+// HeadCaveats are the caveats of the [Head] capability. There are none.
+type HeadCaveats struct{}
+
+func (c HeadCaveats) ToIPLD() (datamodel.Node, error) {
+	return ucan.NoCaveats{}.ToIPLD()
+}
+
+// AdvanceCaveats are the caveats of the [Advance] capability.
+type AdvanceCaveats struct {
+	// Event is the link to the event the clock is advanced with. It may be
+	// omitted in a delegation to allow advancing with any event.
+	Event ipld.Link
+}
+
+func (c AdvanceCaveats) ToIPLD() (datamodel.Node, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	ma, err := nb.BeginMap(1)
+	if err != nil {
+		return nil, fmt.Errorf("beginning map: %w", err)
+	}
+	if c.Event != nil {
+		err = ma.AssembleKey().AssignString("event")
+		if err != nil {
+			return nil, fmt.Errorf("assembling event key: %w", err)
+		}
+		err = ma.AssembleValue().AssignLink(c.Event)
+		if err != nil {
+			return nil, fmt.Errorf("assembling event value: %w", err)
+		}
+	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("finishing map: %w", err)
+	}
+	return nb.Build(), nil
+}
+
+// HeadOk is the result of a successful [Head] invocation.
+type HeadOk struct {
+	Head []ipld.Link
+}
+
+func (ok HeadOk) ToIPLD() (datamodel.Node, error) {
+	return headNode(ok.Head)
+}
+
+// AdvanceOk is the result of a successful [Advance] invocation.
+type AdvanceOk struct {
+	// Head is the head of the merkle clock after it was advanced.
+	Head []ipld.Link
+}
+
+func (ok AdvanceOk) ToIPLD() (datamodel.Node, error) {
+	return headNode(ok.Head)
+}
+
+func headNode(head []ipld.Link) (datamodel.Node, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	ma, err := nb.BeginMap(1)
+	if err != nil {
+		return nil, fmt.Errorf("beginning map: %w", err)
+	}
+	err = ma.AssembleKey().AssignString("head")
+	if err != nil {
+		return nil, fmt.Errorf("assembling head key: %w", err)
+	}
+	la, err := ma.AssembleValue().BeginList(int64(len(head)))
+	if err != nil {
+		return nil, fmt.Errorf("beginning head list: %w", err)
+	}
+	for _, l := range head {
+		err = la.AssembleValue().AssignLink(l)
+		if err != nil {
+			return nil, fmt.Errorf("assembling head link: %w", err)
+		}
+	}
+	err = la.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("finishing head list: %w", err)
+	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("finishing map: %w", err)
+	}
+	return nb.Build(), nil
+}
+
+// Head is the capability to read the head of the merkle clock of a bucket.
+var Head = NewHeadCapability(ucschema.DIDString())
+
+// Advance is the capability to advance the merkle clock of a bucket.
+var Advance = NewAdvanceCapability(ucschema.DIDString())
+
+// NewHeadCapability creates a [Head] capability parser whose resource is read
+// by the passed reader. It can be used to restrict the resource to a specific
+// bucket.
+func NewHeadCapability(with ucschema.Reader[string, ucan.Resource]) validator.CapabilityParser[HeadCaveats] {
+	return validator.NewCapability(
+		HeadAbility,
+		with,
+		ucschema.Struct[HeadCaveats](typeSystem.TypeByName("HeadCaveats"), nil),
+		nil,
+	)
+}
+
+// NewAdvanceCapability creates an [Advance] capability parser whose resource
+// is read by the passed reader. It can be used to restrict the resource to a
+// specific bucket.
+func NewAdvanceCapability(with ucschema.Reader[string, ucan.Resource]) validator.CapabilityParser[AdvanceCaveats] {
+	return validator.NewCapability(
+		AdvanceAbility,
+		with,
+		ucschema.Struct[AdvanceCaveats](typeSystem.TypeByName("AdvanceCaveats"), nil),
+		func(claimed, delegated ucan.Capability[AdvanceCaveats]) failure.Failure {
+			if claimed.With() != delegated.With() {
+				return failure.FromError(fmt.Errorf("resource %s does not match delegated %s", claimed.With(), delegated.With()))
+			}
+			if delegated.Nb().Event != nil && claimed.Nb().Event != delegated.Nb().Event {
+				return failure.FromError(fmt.Errorf("event %s violates imposed %s constraint", claimed.Nb().Event, delegated.Nb().Event))
+			}
+			return nil
+		},
+	)
+}
@@ -0,0 +1,100 @@
+package clock_test
+
+import (
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/capabilities/clock"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/core/schema"
+	"github.com/storacha/go-ucanto/principal"
+	"github.com/storacha/go-ucanto/principal/ed25519/verifier"
+	"github.com/storacha/go-ucanto/validator"
+	"github.com/stretchr/testify/require"
+)
+
+// access validates the invocation against the capability to advance the
+// merkle clock of the bucket, as the bucket.
+func access(t *testing.T, bucket principal.Signer, inv delegation.Delegation) error {
+	t.Helper()
+	ctx := validator.NewValidationContext(
+		bucket.Verifier(),
+		clock.NewAdvanceCapability(schema.Literal(bucket.DID().String())),
+		validator.IsSelfIssued,
+		func(auth validator.Authorization[any]) validator.Revoked { return nil },
+		validator.ProofUnavailable,
+		func(str string) (principal.Verifier, error) { return verifier.Parse(str) },
+		validator.FailDIDKeyResolution,
+	)
+	_, err := validator.Access(inv, ctx)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func TestCaveats(t *testing.T) {
+	t.Run("advance with an event", func(t *testing.T) {
+		event := testutil.RandomLink(t)
+		nd, err := clock.AdvanceCaveats{Event: event}.ToIPLD()
+		require.NoError(t, err)
+		n, err := nd.LookupByString("event")
+		require.NoError(t, err)
+		l, err := n.AsLink()
+		require.NoError(t, err)
+		require.Equal(t, event, l)
+	})
+
+	t.Run("advance with any event", func(t *testing.T) {
+		nd, err := clock.AdvanceCaveats{}.ToIPLD()
+		require.NoError(t, err)
+		require.Equal(t, int64(0), nd.Length())
+	})
+
+	t.Run("head", func(t *testing.T) {
+		head := []ipld.Link{testutil.RandomLink(t), testutil.RandomLink(t)}
+		nd, err := clock.AdvanceOk{Head: head}.ToIPLD()
+		require.NoError(t, err)
+		n, err := nd.LookupByString("head")
+		require.NoError(t, err)
+		require.Equal(t, int64(2), n.Length())
+		for i, l := range head {
+			v, err := n.LookupByIndex(int64(i))
+			require.NoError(t, err)
+			got, err := v.AsLink()
+			require.NoError(t, err)
+			require.Equal(t, l, got)
+		}
+	})
+}
+
+func TestAdvance(t *testing.T) {
+	bucket, writer := testutil.NewSigner(t), testutil.NewSigner(t)
+
+	t.Run("delegated for any event", func(t *testing.T) {
+		proof, err := clock.Advance.Delegate(bucket, writer, bucket.DID().String(), clock.AdvanceCaveats{})
+		require.NoError(t, err)
+		inv, err := clock.Advance.Invoke(writer, bucket, bucket.DID().String(), clock.AdvanceCaveats{Event: testutil.RandomLink(t)}, delegation.WithProof(delegation.FromDelegation(proof)))
+		require.NoError(t, err)
+		require.NoError(t, access(t, bucket, inv))
+	})
+
+	t.Run("delegated for a single event", func(t *testing.T) {
+		event := testutil.RandomLink(t)
+		proof, err := clock.Advance.Delegate(bucket, writer, bucket.DID().String(), clock.AdvanceCaveats{Event: event})
+		require.NoError(t, err)
+		inv, err := clock.Advance.Invoke(writer, bucket, bucket.DID().String(), clock.AdvanceCaveats{Event: event}, delegation.WithProof(delegation.FromDelegation(proof)))
+		require.NoError(t, err)
+		require.NoError(t, access(t, bucket, inv))
+	})
+
+	t.Run("delegated for another bucket", func(t *testing.T) {
+		other := testutil.NewSigner(t)
+		proof, err := clock.Advance.Delegate(other, writer, other.DID().String(), clock.AdvanceCaveats{})
+		require.NoError(t, err)
+		inv, err := clock.Advance.Invoke(writer, bucket, bucket.DID().String(), clock.AdvanceCaveats{}, delegation.WithProof(delegation.FromDelegation(proof)))
+		require.NoError(t, err)
+		require.Error(t, access(t, bucket, inv))
+	})
+}
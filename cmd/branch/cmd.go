@@ -0,0 +1,212 @@
+package branch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/cmd/util"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/urfave/cli/v2"
+)
+
+var log = logging.Logger("branch")
+
+// currentBranch returns the current bucket and the bucket on its current
+// branch, along with the name of the branch.
+func currentBranch(cCtx *cli.Context) (bucket.Bucket[ipld.Link], bucket.Bucket[ipld.Link], string, error) {
+	datadir := util.EnsureDataDir(cCtx.String("datadir"))
+	userdata := util.UserDataStore(context.Background(), datadir)
+	curr := util.GetCurrent(datadir)
+	if curr == did.Undef {
+		return nil, nil, "", fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+	}
+	bk, err := userdata.Bucket(context.Background(), curr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	name := util.GetBranch(datadir, curr)
+	bbk, err := util.BucketOnBranch(context.Background(), bk, name)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return bk, bbk, name, nil
+}
+
+// switchBranch makes the named branch the one the CLI reads and writes.
+func switchBranch(cCtx *cli.Context, name string) {
+	datadir := util.EnsureDataDir(cCtx.String("datadir"))
+	util.SetBranch(datadir, util.GetCurrent(datadir), name)
+}
+
+var Command = &cli.Command{
+	Name:      "branch",
+	Usage:     "List local branches of the bucket, or fork the current branch into a new one",
+	Args:      true,
+	ArgsUsage: "[name]",
+	Description: "A branch has its own head but shares the data of the bucket. Writes made on a\n" +
+		"branch do not change the main branch until the branch is merged into it, and\n" +
+		"only the main branch is synced with remotes.",
+	Action: func(cCtx *cli.Context) error {
+		bk, bbk, curr, err := currentBranch(cCtx)
+		if err != nil {
+			return err
+		}
+		name := cCtx.Args().First()
+		if name != "" {
+			br, ok := bbk.(bucket.Brancher)
+			if !ok {
+				return fmt.Errorf("bucket is not a brancher")
+			}
+			_, err := br.Fork(context.Background(), name)
+			if err != nil {
+				return err
+			}
+			return nil
+		}
+
+		br, ok := bk.(bucket.Brancher)
+		if !ok {
+			return fmt.Errorf("bucket is not a brancher")
+		}
+		printBranch(bucket.MainBranch, nil, curr)
+		for entry, err := range br.Branches(context.Background()) {
+			if err != nil {
+				log.Fatal(err)
+			}
+			printBranch(entry.Key, entry.Value, curr)
+		}
+		return nil
+	},
+	Subcommands: []*cli.Command{
+		{
+			Name:      "switch",
+			Usage:     "Switch to a branch, so that reads and writes use it",
+			Args:      true,
+			ArgsUsage: "<name>",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:    "create",
+					Aliases: []string{"c"},
+					Usage:   "fork the current branch into the new branch first",
+				},
+			},
+			Action: func(cCtx *cli.Context) error {
+				name := cCtx.Args().First()
+				if name == "" {
+					return fmt.Errorf("missing branch name")
+				}
+				_, bbk, _, err := currentBranch(cCtx)
+				if err != nil {
+					return err
+				}
+				br, ok := bbk.(bucket.Brancher)
+				if !ok {
+					return fmt.Errorf("bucket is not a brancher")
+				}
+				if cCtx.Bool("create") {
+					_, err = br.Fork(context.Background(), name)
+				} else {
+					_, err = br.Branch(context.Background(), name)
+				}
+				if err != nil {
+					if errors.Is(err, bucket.ErrNotFound) {
+						return fmt.Errorf("branch not found: %s", name)
+					}
+					return err
+				}
+				switchBranch(cCtx, name)
+				return nil
+			},
+		},
+		{
+			Name:      "merge",
+			Usage:     "Merge a branch into the current branch",
+			Args:      true,
+			ArgsUsage: "<name>",
+			Action: func(cCtx *cli.Context) error {
+				name := cCtx.Args().First()
+				if name == "" {
+					return fmt.Errorf("missing branch name")
+				}
+				_, bbk, curr, err := currentBranch(cCtx)
+				if err != nil {
+					return err
+				}
+				if name == curr {
+					return fmt.Errorf("cannot merge a branch into itself: %s", name)
+				}
+				replica, ok := bbk.(bucket.Replica)
+				if !ok {
+					return fmt.Errorf("bucket is not a replica")
+				}
+				res, err := bucket.MergeBranch(context.Background(), replica, name)
+				if err != nil {
+					if errors.Is(err, bucket.ErrNotFound) {
+						return fmt.Errorf("branch not found: %s", name)
+					}
+					log.Fatal(err)
+				}
+				root, err := bbk.Root(context.Background())
+				if err != nil {
+					log.Fatal(err)
+				}
+				fmt.Println(root.String())
+				util.PrintConflicts(res.Conflicts)
+				return nil
+			},
+		},
+		{
+			Name:      "rm",
+			Aliases:   []string{"remove"},
+			Usage:     "Delete a branch",
+			Args:      true,
+			ArgsUsage: "<name>",
+			Action: func(cCtx *cli.Context) error {
+				name := cCtx.Args().First()
+				if name == "" {
+					return fmt.Errorf("missing branch name")
+				}
+				bk, _, curr, err := currentBranch(cCtx)
+				if err != nil {
+					return err
+				}
+				if name == curr {
+					return fmt.Errorf("cannot delete the current branch, switch to another first")
+				}
+				br, ok := bk.(bucket.Brancher)
+				if !ok {
+					return fmt.Errorf("bucket is not a brancher")
+				}
+				err = br.DeleteBranch(context.Background(), name)
+				if err != nil {
+					if errors.Is(err, bucket.ErrNotFound) {
+						return fmt.Errorf("branch not found: %s", name)
+					}
+					return err
+				}
+				return nil
+			},
+		},
+	},
+}
+
+func printBranch(name string, head []ipld.Link, curr string) {
+	marker := " "
+	if name == curr {
+		marker = "*"
+	}
+	if len(head) == 0 {
+		fmt.Printf("%s %s\n", marker, name)
+		return
+	}
+	var links []string
+	for _, l := range head {
+		links = append(links, l.String())
+	}
+	fmt.Printf("%s %s\t%s\n", marker, name, strings.Join(links, ","))
+}
@@ -0,0 +1,18 @@
+package branch
+
+import (
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintBranch(t *testing.T) {
+	a, b := testutil.RandomLink(t), testutil.RandomLink(t)
+	out := testutil.CaptureStdout(t, func() { printBranch("feature", []ipld.Link{a, b}, "feature") })
+	require.Equal(t, "* feature\t"+a.String()+","+b.String()+"\n", out)
+
+	out = testutil.CaptureStdout(t, func() { printBranch("empty", nil, "main") })
+	require.Equal(t, "  empty\n", out)
+}
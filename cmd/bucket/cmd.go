@@ -4,12 +4,12 @@ import (
 	"context"
 	"fmt"
 	"slices"
+	"time"
 
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/storacha/fam/cmd/util"
 	"github.com/storacha/go-ucanto/core/delegation"
 	"github.com/storacha/go-ucanto/did"
-	"github.com/storacha/go-ucanto/principal/ed25519/signer"
 	"github.com/storacha/go-ucanto/ucan"
 	"github.com/urfave/cli/v2"
 )
@@ -57,19 +57,8 @@ var Command = &cli.Command{
 				datadir := util.EnsureDataDir(cCtx.String("datadir"))
 				userdata := util.UserDataStore(context.Background(), datadir)
 				arg := cCtx.Args().Get(0)
-				// TODO: remove
 				if arg == "" {
-					issuer, _ := signer.Generate()
-					audience, _ := userdata.ID(context.Background())
-					d, _ := delegation.Delegate(
-						issuer,
-						audience,
-						[]ucan.Capability[ucan.NoCaveats]{
-							ucan.NewCapability("space/blob/*", issuer.DID().String(), ucan.NoCaveats{}),
-							ucan.NewCapability("clock/*", issuer.DID().String(), ucan.NoCaveats{}),
-						},
-					)
-					arg, _ = delegation.Format(d)
+					return fmt.Errorf("missing grant, ask the owner of the bucket to share it using `fam bucket share`")
 				}
 				proof, err := delegation.Parse(arg)
 				if err != nil {
@@ -122,6 +111,12 @@ var Command = &cli.Command{
 			Usage:     "Share a bucket",
 			Args:      true,
 			ArgsUsage: "<recipient>",
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:  "expiration",
+					Usage: "Time after which the grant expires, it never expires if unset",
+				},
+			},
 			Action: func(cCtx *cli.Context) error {
 				datadir := util.EnsureDataDir(cCtx.String("datadir"))
 				userdata := util.UserDataStore(context.Background(), datadir)
@@ -148,6 +143,12 @@ var Command = &cli.Command{
 				if err != nil {
 					log.Fatal(err)
 				}
+				opts := []delegation.Option{delegation.WithProof(delegation.FromDelegation(proof))}
+				if exp := cCtx.Duration("expiration"); exp > 0 {
+					opts = append(opts, delegation.WithExpiration(int(time.Now().Add(exp).Unix())))
+				} else {
+					opts = append(opts, delegation.WithNoExpiration())
+				}
 				d, err := delegation.Delegate(
 					issuer,
 					audience,
@@ -155,7 +156,7 @@ var Command = &cli.Command{
 						ucan.NewCapability("space/blob/*", curr.String(), ucan.NoCaveats{}),
 						ucan.NewCapability("clock/*", curr.String(), ucan.NoCaveats{}),
 					},
-					delegation.WithProof(delegation.FromDelegation(proof)),
+					opts...,
 				)
 				if err != nil {
 					log.Fatal(err)
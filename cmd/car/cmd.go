@@ -0,0 +1,181 @@
+package car
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log/v2"
+	carv2 "github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/storage"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/cmd/util"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/urfave/cli/v2"
+)
+
+var log = logging.Logger("car")
+
+var ExportCommand = &cli.Command{
+	Name:      "export",
+	Usage:     "Export the bucket history to a CAR file, with the head as roots",
+	Args:      true,
+	ArgsUsage: "<file.car>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "export only events since the head made of these event CIDs, separated by commas",
+		},
+		&cli.BoolFlag{
+			Name:  "v1",
+			Usage: "write a CARv1 instead of a CARv2",
+		},
+	},
+	Action: func(cCtx *cli.Context) error {
+		path := cCtx.Args().Get(0)
+		if path == "" {
+			return fmt.Errorf("missing CAR file path")
+		}
+		since, err := util.ParseLinks(cCtx.String("since"))
+		if err != nil {
+			return fmt.Errorf("parsing since event CIDs: %w", err)
+		}
+
+		datadir := util.EnsureDataDir(cCtx.String("datadir"))
+		userdata := util.UserDataStore(context.Background(), datadir)
+		curr := util.GetCurrent(datadir)
+		if curr == did.Undef {
+			return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+		}
+		replica, err := userdata.Replica(context.Background(), curr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		head, err := replica.Head(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(head) == 0 {
+			return fmt.Errorf("bucket is empty, nothing to export")
+		}
+
+		var roots []cid.Cid
+		for _, l := range head {
+			roots = append(roots, l.(cidlink.Link).Cid)
+		}
+		var opts []carv2.Option
+		if cCtx.Bool("v1") {
+			opts = append(opts, carv2.WriteAsCarV1(true))
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("creating CAR file: %w", err)
+		}
+		defer f.Close()
+		w, err := storage.NewWritable(f, roots, opts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		count := 0
+		for b, err := range bucket.Export(context.Background(), replica.Blocks(), head, since) {
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = w.Put(context.Background(), b.Link().(cidlink.Link).Cid.KeyString(), b.Bytes())
+			if err != nil {
+				log.Fatal(err)
+			}
+			count++
+		}
+		err = w.Finalize()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, l := range head {
+			fmt.Println(l.String())
+		}
+		fmt.Printf("%d blocks exported\n", count)
+		return nil
+	},
+}
+
+var ImportCommand = &cli.Command{
+	Name:      "import-car",
+	Usage:     "Import bucket history from a CAR file and advance the clock with its roots",
+	Args:      true,
+	ArgsUsage: "<file.car>",
+	Action: func(cCtx *cli.Context) error {
+		path := cCtx.Args().Get(0)
+		if path == "" {
+			return fmt.Errorf("missing CAR file path")
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("opening CAR file: %w", err)
+		}
+		defer f.Close()
+
+		// CARv1 and CARv2 are both supported
+		br, err := carv2.NewBlockReader(f)
+		if err != nil {
+			return fmt.Errorf("reading CAR header: %w", err)
+		}
+		var head []ipld.Link
+		for _, c := range br.Roots {
+			head = append(head, cidlink.Link{Cid: c})
+		}
+		if len(head) == 0 {
+			return fmt.Errorf("CAR has no roots")
+		}
+		blocks := block.NewMapBlockstore()
+		for {
+			b, err := br.Next()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return fmt.Errorf("reading CAR block: %w", err)
+			}
+			blk, err := block.Verify(cidlink.Link{Cid: b.Cid()}, b.RawData())
+			if err != nil {
+				return err
+			}
+			err = blocks.Put(context.Background(), blk)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		datadir := util.EnsureDataDir(cCtx.String("datadir"))
+		userdata := util.UserDataStore(context.Background(), datadir)
+		curr := util.GetCurrent(datadir)
+		if curr == did.Undef {
+			return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+		}
+		bk, err := userdata.Bucket(context.Background(), curr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		replica, ok := bk.(bucket.Replica)
+		if !ok {
+			return fmt.Errorf("bucket is not a replica")
+		}
+		_, err = bucket.Import(context.Background(), replica, head, blocks)
+		if err != nil {
+			log.Fatal(err)
+		}
+		root, err := bk.Root(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(root.String())
+		return nil
+	},
+}
@@ -0,0 +1,93 @@
+package car
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/cmd/util"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/principal"
+	"github.com/storacha/go-ucanto/principal/ed25519/signer"
+	"github.com/storacha/go-ucanto/ucan"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+// newDataDir creates a data directory with the bucket selected, whose data is
+// written by the passed function.
+func newDataDir(t *testing.T, space principal.Signer, write func(bk bucket.Bucket[ipld.Link])) string {
+	t.Helper()
+	ctx := context.Background()
+	dir := t.TempDir()
+	userdata := util.UserDataStore(ctx, dir)
+	id, err := userdata.ID(ctx)
+	require.NoError(t, err)
+	proof, err := delegation.Delegate(space, id, []ucan.Capability[ucan.NoCaveats]{
+		ucan.NewCapability("*", space.DID().String(), ucan.NoCaveats{}),
+	})
+	require.NoError(t, err)
+	bid, err := userdata.AddBucket(ctx, proof)
+	require.NoError(t, err)
+	util.SetCurrent(dir, bid)
+	bk, err := userdata.Bucket(ctx, bid)
+	require.NoError(t, err)
+	write(bk)
+	// commands open the data directory themselves
+	require.NoError(t, userdata.Close())
+	return dir
+}
+
+// run runs the command on the data directory and returns what it printed.
+func run(t *testing.T, dir string, cmd *cli.Command, args ...string) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	app := &cli.App{
+		Flags:    []cli.Flag{&cli.StringFlag{Name: "datadir"}},
+		Commands: []*cli.Command{cmd},
+	}
+	err = app.Run(append([]string{"fam", "--datadir", dir, cmd.Name}, args...))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestExportImport(t *testing.T) {
+	ctx := context.Background()
+	space, err := signer.Generate()
+	require.NoError(t, err)
+
+	for name, flags := range map[string][]string{"CARv2": nil, "CARv1": {"--v1"}} {
+		t.Run(name, func(t *testing.T) {
+			var root ipld.Link
+			src := newDataDir(t, space, func(bk bucket.Bucket[ipld.Link]) {
+				for _, k := range []string{"a", "b", "c"} {
+					require.NoError(t, bk.Put(ctx, k, testutil.RandomLink(t)))
+				}
+				root, err = bk.Root(ctx)
+				require.NoError(t, err)
+			})
+			dst := newDataDir(t, space, func(bk bucket.Bucket[ipld.Link]) {})
+
+			path := filepath.Join(t.TempDir(), "bucket.car")
+			out := run(t, src, ExportCommand, append(flags, path)...)
+			require.Contains(t, out, "blocks exported\n")
+
+			out = run(t, dst, ImportCommand, path)
+			require.Equal(t, root.String(), strings.TrimSpace(out))
+		})
+	}
+}
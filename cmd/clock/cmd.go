@@ -0,0 +1,127 @@
+package clock
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/cmd/util"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/urfave/cli/v2"
+)
+
+var log = logging.Logger("clock")
+
+var Command = &cli.Command{
+	Name:  "clock",
+	Usage: "Inspect the merkle clock of the bucket",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "graph",
+			Usage: "Render the merkle clock event DAG from the current head",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "format",
+					Aliases: []string{"f"},
+					Usage:   "output format, dot or mermaid",
+					Value:   string(bucket.GraphDOT),
+				},
+				&cli.BoolFlag{
+					Name:    "remotes",
+					Aliases: []string{"r"},
+					Usage:   "include the last known heads of remotes",
+				},
+			},
+			Action: func(cCtx *cli.Context) error {
+				datadir := util.EnsureDataDir(cCtx.String("datadir"))
+				userdata := util.UserDataStore(context.Background(), datadir)
+				curr := util.GetCurrent(datadir)
+				if curr == did.Undef {
+					return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+				}
+				format := bucket.GraphFormat(cCtx.String("format"))
+				if format != bucket.GraphDOT && format != bucket.GraphMermaid {
+					return fmt.Errorf("unknown format: %s, expected dot or mermaid", format)
+				}
+				replica, err := userdata.Replica(context.Background(), curr)
+				if err != nil {
+					log.Fatal(err)
+				}
+				head, err := replica.Head(context.Background())
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				remotes := map[string][]ipld.Link{}
+				if cCtx.Bool("remotes") {
+					bk, err := userdata.Bucket(context.Background(), curr)
+					if err != nil {
+						log.Fatal(err)
+					}
+					remotes, err = remoteHeads(context.Background(), bk)
+					if err != nil {
+						log.Fatal(err)
+					}
+				}
+
+				for line, err := range bucket.Graph(context.Background(), replica.Blocks(), head, remotes, format) {
+					if err != nil {
+						log.Fatal(err)
+					}
+					fmt.Println(line)
+				}
+				return nil
+			},
+		},
+	},
+}
+
+// remoteHeads collects the last known head of every configured and discovered
+// remote that has been synced.
+func remoteHeads(ctx context.Context, bk bucket.Bucket[ipld.Link]) (map[string][]ipld.Link, error) {
+	nbk, ok := bk.(bucket.Networker)
+	if !ok {
+		return nil, fmt.Errorf("bucket is not a networker")
+	}
+	tracker, ok := bk.(bucket.Tracker)
+	if !ok {
+		return nil, fmt.Errorf("bucket is not a tracker")
+	}
+	rems, err := nbk.Remotes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting remotes: %w", err)
+	}
+	var names []string
+	for entry, err := range rems.Entries(ctx) {
+		if err != nil {
+			return nil, fmt.Errorf("listing remotes: %w", err)
+		}
+		names = append(names, entry.Key)
+	}
+	if dbk, ok := bk.(bucket.Discoverer); ok {
+		discovered, err := dbk.Discovered(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing discovered remotes: %w", err)
+		}
+		for name := range discovered {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	heads := map[string][]ipld.Link{}
+	for _, name := range names {
+		head, err := tracker.RemoteHead(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("getting remote head: %s: %w", name, err)
+		}
+		if len(head) > 0 {
+			heads[name] = head
+		}
+	}
+	return heads, nil
+}
@@ -0,0 +1,49 @@
+package clock
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/fam/internal/testutil/buckettest"
+	"github.com/stretchr/testify/require"
+)
+
+func newAddrInfo(t *testing.T) peer.AddrInfo {
+	t.Helper()
+	_, pub, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	id, err := peer.IDFromPublicKey(pub)
+	require.NoError(t, err)
+	return peer.AddrInfo{ID: id}
+}
+
+func TestRemoteHeads(t *testing.T) {
+	ctx := context.Background()
+	bk := buckettest.NewBucket(t)
+	nbk, err := bucket.NewNetworkClockBucket(bk, bk.Blocks(), bucket.NewRemoteBucket(bk, buckettest.NewBucket(t)), bk, nil, nil, nil)
+	require.NoError(t, err)
+	rems, err := nbk.Remotes(ctx)
+	require.NoError(t, err)
+	require.NoError(t, rems.Put(ctx, "origin", newAddrInfo(t)))
+	require.NoError(t, rems.Put(ctx, "never", newAddrInfo(t)))
+	require.NoError(t, nbk.AddDiscovered(ctx, "lan", newAddrInfo(t)))
+
+	require.NoError(t, bk.Put(ctx, "k", testutil.RandomLink(t)))
+	origin, err := bk.Head(ctx)
+	require.NoError(t, err)
+	require.NoError(t, bk.Put(ctx, "k2", testutil.RandomLink(t)))
+	lan, err := bk.Head(ctx)
+	require.NoError(t, err)
+	require.NoError(t, nbk.SetRemoteHead(ctx, "origin", origin))
+	require.NoError(t, nbk.SetRemoteHead(ctx, "lan", lan))
+
+	heads, err := remoteHeads(ctx, nbk)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]ipld.Link{"origin": origin, "lan": lan}, heads)
+}
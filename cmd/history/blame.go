@@ -0,0 +1,86 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/cmd/util"
+	"github.com/storacha/fam/p2p"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/urfave/cli/v2"
+)
+
+var BlameCommand = &cli.Command{
+	Name:      "blame",
+	Usage:     "Show who changed a key and when, newest first",
+	Args:      true,
+	ArgsUsage: "<key>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "print events as dag-json, one per line",
+		},
+	},
+	Action: func(cCtx *cli.Context) error {
+		if cCtx.Args().Len() != 1 {
+			return fmt.Errorf("expected a key")
+		}
+		key := cCtx.Args().First()
+
+		datadir := util.EnsureDataDir(cCtx.String("datadir"))
+		userdata := util.UserDataStore(context.Background(), datadir)
+		curr := util.GetCurrent(datadir)
+		if curr == did.Undef {
+			return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+		}
+		replica, err := currentReplica(context.Background(), datadir, userdata, curr)
+		if err != nil {
+			return err
+		}
+		head, err := replica.Head(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for evt, err := range bucket.History(context.Background(), replica.Blocks(), head, bucket.WithAuthors(p2p.NewEventVerifier(curr))) {
+			if err != nil {
+				log.Fatal(err)
+			}
+			change, ok := changeOf(evt, key)
+			if !ok {
+				continue
+			}
+			if cCtx.Bool("json") {
+				err = printJSON(evt)
+				if err != nil {
+					log.Fatal(err)
+				}
+				continue
+			}
+			author := "unknown"
+			if evt.AuthorErr != nil {
+				author = "unverified"
+			} else if evt.Author != did.Undef {
+				author = evt.Author.String()
+			}
+			date := "unknown"
+			if !evt.Time.IsZero() {
+				date = evt.Time.Format(time.RFC3339)
+			}
+			op, value := "del", "-"
+			if change.Value != nil {
+				op, value = "put", change.Value.String()
+			}
+			if evt.Type == bucket.TypeBatch {
+				op = evt.Type + " " + op
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", evt.Link, date, author, op, value)
+		}
+		return w.Flush()
+	},
+}
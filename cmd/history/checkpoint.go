@@ -0,0 +1,82 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/cmd/util"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/urfave/cli/v2"
+)
+
+var CheckpointCommand = &cli.Command{
+	Name:  "checkpoint",
+	Usage: "Add a checkpoint to the history of the current bucket, so that older events can be pruned",
+	Description: "A checkpoint snapshots the bucket at the current head. Replicas fetching the\n" +
+		"bucket stop at the latest checkpoint instead of fetching the whole history.",
+	Action: func(cCtx *cli.Context) error {
+		datadir := util.EnsureDataDir(cCtx.String("datadir"))
+		userdata := util.UserDataStore(context.Background(), datadir)
+		curr := util.GetCurrent(datadir)
+		if curr == did.Undef {
+			return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+		}
+		bk, err := currentBucket(context.Background(), datadir, userdata, curr)
+		if err != nil {
+			return err
+		}
+		cp, ok := bk.(bucket.Checkpointer)
+		if !ok {
+			return fmt.Errorf("bucket is not a checkpointer")
+		}
+		l, err := cp.Checkpoint(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(l)
+		return nil
+	},
+}
+
+var PruneCommand = &cli.Command{
+	Name:  "prune",
+	Usage: "Delete the events of the current bucket that are older than a checkpoint, and the data only they refer to",
+	Description: "Events are pruned behind the latest checkpoint that is at least --min-age old.\n" +
+		"A replica that last synced before that checkpoint may fail to merge changes made\n" +
+		"concurrently with it, so --min-age should be longer than the time between syncs.",
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "min-age",
+			Usage: "minimum age of the checkpoint to prune behind",
+			Value: 30 * 24 * time.Hour,
+		},
+	},
+	Action: func(cCtx *cli.Context) error {
+		datadir := util.EnsureDataDir(cCtx.String("datadir"))
+		userdata := util.UserDataStore(context.Background(), datadir)
+		curr := util.GetCurrent(datadir)
+		if curr == did.Undef {
+			return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+		}
+		bk, err := userdata.Bucket(context.Background(), curr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cp, ok := bk.(bucket.Checkpointer)
+		if !ok {
+			return fmt.Errorf("bucket is not a checkpointer")
+		}
+		res, err := cp.Prune(context.Background(), bucket.RetentionPolicy{MinAge: cCtx.Duration("min-age")})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if res.Checkpoint == nil {
+			fmt.Println("no checkpoint old enough to prune behind")
+			return nil
+		}
+		fmt.Printf("pruned %d events and %d shards behind checkpoint %s\n", res.Events, res.Shards, res.Checkpoint)
+		return nil
+	},
+}
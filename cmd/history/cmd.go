@@ -0,0 +1,335 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/cmd/util"
+	"github.com/storacha/fam/p2p"
+	"github.com/storacha/fam/store"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/urfave/cli/v2"
+)
+
+var log = logging.Logger("history")
+
+var Command = &cli.Command{
+	Name:  "log",
+	Usage: "Show the merkle clock event history of the bucket, newest first",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:    "limit",
+			Aliases: []string{"n"},
+			Usage:   "limit the number of events printed",
+		},
+		&cli.StringFlag{
+			Name:    "key",
+			Aliases: []string{"k"},
+			Usage:   "show only events that operated on this key",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "print events as dag-json, one per line",
+		},
+	},
+	Action: func(cCtx *cli.Context) error {
+		datadir := util.EnsureDataDir(cCtx.String("datadir"))
+		userdata := util.UserDataStore(context.Background(), datadir)
+		curr := util.GetCurrent(datadir)
+		if curr == did.Undef {
+			return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+		}
+		replica, err := currentReplica(context.Background(), datadir, userdata, curr)
+		if err != nil {
+			return err
+		}
+		head, err := replica.Head(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		key := cCtx.String("key")
+		limit := cCtx.Int("limit")
+		count := 0
+		for evt, err := range bucket.History(context.Background(), replica.Blocks(), head, bucket.WithAuthors(p2p.NewEventVerifier(curr))) {
+			if err != nil {
+				log.Fatal(err)
+			}
+			if _, ok := changeOf(evt, key); cCtx.IsSet("key") && !ok {
+				continue
+			}
+			if cCtx.Bool("json") {
+				err = printJSON(evt)
+				if err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				printEvent(evt)
+			}
+			count++
+			if limit > 0 && count >= limit {
+				break
+			}
+		}
+		return nil
+	},
+}
+
+// currentBucket returns the bucket on the branch the CLI reads and writes, see
+// [util.GetBranch].
+func currentBucket(ctx context.Context, datadir string, userdata *store.UserDataStore, id did.DID) (bucket.Bucket[ipld.Link], error) {
+	bk, err := userdata.Bucket(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return util.BucketOnBranch(ctx, bk, util.GetBranch(datadir, id))
+}
+
+// currentReplica returns the replica of the bucket on the branch the CLI reads
+// and writes, see [currentBucket].
+func currentReplica(ctx context.Context, datadir string, userdata *store.UserDataStore, id did.DID) (bucket.Replica, error) {
+	bk, err := currentBucket(ctx, datadir, userdata, id)
+	if err != nil {
+		return nil, err
+	}
+	replica, ok := bk.(bucket.Replica)
+	if !ok {
+		return nil, fmt.Errorf("bucket is not a replica: %s", id)
+	}
+	return replica, nil
+}
+
+func printEvent(evt bucket.Event) {
+	fmt.Printf("event %s\n", evt.Link)
+	if len(evt.Parents) > 0 {
+		var parents []string
+		for _, p := range evt.Parents {
+			parents = append(parents, p.String())
+		}
+		fmt.Printf("Parents: %s\n", strings.Join(parents, " "))
+	}
+	if evt.AuthorErr != nil {
+		fmt.Printf("Author:  unverified (%s)\n", evt.AuthorErr)
+	} else if evt.Author != did.Undef {
+		fmt.Printf("Author:  %s\n", evt.Author)
+	}
+	if !evt.Time.IsZero() {
+		fmt.Printf("Date:    %s\n", evt.Time.Format(time.RFC3339))
+	}
+	fmt.Printf("Root:    %s\n", evt.Root)
+	if evt.Type == bucket.TypeCheckpoint {
+		fmt.Printf("\n    %s\n\n", evt.Type)
+	} else if evt.Type == bucket.TypeBatch {
+		fmt.Printf("\n    %s\n", evt.Type)
+		for _, op := range evt.Ops {
+			if op.Value != nil {
+				fmt.Printf("      put %s %s\n", op.Key, op.Value)
+			} else {
+				fmt.Printf("      del %s\n", op.Key)
+			}
+		}
+		fmt.Println()
+	} else if evt.Value != nil {
+		fmt.Printf("\n    %s %s %s\n\n", evt.Type, evt.Key, evt.Value)
+	} else {
+		fmt.Printf("\n    %s %s\n\n", evt.Type, evt.Key)
+	}
+}
+
+// changeOf returns the last change the event made to the key, and whether it
+// made one.
+func changeOf(evt bucket.Event, key string) (bucket.BatchOp, bool) {
+	var change bucket.BatchOp
+	found := false
+	for _, c := range evt.Changes() {
+		if c.Key == key {
+			change, found = c, true
+		}
+	}
+	return change, found
+}
+
+func printJSON(evt bucket.Event) error {
+	n, err := eventNode(evt)
+	if err != nil {
+		return fmt.Errorf("building event node: %w", err)
+	}
+	err = dagjson.Encode(n, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+	fmt.Println()
+	return nil
+}
+
+func eventNode(evt bucket.Event) (datamodel.Node, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	ma, err := nb.BeginMap(10)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("link")
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleValue().AssignLink(evt.Link)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("parents")
+	if err != nil {
+		return nil, err
+	}
+	la, err := ma.AssembleValue().BeginList(int64(len(evt.Parents)))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range evt.Parents {
+		err = la.AssembleValue().AssignLink(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = la.Finish()
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("type")
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleValue().AssignString(evt.Type)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("key")
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleValue().AssignString(evt.Key)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("value")
+	if err != nil {
+		return nil, err
+	}
+	err = assignLink(ma.AssembleValue(), evt.Value)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("ops")
+	if err != nil {
+		return nil, err
+	}
+	if evt.Type == bucket.TypeBatch {
+		err = assignOps(ma.AssembleValue(), evt.Ops)
+	} else {
+		err = ma.AssembleValue().AssignNull()
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("root")
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleValue().AssignLink(evt.Root)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("author")
+	if err != nil {
+		return nil, err
+	}
+	if evt.Author != did.Undef {
+		err = ma.AssembleValue().AssignString(evt.Author.String())
+	} else {
+		err = ma.AssembleValue().AssignNull()
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("authorError")
+	if err != nil {
+		return nil, err
+	}
+	if evt.AuthorErr != nil {
+		err = ma.AssembleValue().AssignString(evt.AuthorErr.Error())
+	} else {
+		err = ma.AssembleValue().AssignNull()
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("time")
+	if err != nil {
+		return nil, err
+	}
+	if !evt.Time.IsZero() {
+		err = ma.AssembleValue().AssignInt(evt.Time.UnixMilli())
+	} else {
+		err = ma.AssembleValue().AssignNull()
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
+
+// assignLink assigns a link, or null if it is nil.
+func assignLink(na datamodel.NodeAssembler, l ipld.Link) error {
+	if l == nil {
+		return na.AssignNull()
+	}
+	return na.AssignLink(l)
+}
+
+// assignOps assigns the changes of a batch event as a list of maps.
+func assignOps(na datamodel.NodeAssembler, ops []bucket.BatchOp) error {
+	la, err := na.BeginList(int64(len(ops)))
+	if err != nil {
+		return err
+	}
+	for _, op := range ops {
+		ma, err := la.AssembleValue().BeginMap(2)
+		if err != nil {
+			return err
+		}
+		err = ma.AssembleKey().AssignString("key")
+		if err != nil {
+			return err
+		}
+		err = ma.AssembleValue().AssignString(op.Key)
+		if err != nil {
+			return err
+		}
+		err = ma.AssembleKey().AssignString("value")
+		if err != nil {
+			return err
+		}
+		err = assignLink(ma.AssembleValue(), op.Value)
+		if err != nil {
+			return err
+		}
+		err = ma.Finish()
+		if err != nil {
+			return err
+		}
+	}
+	return la.Finish()
+}
@@ -0,0 +1,153 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/go-ucanto/principal/ed25519/signer"
+	"github.com/stretchr/testify/require"
+)
+
+// lookup returns the node at the map key.
+func lookup(t *testing.T, n datamodel.Node, key string) datamodel.Node {
+	t.Helper()
+	v, err := n.LookupByString(key)
+	require.NoError(t, err)
+	return v
+}
+
+func TestPrintEvent(t *testing.T) {
+	t.Run("put", func(t *testing.T) {
+		evt := bucket.Event{Link: testutil.RandomLink(t), Parents: []ipld.Link{testutil.RandomLink(t), testutil.RandomLink(t)}, Type: "put", Key: "k", Value: testutil.RandomLink(t), Root: testutil.RandomLink(t)}
+		out := testutil.CaptureStdout(t, func() { printEvent(evt) })
+		require.Equal(t, "event "+evt.Link.String()+"\n"+
+			"Parents: "+evt.Parents[0].String()+" "+evt.Parents[1].String()+"\n"+
+			"Root:    "+evt.Root.String()+"\n"+
+			"\n    put k "+evt.Value.String()+"\n\n", out)
+	})
+
+	t.Run("del", func(t *testing.T) {
+		evt := bucket.Event{Link: testutil.RandomLink(t), Type: "del", Key: "k", Root: testutil.RandomLink(t)}
+		out := testutil.CaptureStdout(t, func() { printEvent(evt) })
+		require.Equal(t, "event "+evt.Link.String()+"\n"+
+			"Root:    "+evt.Root.String()+"\n"+
+			"\n    del k\n\n", out)
+	})
+}
+
+func TestEventNode(t *testing.T) {
+	evt := bucket.Event{Link: testutil.RandomLink(t), Parents: []ipld.Link{testutil.RandomLink(t)}, Type: "del", Key: "k", Root: testutil.RandomLink(t)}
+	n, err := eventNode(evt)
+	require.NoError(t, err)
+
+	l, err := lookup(t, n, "link").AsLink()
+	require.NoError(t, err)
+	require.Equal(t, evt.Link, l)
+	p, err := lookup(t, n, "parents").LookupByIndex(0)
+	require.NoError(t, err)
+	l, err = p.AsLink()
+	require.NoError(t, err)
+	require.Equal(t, evt.Parents[0], l)
+	typ, err := lookup(t, n, "type").AsString()
+	require.NoError(t, err)
+	require.Equal(t, "del", typ)
+	k, err := lookup(t, n, "key").AsString()
+	require.NoError(t, err)
+	require.Equal(t, "k", k)
+	require.True(t, lookup(t, n, "value").IsNull())
+	l, err = lookup(t, n, "root").AsLink()
+	require.NoError(t, err)
+	require.Equal(t, evt.Root, l)
+}
+
+func TestEventAuthor(t *testing.T) {
+	id, err := signer.Generate()
+	require.NoError(t, err)
+	at := time.UnixMilli(1700000000000).UTC()
+
+	t.Run("verified", func(t *testing.T) {
+		evt := bucket.Event{Link: testutil.RandomLink(t), Type: "put", Key: "k", Value: testutil.RandomLink(t), Root: testutil.RandomLink(t), Author: id.DID(), Time: at}
+		out := testutil.CaptureStdout(t, func() { printEvent(evt) })
+		require.Contains(t, out, "Author:  "+id.DID().String()+"\n")
+		require.Contains(t, out, "Date:    "+at.Format(time.RFC3339)+"\n")
+
+		n, err := eventNode(evt)
+		require.NoError(t, err)
+		author, err := lookup(t, n, "author").AsString()
+		require.NoError(t, err)
+		require.Equal(t, id.DID().String(), author)
+		require.True(t, lookup(t, n, "authorError").IsNull())
+		ms, err := lookup(t, n, "time").AsInt()
+		require.NoError(t, err)
+		require.Equal(t, at.UnixMilli(), ms)
+	})
+
+	t.Run("unverified", func(t *testing.T) {
+		evt := bucket.Event{Link: testutil.RandomLink(t), Type: "put", Key: "k", Value: testutil.RandomLink(t), Root: testutil.RandomLink(t), AuthorErr: errors.New("bad signature")}
+		out := testutil.CaptureStdout(t, func() { printEvent(evt) })
+		require.Contains(t, out, "Author:  unverified (bad signature)\n")
+		require.NotContains(t, out, "Date:")
+
+		n, err := eventNode(evt)
+		require.NoError(t, err)
+		require.True(t, lookup(t, n, "author").IsNull())
+		msg, err := lookup(t, n, "authorError").AsString()
+		require.NoError(t, err)
+		require.Equal(t, "bad signature", msg)
+		require.True(t, lookup(t, n, "time").IsNull())
+	})
+}
+
+func TestBatchEvent(t *testing.T) {
+	v := testutil.RandomLink(t)
+	evt := bucket.Event{
+		Link: testutil.RandomLink(t),
+		Type: bucket.TypeBatch,
+		Ops:  []bucket.BatchOp{{Key: "a", Value: testutil.RandomLink(t)}, {Key: "b"}, {Key: "a", Value: v}},
+		Root: testutil.RandomLink(t),
+	}
+
+	t.Run("changes", func(t *testing.T) {
+		change, ok := changeOf(evt, "a")
+		require.True(t, ok)
+		require.Equal(t, v, change.Value)
+		change, ok = changeOf(evt, "b")
+		require.True(t, ok)
+		require.Nil(t, change.Value)
+		_, ok = changeOf(evt, "c")
+		require.False(t, ok)
+
+		_, ok = changeOf(bucket.Event{Type: bucket.TypeCheckpoint}, "")
+		require.False(t, ok)
+	})
+
+	t.Run("print", func(t *testing.T) {
+		out := testutil.CaptureStdout(t, func() { printEvent(evt) })
+		require.Contains(t, out, "\n    batch\n"+
+			"      put a "+evt.Ops[0].Value.String()+"\n"+
+			"      del b\n"+
+			"      put a "+v.String()+"\n\n")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		n, err := eventNode(evt)
+		require.NoError(t, err)
+		ops := lookup(t, n, "ops")
+		require.Equal(t, int64(3), ops.Length())
+		op, err := ops.LookupByIndex(1)
+		require.NoError(t, err)
+		k, err := lookup(t, op, "key").AsString()
+		require.NoError(t, err)
+		require.Equal(t, "b", k)
+		require.True(t, lookup(t, op, "value").IsNull())
+
+		n, err = eventNode(bucket.Event{Link: testutil.RandomLink(t), Type: "put", Key: "k", Value: v, Root: testutil.RandomLink(t)})
+		require.NoError(t, err)
+		require.True(t, lookup(t, n, "ops").IsNull())
+	})
+}
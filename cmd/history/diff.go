@@ -0,0 +1,158 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/cmd/util"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/urfave/cli/v2"
+)
+
+var DiffCommand = &cli.Command{
+	Name:      "diff",
+	Usage:     "Show the keys that differ between two states of the bucket",
+	Args:      true,
+	ArgsUsage: "[<from>] [<to>]",
+	Description: "Each state is a pail root CID, or event CIDs separated by commas. <to> defaults\n" +
+		"to the current head and <from> to the head before the last change, so with no\n" +
+		"arguments the changes made by the latest events are shown.",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "print changes as dag-json, one per line",
+		},
+	},
+	Action: func(cCtx *cli.Context) error {
+		from, err := util.ParseLinks(cCtx.Args().Get(0))
+		if err != nil {
+			return fmt.Errorf("parsing from: %w", err)
+		}
+		to, err := util.ParseLinks(cCtx.Args().Get(1))
+		if err != nil {
+			return fmt.Errorf("parsing to: %w", err)
+		}
+
+		datadir := util.EnsureDataDir(cCtx.String("datadir"))
+		userdata := util.UserDataStore(context.Background(), datadir)
+		curr := util.GetCurrent(datadir)
+		if curr == did.Undef {
+			return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+		}
+		replica, err := currentReplica(context.Background(), datadir, userdata, curr)
+		if err != nil {
+			return err
+		}
+		blocks := replica.Blocks()
+		if to == nil {
+			to, err = replica.Head(context.Background())
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if from == nil && cCtx.Args().Len() == 0 {
+			from, err = bucket.Parents(context.Background(), blocks, to)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		a, err := bucket.ResolveRoot(context.Background(), blocks, from)
+		if err != nil {
+			return fmt.Errorf("resolving from: %w", err)
+		}
+		b, err := bucket.ResolveRoot(context.Background(), blocks, to)
+		if err != nil {
+			return fmt.Errorf("resolving to: %w", err)
+		}
+
+		for change, err := range bucket.Diff(context.Background(), blocks, a, b) {
+			if err != nil {
+				log.Fatal(err)
+			}
+			if cCtx.Bool("json") {
+				err = printChangeJSON(change)
+				if err != nil {
+					log.Fatal(err)
+				}
+				continue
+			}
+			printChange(change)
+		}
+		return nil
+	},
+}
+
+func printChange(change bucket.Change) {
+	switch change.Type {
+	case bucket.ChangeAdded:
+		fmt.Printf("+ %s\t%s\n", change.Key, change.New)
+	case bucket.ChangeRemoved:
+		fmt.Printf("- %s\t%s\n", change.Key, change.Old)
+	default:
+		fmt.Printf("~ %s\t%s -> %s\n", change.Key, change.Old, change.New)
+	}
+}
+
+func printChangeJSON(change bucket.Change) error {
+	n, err := changeNode(change)
+	if err != nil {
+		return fmt.Errorf("building change node: %w", err)
+	}
+	err = dagjson.Encode(n, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("encoding change: %w", err)
+	}
+	fmt.Println()
+	return nil
+}
+
+func changeNode(change bucket.Change) (datamodel.Node, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	ma, err := nb.BeginMap(4)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("type")
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleValue().AssignString(string(change.Type))
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("key")
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleValue().AssignString(change.Key)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("old")
+	if err != nil {
+		return nil, err
+	}
+	err = assignLink(ma.AssembleValue(), change.Old)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.AssembleKey().AssignString("new")
+	if err != nil {
+		return nil, err
+	}
+	err = assignLink(ma.AssembleValue(), change.New)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, err
+	}
+	return nb.Build(), nil
+}
@@ -0,0 +1,39 @@
+package history
+
+import (
+	"testing"
+
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintChange(t *testing.T) {
+	before, after := testutil.RandomLink(t), testutil.RandomLink(t)
+	for _, tc := range []struct {
+		change bucket.Change
+		want   string
+	}{
+		{bucket.Change{Type: bucket.ChangeAdded, Key: "k", New: after}, "+ k\t" + after.String() + "\n"},
+		{bucket.Change{Type: bucket.ChangeRemoved, Key: "k", Old: before}, "- k\t" + before.String() + "\n"},
+		{bucket.Change{Type: bucket.ChangeChanged, Key: "k", Old: before, New: after}, "~ k\t" + before.String() + " -> " + after.String() + "\n"},
+	} {
+		require.Equal(t, tc.want, testutil.CaptureStdout(t, func() { printChange(tc.change) }))
+	}
+}
+
+func TestChangeNode(t *testing.T) {
+	old := testutil.RandomLink(t)
+	n, err := changeNode(bucket.Change{Type: bucket.ChangeRemoved, Key: "k", Old: old})
+	require.NoError(t, err)
+	typ, err := lookup(t, n, "type").AsString()
+	require.NoError(t, err)
+	require.Equal(t, string(bucket.ChangeRemoved), typ)
+	k, err := lookup(t, n, "key").AsString()
+	require.NoError(t, err)
+	require.Equal(t, "k", k)
+	l, err := lookup(t, n, "old").AsLink()
+	require.NoError(t, err)
+	require.Equal(t, old, l)
+	require.True(t, lookup(t, n, "new").IsNull())
+}
@@ -0,0 +1,93 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/cmd/util"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/urfave/cli/v2"
+)
+
+var RevertCommand = &cli.Command{
+	Name:      "revert",
+	Usage:     "Restore the keys changed by an event or a range of events to their previous values",
+	Args:      true,
+	ArgsUsage: "<event> | <from>..<to>",
+	Description: "Reverting an event restores the keys it changed to their values before the event.\n" +
+		"A range <from>..<to> reverts the events reachable from <to> but not from <from>,\n" +
+		"restoring every key they changed to its value at <from>. Each side of a range is\n" +
+		"event CIDs separated by commas. The restored values are written as a single new\n" +
+		"event, overwriting any later changes to the same keys.",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "print the changes that would be made without making them",
+		},
+	},
+	Action: func(cCtx *cli.Context) error {
+		if cCtx.Args().Len() != 1 {
+			return fmt.Errorf("expected an event or a range of events")
+		}
+
+		datadir := util.EnsureDataDir(cCtx.String("datadir"))
+		userdata := util.UserDataStore(context.Background(), datadir)
+		curr := util.GetCurrent(datadir)
+		if curr == did.Undef {
+			return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+		}
+		bk, err := currentBucket(context.Background(), datadir, userdata, curr)
+		if err != nil {
+			return err
+		}
+		replica, ok := bk.(bucket.Replica)
+		if !ok {
+			return fmt.Errorf("bucket is not a replica: %s", curr)
+		}
+		blocks := replica.Blocks()
+		head, err := replica.Head(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		from, to, ranged := strings.Cut(cCtx.Args().First(), "..")
+		if !ranged {
+			from, to = "", from
+		}
+		tlinks, err := util.ParseLinks(to)
+		if err != nil {
+			return fmt.Errorf("parsing events: %w", err)
+		}
+		if len(tlinks) == 0 {
+			return fmt.Errorf("missing events to revert")
+		}
+		flinks, err := util.ParseLinks(from)
+		if err != nil {
+			return fmt.Errorf("parsing from: %w", err)
+		}
+		if !ranged {
+			flinks, err = bucket.Parents(context.Background(), blocks, tlinks)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		changes, err := bucket.Revert(context.Background(), blocks, head, flinks, tlinks)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			printChange(change)
+		}
+		if cCtx.Bool("dry-run") {
+			return nil
+		}
+		err = bucket.Apply(context.Background(), bk, changes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,221 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/cmd/util"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/urfave/cli/v2"
+)
+
+var TagCommand = &cli.Command{
+	Name:      "tag",
+	Usage:     "Name the current state of the bucket, or a past one, with a tag",
+	Args:      true,
+	ArgsUsage: "<name>",
+	Description: "A tag points at a head, the current head unless --at is passed, or at a pail\n" +
+		"root passed with --root. Read the bucket as it was at a tag with `fam ls --tag`\n" +
+		"and `fam get --tag`. The events and data of a tag are kept when the bucket is\n" +
+		"pruned. Tags are local, they are not synced to remotes.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "at",
+			Usage: "tag these event CIDs, separated by commas, instead of the current head",
+		},
+		&cli.StringFlag{
+			Name:  "root",
+			Usage: "tag this pail root instead of a head",
+		},
+	},
+	Action: func(cCtx *cli.Context) error {
+		name := cCtx.Args().First()
+		if name == "" {
+			return fmt.Errorf("missing tag name")
+		}
+		if cCtx.IsSet("at") && cCtx.IsSet("root") {
+			return fmt.Errorf("--at and --root cannot be used together")
+		}
+		at, err := util.ParseLinks(cCtx.String("at"))
+		if err != nil {
+			return fmt.Errorf("parsing events: %w", err)
+		}
+
+		datadir := util.EnsureDataDir(cCtx.String("datadir"))
+		userdata := util.UserDataStore(context.Background(), datadir)
+		curr := util.GetCurrent(datadir)
+		if curr == did.Undef {
+			return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+		}
+		bk, err := currentBucket(context.Background(), datadir, userdata, curr)
+		if err != nil {
+			return err
+		}
+		tbk, ok := bk.(bucket.Tagger)
+		if !ok {
+			return fmt.Errorf("bucket is not a tagger")
+		}
+
+		var tag bucket.Tag
+		if cCtx.IsSet("root") {
+			root, err := cid.Parse(cCtx.String("root"))
+			if err != nil {
+				return fmt.Errorf("parsing root: %w", err)
+			}
+			tag, err = tbk.TagRoot(context.Background(), name, cidlink.Link{Cid: root})
+			if err != nil {
+				return err
+			}
+		} else {
+			tag, err = tbk.Tag(context.Background(), name, at)
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Println(tag.Root)
+		return nil
+	},
+	Subcommands: []*cli.Command{
+		{
+			Name:    "ls",
+			Aliases: []string{"list"},
+			Usage:   "List the tags of the bucket",
+			Action: func(cCtx *cli.Context) error {
+				datadir := util.EnsureDataDir(cCtx.String("datadir"))
+				userdata := util.UserDataStore(context.Background(), datadir)
+				curr := util.GetCurrent(datadir)
+				if curr == did.Undef {
+					return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+				}
+				bk, err := userdata.Bucket(context.Background(), curr)
+				if err != nil {
+					log.Fatal(err)
+				}
+				tbk, ok := bk.(bucket.Tagger)
+				if !ok {
+					return fmt.Errorf("bucket is not a tagger")
+				}
+				for entry, err := range tbk.Tags(context.Background()) {
+					if err != nil {
+						log.Fatal(err)
+					}
+					if len(entry.Value.Head) == 0 {
+						fmt.Printf("%s\troot %s\n", entry.Key, entry.Value.Root)
+						continue
+					}
+					var head []string
+					for _, l := range entry.Value.Head {
+						head = append(head, l.String())
+					}
+					fmt.Printf("%s\thead %s\n", entry.Key, strings.Join(head, ","))
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "rm",
+			Aliases:   []string{"remove"},
+			Usage:     "Delete a tag, its events and data are no longer kept when pruning",
+			Args:      true,
+			ArgsUsage: "<name>",
+			Action: func(cCtx *cli.Context) error {
+				name := cCtx.Args().First()
+				if name == "" {
+					return fmt.Errorf("missing tag name")
+				}
+				datadir := util.EnsureDataDir(cCtx.String("datadir"))
+				userdata := util.UserDataStore(context.Background(), datadir)
+				curr := util.GetCurrent(datadir)
+				if curr == did.Undef {
+					return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+				}
+				bk, err := userdata.Bucket(context.Background(), curr)
+				if err != nil {
+					log.Fatal(err)
+				}
+				tbk, ok := bk.(bucket.Tagger)
+				if !ok {
+					return fmt.Errorf("bucket is not a tagger")
+				}
+				err = tbk.Untag(context.Background(), name)
+				if err != nil {
+					if errors.Is(err, bucket.ErrNotFound) {
+						return fmt.Errorf("tag not found: %s", name)
+					}
+					log.Fatal(err)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "restore",
+			Usage:     "Restore every key of the bucket to its value at a tag",
+			Args:      true,
+			ArgsUsage: "<name>",
+			Description: "The restored values are written as a single new event, so the restore syncs\n" +
+				"like any other change and can itself be reverted.",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "print the changes that would be made without making them",
+				},
+			},
+			Action: func(cCtx *cli.Context) error {
+				name := cCtx.Args().First()
+				if name == "" {
+					return fmt.Errorf("missing tag name")
+				}
+				datadir := util.EnsureDataDir(cCtx.String("datadir"))
+				userdata := util.UserDataStore(context.Background(), datadir)
+				curr := util.GetCurrent(datadir)
+				if curr == did.Undef {
+					return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+				}
+				bk, err := currentBucket(context.Background(), datadir, userdata, curr)
+				if err != nil {
+					return err
+				}
+				tbk, ok := bk.(bucket.Tagger)
+				if !ok {
+					return fmt.Errorf("bucket is not a tagger")
+				}
+				tag, err := tbk.GetTag(context.Background(), name)
+				if err != nil {
+					if errors.Is(err, bucket.ErrNotFound) {
+						return fmt.Errorf("tag not found: %s", name)
+					}
+					log.Fatal(err)
+				}
+				replica, ok := bk.(bucket.Replica)
+				if !ok {
+					return fmt.Errorf("bucket is not a replica: %s", curr)
+				}
+				head, err := replica.Head(context.Background())
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				changes, err := bucket.Restore(context.Background(), replica.Blocks(), head, tag.Root)
+				if err != nil {
+					log.Fatal(err)
+				}
+				for _, change := range changes {
+					printChange(change)
+				}
+				if cCtx.Bool("dry-run") {
+					return nil
+				}
+				err = bucket.Apply(context.Background(), bk, changes)
+				if err != nil {
+					log.Fatal(err)
+				}
+				return nil
+			},
+		},
+	},
+}
@@ -10,8 +10,14 @@ import (
 	logging "github.com/ipfs/go-log/v2"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	fbucket "github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/cmd/branch"
 	"github.com/storacha/fam/cmd/bucket"
+	"github.com/storacha/fam/cmd/car"
+	"github.com/storacha/fam/cmd/clock"
+	"github.com/storacha/fam/cmd/history"
 	"github.com/storacha/fam/cmd/remote"
+	"github.com/storacha/fam/cmd/serve"
+	fsync "github.com/storacha/fam/cmd/sync"
 	"github.com/storacha/fam/cmd/util"
 	"github.com/storacha/fam/store"
 	"github.com/storacha/go-ucanto/did"
@@ -50,6 +56,7 @@ func main() {
 				},
 			},
 			bucket.Command,
+			branch.Command,
 			{
 				Name:      "del",
 				Aliases:   []string{"delete"},
@@ -67,6 +74,10 @@ func main() {
 					if err != nil {
 						log.Fatal(err)
 					}
+					bk, err = util.BucketOnBranch(context.Background(), bk, util.GetBranch(datadir, curr))
+					if err != nil {
+						return err
+					}
 					key := cCtx.Args().Get(0)
 					if key == "" {
 						return fmt.Errorf("missing key")
@@ -83,6 +94,49 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:      "fetch",
+				Usage:     "Fetch changes from a remote without merging them",
+				Args:      true,
+				ArgsUsage: "[remote]",
+				Action: func(cCtx *cli.Context) error {
+					datadir := util.EnsureDataDir(cCtx.String("datadir"))
+					userdata := util.UserDataStore(context.Background(), datadir)
+					curr := util.GetCurrent(datadir)
+					if curr == did.Undef {
+						return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+					}
+					bk, err := userdata.Bucket(context.Background(), curr)
+					if err != nil {
+						log.Fatal(err)
+					}
+					if nbk, ok := bk.(fbucket.Networker); ok {
+						name := cCtx.Args().Get(0)
+						if name == "" {
+							name = store.DefaultRemoteName
+						}
+						remote, err := nbk.Remote(context.Background(), name)
+						if err != nil {
+							if errors.Is(err, fbucket.ErrNotFound) {
+								return fmt.Errorf("remote not found: %s", name)
+							}
+							log.Fatal(err)
+						}
+						progress, done := util.PrintProgress("fetching")
+						head, err := remote.Fetch(context.Background(), progress)
+						done()
+						if err != nil {
+							log.Fatal(err)
+						}
+						for _, l := range head {
+							fmt.Println(l.String())
+						}
+					} else {
+						return fmt.Errorf("bucket is not a networker")
+					}
+					return nil
+				},
+			},
 			{
 				Name:    "ls",
 				Aliases: []string{"list"},
@@ -114,6 +168,14 @@ func main() {
 						Aliases: []string{"l"},
 						Usage:   "limit the number of entries printed",
 					},
+					&cli.StringFlag{
+						Name:  "at",
+						Usage: "list entries as they were at these event CIDs, separated by commas",
+					},
+					&cli.StringFlag{
+						Name:  "tag",
+						Usage: "list entries as they were at this tag",
+					},
 				},
 				Action: func(cCtx *cli.Context) error {
 					datadir := util.EnsureDataDir(cCtx.String("datadir"))
@@ -126,6 +188,21 @@ func main() {
 					if err != nil {
 						log.Fatal(err)
 					}
+					bk, err = util.BucketOnBranch(context.Background(), bk, util.GetBranch(datadir, curr))
+					if err != nil {
+						return err
+					}
+					if cCtx.IsSet("at") && cCtx.IsSet("tag") {
+						return fmt.Errorf("--at and --tag cannot be used together")
+					}
+					bk, err = util.BucketAt(context.Background(), bk, cCtx.String("at"))
+					if err != nil {
+						return err
+					}
+					bk, err = util.BucketAtTag(context.Background(), bk, cCtx.String("tag"))
+					if err != nil {
+						return err
+					}
 					opts := []fbucket.EntriesOption{}
 					if cCtx.String("pfx") != "" {
 						opts = append(opts, fbucket.WithKeyPrefix(cCtx.String("pfx")))
@@ -159,8 +236,8 @@ func main() {
 				},
 			},
 			{
-				Name:      "pull",
-				Usage:     "Pull changes from a remote",
+				Name:      "merge",
+				Usage:     "Merge changes fetched from a remote",
 				Args:      true,
 				ArgsUsage: "[remote]",
 				Action: func(cCtx *cli.Context) error {
@@ -186,7 +263,7 @@ func main() {
 							}
 							log.Fatal(err)
 						}
-						err = remote.Pull(context.Background())
+						res, err := remote.Merge(context.Background())
 						if err != nil {
 							log.Fatal(err)
 						}
@@ -195,6 +272,7 @@ func main() {
 							log.Fatal(err)
 						}
 						fmt.Println(root.String())
+						util.PrintConflicts(res.Conflicts)
 					} else {
 						return fmt.Errorf("bucket is not a networker")
 					}
@@ -202,8 +280,8 @@ func main() {
 				},
 			},
 			{
-				Name:      "push",
-				Usage:     "Push local changes to a remote",
+				Name:      "pull",
+				Usage:     "Pull changes from a remote",
 				Args:      true,
 				ArgsUsage: "[remote]",
 				Action: func(cCtx *cli.Context) error {
@@ -229,7 +307,9 @@ func main() {
 							}
 							log.Fatal(err)
 						}
-						err = remote.Push(context.Background())
+						progress, done := util.PrintProgress("pulling")
+						res, err := remote.Pull(context.Background(), progress)
+						done()
 						if err != nil {
 							log.Fatal(err)
 						}
@@ -238,12 +318,112 @@ func main() {
 							log.Fatal(err)
 						}
 						fmt.Println(root.String())
+						util.PrintConflicts(res.Conflicts)
+					} else {
+						return fmt.Errorf("bucket is not a networker")
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "push",
+				Usage:     "Push local changes to a remote",
+				Args:      true,
+				ArgsUsage: "[remote]",
+				Action: func(cCtx *cli.Context) error {
+					datadir := util.EnsureDataDir(cCtx.String("datadir"))
+					userdata := util.UserDataStore(context.Background(), datadir)
+					curr := util.GetCurrent(datadir)
+					if curr == did.Undef {
+						return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+					}
+					bk, err := userdata.Bucket(context.Background(), curr)
+					if err != nil {
+						log.Fatal(err)
+					}
+					if nbk, ok := bk.(fbucket.Networker); ok {
+						name := cCtx.Args().Get(0)
+						if name == "" {
+							name = store.DefaultRemoteName
+						}
+						remote, err := nbk.Remote(context.Background(), name)
+						if err != nil {
+							if errors.Is(err, fbucket.ErrNotFound) {
+								return fmt.Errorf("remote not found: %s", name)
+							}
+							log.Fatal(err)
+						}
+						progress, done := util.PrintProgress("pushing")
+						head, err := remote.Push(context.Background(), progress)
+						done()
+						if err != nil {
+							log.Fatal(err)
+						}
+						for _, l := range head {
+							fmt.Println(l.String())
+						}
 					} else {
 						return fmt.Errorf("bucket is not a networker")
 					}
 					return nil
 				},
 			},
+			{
+				Name:      "get",
+				Usage:     "Get the value of a key in the bucket",
+				Args:      true,
+				ArgsUsage: "<key>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "at",
+						Usage: "get the value as it was at these event CIDs, separated by commas",
+					},
+					&cli.StringFlag{
+						Name:  "tag",
+						Usage: "get the value as it was at this tag",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					datadir := util.EnsureDataDir(cCtx.String("datadir"))
+					userdata := util.UserDataStore(context.Background(), datadir)
+					curr := util.GetCurrent(datadir)
+					if curr == did.Undef {
+						return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+					}
+					bk, err := userdata.Bucket(context.Background(), curr)
+					if err != nil {
+						log.Fatal(err)
+					}
+					bk, err = util.BucketOnBranch(context.Background(), bk, util.GetBranch(datadir, curr))
+					if err != nil {
+						return err
+					}
+					key := cCtx.Args().Get(0)
+					if key == "" {
+						return fmt.Errorf("missing key")
+					}
+					if cCtx.IsSet("at") && cCtx.IsSet("tag") {
+						return fmt.Errorf("--at and --tag cannot be used together")
+					}
+					bk, err = util.BucketAt(context.Background(), bk, cCtx.String("at"))
+					if err != nil {
+						return err
+					}
+					bk, err = util.BucketAtTag(context.Background(), bk, cCtx.String("tag"))
+					if err != nil {
+						return err
+					}
+					value, err := bk.Get(context.Background(), key)
+					if err != nil {
+						if errors.Is(err, fbucket.ErrNotFound) {
+							return fmt.Errorf("key not found: %s", key)
+						}
+						log.Fatal(err)
+					}
+					fmt.Println(value.String())
+					return nil
+				},
+			},
 			{
 				Name:      "put",
 				Usage:     "Put a value to the bucket",
@@ -260,6 +440,10 @@ func main() {
 					if err != nil {
 						log.Fatal(err)
 					}
+					bk, err = util.BucketOnBranch(context.Background(), bk, util.GetBranch(datadir, curr))
+					if err != nil {
+						return err
+					}
 					key := cCtx.Args().Get(0)
 					if key == "" {
 						return fmt.Errorf("missing key")
@@ -280,7 +464,65 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:  "status",
+				Usage: "Show how the bucket compares to its remotes",
+				Action: func(cCtx *cli.Context) error {
+					datadir := util.EnsureDataDir(cCtx.String("datadir"))
+					userdata := util.UserDataStore(context.Background(), datadir)
+					curr := util.GetCurrent(datadir)
+					if curr == did.Undef {
+						return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+					}
+					bk, err := userdata.Bucket(context.Background(), curr)
+					if err != nil {
+						log.Fatal(err)
+					}
+					fmt.Printf("Bucket: %s\n", curr)
+					if name := util.GetBranch(datadir, curr); name != fbucket.MainBranch {
+						fmt.Printf("Branch: %s\n", name)
+					}
+					if nbk, ok := bk.(fbucket.Networker); ok {
+						rems, err := nbk.Remotes(context.Background())
+						if err != nil {
+							log.Fatal(err)
+						}
+						for entry, err := range rems.Entries(context.Background()) {
+							if err != nil {
+								log.Fatal(err)
+							}
+							status, err := nbk.Status(context.Background(), entry.Key)
+							if err != nil {
+								log.Fatal(err)
+							}
+							switch {
+							case len(status.Head) == 0:
+								fmt.Printf("  %s: never synced\n", entry.Key)
+							case status.Ahead == 0 && status.Behind == 0:
+								fmt.Printf("  %s: up to date\n", entry.Key)
+							default:
+								fmt.Printf("  %s: %d ahead, %d behind\n", entry.Key, status.Ahead, status.Behind)
+							}
+						}
+					} else {
+						return fmt.Errorf("bucket is not a networker")
+					}
+					return nil
+				},
+			},
 			remote.Command,
+			serve.Command,
+			fsync.Command,
+			car.ExportCommand,
+			car.ImportCommand,
+			history.Command,
+			history.DiffCommand,
+			history.BlameCommand,
+			history.RevertCommand,
+			history.CheckpointCommand,
+			history.PruneCommand,
+			history.TagCommand,
+			clock.Command,
 		},
 	}
 
@@ -2,23 +2,84 @@ package remote
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	logging "github.com/ipfs/go-log/v2"
-	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/ipld/go-ipld-prime"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
-	"github.com/multiformats/go-multibase"
 	"github.com/storacha/fam/bucket"
 	"github.com/storacha/fam/cmd/util"
+	"github.com/storacha/fam/p2p"
 	"github.com/storacha/go-ucanto/did"
-	"github.com/storacha/go-ucanto/principal/ed25519/verifier"
-	"github.com/storacha/go-ucanto/principal/multiformat"
 	"github.com/urfave/cli/v2"
 )
 
 var log = logging.Logger("remote")
 
+// currentRemotes returns the current bucket and its remotes.
+func currentRemotes(cCtx *cli.Context) (bucket.Bucket[ipld.Link], bucket.Bucket[peer.AddrInfo], error) {
+	datadir := util.EnsureDataDir(cCtx.String("datadir"))
+	userdata := util.UserDataStore(context.Background(), datadir)
+	curr := util.GetCurrent(datadir)
+	if curr == did.Undef {
+		return nil, nil, fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+	}
+	bk, err := userdata.Bucket(context.Background(), curr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	nbk, ok := bk.(bucket.Networker)
+	if !ok {
+		return nil, nil, fmt.Errorf("bucket is not a networker")
+	}
+	rems, err := nbk.Remotes(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	return bk, rems, nil
+}
+
+func parseAddrs(args []string) ([]multiaddr.Multiaddr, error) {
+	var addrs []multiaddr.Multiaddr
+	for _, a := range args {
+		addr, err := multiaddr.NewMultiaddr(a)
+		if err != nil {
+			return nil, fmt.Errorf("parsing multiaddr: %s: %w", a, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// updateAddrs replaces the addresses of the named remote with the result of
+// the passed function.
+func updateAddrs(cCtx *cli.Context, update func(name string, addrs []multiaddr.Multiaddr) ([]multiaddr.Multiaddr, error)) error {
+	_, rems, err := currentRemotes(cCtx)
+	if err != nil {
+		return err
+	}
+	name := cCtx.Args().Get(0)
+	if name == "" {
+		return fmt.Errorf("missing remote name")
+	}
+	info, err := rems.Get(context.Background(), name)
+	if err != nil {
+		return fmt.Errorf("getting remote: %s: %w", name, err)
+	}
+	info.Addrs, err = update(name, info.Addrs)
+	if err != nil {
+		return err
+	}
+	err = rems.Put(context.Background(), name, info)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return nil
+}
+
 func listRemotes(cCtx *cli.Context) error {
 	datadir := util.EnsureDataDir(cCtx.String("datadir"))
 	userdata := util.UserDataStore(context.Background(), datadir)
@@ -42,19 +103,24 @@ func listRemotes(cCtx *cli.Context) error {
 			}
 			count++
 			fmt.Printf("%s\n", entry.Key)
-			pk, err := entry.Value.ID.ExtractPublicKey()
-			if err != nil {
-				log.Fatal(err)
-			}
-			raw, err := pk.Raw()
-			if err != nil {
-				log.Fatal(err)
-			}
-			key, err := multibase.Encode(multibase.Base58BTC, multiformat.TagWith(verifier.Code, raw))
-			if err != nil {
-				log.Fatal(err)
+			var id string
+			server, err := userdata.RemoteID(context.Background(), entry.Value.ID)
+			if err == nil {
+				id = server.String()
+			} else {
+				// remotes added before keys that cannot be UCAN principals were
+				// rejected cannot be pushed to
+				pk, err := entry.Value.ID.ExtractPublicKey()
+				if err != nil {
+					log.Fatal(err)
+				}
+				id, err = p2p.FormatPublicKey(pk)
+				if err != nil {
+					log.Fatal(err)
+				}
+				id += " (unsupported key, cannot sync)"
 			}
-			fmt.Printf("  ID:    did:key:%s\n", key)
+			fmt.Printf("  ID:    %s\n", id)
 			fmt.Println("  Addrs:")
 			for _, a := range entry.Value.Addrs {
 				fmt.Printf("    %s\n", a)
@@ -74,10 +140,14 @@ var Command = &cli.Command{
 	Action: listRemotes,
 	Subcommands: []*cli.Command{
 		{
-			Name:      "add",
-			Usage:     "Add a remote",
+			Name:  "add",
+			Usage: "Add a remote, addresses of a did:web are resolved if none are given",
+			Description: "The remote is identified by a did:key, which must be an Ed25519 or RSA key, or\n" +
+				"a did:web, whose DID document lists the key of its peer ID. UCAN invocations\n" +
+				"are addressed to the DID of the remote, so a did:web remote served by `fam serve`\n" +
+				"must be served with --did.",
 			Args:      true,
-			ArgsUsage: "<name> <id> <address>",
+			ArgsUsage: "<name> <did:key|did:web> [address...]",
 			Action: func(cCtx *cli.Context) error {
 				datadir := util.EnsureDataDir(cCtx.String("datadir"))
 				userdata := util.UserDataStore(context.Background(), datadir)
@@ -98,25 +168,38 @@ var Command = &cli.Command{
 					if name == "" {
 						return fmt.Errorf("missing remote name")
 					}
-					id, err := verifier.Parse(cCtx.Args().Get(1))
-					if err != nil {
-						return fmt.Errorf("parsing remote DID: %w", err)
+					id := cCtx.Args().Get(1)
+					if id == "" {
+						return fmt.Errorf("missing remote DID")
 					}
-					pubKey, err := crypto.UnmarshalEd25519PublicKey(id.Raw())
+					addrs, err := parseAddrs(cCtx.Args().Slice()[2:])
 					if err != nil {
-						return fmt.Errorf("unmarshalling Ed25519 public key: %w", err)
+						return err
 					}
-					peerID, err := peer.IDFromPublicKey(pubKey)
+					info, err := p2p.ResolveAddrInfo(context.Background(), id)
 					if err != nil {
-						return fmt.Errorf("creating peer ID from public key: %w", err)
+						return fmt.Errorf("resolving remote DID: %w", err)
 					}
-					addr, err := multiaddr.NewMultiaddr(cCtx.Args().Get(2))
-					if err != nil {
-						return fmt.Errorf("parsing multiaddr: %w", err)
+					// UCAN invocations are addressed to the did:web of a remote, or
+					// else to the did:key of its peer ID
+					if strings.HasPrefix(id, "did:web:") {
+						server, err := did.Parse(id)
+						if err != nil {
+							return fmt.Errorf("parsing remote DID: %w", err)
+						}
+						err = userdata.SetRemoteID(context.Background(), info.ID, server)
+						if err != nil {
+							log.Fatal(err)
+						}
+					} else if _, err := p2p.PeerDID(info.ID); err != nil {
+						return fmt.Errorf("unsupported remote DID: %w", err)
+					}
+					// addresses passed explicitly take precedence over resolved ones
+					if len(addrs) > 0 {
+						info.Addrs = addrs
 					}
-					info := peer.AddrInfo{
-						ID:    peerID,
-						Addrs: []multiaddr.Multiaddr{addr},
+					if len(info.Addrs) == 0 {
+						return fmt.Errorf("missing remote address")
 					}
 					err = rems.Put(context.Background(), name, info)
 					if err != nil {
@@ -164,11 +247,150 @@ var Command = &cli.Command{
 					if err != nil {
 						log.Fatal(err)
 					}
+					if tracker, ok := bk.(bucket.Tracker); ok {
+						err = tracker.SetRemoteHead(context.Background(), name, nil)
+						if err != nil {
+							log.Fatal(err)
+						}
+						err = tracker.SetSyncState(context.Background(), name, bucket.SyncState{})
+						if err != nil {
+							log.Fatal(err)
+						}
+					}
 				} else {
 					return fmt.Errorf("bucket is not a networker")
 				}
 				return nil
 			},
 		},
+		{
+			Name:      "set-url",
+			Usage:     "Replace the addresses of a remote",
+			Args:      true,
+			ArgsUsage: "<name> <address...>",
+			Action: func(cCtx *cli.Context) error {
+				return updateAddrs(cCtx, func(name string, _ []multiaddr.Multiaddr) ([]multiaddr.Multiaddr, error) {
+					addrs, err := parseAddrs(cCtx.Args().Tail())
+					if err != nil {
+						return nil, err
+					}
+					if len(addrs) == 0 {
+						return nil, fmt.Errorf("missing remote address")
+					}
+					return addrs, nil
+				})
+			},
+		},
+		{
+			Name:      "add-addr",
+			Usage:     "Add an address to a remote",
+			Args:      true,
+			ArgsUsage: "<name> <address>",
+			Action: func(cCtx *cli.Context) error {
+				return updateAddrs(cCtx, func(name string, addrs []multiaddr.Multiaddr) ([]multiaddr.Multiaddr, error) {
+					addr, err := multiaddr.NewMultiaddr(cCtx.Args().Get(1))
+					if err != nil {
+						return nil, fmt.Errorf("parsing multiaddr: %w", err)
+					}
+					for _, a := range addrs {
+						if a.Equal(addr) {
+							return nil, fmt.Errorf("remote %s already has address: %s", name, addr)
+						}
+					}
+					return append(addrs, addr), nil
+				})
+			},
+		},
+		{
+			Name:      "rm-addr",
+			Usage:     "Remove an address from a remote",
+			Args:      true,
+			ArgsUsage: "<name> <address>",
+			Action: func(cCtx *cli.Context) error {
+				return updateAddrs(cCtx, func(name string, addrs []multiaddr.Multiaddr) ([]multiaddr.Multiaddr, error) {
+					addr, err := multiaddr.NewMultiaddr(cCtx.Args().Get(1))
+					if err != nil {
+						return nil, fmt.Errorf("parsing multiaddr: %w", err)
+					}
+					var rest []multiaddr.Multiaddr
+					for _, a := range addrs {
+						if !a.Equal(addr) {
+							rest = append(rest, a)
+						}
+					}
+					if len(rest) == len(addrs) {
+						return nil, fmt.Errorf("remote %s does not have address: %s", name, addr)
+					}
+					if len(rest) == 0 {
+						return nil, fmt.Errorf("cannot remove the only address of remote %s", name)
+					}
+					return rest, nil
+				})
+			},
+		},
+		{
+			Name:      "rename",
+			Usage:     "Rename a remote",
+			Aliases:   []string{"mv"},
+			Args:      true,
+			ArgsUsage: "<old> <new>",
+			Action: func(cCtx *cli.Context) error {
+				bk, rems, err := currentRemotes(cCtx)
+				if err != nil {
+					return err
+				}
+				from := cCtx.Args().Get(0)
+				to := cCtx.Args().Get(1)
+				if from == "" || to == "" {
+					return fmt.Errorf("missing remote name")
+				}
+				info, err := rems.Get(context.Background(), from)
+				if err != nil {
+					return fmt.Errorf("getting remote: %s: %w", from, err)
+				}
+				_, err = rems.Get(context.Background(), to)
+				if err == nil {
+					return fmt.Errorf("remote already exists: %s", to)
+				}
+				if !errors.Is(err, bucket.ErrNotFound) {
+					log.Fatal(err)
+				}
+				err = rems.Put(context.Background(), to, info)
+				if err != nil {
+					log.Fatal(err)
+				}
+				err = rems.Del(context.Background(), from)
+				if err != nil {
+					log.Fatal(err)
+				}
+				if tracker, ok := bk.(bucket.Tracker); ok {
+					head, err := tracker.RemoteHead(context.Background(), from)
+					if err != nil {
+						log.Fatal(err)
+					}
+					state, err := tracker.SyncState(context.Background(), from)
+					if err != nil {
+						log.Fatal(err)
+					}
+					err = tracker.SetRemoteHead(context.Background(), to, head)
+					if err != nil {
+						log.Fatal(err)
+					}
+					err = tracker.SetSyncState(context.Background(), to, state)
+					if err != nil {
+						log.Fatal(err)
+					}
+					err = tracker.SetRemoteHead(context.Background(), from, nil)
+					if err != nil {
+						log.Fatal(err)
+					}
+					err = tracker.SetSyncState(context.Background(), from, bucket.SyncState{})
+					if err != nil {
+						log.Fatal(err)
+					}
+				}
+				return nil
+			},
+		},
 	},
 }
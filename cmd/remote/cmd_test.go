@@ -0,0 +1,22 @@
+package remote
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddrs(t *testing.T) {
+	addrs, err := parseAddrs([]string{"/ip4/127.0.0.1/tcp/4001", "/dns4/example.org/udp/4001/quic-v1"})
+	require.NoError(t, err)
+	require.Len(t, addrs, 2)
+	require.Equal(t, "/ip4/127.0.0.1/tcp/4001", addrs[0].String())
+	require.Equal(t, "/dns4/example.org/udp/4001/quic-v1", addrs[1].String())
+
+	addrs, err = parseAddrs(nil)
+	require.NoError(t, err)
+	require.Empty(t, addrs)
+
+	_, err = parseAddrs([]string{"/ip4/127.0.0.1/tcp/4001", "127.0.0.1:4001"})
+	require.ErrorContains(t, err, "127.0.0.1:4001")
+}
@@ -0,0 +1,138 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p"
+	"github.com/storacha/fam/cmd/util"
+	"github.com/storacha/fam/p2p"
+	"github.com/storacha/fam/store"
+	"github.com/storacha/fam/w3clock"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal"
+	"github.com/storacha/go-ucanto/principal/signer"
+	"github.com/urfave/cli/v2"
+)
+
+var log = logging.Logger("serve")
+
+var Command = &cli.Command{
+	Name:  "serve",
+	Usage: "Serve buckets to remotes",
+	Description: "Writes must be authorized by a UCAN delegation for the bucket, but reads are\n" +
+		"not: anyone who can reach the server and knows the DID of a bucket can read\n" +
+		"its contents. Only serve buckets that may be public.",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "listen",
+			Aliases: []string{"l"},
+			Usage:   "libp2p multiaddr to listen on e.g. /ip4/0.0.0.0/tcp/3000",
+		},
+		&cli.StringFlag{
+			Name:  "http",
+			Usage: "address to serve UCAN invocations over HTTP on e.g. :3000",
+		},
+		&cli.StringFlag{
+			Name:  "did",
+			Usage: "did:web to serve as, UCAN invocations must be addressed to it instead of the agent did:key",
+		},
+		&cli.BoolFlag{
+			Name:  "mdns",
+			Usage: "discover peers holding the same buckets on the local network, requires --listen",
+		},
+	},
+	Action: func(cCtx *cli.Context) error {
+		listen := cCtx.StringSlice("listen")
+		addr := cCtx.String("http")
+		if len(listen) == 0 && addr == "" {
+			return fmt.Errorf("nothing to serve, use --listen and/or --http")
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		datadir := util.EnsureDataDir(cCtx.String("datadir"))
+		var options []store.Option
+		if len(listen) > 0 {
+			options = append(options, store.WithHostOptions(libp2p.ListenAddrStrings(listen...)))
+		}
+		userdata := util.UserDataStore(ctx, datadir, options...)
+		defer userdata.Close()
+
+		var id principal.Signer
+		id, err := userdata.ID(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if web := cCtx.String("did"); web != "" {
+			if !strings.HasPrefix(web, "did:web:") {
+				return fmt.Errorf("not a did:web: %s", web)
+			}
+			wid, err := did.Parse(web)
+			if err != nil {
+				return fmt.Errorf("parsing DID: %w", err)
+			}
+			id, err = signer.Wrap(id, wid)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		fmt.Printf("Serving as %s\n", id.DID())
+
+		if len(listen) > 0 {
+			h, err := userdata.Host(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+			conflicts := p2p.WithConflictHandler(util.PrintPeerConflicts)
+			p2p.NewHandler(id, userdata.Replica, conflicts).Register(h)
+			err = userdata.StartGossip(ctx, conflicts)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if cCtx.Bool("mdns") {
+				err = userdata.StartDiscovery(ctx)
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			fmt.Println("libp2p:")
+			for _, a := range h.Addrs() {
+				fmt.Printf("  %s/p2p/%s\n", a, h.ID())
+			}
+		}
+
+		var srv *http.Server
+		if addr != "" {
+			clk, err := w3clock.NewServer(id, userdata.Replica)
+			if err != nil {
+				log.Fatal(err)
+			}
+			srv = &http.Server{Addr: addr, Handler: w3clock.NewHTTPHandler(clk, userdata.Replica)}
+			go func() {
+				err := srv.ListenAndServe()
+				if err != nil && !errors.Is(err, http.ErrServerClosed) {
+					log.Fatal(err)
+				}
+			}()
+			fmt.Printf("HTTP:\n  %s\n", addr)
+		}
+
+		<-ctx.Done()
+		if srv != nil {
+			err := srv.Shutdown(context.Background())
+			if err != nil {
+				log.Errorf("shutting down HTTP server: %s", err)
+			}
+		}
+		return nil
+	},
+}
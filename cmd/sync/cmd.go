@@ -0,0 +1,233 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/cmd/util"
+	"github.com/storacha/fam/p2p"
+	"github.com/storacha/fam/store"
+	"github.com/storacha/fam/syncer"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/urfave/cli/v2"
+)
+
+var log = logging.Logger("sync")
+
+func printResult(r syncer.Result) {
+	if r.State.LastError != "" {
+		fmt.Printf("%s %s: failed: %s\n", r.Bucket, r.Remote, r.State.LastError)
+	} else {
+		fmt.Printf("%s %s: synced\n", r.Bucket, r.Remote)
+	}
+	util.PrintConflicts(r.Conflicts)
+}
+
+var Command = &cli.Command{
+	Name:  "sync",
+	Usage: "Periodically pull from and push to the remotes of all buckets",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "once",
+			Usage: "sync remotes that are due once and exit",
+		},
+		&cli.DurationFlag{
+			Name:  "interval",
+			Usage: "time between syncs with remotes that have no interval set",
+			Value: syncer.DefaultInterval,
+		},
+		&cli.StringSliceFlag{
+			Name:    "listen",
+			Aliases: []string{"l"},
+			Usage:   "libp2p multiaddr to listen on while running, so that peers can connect",
+			Value:   cli.NewStringSlice("/ip4/0.0.0.0/tcp/0"),
+		},
+		&cli.BoolFlag{
+			Name:  "mdns",
+			Usage: "discover peers holding the same buckets on the local network and sync with them",
+			Value: true,
+		},
+	},
+	Action: func(cCtx *cli.Context) error {
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		datadir := util.EnsureDataDir(cCtx.String("datadir"))
+		var options []store.Option
+		if listen := cCtx.StringSlice("listen"); !cCtx.Bool("once") && len(listen) > 0 {
+			options = append(options, store.WithHostOptions(libp2p.ListenAddrStrings(listen...)))
+		}
+		userdata := util.UserDataStore(ctx, datadir, options...)
+		defer userdata.Close()
+
+		s := syncer.New(
+			userdata,
+			syncer.WithInterval(cCtx.Duration("interval")),
+			syncer.WithNotify(printResult),
+		)
+		if cCtx.Bool("once") {
+			err := s.SyncDue(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+			return nil
+		}
+		// peers announcing new heads are served blocks and synced with live
+		// while the daemon runs
+		id, err := userdata.ID(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		h, err := userdata.Host(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		conflicts := p2p.WithConflictHandler(util.PrintPeerConflicts)
+		p2p.NewHandler(id, userdata.Replica, conflicts).Register(h)
+		err = userdata.StartGossip(ctx, conflicts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if cCtx.Bool("mdns") {
+			err = userdata.StartDiscovery(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		err = s.Run(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Fatal(err)
+		}
+		return nil
+	},
+	Subcommands: []*cli.Command{
+		{
+			Name:  "status",
+			Usage: "Show the background sync status of the remotes of the current bucket",
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:  "interval",
+					Usage: "time between syncs with remotes that have no interval set",
+					Value: syncer.DefaultInterval,
+				},
+			},
+			Action: func(cCtx *cli.Context) error {
+				datadir := util.EnsureDataDir(cCtx.String("datadir"))
+				userdata := util.UserDataStore(context.Background(), datadir)
+				curr := util.GetCurrent(datadir)
+				if curr == did.Undef {
+					return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+				}
+				bk, err := userdata.Bucket(context.Background(), curr)
+				if err != nil {
+					log.Fatal(err)
+				}
+				nbk, ok := bk.(bucket.Networker)
+				if !ok {
+					return fmt.Errorf("bucket is not a networker")
+				}
+				tracker, ok := bk.(bucket.Tracker)
+				if !ok {
+					return fmt.Errorf("bucket is not a tracker")
+				}
+				rems, err := nbk.Remotes(context.Background())
+				if err != nil {
+					log.Fatal(err)
+				}
+				s := syncer.New(userdata, syncer.WithInterval(cCtx.Duration("interval")))
+				for entry, err := range rems.Entries(context.Background()) {
+					if err != nil {
+						log.Fatal(err)
+					}
+					state, err := tracker.SyncState(context.Background(), entry.Key)
+					if err != nil {
+						log.Fatal(err)
+					}
+					fmt.Println(entry.Key)
+					if state.Interval != 0 {
+						fmt.Printf("  Interval:  %s\n", state.Interval)
+					}
+					if state.LastSync.IsZero() {
+						fmt.Println("  Last sync: never")
+					} else {
+						fmt.Printf("  Last sync: %s\n", state.LastSync.Format(time.RFC3339))
+					}
+					if state.LastError != "" {
+						fmt.Printf("  Error:     %s (%d consecutive failures)\n", state.LastError, state.Failures)
+					}
+					next := s.Next(state)
+					if next.Before(time.Now()) {
+						fmt.Println("  Next sync: now")
+					} else {
+						fmt.Printf("  Next sync: %s\n", next.Format(time.RFC3339))
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "interval",
+			Usage:     "Set the time between background syncs with a remote, 0 for the default",
+			Args:      true,
+			ArgsUsage: "<remote> <duration>",
+			Action: func(cCtx *cli.Context) error {
+				name := cCtx.Args().Get(0)
+				if name == "" {
+					return fmt.Errorf("missing remote name")
+				}
+				interval, err := time.ParseDuration(cCtx.Args().Get(1))
+				if err != nil {
+					return fmt.Errorf("parsing interval: %w", err)
+				}
+				if interval < 0 {
+					return fmt.Errorf("interval must not be negative")
+				}
+
+				datadir := util.EnsureDataDir(cCtx.String("datadir"))
+				userdata := util.UserDataStore(context.Background(), datadir)
+				curr := util.GetCurrent(datadir)
+				if curr == did.Undef {
+					return fmt.Errorf("no bucket selected, use `fam bucket use <did>`")
+				}
+				bk, err := userdata.Bucket(context.Background(), curr)
+				if err != nil {
+					log.Fatal(err)
+				}
+				nbk, ok := bk.(bucket.Networker)
+				if !ok {
+					return fmt.Errorf("bucket is not a networker")
+				}
+				tracker, ok := bk.(bucket.Tracker)
+				if !ok {
+					return fmt.Errorf("bucket is not a tracker")
+				}
+				rems, err := nbk.Remotes(context.Background())
+				if err != nil {
+					log.Fatal(err)
+				}
+				_, err = rems.Get(context.Background(), name)
+				if err != nil {
+					return fmt.Errorf("getting remote: %s: %w", name, err)
+				}
+				state, err := tracker.SyncState(context.Background(), name)
+				if err != nil {
+					log.Fatal(err)
+				}
+				state.Interval = interval
+				err = tracker.SetSyncState(context.Background(), name, state)
+				if err != nil {
+					log.Fatal(err)
+				}
+				return nil
+			},
+		},
+	},
+}
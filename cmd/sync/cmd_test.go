@@ -0,0 +1,24 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/fam/syncer"
+	"github.com/storacha/go-ucanto/principal/ed25519/signer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintResult(t *testing.T) {
+	id, err := signer.Generate()
+	require.NoError(t, err)
+
+	out := testutil.CaptureStdout(t, func() { printResult(syncer.Result{Bucket: id.DID(), Remote: "origin"}) })
+	require.Equal(t, id.DID().String()+" origin: synced\n", out)
+
+	out = testutil.CaptureStdout(t, func() {
+		printResult(syncer.Result{Bucket: id.DID(), Remote: "origin", State: bucket.SyncState{LastError: "dial failed"}})
+	})
+	require.Equal(t, id.DID().String()+" origin: failed: dial failed\n", out)
+}
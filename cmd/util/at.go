@@ -0,0 +1,72 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/storacha/fam/bucket"
+)
+
+// ParseLinks parses CIDs separated by commas, the way a head made of several
+// events is passed to commands. It returns nil for an empty string.
+func ParseLinks(s string) ([]ipld.Link, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var links []ipld.Link
+	for _, p := range strings.Split(s, ",") {
+		c, err := cid.Parse(strings.TrimSpace(p))
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, cidlink.Link{Cid: c})
+	}
+	return links, nil
+}
+
+// BucketAt returns a read-only view of the bucket at the head made of the
+// passed event CIDs, separated by commas, or the bucket itself if none are
+// passed.
+func BucketAt(ctx context.Context, bk bucket.Bucket[ipld.Link], at string) (bucket.Bucket[ipld.Link], error) {
+	head, err := ParseLinks(at)
+	if err != nil {
+		return nil, fmt.Errorf("parsing event CIDs: %w", err)
+	}
+	if len(head) == 0 {
+		return bk, nil
+	}
+	cbk, ok := bk.(bucket.ClockBucket[ipld.Link])
+	if !ok {
+		return nil, fmt.Errorf("bucket is not a clock bucket")
+	}
+	return cbk.At(ctx, head)
+}
+
+// BucketAtTag returns a read-only view of the bucket at the pail root of the
+// named tag, or the bucket itself if no name is passed.
+func BucketAtTag(ctx context.Context, bk bucket.Bucket[ipld.Link], name string) (bucket.Bucket[ipld.Link], error) {
+	if name == "" {
+		return bk, nil
+	}
+	tbk, ok := bk.(bucket.Tagger)
+	if !ok {
+		return nil, fmt.Errorf("bucket is not a tagger")
+	}
+	replica, ok := bk.(bucket.Replica)
+	if !ok {
+		return nil, fmt.Errorf("bucket is not a replica")
+	}
+	tag, err := tbk.GetTag(ctx, name)
+	if err != nil {
+		if errors.Is(err, bucket.ErrNotFound) {
+			return nil, fmt.Errorf("tag not found: %s", name)
+		}
+		return nil, err
+	}
+	return bucket.NewRootSnapshot(ctx, replica.Blocks(), tag.Root)
+}
@@ -0,0 +1,68 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/fam/internal/testutil/buckettest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLinks(t *testing.T) {
+	a, b := testutil.RandomLink(t), testutil.RandomLink(t)
+	links, err := ParseLinks(a.String() + ", " + b.String())
+	require.NoError(t, err)
+	require.Equal(t, []ipld.Link{a, b}, links)
+
+	links, err = ParseLinks("")
+	require.NoError(t, err)
+	require.Nil(t, links)
+
+	_, err = ParseLinks("not a cid")
+	require.Error(t, err)
+}
+
+func TestBucketAt(t *testing.T) {
+	ctx := context.Background()
+	bk := buckettest.NewBucket(t)
+	v := testutil.RandomLink(t)
+	require.NoError(t, bk.Put(ctx, "k", v))
+	head, err := bk.Head(ctx)
+	require.NoError(t, err)
+	require.NoError(t, bk.Put(ctx, "k", testutil.RandomLink(t)))
+
+	past, err := BucketAt(ctx, bk, head[0].String())
+	require.NoError(t, err)
+	got, err := past.Get(ctx, "k")
+	require.NoError(t, err)
+	require.Equal(t, v, got)
+
+	curr, err := BucketAt(ctx, bk, "")
+	require.NoError(t, err)
+	require.Equal(t, bk, curr)
+}
+
+func TestBucketAtTag(t *testing.T) {
+	ctx := context.Background()
+	bk := buckettest.NewBucket(t)
+	v := testutil.RandomLink(t)
+	require.NoError(t, bk.Put(ctx, "k", v))
+	_, err := bk.Tag(ctx, "v1", nil)
+	require.NoError(t, err)
+	require.NoError(t, bk.Del(ctx, "k"))
+
+	tagged, err := BucketAtTag(ctx, bk, "v1")
+	require.NoError(t, err)
+	got, err := tagged.Get(ctx, "k")
+	require.NoError(t, err)
+	require.Equal(t, v, got)
+
+	_, err = BucketAtTag(ctx, bk, "missing")
+	require.ErrorContains(t, err, "tag not found")
+
+	curr, err := BucketAtTag(ctx, bk, "")
+	require.NoError(t, err)
+	require.Equal(t, bk, curr)
+}
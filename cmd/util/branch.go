@@ -0,0 +1,68 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/go-ucanto/did"
+)
+
+// GetBranch returns the branch of the bucket that the CLI reads and writes,
+// the main branch unless another was switched to.
+func GetBranch(dataDir string, id did.DID) string {
+	branchDataDir, err := mkdirp(dataDir, "cli", "branch")
+	if err != nil {
+		log.Fatalln("creating CLI data directory: %w", err)
+	}
+	b, err := os.ReadFile(path.Join(branchDataDir, id.String()))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return bucket.MainBranch
+		}
+		log.Fatalln("reading current branch: %w", err)
+	}
+	if len(b) == 0 {
+		return bucket.MainBranch
+	}
+	return string(b)
+}
+
+func SetBranch(dataDir string, id did.DID, name string) {
+	branchDataDir, err := mkdirp(dataDir, "cli", "branch")
+	if err != nil {
+		log.Fatalln("creating CLI data directory: %w", err)
+	}
+	var bytes []byte
+	if name != bucket.MainBranch {
+		bytes = []byte(name)
+	}
+	err = os.WriteFile(path.Join(branchDataDir, id.String()), bytes, 0644)
+	if err != nil {
+		log.Fatalln("writing current branch: %w", err)
+	}
+}
+
+// BucketOnBranch returns the bucket on the named branch, or the bucket itself
+// for the main branch.
+func BucketOnBranch(ctx context.Context, bk bucket.Bucket[ipld.Link], name string) (bucket.Bucket[ipld.Link], error) {
+	if name == bucket.MainBranch {
+		return bk, nil
+	}
+	br, ok := bk.(bucket.Brancher)
+	if !ok {
+		return nil, fmt.Errorf("bucket is not a brancher")
+	}
+	bbk, err := br.Branch(ctx, name)
+	if err != nil {
+		if errors.Is(err, bucket.ErrNotFound) {
+			return nil, fmt.Errorf("branch not found: %s, use `fam branch switch main`", name)
+		}
+		return nil, err
+	}
+	return bbk, nil
+}
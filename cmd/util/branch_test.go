@@ -0,0 +1,51 @@
+package util
+
+import (
+	"context"
+	"testing"
+
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/fam/internal/testutil/buckettest"
+	"github.com/storacha/go-ucanto/principal/ed25519/signer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBranch(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("current branch", func(t *testing.T) {
+		dataDir := t.TempDir()
+		id, err := signer.Generate()
+		require.NoError(t, err)
+		require.Equal(t, bucket.MainBranch, GetBranch(dataDir, id.DID()))
+
+		SetBranch(dataDir, id.DID(), "feature")
+		require.Equal(t, "feature", GetBranch(dataDir, id.DID()))
+
+		SetBranch(dataDir, id.DID(), bucket.MainBranch)
+		require.Equal(t, bucket.MainBranch, GetBranch(dataDir, id.DID()))
+	})
+
+	t.Run("bucket on branch", func(t *testing.T) {
+		bk := buckettest.NewBucket(t)
+		require.NoError(t, bk.Put(ctx, "k", testutil.RandomLink(t)))
+		branch, err := bk.Fork(ctx, "feature")
+		require.NoError(t, err)
+		v := testutil.RandomLink(t)
+		require.NoError(t, branch.Put(ctx, "k", v))
+
+		bbk, err := BucketOnBranch(ctx, bk, "feature")
+		require.NoError(t, err)
+		got, err := bbk.Get(ctx, "k")
+		require.NoError(t, err)
+		require.Equal(t, v, got)
+
+		main, err := BucketOnBranch(ctx, bk, bucket.MainBranch)
+		require.NoError(t, err)
+		require.Equal(t, bk, main)
+
+		_, err = BucketOnBranch(ctx, bk, "missing")
+		require.ErrorContains(t, err, "branch not found")
+	})
+}
@@ -0,0 +1,39 @@
+package util
+
+import (
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/go-ucanto/did"
+)
+
+// PrintConflicts prints the keys that were modified both locally and on a
+// remote, with both candidate values and the value the merge resolved to.
+func PrintConflicts(conflicts []bucket.Conflict) {
+	if len(conflicts) == 0 {
+		return
+	}
+	fmt.Printf("%d concurrently modified:\n", len(conflicts))
+	for _, c := range conflicts {
+		fmt.Printf("  %s\n", c.Key)
+		fmt.Printf("    local:    %s\n", formatValue(c.Local))
+		fmt.Printf("    remote:   %s\n", formatValue(c.Remote))
+		fmt.Printf("    resolved: %s\n", formatValue(c.Resolved))
+	}
+}
+
+// PrintPeerConflicts prints the conflicts found when merging a head pushed or
+// announced by a peer, as reported to p2p.WithConflictHandler.
+func PrintPeerConflicts(id did.DID, from peer.ID, conflicts []bucket.Conflict) {
+	fmt.Printf("%s %s: merged\n", id, from)
+	PrintConflicts(conflicts)
+}
+
+func formatValue(v ipld.Link) string {
+	if v == nil {
+		return "(deleted)"
+	}
+	return v.String()
+}
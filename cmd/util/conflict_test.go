@@ -0,0 +1,27 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintConflicts(t *testing.T) {
+	t.Run("none", func(t *testing.T) {
+		require.Empty(t, testutil.CaptureStdout(t, func() { PrintConflicts(nil) }))
+	})
+
+	t.Run("deleted remotely", func(t *testing.T) {
+		local := testutil.RandomLink(t)
+		out := testutil.CaptureStdout(t, func() {
+			PrintConflicts([]bucket.Conflict{{Key: "k", Local: local}})
+		})
+		require.Equal(t, "1 concurrently modified:\n"+
+			"  k\n"+
+			"    local:    "+local.String()+"\n"+
+			"    remote:   (deleted)\n"+
+			"    resolved: (deleted)\n", out)
+	})
+}
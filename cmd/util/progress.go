@@ -0,0 +1,71 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/storacha/fam/bucket"
+)
+
+// PrintProgress returns a transfer option that renders the progress of a
+// transfer on a single line of stderr, if it is a terminal. Call the returned
+// function when the transfer ends to finish the line.
+func PrintProgress(verb string) (bucket.TransferOption, func()) {
+	if !isatty.IsTerminal(os.Stderr.Fd()) {
+		return bucket.WithProgress(func(bucket.Progress) {}), func() {}
+	}
+	var mutex sync.Mutex
+	var last time.Time
+	var printed bool
+	print := func(p bucket.Progress) {
+		line := fmt.Sprintf("%s: %d events, %d blocks, %s", verb, p.Events, p.Blocks, formatBytes(p.Bytes))
+		if p.Resumed > 0 {
+			line += fmt.Sprintf(", %d resumed", p.Resumed)
+		}
+		if p.Pending > 0 {
+			line += fmt.Sprintf(", %d pending", p.Pending)
+		}
+		if p.ETA > 0 {
+			line += fmt.Sprintf(", ETA %s", p.ETA.Round(time.Second))
+		}
+		fmt.Fprintf(os.Stderr, "\r\033[K%s", line)
+		printed = true
+	}
+	var latest bucket.Progress
+	progress := func(p bucket.Progress) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		latest = p
+		if !p.Done && time.Since(last) < 100*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		print(p)
+	}
+	done := func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !printed {
+			return
+		}
+		print(latest)
+		fmt.Fprintln(os.Stderr)
+	}
+	return bucket.WithProgress(progress), done
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
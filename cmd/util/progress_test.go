@@ -0,0 +1,21 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{
+		0:         "0 B",
+		1023:      "1023 B",
+		1024:      "1.0 KiB",
+		1536:      "1.5 KiB",
+		5 << 20:   "5.0 MiB",
+		3 << 30:   "3.0 GiB",
+		1<<40 + 1: "1.0 TiB",
+	} {
+		require.Equal(t, want, formatBytes(n))
+	}
+}
@@ -6,8 +6,8 @@ import { ok, error } from '@ucanto/core'
 import { ed25519 } from '@ucanto/principal'
 import { extract as extractDelegation } from '@ucanto/core/delegation'
 import { parse as parseJSON, stringify as encodeJSON } from '@ipld/dag-json'
-import { ID, Buckets, AddBucket, Root, Entries, Put } from '../wailsjs/go/main/App'
-import { BrowserOpenURL } from '../wailsjs/runtime/runtime'
+import { ID, Buckets, AddBucket, Root, Entries, Put, Pull, Status, Diff } from '../wailsjs/go/main/App'
+import { BrowserOpenURL, EventsOn } from '../wailsjs/runtime/runtime'
 
 export interface InvocationFailure extends Error {
   name: 'InvocationFailure'
@@ -204,4 +204,147 @@ export const put = async (id: DID, key: string, value: UnknownLink): Promise<Res
   }
 }
 
+export interface RemoteStatus {
+  /** Last known head of the remote. Empty if the remote has never been synced. */
+  head: UnknownLink[]
+  /** Number of local events the remote does not have. */
+  ahead: number
+  /** Number of remote events not merged locally. */
+  behind: number
+  /** Time of the last background sync in milliseconds since epoch. Zero if never synced in the background. */
+  lastSync: number
+  /** Reason the last background sync failed. Empty if it succeeded. */
+  lastError: string
+}
+
+export interface Progress {
+  /** Number of clock events walked. */
+  events: number
+  /** Number of blocks transferred. */
+  blocks: number
+  /** Number of bytes transferred. */
+  bytes: number
+  /** Number of blocks not transferred because an interrupted transfer had already stored them. */
+  resumed: number
+  /** Number of blocks known to be missing that have not been transferred yet. */
+  pending: number
+  /** Time since the transfer started in milliseconds. */
+  elapsed: number
+  /** Estimated time until the pending blocks are transferred in milliseconds. Zero if unknown. */
+  eta: number
+  /** Set on the last progress of a transfer, once it has finished or failed. */
+  done: boolean
+  /** Reason the transfer failed. Empty if it has not failed. */
+  error: string
+}
+
+/** Calls the listener as transfers with remotes make progress, and once more when each finishes or fails. */
+export const onProgress = (listener: (id: DID, remote: string, progress: Progress) => void) =>
+  EventsOn('progress', (id: DID, remote: string, progress: string) => listener(id, remote, parseJSON<Progress>(progress)))
+
+/** Calls the listener whenever a bucket is synced with a remote in the background. */
+export const onSync = (listener: (id: DID, remote: string) => void) => EventsOn('sync', listener)
+
+export const status = async (id: DID): Promise<Result<Map<string, RemoteStatus>, EncodeFailure|InvocationFailure|DecodeError>> => {
+  let input: string
+  try {
+    input = encodeJSON(principalFrom(id))
+  } catch (err) {
+    return error(new EncodeError('failed to stringify API parameters', { cause: err }))
+  }
+
+  let res: string
+  try {
+    res = await Status(input)
+  } catch (err) {
+    return error(new InvocationError('failed to invoke API', { cause: err }))
+  }
+
+  try {
+    return ok(new Map(Object.entries(parseJSON<Record<string, RemoteStatus>>(res))))
+  } catch (err) {
+    return error(new DecodeError('failed to parse API response', { cause: err }))
+  }
+}
+
+/** A key modified both locally and on a remote since they diverged. Values are null where the key was deleted. */
+export interface Conflict {
+  key: string
+  /** Value at the local head before the merge. */
+  local: UnknownLink|null
+  /** Value at the remote head. */
+  remote: UnknownLink|null
+  /** Value the merge resolved to. */
+  resolved: UnknownLink|null
+}
+
+export interface MergeResult {
+  /** New local head. */
+  head: UnknownLink[]
+  conflicts: Conflict[]
+}
+
+/** Calls the listener whenever a background sync merges concurrent edits of the same keys. */
+export const onConflicts = (listener: (id: DID, remote: string, conflicts: Conflict[]) => void) =>
+  EventsOn('conflicts', (id: DID, remote: string, conflicts: string) => listener(id, remote, parseJSON<Conflict[]>(conflicts)))
+
+export const pull = async (id: DID, remote?: string): Promise<Result<MergeResult, EncodeFailure|InvocationFailure|DecodeError>> => {
+  let input: string
+  try {
+    input = encodeJSON({ id: principalFrom(id), ...(remote ? { remote } : {}) })
+  } catch (err) {
+    return error(new EncodeError('failed to stringify API parameters', { cause: err }))
+  }
+
+  let res: string
+  try {
+    res = await Pull(input)
+  } catch (err) {
+    return error(new InvocationError('failed to invoke API', { cause: err }))
+  }
+
+  try {
+    return ok(parseJSON<MergeResult>(res))
+  } catch (err) {
+    return error(new DecodeError('failed to parse API response', { cause: err }))
+  }
+}
+
+/** A difference in the value of a key between two states of a bucket. */
+export interface Change {
+  type: 'added'|'removed'|'changed'
+  key: string
+  /** Value in the from state. Null if the key was added. */
+  old: UnknownLink|null
+  /** Value in the to state. Null if the key was removed. */
+  new: UnknownLink|null
+}
+
+/**
+ * Lists the keys that differ between two states of a bucket. A state is the
+ * event links of a head, or a single pail root link. `to` defaults to the
+ * current head and `from` to the head before the last change.
+ */
+export const diff = async (id: DID, options?: { from?: UnknownLink[], to?: UnknownLink[] }): Promise<Result<Change[], EncodeFailure|InvocationFailure|DecodeError>> => {
+  let input: string
+  try {
+    input = encodeJSON({ id: principalFrom(id), ...options })
+  } catch (err) {
+    return error(new EncodeError('failed to stringify API parameters', { cause: err }))
+  }
+
+  let res: string
+  try {
+    res = await Diff(input)
+  } catch (err) {
+    return error(new InvocationError('failed to invoke API', { cause: err }))
+  }
+
+  try {
+    return ok(parseJSON<Change[]>(res))
+  } catch (err) {
+    return error(new DecodeError('failed to parse API response', { cause: err }))
+  }
+}
+
 export const openExternalURL = (url: string) => BrowserOpenURL(url)
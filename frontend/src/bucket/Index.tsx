@@ -9,6 +9,24 @@ export const Index = () => {
   const [buckets, setBuckets] = useState(new Map<DID, Delegation>())
   const [selections, setSelections] = useState(new Set<DID>())
   const [roots, setRoots] = useState(new Map<DID, Link>)
+  const [statuses, setStatuses] = useState(new Map<DID, Map<string, API.RemoteStatus>>)
+  const [synced, setSynced] = useState(0)
+  const [progress, setProgress] = useState(new Map<string, API.Progress>())
+
+  useEffect(() => API.onSync((id, remote) => {
+    setProgress(p => new Map([...p].filter(([k]) => k !== `${id}/${remote}`)))
+    setSynced(n => n + 1)
+  }), [])
+
+  useEffect(() => API.onProgress((id, remote, progress) => {
+    const key = `${id}/${remote}`
+    if (progress.done) {
+      setProgress(p => new Map([...p].filter(([k]) => k !== key)))
+      setSynced(n => n + 1)
+      return
+    }
+    setProgress(p => new Map([...p, [key, progress]]))
+  }), [])
 
   useEffect(() => {
     (async () => {
@@ -28,7 +46,19 @@ export const Index = () => {
       }))
       setRoots(new Map(roots))
     })()
-  }, [buckets])
+  }, [buckets, synced])
+
+  useEffect(() => {
+    (async () => {
+      if (!buckets.size) return
+      const statuses = await Promise.all([...buckets.keys()].map(async id => {
+        const status = await API.status(id)
+        if (status.error) throw status.error // TODO handle error
+        return [id, status.ok] as [DID, Map<string, API.RemoteStatus>]
+      }))
+      setStatuses(new Map(statuses))
+    })()
+  }, [buckets, synced])
 
   if (!buckets.size) {
     return (
@@ -46,7 +76,7 @@ export const Index = () => {
   const entries = [...buckets.keys()].sort((a, b) => a[0] > b[0] ? -1 : 1)
   return (
     <div className='p-3 overflow-scroll'>
-      <BucketList buckets={entries} roots={roots} selections={selections} onSelectionsChange={setSelections} />
+      <BucketList buckets={entries} roots={roots} statuses={statuses} progress={progress} selections={selections} onSelectionsChange={setSelections} />
     </div>
   )
 }
@@ -54,11 +84,14 @@ export const Index = () => {
 interface BucketListProps {
   buckets: DID[]
   roots: Map<DID, Link>
+  statuses: Map<DID, Map<string, API.RemoteStatus>>
+  /** Progress of ongoing transfers, keyed by bucket and remote name joined by a slash. */
+  progress: Map<string, API.Progress>
   selections: Set<DID>
   onSelectionsChange: (selections: Set<DID>) => void
 }
 
-const BucketList = ({ buckets, roots, selections, onSelectionsChange }: BucketListProps) => {
+const BucketList = ({ buckets, roots, statuses, progress, selections, onSelectionsChange }: BucketListProps) => {
   const allSelected = () => buckets.length > 0 && selections.size === buckets.length
   const handleSelectAllChange = () => {
     if (allSelected()) {
@@ -105,6 +138,9 @@ const BucketList = ({ buckets, roots, selections, onSelectionsChange }: BucketLi
                   <NavLink to={`/bucket/${id}`} className='max-w-lg font-medium font-mono text-xs text-gray-900 group hover:text-hot-red block' title={id}>
                     {id}<br/>
                     <span className='text-gray-500 group-hover:text-hot-red'>{roots.get(id)?.toString() ?? 'Unknown'}</span>
+                    {[...(statuses.get(id) ?? new Map<string, API.RemoteStatus>())].map(([name, status]) => (
+                      <span key={name} className='block text-gray-400 group-hover:text-hot-red'>{name}: {progress.has(`${id}/${name}`) ? formatProgress(progress.get(`${id}/${name}`)!) : formatStatus(status)}</span>
+                    ))}
                   </NavLink>
                 </th>
               </tr>
@@ -115,3 +151,17 @@ const BucketList = ({ buckets, roots, selections, onSelectionsChange }: BucketLi
     </div>
   )
 }
+
+const formatStatus = (status: API.RemoteStatus) => {
+  if (status.lastError) return `sync failed: ${status.lastError}`
+  if (!status.head.length) return 'never synced'
+  if (!status.ahead && !status.behind) return 'up to date'
+  return `${status.ahead} ahead, ${status.behind} behind`
+}
+
+const formatProgress = (progress: API.Progress) => {
+  let s = `syncing: ${progress.blocks} blocks`
+  if (progress.pending) s += `, ${progress.pending} pending`
+  if (progress.eta) s += `, ${Math.ceil(progress.eta / 1000)}s left`
+  return s
+}
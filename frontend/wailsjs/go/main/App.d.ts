@@ -7,12 +7,18 @@ export function Buckets():Promise<string>;
 
 export function Del(arg1:string):Promise<string>;
 
+export function Diff(arg1:string):Promise<string>;
+
 export function Entries(arg1:string):Promise<string>;
 
 export function ID():Promise<string>;
 
+export function Pull(arg1:string):Promise<string>;
+
 export function Put(arg1:string):Promise<string>;
 
 export function RemoveBucket(arg1:string):Promise<void>;
 
 export function Root(arg1:string):Promise<string>;
+
+export function Status(arg1:string):Promise<string>;
@@ -14,6 +14,10 @@ export function Del(arg1) {
   return window['go']['main']['App']['Del'](arg1);
 }
 
+export function Diff(arg1) {
+  return window['go']['main']['App']['Diff'](arg1);
+}
+
 export function Entries(arg1) {
   return window['go']['main']['App']['Entries'](arg1);
 }
@@ -22,6 +26,10 @@ export function ID() {
   return window['go']['main']['App']['ID']();
 }
 
+export function Pull(arg1) {
+  return window['go']['main']['App']['Pull'](arg1);
+}
+
 export function Put(arg1) {
   return window['go']['main']['App']['Put'](arg1);
 }
@@ -33,3 +41,7 @@ export function RemoveBucket(arg1) {
 export function Root(arg1) {
   return window['go']['main']['App']['Root'](arg1);
 }
+
+export function Status(arg1) {
+  return window['go']['main']['App']['Status'](arg1);
+}
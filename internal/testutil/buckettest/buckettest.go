@@ -0,0 +1,26 @@
+// Package buckettest provides bucket fixtures shared by the tests of packages
+// that use buckets.
+package buckettest
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/bucket"
+	"github.com/stretchr/testify/require"
+)
+
+// NewBucket creates a bucket that keeps its history, backed by an in-memory
+// datastore.
+func NewBucket(t *testing.T, options ...bucket.DsClockBucketOption) *bucket.DsClockBucket {
+	t.Helper()
+	dstore := dssync.MutexWrap(datastore.NewMapDatastore())
+	blocks := block.NewDsBlockstore(namespace.Wrap(dstore, datastore.NewKey("blocks")))
+	options = append([]bucket.DsClockBucketOption{bucket.WithHistory()}, options...)
+	bk, err := bucket.NewDsClockBucket(blocks, namespace.Wrap(dstore, datastore.NewKey("shards")), options...)
+	require.NoError(t, err)
+	return bk
+}
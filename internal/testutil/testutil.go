@@ -0,0 +1,58 @@
+// Package testutil provides fixtures shared by the tests of the module.
+package testutil
+
+import (
+	"crypto/rand"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/go-ucanto/principal"
+	"github.com/storacha/go-ucanto/principal/ed25519/signer"
+	"github.com/stretchr/testify/require"
+)
+
+// RandomBlock creates a raw block of random bytes.
+func RandomBlock(t *testing.T) block.Block {
+	t.Helper()
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	mh, err := multihash.Sum(b, multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	return block.New(cidlink.Link{Cid: cid.NewCidV1(cid.Raw, mh)}, b)
+}
+
+// RandomLink creates a link to a raw block of random bytes.
+func RandomLink(t *testing.T) ipld.Link {
+	t.Helper()
+	return RandomBlock(t).Link()
+}
+
+// NewSigner generates a new ed25519 signer.
+func NewSigner(t *testing.T) principal.Signer {
+	t.Helper()
+	id, err := signer.Generate()
+	require.NoError(t, err)
+	return id
+}
+
+// CaptureStdout returns what the passed function writes to stdout.
+func CaptureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	fn()
+	require.NoError(t, w.Close())
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(b)
+}
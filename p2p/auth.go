@@ -0,0 +1,265 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	bkt "github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/capabilities/clock"
+	"github.com/storacha/go-ucanto/core/dag/blockstore"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/core/schema"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal"
+	edverifier "github.com/storacha/go-ucanto/principal/ed25519/verifier"
+	rsaverifier "github.com/storacha/go-ucanto/principal/rsa/verifier"
+	"github.com/storacha/go-ucanto/ucan"
+	"github.com/storacha/go-ucanto/validator"
+)
+
+// ErrUnauthorized is returned when a caller does not present a valid UCAN.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// invokeAdvance issues an archived `clock/advance` invocation on the bucket to
+// the audience, using the passed delegation (if any) as proof.
+func invokeAdvance(issuer principal.Signer, audience did.DID, bucket did.DID, proof delegation.Delegation) ([]byte, error) {
+	var opts []delegation.Option
+	if proof != nil {
+		opts = append(opts, delegation.WithProof(delegation.FromDelegation(proof)))
+	}
+	inv, err := clock.Advance.Invoke(issuer, audience, bucket.String(), clock.AdvanceCaveats{}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invoking %s: %w", clock.AdvanceAbility, err)
+	}
+	b, err := io.ReadAll(inv.Archive())
+	if err != nil {
+		return nil, fmt.Errorf("archiving invocation: %w", err)
+	}
+	return b, nil
+}
+
+// invokeHead issues an archived `clock/head` invocation on the bucket to the
+// audience, using the passed delegation (if any) as proof. It authorizes reads.
+func invokeHead(issuer principal.Signer, audience did.DID, bucket did.DID, proof delegation.Delegation) ([]byte, error) {
+	var opts []delegation.Option
+	if proof != nil {
+		opts = append(opts, delegation.WithProof(delegation.FromDelegation(proof)))
+	}
+	inv, err := clock.Head.Invoke(issuer, audience, bucket.String(), clock.HeadCaveats{}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invoking %s: %w", clock.HeadAbility, err)
+	}
+	b, err := io.ReadAll(inv.Archive())
+	if err != nil {
+		return nil, fmt.Errorf("archiving invocation: %w", err)
+	}
+	return b, nil
+}
+
+// authorize verifies that the passed archived invocation was issued by the
+// caller to this host and that its delegation chain, rooted at the bucket,
+// grants the capability to advance the merkle clock of the bucket.
+func authorize(id principal.Verifier, bucket did.DID, caller did.DID, auth []byte) error {
+	return authorizeInvocation(id, clock.NewAdvanceCapability(schema.Literal(bucket.String())), caller, auth)
+}
+
+// authorizeRead is [authorize] for the capability to read the merkle clock of
+// the bucket, which is also granted by a delegation of `clock/*`.
+func authorizeRead(id principal.Verifier, bucket did.DID, caller did.DID, auth []byte) error {
+	return authorizeInvocation(id, clock.NewHeadCapability(schema.Literal(bucket.String())), caller, auth)
+}
+
+// authorizeInvocation verifies that the passed archived invocation was issued
+// by the caller to this host and that its delegation chain grants the passed
+// capability. Only capabilities on the requested bucket may match it.
+func authorizeInvocation[C any](id principal.Verifier, capability validator.CapabilityParser[C], caller did.DID, auth []byte) error {
+	if len(auth) == 0 {
+		return fmt.Errorf("%w: missing invocation", ErrUnauthorized)
+	}
+	inv, err := delegation.Extract(auth)
+	if err != nil {
+		return fmt.Errorf("%w: extracting invocation: %w", ErrUnauthorized, err)
+	}
+	if inv.Issuer().DID() != caller {
+		return fmt.Errorf("%w: invocation issuer %s is not caller %s", ErrUnauthorized, inv.Issuer().DID(), caller)
+	}
+	if inv.Audience().DID() != id.DID() {
+		return fmt.Errorf("%w: invocation audience %s is not this host %s", ErrUnauthorized, inv.Audience().DID(), id.DID())
+	}
+	return access(id, capability, inv)
+}
+
+// access validates that the delegation chain of the invocation, rooted at the
+// resource, grants the passed capability. Revocations are not looked up, there
+// is nowhere to publish them yet, so a delegation stays valid until it
+// expires.
+func access[C any](id principal.Verifier, capability validator.CapabilityParser[C], inv delegation.Delegation) error {
+	ctx := validator.NewValidationContext(
+		id,
+		capability,
+		validator.IsSelfIssued,
+		func(auth validator.Authorization[any]) validator.Revoked { return nil },
+		validator.ProofUnavailable,
+		ParsePrincipal,
+		validator.FailDIDKeyResolution,
+	)
+	_, uerr := validator.Access(inv, ctx)
+	if uerr != nil {
+		return fmt.Errorf("%w: %w", ErrUnauthorized, uerr)
+	}
+	return nil
+}
+
+// AuthorizeEvent issues an archived `clock/advance` invocation on the bucket,
+// addressed to the bucket and constrained to the passed clock event, using the
+// passed delegation as proof. It is the signature of the event, see
+// [bucket.SignEvent]. It expires like any other invocation, events are
+// verified at the time they were signed, see [VerifyEvent].
+func AuthorizeEvent(issuer principal.Signer, bucket did.DID, proof delegation.Delegation, event ipld.Link) ([]byte, error) {
+	var opts []delegation.Option
+	if proof != nil {
+		opts = append(opts, delegation.WithProof(delegation.FromDelegation(proof)))
+	}
+	inv, err := clock.Advance.Invoke(issuer, bucket, bucket.String(), clock.AdvanceCaveats{Event: event}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invoking %s: %w", clock.AdvanceAbility, err)
+	}
+	b, err := io.ReadAll(inv.Archive())
+	if err != nil {
+		return nil, fmt.Errorf("archiving invocation: %w", err)
+	}
+	return b, nil
+}
+
+// VerifyEvent verifies that the passed archived invocation authorizes the clock
+// event with the passed link, and that its delegation chain is rooted at the
+// bucket. It returns the DID of the writer that issued it. The invocation and
+// the delegations it is proven by must have been valid when the event was
+// signed, at the time stamped on the event by its writer, so events stay valid
+// once they expire. Events without a time are checked at the current time.
+// Revocations are not checked, see [bkt.EventVerifier].
+func VerifyEvent(bucket did.DID, event ipld.Link, signed time.Time, auth []byte) (did.DID, error) {
+	inv, err := delegation.Extract(auth)
+	if err != nil {
+		return did.Undef, fmt.Errorf("%w: extracting invocation: %w", ErrUnauthorized, err)
+	}
+	if inv.Audience().DID() != bucket {
+		return did.Undef, fmt.Errorf("%w: invocation audience %s is not bucket %s", ErrUnauthorized, inv.Audience().DID(), bucket)
+	}
+	if !slices.ContainsFunc(inv.Capabilities(), func(c ucan.Capability[any]) bool {
+		return c.Can() == clock.AdvanceAbility && c.With() == bucket.String() && advanceEvent(c) == event
+	}) {
+		return did.Undef, fmt.Errorf("%w: invocation is not for event %s", ErrUnauthorized, event)
+	}
+	if signed.IsZero() {
+		signed = time.Now()
+	}
+	err = grants(inv, bucket, event, signed)
+	if err != nil {
+		return did.Undef, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+	return inv.Issuer().DID(), nil
+}
+
+// NewEventVerifier returns a verifier of the clock events of the bucket, see
+// [VerifyEvent].
+func NewEventVerifier(bucket did.DID) bkt.EventVerifier {
+	return func(ctx context.Context, event ipld.Link, signed time.Time, auth []byte) (did.DID, error) {
+		return VerifyEvent(bucket, event, signed, auth)
+	}
+}
+
+// grants checks that the delegation was valid at the passed time, that it is
+// signed by its issuer, and that it grants the capability to advance the
+// merkle clock of the bucket with the event, either issued by the bucket or
+// proven by a chain of delegations that is. The time bounds are checked here,
+// rather than by the go-ucanto validator, which checks them at the current
+// time.
+func grants(dlg delegation.Delegation, bucket did.DID, event ipld.Link, at time.Time) error {
+	if exp := dlg.Expiration(); exp != nil && int64(*exp) <= at.Unix() {
+		return fmt.Errorf("%s had expired when the event was signed at %s", dlg.Link(), at.Format(time.RFC3339))
+	}
+	if nbf := dlg.NotBefore(); nbf != 0 && at.Unix() < int64(nbf) {
+		return fmt.Errorf("%s was not valid yet when the event was signed at %s", dlg.Link(), at.Format(time.RFC3339))
+	}
+	issuer, err := ParsePrincipal(dlg.Issuer().DID().String())
+	if err != nil {
+		return fmt.Errorf("parsing issuer of %s: %w", dlg.Link(), err)
+	}
+	_, serr := validator.VerifySignature(dlg, issuer)
+	if serr != nil {
+		return serr
+	}
+	if !slices.ContainsFunc(dlg.Capabilities(), func(c ucan.Capability[any]) bool {
+		return canAdvance(c.Can()) && c.With() == bucket.String() && (advanceEvent(c) == nil || advanceEvent(c) == event)
+	}) {
+		return fmt.Errorf("%s does not grant %s on %s", dlg.Link(), clock.AdvanceAbility, bucket)
+	}
+	if dlg.Issuer().DID() == bucket {
+		return nil
+	}
+
+	br, err := blockstore.NewBlockReader(blockstore.WithBlocksIterator(dlg.Blocks()))
+	if err != nil {
+		return fmt.Errorf("reading proofs of %s: %w", dlg.Link(), err)
+	}
+	var errs []error
+	for _, prf := range delegation.NewProofsView(dlg.Proofs(), br) {
+		p, ok := prf.Delegation()
+		if !ok {
+			errs = append(errs, fmt.Errorf("proof not included: %s", prf.Link()))
+			continue
+		}
+		if p.Audience().DID() != dlg.Issuer().DID() {
+			errs = append(errs, fmt.Errorf("proof %s is delegated to %s not %s", p.Link(), p.Audience().DID(), dlg.Issuer().DID()))
+			continue
+		}
+		err := grants(p, bucket, event, at)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("%s is not issued by the bucket and has no proofs", dlg.Link())
+	}
+	return errors.Join(errs...)
+}
+
+// canAdvance reports whether the ability includes advancing a merkle clock.
+func canAdvance(can string) bool {
+	return can == clock.AdvanceAbility || can == "clock/*" || can == "*"
+}
+
+// advanceEvent returns the event a `clock/advance` capability is constrained
+// to, or nil if it is not.
+func advanceEvent(c ucan.Capability[any]) ipld.Link {
+	nb, ok := c.Nb().(datamodel.Node)
+	if !ok || nb == nil {
+		return nil
+	}
+	n, err := nb.LookupByString("event")
+	if err != nil {
+		return nil
+	}
+	l, err := n.AsLink()
+	if err != nil {
+		return nil
+	}
+	return l
+}
+
+// ParsePrincipal parses an Ed25519 or RSA did:key into a verifier.
+func ParsePrincipal(str string) (principal.Verifier, error) {
+	if strings.HasPrefix(str, "did:key:z6Mk") {
+		return edverifier.Parse(str)
+	}
+	return rsaverifier.Parse(str)
+}
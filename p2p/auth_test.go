@@ -0,0 +1,99 @@
+package p2p_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/fam/p2p"
+	"github.com/storacha/go-ucanto/core/delegation"
+	wrapped "github.com/storacha/go-ucanto/principal/signer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyEvent(t *testing.T) {
+	space := testutil.NewSigner(t)
+
+	t.Run("authorized writer", func(t *testing.T) {
+		writer := testutil.NewSigner(t)
+		event := testutil.RandomLink(t)
+		auth, err := p2p.AuthorizeEvent(writer, space.DID(), grant(t, space, writer), event)
+		require.NoError(t, err)
+
+		author, err := p2p.VerifyEvent(space.DID(), event, time.Now(), auth)
+		require.NoError(t, err)
+		require.Equal(t, writer.DID(), author)
+
+		author, err = p2p.NewEventVerifier(space.DID())(context.Background(), event, time.Now(), auth)
+		require.NoError(t, err)
+		require.Equal(t, writer.DID(), author)
+
+		// the authorization is for a single event
+		_, err = p2p.VerifyEvent(space.DID(), testutil.RandomLink(t), time.Now(), auth)
+		require.ErrorIs(t, err, p2p.ErrUnauthorized)
+	})
+
+	t.Run("unauthorized signer", func(t *testing.T) {
+		writer, other := testutil.NewSigner(t), testutil.NewSigner(t)
+		event := testutil.RandomLink(t)
+		auth, err := p2p.AuthorizeEvent(writer, space.DID(), grant(t, other, writer), event)
+		require.NoError(t, err)
+
+		_, err = p2p.VerifyEvent(space.DID(), event, time.Now(), auth)
+		require.ErrorIs(t, err, p2p.ErrUnauthorized)
+	})
+
+	t.Run("expired grant on historical events", func(t *testing.T) {
+		writer := testutil.NewSigner(t)
+		// the grant expired a minute ago, the event was signed an hour ago
+		expired := grant(t, space, writer, delegation.WithExpiration(int(time.Now().Add(-time.Minute).Unix())))
+		event := testutil.RandomLink(t)
+		auth, err := p2p.AuthorizeEvent(writer, space.DID(), expired, event)
+		require.NoError(t, err)
+
+		author, err := p2p.VerifyEvent(space.DID(), event, time.Now().Add(-time.Hour), auth)
+		require.NoError(t, err)
+		require.Equal(t, writer.DID(), author)
+
+		// events signed since it expired are not authorized
+		_, err = p2p.VerifyEvent(space.DID(), event, time.Now(), auth)
+		require.ErrorIs(t, err, p2p.ErrUnauthorized)
+		require.ErrorContains(t, err, "expired")
+	})
+
+	t.Run("grant not valid yet", func(t *testing.T) {
+		writer := testutil.NewSigner(t)
+		later := grant(t, space, writer, delegation.WithNotBefore(int(time.Now().Add(time.Hour).Unix())))
+		event := testutil.RandomLink(t)
+		auth, err := p2p.AuthorizeEvent(writer, space.DID(), later, event)
+		require.NoError(t, err)
+
+		_, err = p2p.VerifyEvent(space.DID(), event, time.Now(), auth)
+		require.ErrorIs(t, err, p2p.ErrUnauthorized)
+	})
+
+	t.Run("tampered signature", func(t *testing.T) {
+		writer, mallory := testutil.NewSigner(t), testutil.NewSigner(t)
+		// a grant claiming to be issued by the space, signed by mallory
+		forger, err := wrapped.Wrap(mallory, space.DID())
+		require.NoError(t, err)
+		event := testutil.RandomLink(t)
+		auth, err := p2p.AuthorizeEvent(writer, space.DID(), grant(t, forger, writer), event)
+		require.NoError(t, err)
+
+		_, err = p2p.VerifyEvent(space.DID(), event, time.Now(), auth)
+		require.ErrorIs(t, err, p2p.ErrUnauthorized)
+		require.ErrorContains(t, err, "valid signature")
+	})
+
+	t.Run("authorizations expire", func(t *testing.T) {
+		writer := testutil.NewSigner(t)
+		event := testutil.RandomLink(t)
+		auth, err := p2p.AuthorizeEvent(writer, space.DID(), grant(t, space, writer), event)
+		require.NoError(t, err)
+		inv, err := delegation.Extract(auth)
+		require.NoError(t, err)
+		require.NotNil(t, inv.Expiration())
+	})
+}
@@ -0,0 +1,181 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-msgio"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal"
+)
+
+// ProtocolID is the libp2p protocol used to sync merkle clocks.
+const ProtocolID = protocol.ID("/fam/clock/1.0.0")
+
+// MaxMessageSize is the maximum size in bytes of a protocol message.
+const MaxMessageSize = 8 << 20
+
+// MaxBlocksPerRequest is the maximum number of blocks requested in a single
+// [OpBlocks] request.
+const MaxBlocksPerRequest = 64
+
+// MaxHasPerRequest is the maximum number of links asked about in a single
+// [OpHas] request.
+const MaxHasPerRequest = 1024
+
+// MaxPutSize is the maximum total size in bytes of the blocks sent in a single
+// [OpPut] request.
+const MaxPutSize = MaxMessageSize / 2
+
+// Client is a clock sync client for a single bucket hosted by a remote peer.
+type Client struct {
+	host   host.Host
+	id     principal.Signer
+	peer   peer.ID
+	server did.DID
+	bucket did.DID
+	proof  delegation.Delegation
+}
+
+func (c *Client) Head(ctx context.Context) ([]ipld.Link, error) {
+	auth, err := invokeHead(c.id, c.server, c.bucket, c.proof)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.request(ctx, Request{Op: OpHead, Bucket: c.bucket, Auth: auth})
+	if err != nil {
+		return nil, fmt.Errorf("requesting head: %w", err)
+	}
+	return res.Head, nil
+}
+
+func (c *Client) Blocks(ctx context.Context, links []ipld.Link) iter.Seq2[block.Block, error] {
+	return func(yield func(block.Block, error) bool) {
+		for len(links) > 0 {
+			n := min(len(links), MaxBlocksPerRequest)
+			auth, err := invokeHead(c.id, c.server, c.bucket, c.proof)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			res, err := c.request(ctx, Request{Op: OpBlocks, Bucket: c.bucket, Links: links[:n], Auth: auth})
+			if err != nil {
+				yield(nil, fmt.Errorf("requesting blocks: %w", err))
+				return
+			}
+			for _, b := range res.Blocks {
+				if !yield(b, nil) {
+					return
+				}
+			}
+			links = links[n:]
+		}
+	}
+}
+
+func (c *Client) Has(ctx context.Context, links []ipld.Link) ([]ipld.Link, error) {
+	var have []ipld.Link
+	for len(links) > 0 {
+		n := min(len(links), MaxHasPerRequest)
+		auth, err := invokeHead(c.id, c.server, c.bucket, c.proof)
+		if err != nil {
+			return nil, err
+		}
+		res, err := c.request(ctx, Request{Op: OpHas, Bucket: c.bucket, Links: links[:n], Auth: auth})
+		if err != nil {
+			return nil, fmt.Errorf("requesting has: %w", err)
+		}
+		have = append(have, res.Links...)
+		links = links[n:]
+	}
+	return have, nil
+}
+
+func (c *Client) Advance(ctx context.Context, head []ipld.Link, blocks []block.Block) ([]ipld.Link, error) {
+	return c.AdvanceSent(ctx, head, blocks, func([]block.Block) {})
+}
+
+// AdvanceSent is [Client.Advance], calling sent with the blocks of each
+// request once the server has received them. See [bucket.BlockSender].
+func (c *Client) AdvanceSent(ctx context.Context, head []ipld.Link, blocks []block.Block, sent func(blocks []block.Block)) ([]ipld.Link, error) {
+	auth, err := invokeAdvance(c.id, c.server, c.bucket, c.proof)
+	if err != nil {
+		return nil, err
+	}
+	var batch []block.Block
+	size := 0
+	for i, b := range blocks {
+		batch = append(batch, b)
+		size += len(b.Bytes())
+		if i < len(blocks)-1 && size+len(blocks[i+1].Bytes()) <= MaxPutSize {
+			continue
+		}
+		_, err := c.request(ctx, Request{Op: OpPut, Bucket: c.bucket, Blocks: batch, Auth: auth})
+		if err != nil {
+			return nil, fmt.Errorf("putting blocks: %w", err)
+		}
+		sent(batch)
+		batch = nil
+		size = 0
+	}
+	res, err := c.request(ctx, Request{Op: OpAdvance, Bucket: c.bucket, Links: head, Auth: auth})
+	if err != nil {
+		return nil, fmt.Errorf("requesting advance: %w", err)
+	}
+	return res.Head, nil
+}
+
+func (c *Client) request(ctx context.Context, req Request) (Response, error) {
+	s, err := c.host.NewStream(ctx, c.peer, ProtocolID)
+	if err != nil {
+		return Response{}, fmt.Errorf("opening stream: %w", err)
+	}
+	defer s.Close()
+
+	b, err := marshalRequest(req)
+	if err != nil {
+		return Response{}, fmt.Errorf("marshalling request: %w", err)
+	}
+	err = msgio.NewVarintWriter(s).WriteMsg(b)
+	if err != nil {
+		return Response{}, fmt.Errorf("writing request: %w", err)
+	}
+	err = s.CloseWrite()
+	if err != nil {
+		return Response{}, fmt.Errorf("closing stream for writing: %w", err)
+	}
+
+	b, err = msgio.NewVarintReaderSize(s, MaxMessageSize).ReadMsg()
+	if err != nil {
+		return Response{}, fmt.Errorf("reading response: %w", err)
+	}
+	res, err := unmarshalResponse(b)
+	if err != nil {
+		return Response{}, fmt.Errorf("unmarshalling response: %w", err)
+	}
+	if res.Error != "" {
+		return Response{}, fmt.Errorf("remote error: %s", res.Error)
+	}
+	return res, nil
+}
+
+// Dial connects to the remote peer and returns a client for the given bucket.
+// The passed signer must be the identity of the host. The proof is a UCAN
+// delegation granting it the capability to advance the merkle clock of the
+// bucket, which is required to push to the remote. Invocations are addressed
+// to the passed server DID, which is either the did:web of the remote or the
+// did:key of the peer, see [PeerDID].
+func Dial(ctx context.Context, h host.Host, id principal.Signer, bucket did.DID, proof delegation.Delegation, server did.DID, addr peer.AddrInfo) (*Client, error) {
+	err := h.Connect(ctx, addr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to peer: %s: %w", addr.ID, err)
+	}
+	return &Client{h, id, addr.ID, server, bucket, proof}, nil
+}
@@ -0,0 +1,445 @@
+package p2p_test
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/fam/p2p"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal"
+	wrapped "github.com/storacha/go-ucanto/principal/signer"
+	"github.com/storacha/go-ucanto/ucan"
+	"github.com/stretchr/testify/require"
+)
+
+// peerReplica is a replica of a bucket held by an agent with its own libp2p
+// host, which serves the replica to other agents.
+type peerReplica struct {
+	*bucket.NetworkClockBucket[ipld.Link]
+	id     principal.Signer
+	host   host.Host
+	gossip *p2p.Gossip
+}
+
+func (r *peerReplica) addrInfo() peer.AddrInfo {
+	return peer.AddrInfo{ID: r.host.ID(), Addrs: r.host.Addrs()}
+}
+
+// addRemote adds the other replica as a remote with the passed name.
+func (r *peerReplica) addRemote(t *testing.T, name string, other *peerReplica) bucket.Remote {
+	t.Helper()
+	ctx := context.Background()
+	rems, err := r.Remotes(ctx)
+	require.NoError(t, err)
+	require.NoError(t, rems.Put(ctx, name, other.addrInfo()))
+	rem, err := r.Remote(ctx, name)
+	require.NoError(t, err)
+	return rem
+}
+
+// grant delegates the capability to advance the merkle clock of the bucket to
+// the audience.
+func grant(t *testing.T, space principal.Signer, audience ucan.Principal, options ...delegation.Option) delegation.Delegation {
+	t.Helper()
+	d, err := delegation.Delegate(
+		space,
+		audience,
+		[]ucan.Capability[ucan.NoCaveats]{
+			ucan.NewCapability("clock/*", space.DID().String(), ucan.NoCaveats{}),
+		},
+		options...,
+	)
+	require.NoError(t, err)
+	return d
+}
+
+func newHost(t *testing.T, id principal.Signer) host.Host {
+	t.Helper()
+	h, err := p2p.NewHost(id, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// newPeerReplica creates a replica of the bucket for a new agent, holding the
+// passed grant, that signs and verifies events and serves the replica over the
+// clock sync protocol. The announcer may be nil.
+func newPeerReplica(t *testing.T, space did.DID, id principal.Signer, proof delegation.Delegation, announce func(r *peerReplica) bucket.Announcer, options ...p2p.Option) *peerReplica {
+	t.Helper()
+	h := newHost(t, id)
+	dstore := dssync.MutexWrap(datastore.NewMapDatastore())
+	blocks := block.NewDsBlockstore(namespace.Wrap(dstore, datastore.NewKey("blocks")))
+	sign := func(ctx context.Context, event ipld.Link) ([]byte, error) {
+		return p2p.AuthorizeEvent(id, space, proof, event)
+	}
+	bk, err := bucket.NewDsClockBucket(blocks, namespace.Wrap(dstore, datastore.NewKey("shards")), bucket.WithEventSigner(sign), bucket.WithHistory())
+	require.NoError(t, err)
+	rbk, err := bucket.NewDsClockBucket(
+		block.NewDsBlockstore(namespace.Wrap(dstore, datastore.NewKey("remotes/blocks"))),
+		namespace.Wrap(dstore, datastore.NewKey("remotes/shards")),
+	)
+	require.NoError(t, err)
+	dial := func(ctx context.Context, addr peer.AddrInfo) (bucket.ClockService, error) {
+		server, err := p2p.PeerDID(addr.ID)
+		if err != nil {
+			return nil, err
+		}
+		return p2p.Dial(ctx, h, id, space, proof, server, addr)
+	}
+	verify := func(ctx context.Context, event ipld.Link, signed time.Time, auth []byte) (did.DID, error) {
+		return p2p.VerifyEvent(space, event, signed, auth)
+	}
+	r := &peerReplica{id: id, host: h}
+	var announcer bucket.Announcer
+	if announce != nil {
+		announcer = announce(r)
+	}
+	r.NetworkClockBucket, err = bucket.NewNetworkClockBucket(bk, blocks, bucket.NewRemoteBucket(bk, rbk), bk, dial, announcer, verify)
+	require.NoError(t, err)
+
+	p2p.NewHandler(id, func(ctx context.Context, id did.DID) (bucket.Replica, error) {
+		if id != space {
+			return nil, bucket.ErrNotFound
+		}
+		return r, nil
+	}, options...).Register(h)
+	return r
+}
+
+func requireValue(t *testing.T, bk bucket.Bucket[ipld.Link], key string, value ipld.Link) {
+	t.Helper()
+	got, err := bk.Get(context.Background(), key)
+	require.NoError(t, err)
+	require.Equal(t, value, got)
+}
+
+func TestClockRemotePull(t *testing.T) {
+	ctx := context.Background()
+	space := testutil.NewSigner(t)
+
+	t.Run("fetches and merges remote writes", func(t *testing.T) {
+		aliceID, bobID := testutil.NewSigner(t), testutil.NewSigner(t)
+		alice := newPeerReplica(t, space.DID(), aliceID, grant(t, space, aliceID), nil)
+		bob := newPeerReplica(t, space.DID(), bobID, grant(t, space, bobID), nil)
+
+		a, b := testutil.RandomLink(t), testutil.RandomLink(t)
+		require.NoError(t, alice.Put(ctx, "a", a))
+		require.NoError(t, alice.Put(ctx, "b", b))
+
+		var last bucket.Progress
+		res, err := bob.addRemote(t, "alice", alice).Pull(ctx, bucket.WithProgress(func(p bucket.Progress) { last = p }))
+		require.NoError(t, err)
+		require.Empty(t, res.Conflicts)
+		require.True(t, last.Done)
+		require.NoError(t, last.Err)
+		require.Positive(t, last.Blocks)
+
+		ahead, err := alice.Head(ctx)
+		require.NoError(t, err)
+		require.Equal(t, ahead, res.Head)
+		requireValue(t, bob, "a", a)
+		requireValue(t, bob, "b", b)
+	})
+
+	t.Run("merges concurrent writes", func(t *testing.T) {
+		aliceID, bobID := testutil.NewSigner(t), testutil.NewSigner(t)
+		alice := newPeerReplica(t, space.DID(), aliceID, grant(t, space, aliceID), nil)
+		bob := newPeerReplica(t, space.DID(), bobID, grant(t, space, bobID), nil)
+
+		a, b, c := testutil.RandomLink(t), testutil.RandomLink(t), testutil.RandomLink(t)
+		require.NoError(t, alice.Put(ctx, "a", a))
+		_, err := bob.addRemote(t, "alice", alice).Pull(ctx)
+		require.NoError(t, err)
+
+		require.NoError(t, alice.Put(ctx, "b", b))
+		require.NoError(t, bob.Put(ctx, "c", c))
+
+		res, err := bob.addRemote(t, "alice", alice).Pull(ctx)
+		require.NoError(t, err)
+		require.Len(t, res.Head, 2)
+		requireValue(t, bob, "a", a)
+		requireValue(t, bob, "b", b)
+		requireValue(t, bob, "c", c)
+	})
+
+	t.Run("bucket not held by remote", func(t *testing.T) {
+		other := testutil.NewSigner(t)
+		aliceID, bobID := testutil.NewSigner(t), testutil.NewSigner(t)
+		alice := newPeerReplica(t, other.DID(), aliceID, grant(t, other, aliceID), nil)
+		bob := newPeerReplica(t, space.DID(), bobID, grant(t, space, bobID), nil)
+
+		var last bucket.Progress
+		_, err := bob.addRemote(t, "alice", alice).Pull(ctx, bucket.WithProgress(func(p bucket.Progress) { last = p }))
+		require.ErrorContains(t, err, "bucket not found")
+		require.True(t, last.Done)
+		require.ErrorContains(t, last.Err, "bucket not found")
+	})
+
+	t.Run("unauthorized reader", func(t *testing.T) {
+		aliceID, malloryID := testutil.NewSigner(t), testutil.NewSigner(t)
+		alice := newPeerReplica(t, space.DID(), aliceID, grant(t, space, aliceID), nil)
+		other := testutil.NewSigner(t)
+		mallory := newPeerReplica(t, space.DID(), malloryID, grant(t, other, malloryID), nil)
+		require.NoError(t, alice.Put(ctx, "a", testutil.RandomLink(t)))
+
+		_, err := mallory.addRemote(t, "alice", alice).Pull(ctx)
+		require.ErrorContains(t, err, "unauthorized")
+		head, err := mallory.Head(ctx)
+		require.NoError(t, err)
+		require.Empty(t, head)
+	})
+}
+
+func TestClockRemotePush(t *testing.T) {
+	ctx := context.Background()
+	space := testutil.NewSigner(t)
+
+	t.Run("advances remote with local writes", func(t *testing.T) {
+		aliceID, bobID := testutil.NewSigner(t), testutil.NewSigner(t)
+		alice := newPeerReplica(t, space.DID(), aliceID, grant(t, space, aliceID), nil)
+		bob := newPeerReplica(t, space.DID(), bobID, grant(t, space, bobID), nil)
+
+		a, b := testutil.RandomLink(t), testutil.RandomLink(t)
+		require.NoError(t, bob.Put(ctx, "a", a))
+		rem := bob.addRemote(t, "alice", alice)
+		_, err := rem.Push(ctx)
+		require.NoError(t, err)
+
+		// the second push only sends the new event and its shards
+		require.NoError(t, bob.Put(ctx, "b", b))
+		rhead, err := rem.Push(ctx)
+		require.NoError(t, err)
+
+		head, err := bob.Head(ctx)
+		require.NoError(t, err)
+		require.Equal(t, head, rhead)
+		requireValue(t, alice, "a", a)
+		requireValue(t, alice, "b", b)
+
+		// pushed blocks are not left staged
+		for _, l := range head {
+			_, err := alice.Staged().Get(ctx, l)
+			require.ErrorIs(t, err, block.ErrNotFound)
+		}
+	})
+
+	t.Run("reports conflicts", func(t *testing.T) {
+		aliceID, bobID := testutil.NewSigner(t), testutil.NewSigner(t)
+		var reported []bucket.Conflict
+		var from peer.ID
+		alice := newPeerReplica(t, space.DID(), aliceID, grant(t, space, aliceID), nil, p2p.WithConflictHandler(func(id did.DID, peer peer.ID, conflicts []bucket.Conflict) {
+			require.Equal(t, space.DID(), id)
+			from, reported = peer, conflicts
+		}))
+		bob := newPeerReplica(t, space.DID(), bobID, grant(t, space, bobID), nil)
+
+		require.NoError(t, bob.Put(ctx, "k", testutil.RandomLink(t)))
+		rem := bob.addRemote(t, "alice", alice)
+		_, err := rem.Push(ctx)
+		require.NoError(t, err)
+		require.Empty(t, reported)
+
+		local, remote := testutil.RandomLink(t), testutil.RandomLink(t)
+		require.NoError(t, alice.Put(ctx, "k", local))
+		require.NoError(t, bob.Put(ctx, "k", remote))
+		_, err = rem.Push(ctx)
+		require.NoError(t, err)
+
+		resolved, err := alice.Get(ctx, "k")
+		require.NoError(t, err)
+		require.Equal(t, bob.host.ID(), from)
+		require.Equal(t, []bucket.Conflict{{Key: "k", Local: local, Remote: remote, Resolved: resolved}}, reported)
+	})
+
+	t.Run("unauthorized writer", func(t *testing.T) {
+		aliceID, malloryID := testutil.NewSigner(t), testutil.NewSigner(t)
+		alice := newPeerReplica(t, space.DID(), aliceID, grant(t, space, aliceID), nil)
+		other := testutil.NewSigner(t)
+		mallory := newPeerReplica(t, space.DID(), malloryID, grant(t, other, malloryID), nil)
+
+		require.NoError(t, mallory.Put(ctx, "a", testutil.RandomLink(t)))
+		var last bucket.Progress
+		_, err := mallory.addRemote(t, "alice", alice).Push(ctx, bucket.WithProgress(func(p bucket.Progress) { last = p }))
+		require.ErrorContains(t, err, "unauthorized")
+		require.True(t, last.Done)
+		require.Equal(t, err, last.Err)
+
+		head, err := alice.Head(ctx)
+		require.NoError(t, err)
+		require.Empty(t, head)
+	})
+}
+
+func TestClockRemoteTracking(t *testing.T) {
+	ctx := context.Background()
+	space := testutil.NewSigner(t)
+	aliceID, bobID := testutil.NewSigner(t), testutil.NewSigner(t)
+	alice := newPeerReplica(t, space.DID(), aliceID, grant(t, space, aliceID), nil)
+	bob := newPeerReplica(t, space.DID(), bobID, grant(t, space, bobID), nil)
+	rem := bob.addRemote(t, "alice", alice)
+
+	require.NoError(t, alice.Put(ctx, "a", testutil.RandomLink(t)))
+	_, err := rem.Pull(ctx)
+	require.NoError(t, err)
+	tracked, err := bob.RemoteHead(ctx, "alice")
+	require.NoError(t, err)
+
+	// the remote head after the push has an event bob has not fetched
+	require.NoError(t, alice.Put(ctx, "b", testutil.RandomLink(t)))
+	require.NoError(t, bob.Put(ctx, "c", testutil.RandomLink(t)))
+	rhead, err := rem.Push(ctx)
+	require.NoError(t, err)
+	require.Len(t, rhead, 2)
+
+	got, err := bob.RemoteHead(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, tracked, got)
+	_, err = rem.Merge(ctx)
+	require.NoError(t, err)
+	_, err = bob.Status(ctx, "alice")
+	require.NoError(t, err)
+
+	// fetching records the head
+	fetched, err := rem.Fetch(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, rhead, fetched)
+	got, err = bob.RemoteHead(ctx, "alice")
+	require.NoError(t, err)
+	require.ElementsMatch(t, rhead, got)
+	status, err := bob.Status(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, 0, status.Ahead)
+	require.Equal(t, 1, status.Behind)
+}
+
+func TestClockRemoteNegotiation(t *testing.T) {
+	ctx := context.Background()
+	space := testutil.NewSigner(t)
+	aliceID, bobID := testutil.NewSigner(t), testutil.NewSigner(t)
+	alice := newPeerReplica(t, space.DID(), aliceID, grant(t, space, aliceID), nil)
+	bob := newPeerReplica(t, space.DID(), bobID, grant(t, space, bobID), nil)
+	rem := bob.addRemote(t, "alice", alice)
+
+	for i := range 500 {
+		require.NoError(t, bob.Put(ctx, fmt.Sprintf("dir%d/sub%d/file%d", i%7, i%13, i), testutil.RandomLink(t)))
+	}
+
+	t.Run("interrupted push is not stored", func(t *testing.T) {
+		head, err := bob.Head(ctx)
+		require.NoError(t, err)
+		evt, err := bob.Blocks().Get(ctx, head[0])
+		require.NoError(t, err)
+		client, err := p2p.Dial(ctx, bob.host, bobID, space.DID(), grant(t, space, bobID), alice.id.DID(), alice.addrInfo())
+		require.NoError(t, err)
+		// only the head event, without its shards or parents
+		_, err = client.Advance(ctx, head, []block.Block{evt})
+		require.Error(t, err)
+		_, err = alice.Blocks().Get(ctx, head[0])
+		require.ErrorIs(t, err, block.ErrNotFound)
+	})
+
+	var total int
+	t.Run("pushes every block", func(t *testing.T) {
+		var reports []bucket.Progress
+		_, err := rem.Push(ctx, bucket.WithProgress(func(p bucket.Progress) { reports = append(reports, p) }))
+		require.NoError(t, err)
+		last := reports[len(reports)-1]
+		require.True(t, last.Done)
+		require.NoError(t, last.Err)
+		total = last.Blocks
+
+		// progress is reported for each block sent, before the remote advances
+		sent := 0
+		for _, p := range reports[:len(reports)-1] {
+			require.False(t, p.Done)
+			if p.Blocks > sent {
+				require.Equal(t, sent+1, p.Blocks)
+				sent = p.Blocks
+			}
+		}
+		require.Equal(t, total, sent)
+
+		entries := 0
+		for _, err := range alice.Entries(ctx) {
+			require.NoError(t, err)
+			entries++
+		}
+		require.Equal(t, 500, entries)
+	})
+
+	t.Run("pushes only new blocks", func(t *testing.T) {
+		v := testutil.RandomLink(t)
+		require.NoError(t, bob.Put(ctx, "dir1/sub1/new", v))
+		var sent int
+		_, err := rem.Push(ctx, bucket.WithProgress(func(p bucket.Progress) { sent = p.Blocks }))
+		require.NoError(t, err)
+		requireValue(t, alice, "dir1/sub1/new", v)
+		require.Greater(t, sent, 1)
+		require.Less(t, sent*10, total)
+	})
+}
+
+func TestDial(t *testing.T) {
+	ctx := context.Background()
+	space := testutil.NewSigner(t)
+
+	t.Run("did:web audience", func(t *testing.T) {
+		web, err := did.Parse("did:web:example.org")
+		require.NoError(t, err)
+		aliceKey, bobID := testutil.NewSigner(t), testutil.NewSigner(t)
+		aliceID, err := wrapped.Wrap(aliceKey, web)
+		require.NoError(t, err)
+		alice := newPeerReplica(t, space.DID(), aliceID, grant(t, space, aliceID), nil)
+		bob := newPeerReplica(t, space.DID(), bobID, grant(t, space, bobID), nil)
+
+		v := testutil.RandomLink(t)
+		require.NoError(t, bob.Put(ctx, "k", v))
+		head, err := bob.Head(ctx)
+		require.NoError(t, err)
+		var blocks []block.Block
+		for b, err := range bucket.Export(ctx, bob.Blocks(), head, nil) {
+			require.NoError(t, err)
+			blocks = append(blocks, b)
+		}
+
+		// the did:key of the peer is not the audience alice accepts
+		server, err := p2p.PeerDID(alice.host.ID())
+		require.NoError(t, err)
+		require.Equal(t, aliceKey.DID(), server)
+		client, err := p2p.Dial(ctx, bob.host, bobID, space.DID(), grant(t, space, bobID), server, alice.addrInfo())
+		require.NoError(t, err)
+		_, err = client.Advance(ctx, head, blocks)
+		require.ErrorContains(t, err, "invocation audience")
+
+		client, err = p2p.Dial(ctx, bob.host, bobID, space.DID(), grant(t, space, bobID), web, alice.addrInfo())
+		require.NoError(t, err)
+		rhead, err := client.Advance(ctx, head, blocks)
+		require.NoError(t, err)
+		require.Equal(t, head, rhead)
+		requireValue(t, alice, "k", v)
+	})
+
+	t.Run("secp256k1 peers have no DID", func(t *testing.T) {
+		_, pk, err := crypto.GenerateSecp256k1Key(rand.Reader)
+		require.NoError(t, err)
+		id, err := peer.IDFromPublicKey(pk)
+		require.NoError(t, err)
+		_, err = p2p.PeerDID(id)
+		require.ErrorContains(t, err, "only Ed25519 and RSA keys can be UCAN principals")
+	})
+}
@@ -0,0 +1,252 @@
+package p2p
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multibase"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-varint"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal/multiformat"
+)
+
+// ParsePublicKey parses an Ed25519, RSA or secp256k1 did:key to a libp2p
+// public key.
+func ParsePublicKey(id string) (crypto.PubKey, error) {
+	if !strings.HasPrefix(id, did.KeyPrefix) {
+		return nil, fmt.Errorf("not a did:key: %s", id)
+	}
+	enc, b, err := multibase.Decode(strings.TrimPrefix(id, did.KeyPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("decoding did:key: %w", err)
+	}
+	if enc != multibase.Base58BTC {
+		return nil, errors.New("did:key is not base58btc encoded")
+	}
+	code, n, err := varint.FromUvarint(b)
+	if err != nil {
+		return nil, fmt.Errorf("decoding did:key multicodec: %w", err)
+	}
+	raw := b[n:]
+	switch multicodec.Code(code) {
+	case multicodec.Ed25519Pub:
+		pk, err := crypto.UnmarshalEd25519PublicKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling Ed25519 public key: %w", err)
+		}
+		return pk, nil
+	case multicodec.RsaPub:
+		// RSA DIDs use PKCS #1, but libp2p RSA public keys are PKIX encoded
+		rpk, err := x509.ParsePKCS1PublicKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parsing RSA public key: %w", err)
+		}
+		pkix, err := x509.MarshalPKIXPublicKey(rpk)
+		if err != nil {
+			return nil, fmt.Errorf("marshalling RSA public key: %w", err)
+		}
+		pk, err := crypto.UnmarshalRsaPublicKey(pkix)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling RSA public key: %w", err)
+		}
+		return pk, nil
+	case multicodec.Secp256k1Pub:
+		pk, err := crypto.UnmarshalSecp256k1PublicKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling secp256k1 public key: %w", err)
+		}
+		return pk, nil
+	default:
+		return nil, fmt.Errorf("unsupported did:key type: 0x%x", code)
+	}
+}
+
+// FormatPublicKey formats a libp2p public key as a did:key. Unlike
+// [PublicKeyDID] it supports secp256k1 keys, which cannot be UCAN principals.
+func FormatPublicKey(pk crypto.PubKey) (string, error) {
+	if pk.Type() != crypto.Secp256k1 {
+		id, err := PublicKeyDID(pk)
+		if err != nil {
+			return "", err
+		}
+		return id.String(), nil
+	}
+	raw, err := pk.Raw()
+	if err != nil {
+		return "", fmt.Errorf("getting raw public key: %w", err)
+	}
+	key, err := multibase.Encode(multibase.Base58BTC, multiformat.TagWith(uint64(multicodec.Secp256k1Pub), raw))
+	if err != nil {
+		return "", fmt.Errorf("encoding secp256k1 public key: %w", err)
+	}
+	return did.KeyPrefix + key, nil
+}
+
+// ResolveAddrInfo resolves a did:key or did:web to the address info of a peer.
+// The addresses of a did:key are always empty. The addresses of a did:web are
+// the service endpoints of its DID document, which may be multiaddrs or HTTP(S)
+// URLs, and its peer ID is derived from the first verification method with a
+// public key in multibase format.
+func ResolveAddrInfo(ctx context.Context, id string) (peer.AddrInfo, error) {
+	if strings.HasPrefix(id, did.KeyPrefix) {
+		pk, err := ParsePublicKey(id)
+		if err != nil {
+			return peer.AddrInfo{}, err
+		}
+		pid, err := peer.IDFromPublicKey(pk)
+		if err != nil {
+			return peer.AddrInfo{}, fmt.Errorf("creating peer ID from public key: %w", err)
+		}
+		return peer.AddrInfo{ID: pid}, nil
+	}
+	if strings.HasPrefix(id, "did:web:") {
+		return resolveDIDWeb(ctx, id)
+	}
+	return peer.AddrInfo{}, fmt.Errorf("unsupported DID method: %s", id)
+}
+
+// didDocument is the subset of a DID document needed to find a peer.
+type didDocument struct {
+	ID                 string `json:"id"`
+	VerificationMethod []struct {
+		PublicKeyMultibase string `json:"publicKeyMultibase"`
+	} `json:"verificationMethod"`
+	Service []struct {
+		ServiceEndpoint any `json:"serviceEndpoint"`
+	} `json:"service"`
+}
+
+// didWebURL returns the URL of the DID document of a did:web.
+func didWebURL(id string) (*url.URL, error) {
+	parts := strings.Split(strings.TrimPrefix(id, "did:web:"), ":")
+	host, err := url.PathUnescape(parts[0])
+	if err != nil || host == "" {
+		return nil, fmt.Errorf("invalid did:web host: %s", id)
+	}
+	u := &url.URL{Scheme: "https", Host: host, Path: "/.well-known/did.json"}
+	if len(parts) > 1 {
+		var path []string
+		for _, p := range parts[1:] {
+			p, err := url.PathUnescape(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid did:web path: %s", id)
+			}
+			path = append(path, p)
+		}
+		u.Path = "/" + strings.Join(path, "/") + "/did.json"
+	}
+	return u, nil
+}
+
+func resolveDIDWeb(ctx context.Context, id string) (peer.AddrInfo, error) {
+	u, err := didWebURL(id)
+	if err != nil {
+		return peer.AddrInfo{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("creating request: %w", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("fetching DID document: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return peer.AddrInfo{}, fmt.Errorf("fetching DID document: %s: %s", u, res.Status)
+	}
+	var doc didDocument
+	err = json.NewDecoder(res.Body).Decode(&doc)
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("decoding DID document: %w", err)
+	}
+	if doc.ID != id {
+		return peer.AddrInfo{}, fmt.Errorf("DID document is for %s not %s", doc.ID, id)
+	}
+
+	var info peer.AddrInfo
+	for _, vm := range doc.VerificationMethod {
+		if vm.PublicKeyMultibase == "" {
+			continue
+		}
+		pk, err := ParsePublicKey(did.KeyPrefix + vm.PublicKeyMultibase)
+		if err != nil {
+			continue
+		}
+		info.ID, err = peer.IDFromPublicKey(pk)
+		if err != nil {
+			return peer.AddrInfo{}, fmt.Errorf("creating peer ID from public key: %w", err)
+		}
+		break
+	}
+	if info.ID == "" {
+		return peer.AddrInfo{}, fmt.Errorf("no supported verification method in DID document: %s", id)
+	}
+	for _, svc := range doc.Service {
+		// a service endpoint is a string, a list of strings, or a map
+		var endpoints []string
+		switch ep := svc.ServiceEndpoint.(type) {
+		case string:
+			endpoints = append(endpoints, ep)
+		case []any:
+			for _, e := range ep {
+				if s, ok := e.(string); ok {
+					endpoints = append(endpoints, s)
+				}
+			}
+		}
+		for _, ep := range endpoints {
+			addr, err := endpointMultiaddr(ep)
+			if err != nil {
+				log.Warnf("ignoring service endpoint: %s: %s", ep, err)
+				continue
+			}
+			info.Addrs = append(info.Addrs, addr)
+		}
+	}
+	return info, nil
+}
+
+// endpointMultiaddr converts a service endpoint, a multiaddr or an HTTP(S) URL,
+// to a multiaddr.
+func endpointMultiaddr(ep string) (multiaddr.Multiaddr, error) {
+	if strings.HasPrefix(ep, "/") {
+		return multiaddr.NewMultiaddr(ep)
+	}
+	u, err := url.Parse(ep)
+	if err != nil {
+		return nil, fmt.Errorf("parsing URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme: %s", u.Scheme)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, errors.New("URL paths are not supported")
+	}
+	var s string
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil {
+			s = "/ip4/" + host
+		} else {
+			s = "/ip6/" + host
+		}
+	} else {
+		s = "/dns/" + host
+	}
+	if port := u.Port(); port != "" {
+		s += "/tcp/" + port
+	}
+	return multiaddr.NewMultiaddr(s + "/" + u.Scheme)
+}
@@ -0,0 +1,47 @@
+package p2p
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+)
+
+// MdnsServiceName is the mDNS service fam agents advertise themselves with on
+// the local network.
+const MdnsServiceName = "_fam._udp"
+
+// DiscoveredRemotePrefix is the prefix of the names of remotes discovered on
+// the local network, which are followed by the peer ID.
+const DiscoveredRemotePrefix = "lan-"
+
+// DiscoveredRemoteName is the name of the remote for a peer discovered on the
+// local network.
+func DiscoveredRemoteName(id peer.ID) string {
+	return DiscoveredRemotePrefix + id.String()
+}
+
+type notifee func(peer.AddrInfo)
+
+func (n notifee) HandlePeerFound(info peer.AddrInfo) {
+	n(info)
+}
+
+// StartDiscovery advertises the host on the local network with mDNS and calls
+// the passed function for every other fam agent found. Only hosts with listen
+// addresses can be found by others. Close the returned closer to stop.
+func StartDiscovery(h host.Host, found func(peer.AddrInfo)) (io.Closer, error) {
+	svc := mdns.NewMdnsService(h, MdnsServiceName, notifee(func(info peer.AddrInfo) {
+		if info.ID == h.ID() {
+			return
+		}
+		found(info)
+	}))
+	err := svc.Start()
+	if err != nil {
+		return nil, fmt.Errorf("starting mDNS service: %w", err)
+	}
+	return svc, nil
+}
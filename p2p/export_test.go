@@ -0,0 +1,9 @@
+package p2p
+
+// MarshalAnnouncement is exported for tests that publish announcements without
+// validating them first.
+var MarshalAnnouncement = marshalAnnouncement
+
+// InvokeAdvance is exported for tests that publish announcements without
+// validating them first.
+var InvokeAdvance = invokeAdvance
@@ -0,0 +1,323 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal"
+)
+
+// GossipTopic is the gossipsub topic new heads of the bucket are announced on.
+func GossipTopic(bucket did.DID) string {
+	return "/fam/heads/1.0.0/" + bucket.String()
+}
+
+// Announcement is a message announcing a new head of a bucket.
+type Announcement struct {
+	// Head is the new head of the announcing peer's replica.
+	Head []ipld.Link
+	// Auth is an archived UCAN invocation of `clock/advance` on the bucket,
+	// issued by the announcing peer to the bucket, that proves it may write to
+	// the bucket.
+	Auth []byte
+}
+
+// Gossip announces new heads of local replicas to peers over gossipsub, and
+// advances local replicas with the heads announced by peers. Blocks for an
+// announced head are fetched from the announcing peer using [ProtocolID], so
+// peers must also serve clock sync requests, see [Handler]. Announcements from
+// peers that cannot prove they may write to the bucket are dropped.
+type Gossip struct {
+	host    host.Host
+	id      principal.Signer
+	pubsub  *pubsub.PubSub
+	resolve bucket.Resolver
+	mutex   sync.Mutex
+	topics  map[did.DID]*pubsub.Topic
+	cancels map[did.DID]context.CancelFunc
+	// proofs authorize reading the blocks of announced heads from peers
+	proofs map[did.DID]delegation.Delegation
+	cfg    config
+}
+
+// Join subscribes to announcements for the bucket. The proof is a UCAN
+// delegation granting this peer the capability to read the merkle clock of the
+// bucket, which is required to fetch announced heads. It is a no-op if
+// already joined.
+func (g *Gossip) Join(ctx context.Context, id did.DID, proof delegation.Delegation) error {
+	_, err := g.topic(ctx, id, proof)
+	return err
+}
+
+// Leave unsubscribes from announcements for the bucket.
+func (g *Gossip) Leave(id did.DID) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	topic, ok := g.topics[id]
+	if !ok {
+		return nil
+	}
+	g.cancels[id]()
+	delete(g.topics, id)
+	delete(g.cancels, id)
+	delete(g.proofs, id)
+	err := topic.Close()
+	if err != nil {
+		return fmt.Errorf("closing topic: %w", err)
+	}
+	err = g.pubsub.UnregisterTopicValidator(topic.String())
+	if err != nil {
+		return fmt.Errorf("unregistering topic validator: %w", err)
+	}
+	return nil
+}
+
+// Announce tells peers about a new head of the bucket. The proof is a UCAN
+// delegation granting this peer the capability to advance the merkle clock of
+// the bucket. The bucket is joined if it has not been already.
+func (g *Gossip) Announce(ctx context.Context, id did.DID, proof delegation.Delegation, head []ipld.Link) error {
+	topic, err := g.topic(ctx, id, proof)
+	if err != nil {
+		return err
+	}
+	auth, err := invokeAdvance(g.id, id, id, proof)
+	if err != nil {
+		return err
+	}
+	b, err := marshalAnnouncement(Announcement{Head: head, Auth: auth})
+	if err != nil {
+		return fmt.Errorf("marshalling announcement: %w", err)
+	}
+	log.Debugf("announcing head of %s: %s", id, head)
+	err = topic.Publish(ctx, b)
+	if err != nil {
+		return fmt.Errorf("publishing announcement: %w", err)
+	}
+	return nil
+}
+
+// topic returns the joined topic for the bucket, joining it if necessary, and
+// records the proof used to fetch the heads announced for it.
+func (g *Gossip) topic(ctx context.Context, id did.DID, proof delegation.Delegation) (*pubsub.Topic, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.proofs[id] = proof
+	if topic, ok := g.topics[id]; ok {
+		return topic, nil
+	}
+
+	name := GossipTopic(id)
+	err := g.pubsub.RegisterTopicValidator(name, func(ctx context.Context, from peer.ID, msg *pubsub.Message) bool {
+		_, err := g.validate(id, msg)
+		if err != nil {
+			log.Warnf("rejecting announcement for %s from %s: %s", id, msg.GetFrom(), err)
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("registering topic validator: %w", err)
+	}
+	topic, err := g.pubsub.Join(name)
+	if err != nil {
+		_ = g.pubsub.UnregisterTopicValidator(name)
+		return nil, fmt.Errorf("joining topic: %w", err)
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		_ = topic.Close()
+		_ = g.pubsub.UnregisterTopicValidator(name)
+		return nil, fmt.Errorf("subscribing to topic: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	go func() {
+		defer sub.Cancel()
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					log.Errorf("receiving announcement for %s: %s", id, err)
+				}
+				return
+			}
+			if msg.GetFrom() == g.host.ID() {
+				continue
+			}
+			err = g.receive(ctx, id, msg)
+			if err != nil {
+				log.Warnf("receiving announcement for %s from %s: %s", id, msg.GetFrom(), err)
+			}
+		}
+	}()
+
+	g.topics[id] = topic
+	g.cancels[id] = cancel
+	return topic, nil
+}
+
+// validate decodes an announcement and verifies that its author may write to
+// the bucket.
+func (g *Gossip) validate(id did.DID, msg *pubsub.Message) (Announcement, error) {
+	ann, err := unmarshalAnnouncement(msg.GetData())
+	if err != nil {
+		return Announcement{}, fmt.Errorf("unmarshalling announcement: %w", err)
+	}
+	pk, err := msg.GetFrom().ExtractPublicKey()
+	if err != nil {
+		pk, err = crypto.UnmarshalPublicKey(msg.GetKey())
+		if err != nil {
+			return Announcement{}, fmt.Errorf("getting author public key: %w", err)
+		}
+	}
+	author, err := PublicKeyDID(pk)
+	if err != nil {
+		return Announcement{}, fmt.Errorf("getting author DID: %w", err)
+	}
+	// announcements are addressed to the bucket, not a particular peer
+	audience, err := ParsePrincipal(id.String())
+	if err != nil {
+		return Announcement{}, fmt.Errorf("parsing bucket DID: %w", err)
+	}
+	err = authorize(audience, id, author, ann.Auth)
+	if err != nil {
+		return Announcement{}, err
+	}
+	return ann, nil
+}
+
+// receive fetches the blocks for an announced head from the announcing peer
+// and advances the local replica with it.
+func (g *Gossip) receive(ctx context.Context, id did.DID, msg *pubsub.Message) error {
+	ann, err := unmarshalAnnouncement(msg.GetData())
+	if err != nil {
+		return fmt.Errorf("unmarshalling announcement: %w", err)
+	}
+	replica, err := g.resolve(ctx, id)
+	if err != nil {
+		return fmt.Errorf("resolving bucket: %w", err)
+	}
+
+	var missing []ipld.Link
+	for _, l := range ann.Head {
+		_, err := replica.Blocks().Get(ctx, l)
+		if err != nil {
+			if !errors.Is(err, block.ErrNotFound) {
+				return fmt.Errorf("getting event: %w", err)
+			}
+			missing = append(missing, l)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	log.Debugf("received head of %s from %s: %s", id, msg.GetFrom(), ann.Head)
+
+	// the author has the blocks, but may not be directly connected, in which
+	// case the peer that forwarded the announcement may have them
+	sources := []peer.ID{msg.GetFrom()}
+	if msg.ReceivedFrom != msg.GetFrom() {
+		sources = append(sources, msg.ReceivedFrom)
+	}
+	g.mutex.Lock()
+	proof := g.proofs[id]
+	g.mutex.Unlock()
+	for _, p := range sources {
+		var server did.DID
+		server, err = PeerDID(p)
+		if err != nil {
+			log.Debugf("getting DID of %s: %s", p, err)
+			continue
+		}
+		svc := &Client{host: g.host, id: g.id, peer: p, server: server, bucket: id, proof: proof}
+		err = bucket.FetchHead(ctx, replica, svc, missing)
+		if err == nil {
+			break
+		}
+		log.Debugf("fetching head of %s from %s: %s", id, p, err)
+	}
+	if err != nil {
+		return fmt.Errorf("fetching head: %w", err)
+	}
+
+	res, err := bucket.Merge(ctx, replica, ann.Head, nil)
+	if err != nil {
+		return err
+	}
+	g.cfg.conflicted(id, msg.GetFrom(), res.Conflicts)
+	return nil
+}
+
+func marshalAnnouncement(ann Announcement) ([]byte, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	ma, err := nb.BeginMap(2)
+	if err != nil {
+		return nil, fmt.Errorf("beginning map: %w", err)
+	}
+	err = assembleLinks(ma, "head", ann.Head)
+	if err != nil {
+		return nil, err
+	}
+	err = assembleBytes(ma, "auth", ann.Auth)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("finishing map: %w", err)
+	}
+	return encode(nb.Build())
+}
+
+func unmarshalAnnouncement(b []byte) (Announcement, error) {
+	var ann Announcement
+	n, err := decode(b)
+	if err != nil {
+		return ann, err
+	}
+	ann.Head, err = lookupLinks(n, "head")
+	if err != nil {
+		return ann, err
+	}
+	ann.Auth, err = lookupBytes(n, "auth")
+	if err != nil {
+		return ann, err
+	}
+	return ann, nil
+}
+
+// NewGossip creates a gossipsub router on the passed host that announces and
+// receives new heads of the replicas found by the passed resolver. The passed
+// signer must be the identity of the host. Conflicts between received heads
+// and local replicas are reported to the handler set by
+// [WithConflictHandler]. The router runs until the context is canceled.
+func NewGossip(ctx context.Context, h host.Host, id principal.Signer, resolve bucket.Resolver, options ...Option) (*Gossip, error) {
+	cfg := newConfig(options)
+	ps, err := pubsub.NewGossipSub(ctx, h, cfg.pubsubOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("creating gossipsub router: %w", err)
+	}
+	return &Gossip{
+		host:    h,
+		id:      id,
+		pubsub:  ps,
+		resolve: resolve,
+		topics:  map[did.DID]*pubsub.Topic{},
+		cancels: map[did.DID]context.CancelFunc{},
+		proofs:  map[did.DID]delegation.Delegation{},
+		cfg:     cfg,
+	}, nil
+}
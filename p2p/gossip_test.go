@@ -0,0 +1,146 @@
+package p2p_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipld/go-ipld-prime"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/fam/p2p"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal"
+	"github.com/stretchr/testify/require"
+)
+
+// newGossipReplica creates a peer replica that announces its writes over
+// gossip, and counts its announcements.
+func newGossipReplica(t *testing.T, space did.DID, id principal.Signer, proof delegation.Delegation, announced *atomic.Int32) *peerReplica {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return newPeerReplica(t, space, id, proof, func(r *peerReplica) bucket.Announcer {
+		g, err := p2p.NewGossip(ctx, r.host, id, func(ctx context.Context, id did.DID) (bucket.Replica, error) {
+			if id != space {
+				return nil, bucket.ErrNotFound
+			}
+			return r, nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, g.Join(ctx, space, proof))
+		r.gossip = g
+		return func(ctx context.Context, head []ipld.Link) error {
+			announced.Add(1)
+			return g.Announce(ctx, space, proof, head)
+		}
+	})
+}
+
+// connect connects every replica to every other.
+func connect(t *testing.T, replicas ...*peerReplica) {
+	t.Helper()
+	for i, r := range replicas {
+		for _, o := range replicas[i+1:] {
+			require.NoError(t, r.host.Connect(context.Background(), o.addrInfo()))
+		}
+	}
+}
+
+// reannounce announces the head of the replica, without a write, until the
+// condition holds, since announcements published before peers have learned of
+// each other's subscriptions are lost.
+func reannounce(t *testing.T, r *peerReplica, space did.DID, proof delegation.Delegation, condition func() bool) {
+	t.Helper()
+	ctx := context.Background()
+	require.Eventually(t, func() bool {
+		if condition() {
+			return true
+		}
+		head, err := r.Head(ctx)
+		require.NoError(t, err)
+		require.NoError(t, r.gossip.Announce(ctx, space, proof, head))
+		return false
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+func hasValue(bk bucket.Bucket[ipld.Link], key string, value ipld.Link) bool {
+	got, err := bk.Get(context.Background(), key)
+	return err == nil && got == value
+}
+
+func TestGossip(t *testing.T) {
+	ctx := context.Background()
+	space := testutil.NewSigner(t)
+
+	t.Run("propagates writes without re-announcing them", func(t *testing.T) {
+		aliceID, bobID, carolID := testutil.NewSigner(t), testutil.NewSigner(t), testutil.NewSigner(t)
+		var aliceAnn, bobAnn, carolAnn atomic.Int32
+		aliceProof := grant(t, space, aliceID)
+		alice := newGossipReplica(t, space.DID(), aliceID, aliceProof, &aliceAnn)
+		bob := newGossipReplica(t, space.DID(), bobID, grant(t, space, bobID), &bobAnn)
+		carol := newGossipReplica(t, space.DID(), carolID, grant(t, space, carolID), &carolAnn)
+		connect(t, alice, bob, carol)
+
+		v := testutil.RandomLink(t)
+		require.NoError(t, alice.Put(ctx, "k", v))
+		require.Equal(t, int32(1), aliceAnn.Load())
+		reannounce(t, alice, space.DID(), aliceProof, func() bool {
+			return hasValue(bob, "k", v) && hasValue(carol, "k", v)
+		})
+
+		ahead, err := alice.Head(ctx)
+		require.NoError(t, err)
+		for _, r := range []*peerReplica{bob, carol} {
+			head, err := r.Head(ctx)
+			require.NoError(t, err)
+			require.Equal(t, ahead, head)
+		}
+		// received heads are not announced again
+		require.Zero(t, bobAnn.Load())
+		require.Zero(t, carolAnn.Load())
+
+		// a local write on a peer that received a head is announced
+		w := testutil.RandomLink(t)
+		bobProof := grant(t, space, bobID)
+		require.NoError(t, bob.Put(ctx, "w", w))
+		require.Equal(t, int32(1), bobAnn.Load())
+		reannounce(t, bob, space.DID(), bobProof, func() bool {
+			return hasValue(alice, "w", w) && hasValue(carol, "w", w)
+		})
+		require.Equal(t, int32(1), aliceAnn.Load())
+		require.Zero(t, carolAnn.Load())
+	})
+
+	t.Run("drops announcements from unauthorized peers", func(t *testing.T) {
+		other := testutil.NewSigner(t)
+		aliceID, malloryID := testutil.NewSigner(t), testutil.NewSigner(t)
+		var aliceAnn atomic.Int32
+		alice := newGossipReplica(t, space.DID(), aliceID, grant(t, space, aliceID), &aliceAnn)
+		// mallory's grant is for another bucket, and mallory publishes on the
+		// topic of the bucket without validating announcements
+		mallory := newPeerReplica(t, space.DID(), malloryID, grant(t, other, malloryID), nil)
+		ps, err := pubsub.NewGossipSub(ctx, mallory.host)
+		require.NoError(t, err)
+		topic, err := ps.Join(p2p.GossipTopic(space.DID()))
+		require.NoError(t, err)
+		connect(t, alice, mallory)
+
+		v := testutil.RandomLink(t)
+		require.NoError(t, mallory.Put(ctx, "k", v))
+		head, err := mallory.Head(ctx)
+		require.NoError(t, err)
+		auth, err := p2p.InvokeAdvance(malloryID, space.DID(), space.DID(), grant(t, other, malloryID))
+		require.NoError(t, err)
+		msg, err := p2p.MarshalAnnouncement(p2p.Announcement{Head: head, Auth: auth})
+		require.NoError(t, err)
+		require.Never(t, func() bool {
+			require.NoError(t, topic.Publish(ctx, msg))
+			return hasValue(alice, "k", v)
+		}, time.Second, 100*time.Millisecond)
+		require.Zero(t, aliceAnn.Load())
+	})
+}
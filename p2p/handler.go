@@ -0,0 +1,196 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-msgio"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/go-ucanto/principal"
+)
+
+var log = logging.Logger("p2p")
+
+// StreamTimeout is the maximum time allowed to handle a single request.
+const StreamTimeout = time.Minute
+
+// Handler serves clock sync requests for local replicas. Every request must
+// present a UCAN invocation issued by the calling peer, whose delegation chain
+// is rooted at the bucket and grants the capability to read the merkle clock,
+// or to advance it for requests that write to a replica.
+type Handler struct {
+	id      principal.Signer
+	resolve bucket.Resolver
+	cfg     config
+}
+
+// Register sets the handler as the stream handler for [ProtocolID] on the
+// passed host.
+func (h *Handler) Register(hst host.Host) {
+	hst.SetStreamHandler(ProtocolID, h.HandleStream)
+}
+
+func (h *Handler) HandleStream(s network.Stream) {
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), StreamTimeout)
+	defer cancel()
+	_ = s.SetDeadline(time.Now().Add(StreamTimeout))
+
+	res, err := h.handle(ctx, s)
+	if err != nil {
+		log.Warnf("handling request from %s: %s", s.Conn().RemotePeer(), err)
+		res = Response{Error: err.Error()}
+	}
+
+	b, err := marshalResponse(res)
+	if err != nil {
+		log.Errorf("marshalling response: %s", err)
+		_ = s.Reset()
+		return
+	}
+	err = msgio.NewVarintWriter(s).WriteMsg(b)
+	if err != nil {
+		log.Errorf("writing response: %s", err)
+		_ = s.Reset()
+	}
+}
+
+func (h *Handler) handle(ctx context.Context, s network.Stream) (Response, error) {
+	b, err := msgio.NewVarintReaderSize(s, MaxMessageSize).ReadMsg()
+	if err != nil {
+		return Response{}, fmt.Errorf("reading request: %w", err)
+	}
+	req, err := unmarshalRequest(b)
+	if err != nil {
+		return Response{}, fmt.Errorf("unmarshalling request: %w", err)
+	}
+
+	caller, err := PublicKeyDID(s.Conn().RemotePublicKey())
+	if err != nil {
+		return Response{}, fmt.Errorf("getting caller DID: %w", err)
+	}
+	switch req.Op {
+	case OpPut, OpAdvance:
+		err = authorize(h.id.Verifier(), req.Bucket, caller, req.Auth)
+	default:
+		err = authorizeRead(h.id.Verifier(), req.Bucket, caller, req.Auth)
+	}
+	if err != nil {
+		return Response{}, err
+	}
+
+	replica, err := h.resolve(ctx, req.Bucket)
+	if err != nil {
+		if errors.Is(err, bucket.ErrNotFound) {
+			return Response{}, fmt.Errorf("bucket not found: %s", req.Bucket)
+		}
+		return Response{}, fmt.Errorf("resolving bucket: %w", err)
+	}
+
+	switch req.Op {
+	case OpHead:
+		head, err := replica.Head(ctx)
+		if err != nil {
+			return Response{}, fmt.Errorf("getting head: %w", err)
+		}
+		return Response{Head: head}, nil
+	case OpBlocks:
+		if len(req.Links) > MaxBlocksPerRequest {
+			return Response{}, fmt.Errorf("too many blocks requested: %d", len(req.Links))
+		}
+		var blocks []block.Block
+		for _, l := range req.Links {
+			b, err := replica.Blocks().Get(ctx, l)
+			if err != nil {
+				if errors.Is(err, block.ErrNotFound) {
+					continue
+				}
+				return Response{}, fmt.Errorf("getting block: %w", err)
+			}
+			blocks = append(blocks, b)
+		}
+		return Response{Blocks: blocks}, nil
+	case OpHas:
+		if len(req.Links) > MaxHasPerRequest {
+			return Response{}, fmt.Errorf("too many links requested: %d", len(req.Links))
+		}
+		var links []ipld.Link
+		for _, l := range req.Links {
+			_, err := replica.Blocks().Get(ctx, l)
+			if err != nil {
+				if errors.Is(err, block.ErrNotFound) {
+					continue
+				}
+				return Response{}, fmt.Errorf("getting block: %w", err)
+			}
+			links = append(links, l)
+		}
+		return Response{Links: links}, nil
+	case OpPut:
+		// pushed blocks are staged until the clock is advanced with the events
+		// they belong to, so that incomplete pushes never reach the replica
+		staged, err := stage(replica)
+		if err != nil {
+			return Response{}, err
+		}
+		err = staged.PutBatch(ctx, req.Blocks)
+		if err != nil {
+			return Response{}, fmt.Errorf("staging blocks: %w", err)
+		}
+		return Response{}, nil
+	case OpAdvance:
+		staged, err := stage(replica)
+		if err != nil {
+			return Response{}, err
+		}
+		base, err := replica.Head(ctx)
+		if err != nil {
+			return Response{}, fmt.Errorf("getting head: %w", err)
+		}
+		// only the staged blocks the replica does not have are verified
+		used, err := bucket.VerifyEvents(ctx, replica.Blocks(), staged, req.Links, base)
+		if err != nil {
+			return Response{}, fmt.Errorf("verifying events: %w", err)
+		}
+		res, err := bucket.Merge(ctx, replica, req.Links, used)
+		if err != nil {
+			return Response{}, err
+		}
+		for _, b := range used {
+			err := staged.Del(ctx, b.Link())
+			if err != nil {
+				log.Warnf("removing staged block: %s", err)
+			}
+		}
+		h.cfg.conflicted(req.Bucket, s.Conn().RemotePeer(), res.Conflicts)
+		return Response{Head: res.Head}, nil
+	default:
+		return Response{}, fmt.Errorf("unknown operation: %s", req.Op)
+	}
+}
+
+// stage returns the blockstore pushed blocks are staged in, see
+// [bucket.Stager].
+func stage(replica bucket.Replica) (block.Blockstore, error) {
+	s, ok := replica.(bucket.Stager)
+	if !ok {
+		return nil, errors.New("bucket cannot receive blocks")
+	}
+	return s.Staged(), nil
+}
+
+// NewHandler creates a new handler that serves clock sync requests for the
+// replicas found by the passed resolver. The passed signer is the identity of
+// the host the handler is registered with. Conflicts between pushed heads and
+// local replicas are reported to the handler set by [WithConflictHandler].
+func NewHandler(id principal.Signer, resolve bucket.Resolver, options ...Option) *Handler {
+	return &Handler{id, resolve, newConfig(options)}
+}
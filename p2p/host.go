@@ -0,0 +1,92 @@
+package p2p
+
+import (
+	stdrsa "crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal"
+	ed25519 "github.com/storacha/go-ucanto/principal/ed25519/signer"
+	edverifier "github.com/storacha/go-ucanto/principal/ed25519/verifier"
+	"github.com/storacha/go-ucanto/principal/multiformat"
+	rsa "github.com/storacha/go-ucanto/principal/rsa/signer"
+	rsaverifier "github.com/storacha/go-ucanto/principal/rsa/verifier"
+)
+
+// NewHost creates a libp2p host whose peer identity is the passed signer.
+func NewHost(id principal.Signer, opts ...libp2p.Option) (host.Host, error) {
+	pk, err := PrivateKey(id)
+	if err != nil {
+		return nil, err
+	}
+	return libp2p.New(append([]libp2p.Option{libp2p.Identity(pk)}, opts...)...)
+}
+
+// PrivateKey converts the signer to a libp2p private key.
+func PrivateKey(id principal.Signer) (crypto.PrivKey, error) {
+	switch id.Code() {
+	case ed25519.Code:
+		pk, err := crypto.UnmarshalEd25519PrivateKey(id.Raw())
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling Ed25519 private key: %w", err)
+		}
+		return pk, nil
+	case rsa.Code:
+		pk, err := crypto.UnmarshalRsaPrivateKey(id.Raw())
+		if err != nil {
+			return nil, fmt.Errorf("unmarshalling RSA private key: %w", err)
+		}
+		return pk, nil
+	default:
+		return nil, fmt.Errorf("unsupported signer: 0x%x", id.Code())
+	}
+}
+
+// PeerDID returns the did:key of a peer. Only peers with Ed25519 or RSA keys
+// have one, secp256k1 keys cannot be UCAN principals.
+func PeerDID(id peer.ID) (did.DID, error) {
+	pk, err := id.ExtractPublicKey()
+	if err != nil {
+		return did.Undef, fmt.Errorf("extracting public key from peer ID: %w", err)
+	}
+	return PublicKeyDID(pk)
+}
+
+// PublicKeyDID converts the libp2p public key of a peer to a DID.
+func PublicKeyDID(pk crypto.PubKey) (did.DID, error) {
+	raw, err := pk.Raw()
+	if err != nil {
+		return did.Undef, fmt.Errorf("getting raw public key: %w", err)
+	}
+	switch pk.Type() {
+	case crypto.Ed25519:
+		v, err := edverifier.Decode(multiformat.TagWith(edverifier.Code, raw))
+		if err != nil {
+			return did.Undef, fmt.Errorf("decoding Ed25519 public key: %w", err)
+		}
+		return v.DID(), nil
+	case crypto.RSA:
+		// libp2p RSA public keys are PKIX encoded, but RSA DIDs use PKCS #1
+		pub, err := x509.ParsePKIXPublicKey(raw)
+		if err != nil {
+			return did.Undef, fmt.Errorf("parsing RSA public key: %w", err)
+		}
+		rpk, ok := pub.(*stdrsa.PublicKey)
+		if !ok {
+			return did.Undef, errors.New("public key is not an RSA key")
+		}
+		v, err := rsaverifier.Decode(multiformat.TagWith(rsaverifier.Code, x509.MarshalPKCS1PublicKey(rpk)))
+		if err != nil {
+			return did.Undef, fmt.Errorf("decoding RSA public key: %w", err)
+		}
+		return v.DID(), nil
+	default:
+		return did.Undef, fmt.Errorf("unsupported public key type: %s, only Ed25519 and RSA keys can be UCAN principals", pk.Type())
+	}
+}
@@ -0,0 +1,366 @@
+package p2p
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/go-ucanto/did"
+)
+
+const (
+	// OpHead requests the current head of the merkle clock.
+	OpHead = "head"
+	// OpBlocks requests the blocks for a list of links.
+	OpBlocks = "blocks"
+	// OpHas requests which of a list of links the peer has blocks for.
+	OpHas = "has"
+	// OpPut sends blocks to be stored by the peer.
+	OpPut = "put"
+	// OpAdvance advances the merkle clock with a list of events.
+	OpAdvance = "advance"
+)
+
+// Request is a message sent to a clock sync peer.
+type Request struct {
+	// Op is the operation to perform.
+	Op string
+	// Bucket is the DID of the bucket the request refers to.
+	Bucket did.DID
+	// Links are the CIDs of the blocks requested (for [OpBlocks] and [OpHas])
+	// or the events to advance the clock with (for [OpAdvance]).
+	Links []ipld.Link
+	// Blocks are the blocks to store (for [OpPut]).
+	Blocks []block.Block
+	// Auth is an archived UCAN invocation on the bucket, issued by the caller,
+	// of `clock/advance`, that authorizes writes (for [OpPut] and
+	// [OpAdvance]), or of `clock/head`, that authorizes reads (for the other
+	// operations).
+	Auth []byte
+}
+
+// Response is a message received from a clock sync peer.
+type Response struct {
+	// Head is the head of the merkle clock (for [OpHead] and [OpAdvance]).
+	Head []ipld.Link
+	// Blocks are the requested blocks (for [OpBlocks]).
+	Blocks []block.Block
+	// Links are the requested links the peer has blocks for (for [OpHas]).
+	Links []ipld.Link
+	// Error is a message describing why the request failed.
+	Error string
+}
+
+func marshalRequest(req Request) ([]byte, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	ma, err := nb.BeginMap(5)
+	if err != nil {
+		return nil, fmt.Errorf("beginning map: %w", err)
+	}
+	err = assembleString(ma, "op", req.Op)
+	if err != nil {
+		return nil, err
+	}
+	err = assembleString(ma, "bucket", req.Bucket.String())
+	if err != nil {
+		return nil, err
+	}
+	err = assembleLinks(ma, "links", req.Links)
+	if err != nil {
+		return nil, err
+	}
+	err = assembleBlocks(ma, "blocks", req.Blocks)
+	if err != nil {
+		return nil, err
+	}
+	err = assembleBytes(ma, "auth", req.Auth)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("finishing map: %w", err)
+	}
+	return encode(nb.Build())
+}
+
+func unmarshalRequest(b []byte) (Request, error) {
+	var req Request
+	n, err := decode(b)
+	if err != nil {
+		return req, err
+	}
+	req.Op, err = lookupString(n, "op")
+	if err != nil {
+		return req, err
+	}
+	bucket, err := lookupString(n, "bucket")
+	if err != nil {
+		return req, err
+	}
+	req.Bucket, err = did.Parse(bucket)
+	if err != nil {
+		return req, fmt.Errorf("parsing bucket DID: %w", err)
+	}
+	req.Links, err = lookupLinks(n, "links")
+	if err != nil {
+		return req, err
+	}
+	req.Blocks, err = lookupBlocks(n, "blocks")
+	if err != nil {
+		return req, err
+	}
+	req.Auth, err = lookupBytes(n, "auth")
+	if err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+func marshalResponse(res Response) ([]byte, error) {
+	np := basicnode.Prototype.Any
+	nb := np.NewBuilder()
+	ma, err := nb.BeginMap(4)
+	if err != nil {
+		return nil, fmt.Errorf("beginning map: %w", err)
+	}
+	err = assembleLinks(ma, "head", res.Head)
+	if err != nil {
+		return nil, err
+	}
+	err = assembleBlocks(ma, "blocks", res.Blocks)
+	if err != nil {
+		return nil, err
+	}
+	err = assembleLinks(ma, "links", res.Links)
+	if err != nil {
+		return nil, err
+	}
+	err = assembleString(ma, "error", res.Error)
+	if err != nil {
+		return nil, err
+	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("finishing map: %w", err)
+	}
+	return encode(nb.Build())
+}
+
+func unmarshalResponse(b []byte) (Response, error) {
+	var res Response
+	n, err := decode(b)
+	if err != nil {
+		return res, err
+	}
+	res.Head, err = lookupLinks(n, "head")
+	if err != nil {
+		return res, err
+	}
+	res.Blocks, err = lookupBlocks(n, "blocks")
+	if err != nil {
+		return res, err
+	}
+	res.Links, err = lookupLinks(n, "links")
+	if err != nil {
+		return res, err
+	}
+	res.Error, err = lookupString(n, "error")
+	if err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+func encode(n ipld.Node) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+	err := dagcbor.Encode(n, buf)
+	if err != nil {
+		return nil, fmt.Errorf("CBOR encoding: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(b []byte) (ipld.Node, error) {
+	np := basicnode.Prototype.Map
+	nb := np.NewBuilder()
+	err := dagcbor.Decode(nb, bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("CBOR decoding: %w", err)
+	}
+	return nb.Build(), nil
+}
+
+func assembleString(ma datamodel.MapAssembler, key string, value string) error {
+	err := ma.AssembleKey().AssignString(key)
+	if err != nil {
+		return fmt.Errorf("assembling %s key: %w", key, err)
+	}
+	err = ma.AssembleValue().AssignString(value)
+	if err != nil {
+		return fmt.Errorf("assembling %s value: %w", key, err)
+	}
+	return nil
+}
+
+func assembleBytes(ma datamodel.MapAssembler, key string, value []byte) error {
+	err := ma.AssembleKey().AssignString(key)
+	if err != nil {
+		return fmt.Errorf("assembling %s key: %w", key, err)
+	}
+	err = ma.AssembleValue().AssignBytes(value)
+	if err != nil {
+		return fmt.Errorf("assembling %s value: %w", key, err)
+	}
+	return nil
+}
+
+func assembleLinks(ma datamodel.MapAssembler, key string, links []ipld.Link) error {
+	err := ma.AssembleKey().AssignString(key)
+	if err != nil {
+		return fmt.Errorf("assembling %s key: %w", key, err)
+	}
+	la, err := ma.AssembleValue().BeginList(int64(len(links)))
+	if err != nil {
+		return fmt.Errorf("beginning %s list: %w", key, err)
+	}
+	for _, l := range links {
+		err = la.AssembleValue().AssignLink(l)
+		if err != nil {
+			return fmt.Errorf("assembling link: %w", err)
+		}
+	}
+	err = la.Finish()
+	if err != nil {
+		return fmt.Errorf("finishing %s list: %w", key, err)
+	}
+	return nil
+}
+
+func assembleBlocks(ma datamodel.MapAssembler, key string, blocks []block.Block) error {
+	err := ma.AssembleKey().AssignString(key)
+	if err != nil {
+		return fmt.Errorf("assembling %s key: %w", key, err)
+	}
+	la, err := ma.AssembleValue().BeginList(int64(len(blocks)))
+	if err != nil {
+		return fmt.Errorf("beginning %s list: %w", key, err)
+	}
+	for _, b := range blocks {
+		// blocks are encoded as a tuple of [link, bytes]
+		ba, err := la.AssembleValue().BeginList(2)
+		if err != nil {
+			return fmt.Errorf("beginning block tuple: %w", err)
+		}
+		err = ba.AssembleValue().AssignLink(b.Link())
+		if err != nil {
+			return fmt.Errorf("assembling block link: %w", err)
+		}
+		err = ba.AssembleValue().AssignBytes(b.Bytes())
+		if err != nil {
+			return fmt.Errorf("assembling block bytes: %w", err)
+		}
+		err = ba.Finish()
+		if err != nil {
+			return fmt.Errorf("finishing block tuple: %w", err)
+		}
+	}
+	err = la.Finish()
+	if err != nil {
+		return fmt.Errorf("finishing %s list: %w", key, err)
+	}
+	return nil
+}
+
+func lookupString(n ipld.Node, key string) (string, error) {
+	vn, err := n.LookupByString(key)
+	if err != nil {
+		return "", fmt.Errorf("looking up %s: %w", key, err)
+	}
+	v, err := vn.AsString()
+	if err != nil {
+		return "", fmt.Errorf("decoding %s as string: %w", key, err)
+	}
+	return v, nil
+}
+
+func lookupBytes(n ipld.Node, key string) ([]byte, error) {
+	vn, err := n.LookupByString(key)
+	if err != nil {
+		return nil, fmt.Errorf("looking up %s: %w", key, err)
+	}
+	v, err := vn.AsBytes()
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s as bytes: %w", key, err)
+	}
+	return v, nil
+}
+
+func lookupLinks(n ipld.Node, key string) ([]ipld.Link, error) {
+	vn, err := n.LookupByString(key)
+	if err != nil {
+		return nil, fmt.Errorf("looking up %s: %w", key, err)
+	}
+	values := vn.ListIterator()
+	if values == nil {
+		return nil, fmt.Errorf("%s is not a list", key)
+	}
+	var links []ipld.Link
+	for !values.Done() {
+		_, n, err := values.Next()
+		if err != nil {
+			return nil, fmt.Errorf("iterating %s: %w", key, err)
+		}
+		l, err := n.AsLink()
+		if err != nil {
+			return nil, fmt.Errorf("decoding link: %w", err)
+		}
+		links = append(links, l)
+	}
+	return links, nil
+}
+
+func lookupBlocks(n ipld.Node, key string) ([]block.Block, error) {
+	vn, err := n.LookupByString(key)
+	if err != nil {
+		return nil, fmt.Errorf("looking up %s: %w", key, err)
+	}
+	values := vn.ListIterator()
+	if values == nil {
+		return nil, fmt.Errorf("%s is not a list", key)
+	}
+	var blocks []block.Block
+	for !values.Done() {
+		_, n, err := values.Next()
+		if err != nil {
+			return nil, fmt.Errorf("iterating %s: %w", key, err)
+		}
+		ln, err := n.LookupByIndex(0)
+		if err != nil {
+			return nil, fmt.Errorf("looking up block link: %w", err)
+		}
+		l, err := ln.AsLink()
+		if err != nil {
+			return nil, fmt.Errorf("decoding block link: %w", err)
+		}
+		bn, err := n.LookupByIndex(1)
+		if err != nil {
+			return nil, fmt.Errorf("looking up block bytes: %w", err)
+		}
+		b, err := bn.AsBytes()
+		if err != nil {
+			return nil, fmt.Errorf("decoding block bytes: %w", err)
+		}
+		blk, err := block.Verify(l, b)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, blk)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,53 @@
+package p2p
+
+import (
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/go-ucanto/did"
+)
+
+// ConflictHandler is called with the keys modified differently on a local
+// replica and on a head received from a peer, when the head is merged into
+// the replica.
+type ConflictHandler func(id did.DID, from peer.ID, conflicts []bucket.Conflict)
+
+// Option is an option configuring a [Handler] or [Gossip].
+type Option func(cfg *config)
+
+type config struct {
+	conflicts     ConflictHandler
+	pubsubOptions []pubsub.Option
+}
+
+// WithConflictHandler sets a function that is called when a head received
+// from a peer conflicts with the local replica.
+func WithConflictHandler(handler ConflictHandler) Option {
+	return func(cfg *config) {
+		cfg.conflicts = handler
+	}
+}
+
+// WithPubSubOptions configures the options used to create the gossipsub
+// router of a [Gossip].
+func WithPubSubOptions(opts ...pubsub.Option) Option {
+	return func(cfg *config) {
+		cfg.pubsubOptions = append(cfg.pubsubOptions, opts...)
+	}
+}
+
+func newConfig(options []Option) config {
+	cfg := config{}
+	for _, opt := range options {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// conflicted calls the conflict handler, if any, when there are conflicts.
+func (cfg config) conflicted(id did.DID, from peer.ID, conflicts []bucket.Conflict) {
+	if cfg.conflicts == nil || len(conflicts) == 0 {
+		return
+	}
+	cfg.conflicts(id, from, conflicts)
+}
@@ -4,21 +4,28 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"sync"
 
 	ds "github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/namespace"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipld/go-ipld-prime"
-	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/storacha/fam/block"
 	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/p2p"
+	"github.com/storacha/fam/w3clock"
 	"github.com/storacha/go-ucanto/core/delegation"
 	"github.com/storacha/go-ucanto/did"
 	"github.com/storacha/go-ucanto/principal"
 	"github.com/storacha/go-ucanto/principal/ed25519/signer"
-	"github.com/storacha/go-ucanto/principal/ed25519/verifier"
+	"github.com/storacha/go-ucanto/ucan"
 )
 
 var log = logging.Logger("userdata")
@@ -31,11 +38,31 @@ var (
 	DefaultRemoteAddr = "/dns/clock.web3.storage/https"
 )
 
+// Option is an option configuring the user data store.
+type Option func(cfg *config) error
+
+type config struct {
+	hostOptions []libp2p.Option
+}
+
+// WithHostOptions configures the options used to create the libp2p host.
+func WithHostOptions(opts ...libp2p.Option) Option {
+	return func(cfg *config) error {
+		cfg.hostOptions = append(cfg.hostOptions, opts...)
+		return nil
+	}
+}
+
 type UserDataStore struct {
 	dstore  ds.Datastore
 	keys    bucket.Bucket[principal.Signer]
 	grants  bucket.Bucket[delegation.Delegation]
+	remotes bucket.Bucket[did.DID]
 	buckets map[did.DID]bucket.Bucket[ipld.Link]
+	cfg     config
+	mutex   sync.Mutex
+	host    host.Host
+	gossip  *p2p.Gossip
 }
 
 // ID retrieves the named private key (signer) of the agent.
@@ -43,7 +70,215 @@ func (userdata *UserDataStore) ID(ctx context.Context) (principal.Signer, error)
 	return userdata.keys.Get(ctx, DefaultKeyName)
 }
 
+// Host retrieves the libp2p host of the agent, creating it if necessary. The
+// peer ID of the host is derived from the agent's signing key.
+func (userdata *UserDataStore) Host(ctx context.Context) (host.Host, error) {
+	userdata.mutex.Lock()
+	defer userdata.mutex.Unlock()
+	if userdata.host != nil {
+		return userdata.host, nil
+	}
+	id, err := userdata.ID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting agent ID: %w", err)
+	}
+	opts := userdata.cfg.hostOptions
+	if len(opts) == 0 {
+		opts = []libp2p.Option{libp2p.NoListenAddrs}
+	}
+	h, err := p2p.NewHost(id, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating libp2p host: %w", err)
+	}
+	userdata.host = h
+	return h, nil
+}
+
+// StartGossip starts announcing new heads of the user's buckets to peers, and
+// advancing the buckets with the heads announced by peers, until the context
+// is canceled. Peers at the non-HTTP addresses of the remotes of each bucket
+// are connected to, so that announcements can be exchanged with them.
+func (userdata *UserDataStore) StartGossip(ctx context.Context, options ...p2p.Option) error {
+	h, err := userdata.Host(ctx)
+	if err != nil {
+		return err
+	}
+	id, err := userdata.ID(ctx)
+	if err != nil {
+		return fmt.Errorf("getting agent ID: %w", err)
+	}
+	g, err := p2p.NewGossip(ctx, h, id, userdata.Replica, options...)
+	if err != nil {
+		return err
+	}
+	userdata.mutex.Lock()
+	userdata.gossip = g
+	userdata.mutex.Unlock()
+
+	buckets, err := userdata.Buckets(ctx)
+	if err != nil {
+		return err
+	}
+	for bid, proof := range buckets {
+		err := g.Join(ctx, bid, proof)
+		if err != nil {
+			return fmt.Errorf("joining gossip for bucket: %s: %w", bid, err)
+		}
+		bk, err := userdata.Bucket(ctx, bid)
+		if err != nil {
+			return err
+		}
+		nbk, ok := bk.(bucket.Networker)
+		if !ok {
+			continue
+		}
+		rems, err := nbk.Remotes(ctx)
+		if err != nil {
+			return err
+		}
+		for entry, err := range rems.Entries(ctx) {
+			if err != nil {
+				return err
+			}
+			if w3clock.IsHTTP(entry.Value) {
+				continue
+			}
+			go func(addr peer.AddrInfo) {
+				err := h.Connect(ctx, addr)
+				if err != nil {
+					log.Warnf("connecting to remote: %s: %s", addr.ID, err)
+				}
+			}(entry.Value)
+		}
+	}
+	return nil
+}
+
+// StartDiscovery finds other fam agents on the local network with mDNS until the
+// context is canceled. Agents that hold a bucket the user also has are added
+// to it as discovered remotes, see [bucket.Discoverer], and removed again when
+// they disconnect. The host must have listen addresses to be found by others.
+func (userdata *UserDataStore) StartDiscovery(ctx context.Context) error {
+	h, err := userdata.Host(ctx)
+	if err != nil {
+		return err
+	}
+	svc, err := p2p.StartDiscovery(h, func(info peer.AddrInfo) {
+		go userdata.discovered(ctx, info)
+	})
+	if err != nil {
+		return err
+	}
+	h.Network().Notify(&network.NotifyBundle{
+		DisconnectedF: func(n network.Network, c network.Conn) {
+			if n.Connectedness(c.RemotePeer()) == network.Connected {
+				return
+			}
+			go userdata.lost(ctx, c.RemotePeer())
+		},
+	})
+	go func() {
+		<-ctx.Done()
+		err := svc.Close()
+		if err != nil {
+			log.Errorf("closing mDNS service: %s", err)
+		}
+	}()
+	return nil
+}
+
+// discovered adds a peer found on the local network as a discovered remote of
+// the buckets it holds.
+func (userdata *UserDataStore) discovered(ctx context.Context, info peer.AddrInfo) {
+	h, err := userdata.Host(ctx)
+	if err != nil {
+		log.Errorf("getting host: %s", err)
+		return
+	}
+	signer, err := userdata.ID(ctx)
+	if err != nil {
+		log.Errorf("getting agent ID: %s", err)
+		return
+	}
+	server, err := p2p.PeerDID(info.ID)
+	if err != nil {
+		log.Debugf("ignoring discovered peer: %s: %s", info.ID, err)
+		return
+	}
+	buckets, err := userdata.Buckets(ctx)
+	if err != nil {
+		log.Errorf("listing buckets: %s", err)
+		return
+	}
+	name := p2p.DiscoveredRemoteName(info.ID)
+	for id, proof := range buckets {
+		bk, err := userdata.Bucket(ctx, id)
+		if err != nil {
+			log.Errorf("getting bucket: %s: %s", id, err)
+			continue
+		}
+		dbk, ok := bk.(bucket.Discoverer)
+		if !ok {
+			continue
+		}
+		rems, err := dbk.Discovered(ctx)
+		if err != nil {
+			log.Errorf("getting discovered remotes: %s: %s", id, err)
+			continue
+		}
+		if _, ok := rems[name]; ok {
+			continue
+		}
+		// the peer holds the bucket if it can tell us the head
+		client, err := p2p.Dial(ctx, h, signer, id, proof, server, info)
+		if err != nil {
+			log.Debugf("dialing discovered peer: %s: %s", info.ID, err)
+			continue
+		}
+		_, err = client.Head(ctx)
+		if err != nil {
+			log.Debugf("discovered peer %s does not hold bucket %s: %s", info.ID, id, err)
+			continue
+		}
+		log.Infof("discovered peer %s holding bucket %s", info.ID, id)
+		err = dbk.AddDiscovered(ctx, name, info)
+		if err != nil {
+			log.Errorf("adding discovered remote: %s: %s", id, err)
+		}
+	}
+}
+
+// lost removes a disconnected peer from the discovered remotes of all buckets.
+func (userdata *UserDataStore) lost(ctx context.Context, id peer.ID) {
+	userdata.mutex.Lock()
+	buckets := slices.Collect(maps.Values(userdata.buckets))
+	userdata.mutex.Unlock()
+	name := p2p.DiscoveredRemoteName(id)
+	for _, bk := range buckets {
+		dbk, ok := bk.(bucket.Discoverer)
+		if !ok {
+			continue
+		}
+		rems, err := dbk.Discovered(ctx)
+		if err != nil {
+			log.Errorf("getting discovered remotes: %s", err)
+			continue
+		}
+		if _, ok := rems[name]; !ok {
+			continue
+		}
+		log.Infof("lost discovered peer %s", id)
+		err = dbk.RemoveDiscovered(ctx, name)
+		if err != nil {
+			log.Errorf("removing discovered remote: %s", err)
+		}
+	}
+}
+
 func (userdata *UserDataStore) AddBucket(ctx context.Context, proof delegation.Delegation) (did.DID, error) {
+	if ucan.IsExpired(proof) {
+		return did.Undef, errors.New("grant has expired")
+	}
 	bucketID := did.Undef
 	var canMutateClock bool
 	var canUpload bool
@@ -88,6 +323,16 @@ func (userdata *UserDataStore) AddBucket(ctx context.Context, proof delegation.D
 		return did.Undef, err
 	}
 
+	userdata.mutex.Lock()
+	g := userdata.gossip
+	userdata.mutex.Unlock()
+	if g != nil {
+		err = g.Join(ctx, bucketID, proof)
+		if err != nil {
+			return did.Undef, fmt.Errorf("joining gossip for bucket: %w", err)
+		}
+	}
+
 	return bucketID, nil
 }
 
@@ -96,7 +341,16 @@ func (userdata *UserDataStore) RemoveBucket(ctx context.Context, id did.DID) err
 	if err != nil {
 		return err
 	}
+	userdata.mutex.Lock()
 	delete(userdata.buckets, id)
+	g := userdata.gossip
+	userdata.mutex.Unlock()
+	if g != nil {
+		err = g.Leave(id)
+		if err != nil {
+			return fmt.Errorf("leaving gossip for bucket: %w", err)
+		}
+	}
 	// TODO: clean data
 	return nil
 }
@@ -119,11 +373,14 @@ func (userdata *UserDataStore) Buckets(ctx context.Context) (map[did.DID]delegat
 
 // Bucket retrieves a specific user bucket by it's DID.
 func (userdata *UserDataStore) Bucket(ctx context.Context, id did.DID) (bucket.Bucket[ipld.Link], error) {
+	userdata.mutex.Lock()
+	defer userdata.mutex.Unlock()
 	if bucket, ok := userdata.buckets[id]; ok {
 		return bucket, nil
 	}
 	// ensure it exists
-	if _, err := userdata.grants.Get(ctx, id.String()); err != nil {
+	proof, err := userdata.grants.Get(ctx, id.String())
+	if err != nil {
 		return nil, err
 	}
 	// TODO: verify delegation is still valid
@@ -131,10 +388,24 @@ func (userdata *UserDataStore) Bucket(ctx context.Context, id did.DID) (bucket.B
 	// TODO: storacha blockstore?
 	// TODO: tiered blockstore local, remote
 
+	// events written locally are signed by this agent, with the grant as proof
+	// of its authority to write to the bucket
+	sign := func(ctx context.Context, event ipld.Link) ([]byte, error) {
+		signer, err := userdata.ID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return p2p.AuthorizeEvent(signer, id, proof, event)
+	}
+	verify := p2p.NewEventVerifier(id)
+
 	pfx := ds.NewKey(fmt.Sprintf("bucket/%s", id.String()))
+	blocks := block.NewDsBlockstore(namespace.Wrap(userdata.dstore, pfx.ChildString("blocks")))
 	bk, err := bucket.NewDsClockBucket(
-		block.NewDsBlockstore(namespace.Wrap(userdata.dstore, pfx.ChildString("blocks"))),
+		blocks,
 		namespace.Wrap(userdata.dstore, pfx.ChildString("shards")),
+		bucket.WithEventSigner(sign),
+		bucket.WithHistory(),
 	)
 	if err != nil {
 		return nil, err
@@ -153,11 +424,7 @@ func (userdata *UserDataStore) Bucket(ctx context.Context, id did.DID) (bucket.B
 	_, err = rems.Get(ctx, DefaultRemoteName)
 	if err != nil {
 		if errors.Is(err, bucket.ErrNotFound) {
-			pcl, err := verifier.Parse(DefaultRemoteID)
-			if err != nil {
-				return nil, err
-			}
-			pk, err := crypto.UnmarshalEd25519PublicKey(pcl.Raw())
+			pk, err := p2p.ParsePublicKey(DefaultRemoteID)
 			if err != nil {
 				return nil, err
 			}
@@ -180,7 +447,35 @@ func (userdata *UserDataStore) Bucket(ctx context.Context, id did.DID) (bucket.B
 			return nil, err
 		}
 	}
-	nbk, err := bucket.NewNetworkClockBucket(bk, rems)
+	dial := func(ctx context.Context, addr peer.AddrInfo) (bucket.ClockService, error) {
+		signer, err := userdata.ID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		server, err := userdata.RemoteID(ctx, addr.ID)
+		if err != nil {
+			return nil, err
+		}
+		// remotes with an HTTP(S) address are UCAN clock services
+		if w3clock.IsHTTP(addr) {
+			return w3clock.Dial(ctx, signer, id, proof, server, addr)
+		}
+		h, err := userdata.Host(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return p2p.Dial(ctx, h, signer, id, proof, server, addr)
+	}
+	announce := func(ctx context.Context, head []ipld.Link) error {
+		userdata.mutex.Lock()
+		g := userdata.gossip
+		userdata.mutex.Unlock()
+		if g == nil {
+			return nil
+		}
+		return g.Announce(ctx, id, proof, head)
+	}
+	nbk, err := bucket.NewNetworkClockBucket(bk, blocks, rems, bk, dial, announce, verify)
 	if err != nil {
 		return nil, err
 	}
@@ -189,11 +484,66 @@ func (userdata *UserDataStore) Bucket(ctx context.Context, id did.DID) (bucket.B
 	return nbk, nil
 }
 
+// SetRemoteID records the DID of the remote peer with the passed ID, the
+// audience of the UCAN invocations sent to it. It is needed for remotes
+// identified by a did:web, other remotes are identified by the did:key of
+// their peer ID.
+func (userdata *UserDataStore) SetRemoteID(ctx context.Context, id peer.ID, server did.DID) error {
+	return userdata.remotes.Put(ctx, id.String(), server)
+}
+
+// RemoteID retrieves the DID of the remote peer with the passed ID, which is
+// the DID recorded by [UserDataStore.SetRemoteID], if any, or else the did:key
+// of the peer.
+func (userdata *UserDataStore) RemoteID(ctx context.Context, id peer.ID) (did.DID, error) {
+	server, err := userdata.remotes.Get(ctx, id.String())
+	if err == nil {
+		return server, nil
+	}
+	if !errors.Is(err, bucket.ErrNotFound) {
+		return did.Undef, fmt.Errorf("getting remote ID: %s: %w", id, err)
+	}
+	server, err = p2p.PeerDID(id)
+	if err != nil {
+		return did.Undef, fmt.Errorf("remote peer %s has no DID: %w", id, err)
+	}
+	return server, nil
+}
+
+// Replica retrieves a specific user bucket by it's DID as a replica that can be
+// synced with remotes.
+func (userdata *UserDataStore) Replica(ctx context.Context, id did.DID) (bucket.Replica, error) {
+	bk, err := userdata.Bucket(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	replica, ok := bk.(bucket.Replica)
+	if !ok {
+		return nil, fmt.Errorf("bucket is not a replica: %s", id)
+	}
+	return replica, nil
+}
+
 func (userdata *UserDataStore) Close() error {
+	userdata.mutex.Lock()
+	defer userdata.mutex.Unlock()
+	if userdata.host != nil {
+		err := userdata.host.Close()
+		if err != nil {
+			log.Errorf("closing libp2p host: %s", err)
+		}
+	}
 	return userdata.dstore.Close()
 }
 
-func NewUserDataStore(ctx context.Context, dstore ds.Datastore) (*UserDataStore, error) {
+func NewUserDataStore(ctx context.Context, dstore ds.Datastore, options ...Option) (*UserDataStore, error) {
+	cfg := config{}
+	for _, opt := range options {
+		if err := opt(&cfg); err != nil {
+			return nil, err
+		}
+	}
+
 	log.Debugln("creating key bucket...")
 
 	keyshards, err := bucket.NewDsClockBucket(
@@ -231,5 +581,22 @@ func NewUserDataStore(ctx context.Context, dstore ds.Datastore) (*UserDataStore,
 	}
 	grants := bucket.NewDelegationBucket(grantshards)
 
-	return &UserDataStore{dstore, keys, grants, map[did.DID]bucket.Bucket[ipld.Link]{}}, nil
+	log.Debugln("creating remote IDs bucket...")
+	remoteshards, err := bucket.NewDsClockBucket(
+		block.NewDsBlockstore(namespace.Wrap(dstore, ds.NewKey("remotes/blocks/"))),
+		namespace.Wrap(dstore, ds.NewKey("remotes/shards/")),
+	)
+	if err != nil {
+		return nil, err
+	}
+	remotes := bucket.NewDIDBucket(remoteshards)
+
+	return &UserDataStore{
+		dstore:  dstore,
+		keys:    keys,
+		grants:  grants,
+		remotes: remotes,
+		buckets: map[did.DID]bucket.Bucket[ipld.Link]{},
+		cfg:     cfg,
+	}, nil
 }
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/p2p"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal/ed25519/signer"
+	"github.com/storacha/go-ucanto/ucan"
+	"github.com/stretchr/testify/require"
+)
+
+// newUserDataStore creates a user data store whose host listens on the
+// loopback interface and serves its buckets.
+func newUserDataStore(t *testing.T) *UserDataStore {
+	t.Helper()
+	ctx := context.Background()
+	userdata, err := NewUserDataStore(ctx, dssync.MutexWrap(ds.NewMapDatastore()), WithHostOptions(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0")))
+	require.NoError(t, err)
+	t.Cleanup(func() { userdata.Close() })
+	h, err := userdata.Host(ctx)
+	require.NoError(t, err)
+	id, err := userdata.ID(ctx)
+	require.NoError(t, err)
+	p2p.NewHandler(id, userdata.Replica).Register(h)
+	return userdata
+}
+
+// addBucket creates a new bucket and grants the agent of each user data store
+// access to it.
+func addBucket(t *testing.T, stores ...*UserDataStore) did.DID {
+	t.Helper()
+	ctx := context.Background()
+	space, err := signer.Generate()
+	require.NoError(t, err)
+	for _, userdata := range stores {
+		id, err := userdata.ID(ctx)
+		require.NoError(t, err)
+		proof, err := delegation.Delegate(space, id, []ucan.Capability[ucan.NoCaveats]{
+			ucan.NewCapability("*", space.DID().String(), ucan.NoCaveats{}),
+		})
+		require.NoError(t, err)
+		_, err = userdata.AddBucket(ctx, proof)
+		require.NoError(t, err)
+	}
+	return space.DID()
+}
+
+func addrInfo(t *testing.T, userdata *UserDataStore) peer.AddrInfo {
+	t.Helper()
+	h, err := userdata.Host(context.Background())
+	require.NoError(t, err)
+	return peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}
+}
+
+func discovered(t *testing.T, userdata *UserDataStore, id did.DID) map[string]peer.AddrInfo {
+	t.Helper()
+	ctx := context.Background()
+	bk, err := userdata.Bucket(ctx, id)
+	require.NoError(t, err)
+	rems, err := bk.(bucket.Discoverer).Discovered(ctx)
+	require.NoError(t, err)
+	return rems
+}
+
+func TestDiscovered(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("adds peers to the buckets they hold", func(t *testing.T) {
+		alice, bob := newUserDataStore(t), newUserDataStore(t)
+		// alice holds both buckets, bob only the second
+		first := addBucket(t, alice)
+		second := addBucket(t, alice, bob)
+
+		info := addrInfo(t, bob)
+		alice.discovered(ctx, info)
+		require.Empty(t, discovered(t, alice, first))
+		rems := discovered(t, alice, second)
+		require.Contains(t, rems, p2p.DiscoveredRemoteName(info.ID))
+
+		alice.lost(ctx, info.ID)
+		require.Empty(t, discovered(t, alice, second))
+	})
+
+	t.Run("unreachable peer", func(t *testing.T) {
+		alice, bob := newUserDataStore(t), newUserDataStore(t)
+		id := addBucket(t, alice, bob)
+		info := addrInfo(t, bob)
+		require.NoError(t, bob.Close())
+
+		alice.discovered(ctx, info)
+		require.Empty(t, discovered(t, alice, id))
+	})
+
+	t.Run("peer without a DID", func(t *testing.T) {
+		alice := newUserDataStore(t)
+		id := addBucket(t, alice)
+		_, pk, err := crypto.GenerateSecp256k1Key(rand.Reader)
+		require.NoError(t, err)
+		pid, err := peer.IDFromPublicKey(pk)
+		require.NoError(t, err)
+
+		alice.discovered(ctx, peer.AddrInfo{ID: pid})
+		require.Empty(t, discovered(t, alice, id))
+	})
+}
@@ -0,0 +1,314 @@
+package syncer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"golang.org/x/sync/errgroup"
+)
+
+var log = logging.Logger("syncer")
+
+const (
+	// DefaultInterval is the time between syncs with a remote that has no
+	// interval configured.
+	DefaultInterval = 5 * time.Minute
+	// DefaultMaxBackoff is the maximum time between attempts to sync with a
+	// remote that keeps failing, unless its interval is longer.
+	DefaultMaxBackoff = time.Hour
+	// DefaultTick is how often remotes are checked to see if a sync is due.
+	DefaultTick = 10 * time.Second
+	// DefaultConcurrency is the maximum number of buckets synced at once.
+	DefaultConcurrency = 4
+)
+
+// Buckets provides the buckets to sync. It is implemented by
+// [store.UserDataStore].
+type Buckets interface {
+	Buckets(ctx context.Context) (map[did.DID]delegation.Delegation, error)
+	Bucket(ctx context.Context, id did.DID) (bucket.Bucket[ipld.Link], error)
+}
+
+// Result is the outcome of syncing a bucket with a remote.
+type Result struct {
+	Bucket did.DID
+	Remote string
+	State  bucket.SyncState
+	// Conflicts are the keys modified both locally and on the remote that were
+	// resolved when merging.
+	Conflicts []bucket.Conflict
+}
+
+// Option is an option configuring a syncer.
+type Option func(s *Syncer)
+
+// WithInterval sets the time between syncs with remotes that have no interval
+// configured.
+func WithInterval(d time.Duration) Option {
+	return func(s *Syncer) {
+		s.interval = d
+	}
+}
+
+// WithMaxBackoff sets the maximum time between attempts to sync with a remote
+// that keeps failing.
+func WithMaxBackoff(d time.Duration) Option {
+	return func(s *Syncer) {
+		s.maxBackoff = d
+	}
+}
+
+// WithTick sets how often remotes are checked to see if a sync is due.
+func WithTick(d time.Duration) Option {
+	return func(s *Syncer) {
+		s.tick = d
+	}
+}
+
+// WithConcurrency sets the maximum number of buckets synced at once.
+func WithConcurrency(n int) Option {
+	return func(s *Syncer) {
+		s.concurrency = n
+	}
+}
+
+// WithNotify sets a function that is called after every sync attempt.
+func WithNotify(notify func(Result)) Option {
+	return func(s *Syncer) {
+		s.notify = notify
+	}
+}
+
+// WithProgress sets a function that is called as pulls from and pushes to a
+// remote make progress.
+func WithProgress(progress func(id did.DID, remote string, p bucket.Progress)) Option {
+	return func(s *Syncer) {
+		s.progress = progress
+	}
+}
+
+// Syncer periodically pulls from and pushes to every remote of every bucket,
+// including remotes discovered at runtime, see [bucket.Discoverer]. Each
+// remote is synced at its own interval, and attempts to sync with a failing
+// remote back off exponentially. The outcome of each attempt is recorded in
+// the [bucket.Tracker] of the bucket.
+type Syncer struct {
+	buckets     Buckets
+	interval    time.Duration
+	maxBackoff  time.Duration
+	tick        time.Duration
+	concurrency int
+	notify      func(Result)
+	progress    func(id did.DID, remote string, p bucket.Progress)
+}
+
+// Run syncs remotes as they become due until the context is canceled.
+func (s *Syncer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+	for {
+		err := s.SyncDue(ctx)
+		if err != nil {
+			log.Errorf("syncing due remotes: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncDue syncs every remote of every bucket whose sync is due, and waits for
+// them to complete. Buckets are synced concurrently, up to the configured
+// limit, and the remotes of a bucket one after another. Failed syncs are
+// recorded, not returned. A bucket or remote whose sync state cannot be read
+// does not stop the others from syncing, the errors are returned once they
+// have completed.
+func (s *Syncer) SyncDue(ctx context.Context) error {
+	buckets, err := s.buckets.Buckets(ctx)
+	if err != nil {
+		return fmt.Errorf("listing buckets: %w", err)
+	}
+	now := time.Now()
+	var errs []error
+	var g errgroup.Group
+	g.SetLimit(s.concurrency)
+	for id := range buckets {
+		names, err := s.due(ctx, id, now)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if len(names) == 0 {
+			continue
+		}
+		g.Go(func() error {
+			for _, name := range names {
+				_, err := s.Sync(ctx, id, name)
+				if err != nil {
+					log.Errorf("recording sync: %s: %s: %s", id, name, err)
+				}
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	return errors.Join(errs...)
+}
+
+// due returns the names of the remotes of the bucket whose sync is due, with
+// the errors for remotes whose sync state cannot be read.
+func (s *Syncer) due(ctx context.Context, id did.DID, now time.Time) ([]string, error) {
+	bk, err := s.buckets.Bucket(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("getting bucket: %s: %w", id, err)
+	}
+	nbk, nok := bk.(bucket.Networker)
+	tracker, tok := bk.(bucket.Tracker)
+	if !nok || !tok {
+		return nil, nil
+	}
+	rems, err := nbk.Remotes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting remotes: %s: %w", id, err)
+	}
+	var names []string
+	for entry, err := range rems.Entries(ctx) {
+		if err != nil {
+			return nil, fmt.Errorf("listing remotes: %s: %w", id, err)
+		}
+		names = append(names, entry.Key)
+	}
+	var errs []error
+	if dbk, ok := bk.(bucket.Discoverer); ok {
+		discovered, err := dbk.Discovered(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("listing discovered remotes: %s: %w", id, err))
+		}
+		for name := range discovered {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	var due []string
+	for _, name := range names {
+		state, err := tracker.SyncState(ctx, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("getting sync state: %s: %s: %w", id, name, err))
+			continue
+		}
+		if s.Next(state).After(now) {
+			continue
+		}
+		due = append(due, name)
+	}
+	return due, errors.Join(errs...)
+}
+
+// Sync pulls from and then pushes to the named remote of the bucket, and
+// records the outcome. The returned error is only for failing to record it,
+// a failed sync is described by the returned state.
+func (s *Syncer) Sync(ctx context.Context, id did.DID, name string) (bucket.SyncState, error) {
+	bk, err := s.buckets.Bucket(ctx, id)
+	if err != nil {
+		return bucket.SyncState{}, fmt.Errorf("getting bucket: %w", err)
+	}
+	nbk, ok := bk.(bucket.Networker)
+	if !ok {
+		return bucket.SyncState{}, fmt.Errorf("bucket is not a networker: %s", id)
+	}
+	tracker, ok := bk.(bucket.Tracker)
+	if !ok {
+		return bucket.SyncState{}, fmt.Errorf("bucket is not a tracker: %s", id)
+	}
+	state, err := tracker.SyncState(ctx, name)
+	if err != nil {
+		return bucket.SyncState{}, err
+	}
+
+	log.Debugf("syncing %s with remote %s", id, name)
+	state.LastSync = time.Now()
+	var options []bucket.TransferOption
+	if s.progress != nil {
+		options = append(options, bucket.WithProgress(func(p bucket.Progress) {
+			s.progress(id, name, p)
+		}))
+	}
+	conflicts, err := pullPush(ctx, nbk, name, options...)
+	if err != nil {
+		log.Warnf("syncing %s with remote %s: %s", id, name, err)
+		state.LastError = err.Error()
+		state.Failures++
+	} else {
+		state.LastError = ""
+		state.Failures = 0
+	}
+
+	err = tracker.SetSyncState(ctx, name, state)
+	if err != nil {
+		return state, err
+	}
+	if s.notify != nil {
+		s.notify(Result{id, name, state, conflicts})
+	}
+	return state, nil
+}
+
+func pullPush(ctx context.Context, nbk bucket.Networker, name string, options ...bucket.TransferOption) ([]bucket.Conflict, error) {
+	remote, err := nbk.Remote(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("getting remote: %w", err)
+	}
+	res, err := remote.Pull(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("pulling: %w", err)
+	}
+	_, err = remote.Push(ctx, options...)
+	if err != nil {
+		return res.Conflicts, fmt.Errorf("pushing: %w", err)
+	}
+	return res.Conflicts, nil
+}
+
+// Next returns the time the next sync with a remote in the passed state is
+// due. After a failure the interval is doubled for every consecutive failure,
+// up to the maximum backoff.
+func (s *Syncer) Next(state bucket.SyncState) time.Time {
+	if state.LastSync.IsZero() {
+		return time.Time{}
+	}
+	interval := state.Interval
+	if interval == 0 {
+		interval = s.interval
+	}
+	delay := interval
+	for i := 0; i < state.Failures && delay < s.maxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, max(s.maxBackoff, interval))
+	return state.LastSync.Add(delay)
+}
+
+// New creates a syncer for the passed buckets.
+func New(buckets Buckets, options ...Option) *Syncer {
+	s := &Syncer{
+		buckets:     buckets,
+		interval:    DefaultInterval,
+		maxBackoff:  DefaultMaxBackoff,
+		tick:        DefaultTick,
+		concurrency: DefaultConcurrency,
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+	return s
+}
@@ -0,0 +1,215 @@
+package syncer
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"iter"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/fam/internal/testutil/buckettest"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal/ed25519/signer"
+	"github.com/stretchr/testify/require"
+)
+
+// replicaService is a clock service for a replica in the same process.
+type replicaService struct {
+	replica bucket.Replica
+}
+
+func (s replicaService) Head(ctx context.Context) ([]ipld.Link, error) {
+	return s.replica.Head(ctx)
+}
+
+func (s replicaService) Blocks(ctx context.Context, links []ipld.Link) iter.Seq2[block.Block, error] {
+	return func(yield func(block.Block, error) bool) {
+		for _, l := range links {
+			b, err := s.replica.Blocks().Get(ctx, l)
+			if errors.Is(err, block.ErrNotFound) {
+				continue
+			}
+			if !yield(b, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s replicaService) Has(ctx context.Context, links []ipld.Link) ([]ipld.Link, error) {
+	var have []ipld.Link
+	for _, l := range links {
+		_, err := s.replica.Blocks().Get(ctx, l)
+		if err == nil {
+			have = append(have, l)
+		}
+	}
+	return have, nil
+}
+
+func (s replicaService) Advance(ctx context.Context, head []ipld.Link, blocks []block.Block) ([]ipld.Link, error) {
+	received := block.NewMapBlockstore()
+	for _, b := range blocks {
+		_ = received.Put(ctx, b)
+	}
+	return bucket.Import(ctx, s.replica, head, received)
+}
+
+func newPeerID(t *testing.T) peer.ID {
+	t.Helper()
+	_, pk, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	id, err := peer.IDFromPublicKey(pk)
+	require.NoError(t, err)
+	return id
+}
+
+// testBuckets are the buckets to sync, each with remotes that are either
+// replicas in the same process or, if nil, fail to dial.
+type testBuckets struct {
+	buckets map[did.DID]*bucket.NetworkClockBucket[ipld.Link]
+	broken  map[did.DID]bool
+}
+
+func (b *testBuckets) Buckets(ctx context.Context) (map[did.DID]delegation.Delegation, error) {
+	buckets := map[did.DID]delegation.Delegation{}
+	for id := range b.buckets {
+		buckets[id] = nil
+	}
+	for id := range b.broken {
+		buckets[id] = nil
+	}
+	return buckets, nil
+}
+
+func (b *testBuckets) Bucket(ctx context.Context, id did.DID) (bucket.Bucket[ipld.Link], error) {
+	if b.broken[id] {
+		return nil, errors.New("broken bucket")
+	}
+	return b.buckets[id], nil
+}
+
+// add adds a bucket with the passed remotes.
+func (b *testBuckets) add(t *testing.T, remotes map[string]bucket.Replica) *bucket.NetworkClockBucket[ipld.Link] {
+	t.Helper()
+	ctx := context.Background()
+	id, err := signer.Generate()
+	require.NoError(t, err)
+	bk := buckettest.NewBucket(t)
+	addrs := map[peer.ID]bucket.Replica{}
+	rems := bucket.NewRemoteBucket(bk, buckettest.NewBucket(t))
+	for name, r := range remotes {
+		pid := newPeerID(t)
+		addrs[pid] = r
+		require.NoError(t, rems.Put(ctx, name, peer.AddrInfo{ID: pid}))
+	}
+	dial := func(ctx context.Context, addr peer.AddrInfo) (bucket.ClockService, error) {
+		r := addrs[addr.ID]
+		if r == nil {
+			return nil, errors.New("connection refused")
+		}
+		return replicaService{r}, nil
+	}
+	nbk, err := bucket.NewNetworkClockBucket(bk, bk.Blocks(), rems, bk, dial, nil, nil)
+	require.NoError(t, err)
+	b.buckets[id.DID()] = nbk
+	return nbk
+}
+
+func TestSyncDue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("failing remote does not stop others", func(t *testing.T) {
+		buckets := &testBuckets{buckets: map[did.DID]*bucket.NetworkClockBucket[ipld.Link]{}}
+		first, second := buckettest.NewBucket(t), buckettest.NewBucket(t)
+		bk := buckets.add(t, map[string]bucket.Replica{"a": nil, "b": first, "c": nil})
+		other := buckets.add(t, map[string]bucket.Replica{"a": nil, "b": second})
+		v := testutil.RandomLink(t)
+		require.NoError(t, bk.Put(ctx, "k", v))
+		require.NoError(t, other.Put(ctx, "k", v))
+
+		var mu sync.Mutex
+		var results []Result
+		s := New(buckets, WithNotify(func(r Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, r)
+		}))
+		require.NoError(t, s.SyncDue(ctx))
+		require.Len(t, results, 5)
+
+		for _, r := range []bucket.Replica{first, second} {
+			head, err := r.Head(ctx)
+			require.NoError(t, err)
+			require.NotEmpty(t, head)
+		}
+		for _, name := range []string{"a", "b", "c"} {
+			state, err := bk.SyncState(ctx, name)
+			require.NoError(t, err)
+			require.False(t, state.LastSync.IsZero())
+			if name == "b" {
+				require.Zero(t, state.Failures)
+				require.Empty(t, state.LastError)
+			} else {
+				require.Equal(t, 1, state.Failures)
+				require.Contains(t, state.LastError, "connection refused")
+			}
+		}
+
+		// nothing is due until the interval has passed
+		results = nil
+		require.NoError(t, s.SyncDue(ctx))
+		require.Empty(t, results)
+	})
+
+	t.Run("failing bucket does not stop others", func(t *testing.T) {
+		buckets := &testBuckets{buckets: map[did.DID]*bucket.NetworkClockBucket[ipld.Link]{}}
+		id, err := signer.Generate()
+		require.NoError(t, err)
+		buckets.broken = map[did.DID]bool{id.DID(): true}
+		remote := buckettest.NewBucket(t)
+		bk := buckets.add(t, map[string]bucket.Replica{"origin": remote})
+		require.NoError(t, bk.Put(ctx, "k", testutil.RandomLink(t)))
+
+		err = New(buckets).SyncDue(ctx)
+		require.ErrorContains(t, err, "broken bucket")
+		head, err := remote.Head(ctx)
+		require.NoError(t, err)
+		require.NotEmpty(t, head)
+	})
+
+	t.Run("syncs the remotes of a bucket one after another", func(t *testing.T) {
+		buckets := &testBuckets{buckets: map[did.DID]*bucket.NetworkClockBucket[ipld.Link]{}}
+		for range 3 {
+			buckets.add(t, map[string]bucket.Replica{"a": nil, "b": nil})
+		}
+
+		var results []Result
+		s := New(buckets, WithConcurrency(1), WithNotify(func(r Result) { results = append(results, r) }))
+		require.NoError(t, s.SyncDue(ctx))
+		require.Len(t, results, 6)
+		for i := 0; i < len(results); i += 2 {
+			require.Equal(t, results[i].Bucket, results[i+1].Bucket)
+		}
+	})
+}
+
+func TestNext(t *testing.T) {
+	s := New(nil, WithInterval(time.Minute), WithMaxBackoff(10*time.Minute))
+	now := time.Now()
+
+	require.True(t, s.Next(bucket.SyncState{}).IsZero())
+	require.Equal(t, now.Add(time.Minute), s.Next(bucket.SyncState{LastSync: now}))
+	require.Equal(t, now.Add(4*time.Minute), s.Next(bucket.SyncState{LastSync: now, Failures: 2}))
+	require.Equal(t, now.Add(10*time.Minute), s.Next(bucket.SyncState{LastSync: now, Failures: 10}))
+	require.Equal(t, now.Add(time.Hour), s.Next(bucket.SyncState{LastSync: now, Interval: time.Hour, Failures: 3}))
+}
@@ -0,0 +1,386 @@
+package w3clock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/capabilities/clock"
+	"github.com/storacha/go-ucanto/client"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/core/invocation"
+	"github.com/storacha/go-ucanto/core/receipt"
+	"github.com/storacha/go-ucanto/core/result"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal"
+	"github.com/storacha/go-ucanto/transport"
+	thttp "github.com/storacha/go-ucanto/transport/http"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrNotHTTP is returned when a multiaddr is not an HTTP(S) address.
+var ErrNotHTTP = errors.New("not an HTTP address")
+
+// MaxConcurrentHas is the maximum number of concurrent requests made to
+// determine which blocks a clock service has.
+const MaxConcurrentHas = 16
+
+// BlockSource fetches the blocks of a bucket from a clock service.
+type BlockSource interface {
+	block.Fetcher
+	// Has returns the subset of the passed links the service has blocks for.
+	Has(ctx context.Context, links []ipld.Link) ([]ipld.Link, error)
+}
+
+// Client is a clock service client for a single bucket. It invokes
+// `clock/head` and `clock/advance` on the service, using the delegation for the
+// bucket as proof.
+type Client struct {
+	id     principal.Signer
+	conn   client.Connection
+	bucket did.DID
+	proof  delegation.Delegation
+	blocks BlockSource
+}
+
+func (c *Client) Head(ctx context.Context) ([]ipld.Link, error) {
+	inv, err := clock.Head.Invoke(c.id, c.conn.ID(), c.bucket.String(), clock.HeadCaveats{}, c.options()...)
+	if err != nil {
+		return nil, fmt.Errorf("invoking %s: %w", clock.HeadAbility, err)
+	}
+	reader, err := receipt.NewReceiptReaderFromTypes[clock.HeadOk, ipld.Node](clock.HeadOkType(), clock.FailureType())
+	if err != nil {
+		return nil, fmt.Errorf("creating receipt reader: %w", err)
+	}
+	ok, err := execute(c.conn, inv, reader)
+	if err != nil {
+		return nil, err
+	}
+	return ok.Head, nil
+}
+
+func (c *Client) Blocks(ctx context.Context, links []ipld.Link) iter.Seq2[block.Block, error] {
+	return func(yield func(block.Block, error) bool) {
+		for _, l := range links {
+			b, err := c.blocks.Get(ctx, l)
+			if err != nil {
+				if errors.Is(err, block.ErrNotFound) {
+					continue
+				}
+				yield(nil, fmt.Errorf("getting block: %w", err))
+				return
+			}
+			if !yield(b, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) Has(ctx context.Context, links []ipld.Link) ([]ipld.Link, error) {
+	return c.blocks.Has(ctx, links)
+}
+
+// Advance invokes `clock/advance` for each of the passed head events. Each of
+// the passed blocks is attached only to the invocation for the first event it
+// is reachable from, since the service keeps the blocks attached to an
+// invocation that are needed for its event, and the events of a head need not
+// be reachable from one another.
+func (c *Client) Advance(ctx context.Context, head []ipld.Link, blocks []block.Block) ([]ipld.Link, error) {
+	reader, err := receipt.NewReceiptReaderFromTypes[clock.AdvanceOk, ipld.Node](clock.AdvanceOkType(), clock.FailureType())
+	if err != nil {
+		return nil, fmt.Errorf("creating receipt reader: %w", err)
+	}
+	attach, err := partition(head, blocks)
+	if err != nil {
+		return nil, err
+	}
+	var rhead []ipld.Link
+	for i, l := range head {
+		inv, err := clock.Advance.Invoke(c.id, c.conn.ID(), c.bucket.String(), clock.AdvanceCaveats{Event: l}, c.options()...)
+		if err != nil {
+			return nil, fmt.Errorf("invoking %s: %w", clock.AdvanceAbility, err)
+		}
+		for _, b := range attach[i] {
+			err = inv.Attach(b)
+			if err != nil {
+				return nil, fmt.Errorf("attaching block: %w", err)
+			}
+		}
+		ok, err := execute(c.conn, inv, reader)
+		if err != nil {
+			return nil, err
+		}
+		rhead = ok.Head
+	}
+	return rhead, nil
+}
+
+// partition splits the passed blocks by the first of the head events they are
+// reachable from. Blocks not reachable from any of them are dropped.
+func partition(head []ipld.Link, blocks []block.Block) ([][]block.Block, error) {
+	pending := map[ipld.Link]block.Block{}
+	for _, b := range blocks {
+		pending[b.Link()] = b
+	}
+	parts := make([][]block.Block, len(head))
+	for i, h := range head {
+		links := []ipld.Link{h}
+		for len(links) > 0 {
+			l := links[0]
+			links = links[1:]
+			b, ok := pending[l]
+			if !ok {
+				continue
+			}
+			delete(pending, l)
+			parts[i] = append(parts[i], b)
+			ls, err := blockLinks(b)
+			if err != nil {
+				return nil, fmt.Errorf("decoding block: %s: %w", l, err)
+			}
+			links = append(links, ls...)
+		}
+	}
+	return parts, nil
+}
+
+// blockLinks returns the links in a DAG-CBOR encoded block, such as a clock
+// event or a pail shard.
+func blockLinks(b block.Block) ([]ipld.Link, error) {
+	n, err := ipld.Decode(b.Bytes(), dagcbor.Decode)
+	if err != nil {
+		return nil, err
+	}
+	var links []ipld.Link
+	err = traversal.WalkLocal(n, func(p traversal.Progress, n ipld.Node) error {
+		if n.Kind() != datamodel.Kind_Link {
+			return nil
+		}
+		l, err := n.AsLink()
+		if err != nil {
+			return err
+		}
+		links = append(links, l)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+func (c *Client) options() []delegation.Option {
+	if c.proof == nil {
+		return nil
+	}
+	return []delegation.Option{delegation.WithProof(delegation.FromDelegation(c.proof))}
+}
+
+func execute[O any](conn client.Connection, inv invocation.Invocation, reader receipt.ReceiptReader[O, ipld.Node]) (O, error) {
+	var ok O
+	res, err := client.Execute([]invocation.Invocation{inv}, conn)
+	if err != nil {
+		return ok, fmt.Errorf("executing invocation: %w", err)
+	}
+	rlink, found := res.Get(inv.Link())
+	if !found {
+		return ok, fmt.Errorf("missing receipt for invocation: %s", inv.Link())
+	}
+	rcpt, err := reader.Read(rlink, res.Blocks())
+	if err != nil {
+		return ok, fmt.Errorf("reading receipt: %w", err)
+	}
+	return result.MatchResultR2(rcpt.Out(), func(o O) (O, error) {
+		return o, nil
+	}, func(x ipld.Node) (O, error) {
+		return ok, failureError(x)
+	})
+}
+
+// failureError converts a failed invocation result to an error.
+func failureError(n ipld.Node) error {
+	var name, msg string
+	if nn, err := n.LookupByString("name"); err == nil {
+		name, _ = nn.AsString()
+	}
+	if mn, err := n.LookupByString("message"); err == nil {
+		msg, _ = mn.AsString()
+	}
+	if msg == "" {
+		msg = "unknown error"
+	}
+	if name != "" {
+		return fmt.Errorf("remote error: %s: %s", name, msg)
+	}
+	return fmt.Errorf("remote error: %s", msg)
+}
+
+// NewClient creates a client for the given bucket that sends invocations to the
+// clock service with the passed ID over the passed channel, and fetches blocks
+// from the passed source.
+func NewClient(id principal.Signer, bucket did.DID, proof delegation.Delegation, service did.DID, channel transport.Channel, blocks BlockSource) (*Client, error) {
+	conn, err := client.NewConnection(service, channel)
+	if err != nil {
+		return nil, fmt.Errorf("creating connection: %w", err)
+	}
+	return &Client{id, conn, bucket, proof, blocks}, nil
+}
+
+// Dial returns a client for the given bucket that talks to the clock service at
+// the first HTTP(S) address of the passed address info. Blocks are fetched
+// from the service by HTTP GET, and found by HTTP HEAD, at the block endpoint
+// served by [NewHTTPHandler]. The endpoint is not part of the clock service
+// protocol and only `fam serve` provides it, so other services, such as
+// clock.web3.storage, can be pushed to, sending every block, but not fetched
+// from. Invocations are addressed to the passed service DID.
+func Dial(ctx context.Context, id principal.Signer, bucket did.DID, proof delegation.Delegation, service did.DID, addr peer.AddrInfo) (*Client, error) {
+	for _, a := range addr.Addrs {
+		u, err := URL(a)
+		if err != nil {
+			continue
+		}
+		return NewClient(id, bucket, proof, service, thttp.NewHTTPChannel(u), &httpBlockFetcher{u, id, service, bucket, proof})
+	}
+	return nil, fmt.Errorf("no HTTP address for peer: %s", addr.ID)
+}
+
+// IsHTTP determines if the passed address info has an HTTP(S) address.
+func IsHTTP(addr peer.AddrInfo) bool {
+	for _, a := range addr.Addrs {
+		if _, err := URL(a); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// URL converts a multiaddr like /dns/example.org/https or
+// /ip4/127.0.0.1/tcp/3000/http to a URL.
+func URL(addr multiaddr.Multiaddr) (*url.URL, error) {
+	var scheme, host, port string
+	multiaddr.ForEach(addr, func(c multiaddr.Component) bool {
+		switch c.Protocol().Code {
+		case multiaddr.P_DNS, multiaddr.P_DNS4, multiaddr.P_DNS6, multiaddr.P_IP4:
+			host = c.Value()
+		case multiaddr.P_IP6:
+			host = "[" + c.Value() + "]"
+		case multiaddr.P_TCP:
+			port = c.Value()
+		case multiaddr.P_HTTP:
+			if scheme == "" {
+				scheme = "http"
+			}
+		case multiaddr.P_TLS:
+			scheme = "https"
+		case multiaddr.P_HTTPS:
+			scheme = "https"
+		}
+		return true
+	})
+	if scheme == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotHTTP, addr)
+	}
+	if host == "" {
+		return nil, fmt.Errorf("missing host: %s", addr)
+	}
+	if port != "" {
+		host = host + ":" + port
+	}
+	return &url.URL{Scheme: scheme, Host: host, Path: "/"}, nil
+}
+
+// httpBlockFetcher fetches the blocks of a bucket from a clock service by HTTP
+// GET, and determines which blocks it has by HTTP HEAD. Requests are
+// authorized by a `clock/head` invocation, see [AuthorizeRequest].
+type httpBlockFetcher struct {
+	url     *url.URL
+	id      principal.Signer
+	service did.DID
+	bucket  did.DID
+	proof   delegation.Delegation
+}
+
+func (f *httpBlockFetcher) Get(ctx context.Context, link ipld.Link) (block.Block, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.blockURL(link), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	err = AuthorizeRequest(req, f.id, f.service, f.bucket, f.proof)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting block: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, block.ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("requesting block: %s: unexpected status: %d", link, res.StatusCode)
+	}
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading block: %w", err)
+	}
+	return block.Verify(link, b)
+}
+
+func (f *httpBlockFetcher) Has(ctx context.Context, links []ipld.Link) ([]ipld.Link, error) {
+	found := make([]bool, len(links))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(MaxConcurrentHas)
+	for i, l := range links {
+		g.Go(func() error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodHead, f.blockURL(l), nil)
+			if err != nil {
+				return fmt.Errorf("creating request: %w", err)
+			}
+			err = AuthorizeRequest(req, f.id, f.service, f.bucket, f.proof)
+			if err != nil {
+				return err
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return fmt.Errorf("requesting block: %w", err)
+			}
+			res.Body.Close()
+			switch res.StatusCode {
+			case http.StatusOK:
+				found[i] = true
+			case http.StatusNotFound:
+			default:
+				return fmt.Errorf("requesting block: %s: unexpected status: %d", l, res.StatusCode)
+			}
+			return nil
+		})
+	}
+	err := g.Wait()
+	if err != nil {
+		return nil, err
+	}
+	var have []ipld.Link
+	for i, l := range links {
+		if found[i] {
+			have = append(have, l)
+		}
+	}
+	return have, nil
+}
+
+func (f *httpBlockFetcher) blockURL(link ipld.Link) string {
+	return f.url.JoinPath(f.bucket.String(), "blocks", link.String()).String()
+}
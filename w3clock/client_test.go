@@ -0,0 +1,115 @@
+package w3clock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/fam/internal/testutil/buckettest"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/ucan"
+	"github.com/stretchr/testify/require"
+)
+
+// divergentBucket creates a bucket whose head has two events, with the passed
+// values written on either side.
+func divergentBucket(t *testing.T, values map[string]ipld.Link) *bucket.DsClockBucket {
+	t.Helper()
+	ctx := context.Background()
+	bk := buckettest.NewBucket(t)
+	require.NoError(t, bk.Put(ctx, "base", testutil.RandomLink(t)))
+	branch, err := bk.Fork(ctx, "other")
+	require.NoError(t, err)
+	i := 0
+	for k, v := range values {
+		if i%2 == 0 {
+			require.NoError(t, bk.Put(ctx, k, v))
+		} else {
+			require.NoError(t, branch.Put(ctx, k, v))
+		}
+		i++
+	}
+	bhead, err := branch.Head(ctx)
+	require.NoError(t, err)
+	for _, l := range bhead {
+		evt, err := bk.Blocks().Get(ctx, l)
+		require.NoError(t, err)
+		_, err = bk.Advance(ctx, evt)
+		require.NoError(t, err)
+	}
+	head, err := bk.Head(ctx)
+	require.NoError(t, err)
+	require.Len(t, head, 2)
+	return bk
+}
+
+func exportBlocks(t *testing.T, blocks block.Fetcher, head []ipld.Link) []block.Block {
+	t.Helper()
+	var bs []block.Block
+	for b, err := range bucket.Export(context.Background(), blocks, head, nil) {
+		require.NoError(t, err)
+		bs = append(bs, b)
+	}
+	return bs
+}
+
+func TestClientAdvance(t *testing.T) {
+	ctx := context.Background()
+	space, alice, service := testutil.NewSigner(t), testutil.NewSigner(t), testutil.NewSigner(t)
+	proof, err := delegation.Delegate(
+		space,
+		alice,
+		[]ucan.Capability[ucan.NoCaveats]{
+			ucan.NewCapability("clock/*", space.DID().String(), ucan.NoCaveats{}),
+		},
+	)
+	require.NoError(t, err)
+
+	values := map[string]ipld.Link{"a": testutil.RandomLink(t), "b": testutil.RandomLink(t), "c": testutil.RandomLink(t), "d": testutil.RandomLink(t)}
+	local := divergentBucket(t, values)
+	head, err := local.Head(ctx)
+	require.NoError(t, err)
+	blocks := exportBlocks(t, local.Blocks(), head)
+
+	t.Run("attaches each block once", func(t *testing.T) {
+		parts, err := partition(head, blocks)
+		require.NoError(t, err)
+		seen := map[ipld.Link]int{}
+		for _, part := range parts {
+			require.NotEmpty(t, part)
+			for _, b := range part {
+				seen[b.Link()]++
+			}
+		}
+		require.Len(t, seen, len(blocks))
+		for l, n := range seen {
+			require.Equal(t, 1, n, "block %s attached %d times", l, n)
+		}
+	})
+
+	t.Run("advances a head with several events", func(t *testing.T) {
+		remote := buckettest.NewBucket(t)
+		svc, err := NewLocalService(service, func(ctx context.Context, id did.DID) (bucket.Replica, error) {
+			if id != space.DID() {
+				return nil, bucket.ErrNotFound
+			}
+			return remote, nil
+		})
+		require.NoError(t, err)
+		client, err := svc.Dial(ctx, alice, space.DID(), proof)
+		require.NoError(t, err)
+
+		rhead, err := client.Advance(ctx, head, blocks)
+		require.NoError(t, err)
+		require.ElementsMatch(t, head, rhead)
+		for k, v := range values {
+			got, err := remote.Get(ctx, k)
+			require.NoError(t, err)
+			require.Equal(t, v, got)
+		}
+	})
+}
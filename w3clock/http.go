@@ -0,0 +1,151 @@
+package w3clock
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/capabilities/clock"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/core/schema"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal"
+	"github.com/storacha/go-ucanto/server"
+	thttp "github.com/storacha/go-ucanto/transport/http"
+	"github.com/storacha/go-ucanto/validator"
+)
+
+// NewHTTPHandler creates an HTTP handler that accepts UCAN invocations for the
+// passed clock service at "POST /" and serves the blocks of the replicas found
+// by the passed resolver at "GET /{bucket}/blocks/{cid}". Requests for blocks
+// must carry an archived `clock/head` invocation on the bucket, addressed to
+// the service, as a bearer token, see [AuthorizeRequest].
+func NewHTTPHandler(srv server.ServerView, resolve bucket.Resolver) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{$}", func(w http.ResponseWriter, r *http.Request) {
+		res, err := srv.Request(thttp.NewHTTPRequest(r.Body, r.Header))
+		if err != nil {
+			log.Errorf("handling UCAN request: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for key, vals := range res.Headers() {
+			for _, v := range vals {
+				w.Header().Add(key, v)
+			}
+		}
+		if res.Status() != 0 {
+			w.WriteHeader(res.Status())
+		}
+		_, err = io.Copy(w, res.Body())
+		if err != nil {
+			log.Errorf("writing UCAN response: %s", err)
+		}
+	})
+	mux.HandleFunc("GET /{bucket}/blocks/{cid}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := did.Parse(r.PathValue("bucket"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parsing bucket DID: %s", err), http.StatusBadRequest)
+			return
+		}
+		c, err := cid.Parse(r.PathValue("cid"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parsing CID: %s", err), http.StatusBadRequest)
+			return
+		}
+		err = authorizeRead(srv, id, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		replica, err := resolve(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, bucket.ErrNotFound) {
+				http.Error(w, fmt.Sprintf("bucket not found: %s", id), http.StatusNotFound)
+				return
+			}
+			log.Errorf("resolving bucket: %s", err)
+			http.Error(w, "resolving bucket", http.StatusInternalServerError)
+			return
+		}
+		b, err := replica.Blocks().Get(r.Context(), cidlink.Link{Cid: c})
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				http.Error(w, fmt.Sprintf("block not found: %s", c), http.StatusNotFound)
+				return
+			}
+			log.Errorf("getting block: %s", err)
+			http.Error(w, "getting block", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.ipld.raw")
+		_, err = w.Write(b.Bytes())
+		if err != nil {
+			log.Errorf("writing block: %s", err)
+		}
+	})
+	return mux
+}
+
+// AuthorizeRequest sets the bearer token of a request for blocks to an
+// archived `clock/head` invocation on the bucket, issued by the passed signer
+// to the service, using the passed delegation (if any) as proof.
+func AuthorizeRequest(r *http.Request, issuer principal.Signer, service did.DID, bucket did.DID, proof delegation.Delegation) error {
+	var opts []delegation.Option
+	if proof != nil {
+		opts = append(opts, delegation.WithProof(delegation.FromDelegation(proof)))
+	}
+	inv, err := clock.Head.Invoke(issuer, service, bucket.String(), clock.HeadCaveats{}, opts...)
+	if err != nil {
+		return fmt.Errorf("invoking %s: %w", clock.HeadAbility, err)
+	}
+	b, err := io.ReadAll(inv.Archive())
+	if err != nil {
+		return fmt.Errorf("archiving invocation: %w", err)
+	}
+	r.Header.Set("Authorization", "Bearer "+base64.RawURLEncoding.EncodeToString(b))
+	return nil
+}
+
+// authorizeRead verifies that the bearer token of the request is an archived
+// `clock/head` invocation on the bucket, addressed to the service, whose
+// delegation chain is rooted at the bucket.
+func authorizeRead(srv server.ServerView, bucket did.DID, r *http.Request) error {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return errors.New("missing bearer token")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return fmt.Errorf("decoding bearer token: %w", err)
+	}
+	inv, err := delegation.Extract(b)
+	if err != nil {
+		return fmt.Errorf("extracting invocation: %w", err)
+	}
+	if inv.Audience().DID() != srv.ID().DID() {
+		return fmt.Errorf("invocation audience %s is not this service %s", inv.Audience().DID(), srv.ID().DID())
+	}
+	ictx := srv.Context()
+	vctx := validator.NewValidationContext(
+		srv.ID().Verifier(),
+		clock.NewHeadCapability(schema.Literal(bucket.String())),
+		ictx.CanIssue,
+		ictx.ValidateAuthorization,
+		ictx.ResolveProof,
+		ictx.ParsePrincipal,
+		ictx.ResolveDIDKey,
+	)
+	_, uerr := validator.Access(inv, vctx)
+	if uerr != nil {
+		return uerr
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package w3clock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/internal/testutil"
+	"github.com/storacha/fam/internal/testutil/buckettest"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/ucan"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPHandlerBlocks(t *testing.T) {
+	ctx := context.Background()
+	space, alice, service := testutil.NewSigner(t), testutil.NewSigner(t), testutil.NewSigner(t)
+	remote := buckettest.NewBucket(t)
+	require.NoError(t, remote.Put(ctx, "k", testutil.RandomLink(t)))
+	head, err := remote.Head(ctx)
+	require.NoError(t, err)
+
+	resolve := func(ctx context.Context, id did.DID) (bucket.Replica, error) {
+		if id != space.DID() {
+			return nil, bucket.ErrNotFound
+		}
+		return remote, nil
+	}
+	srv, err := NewServer(service, resolve)
+	require.NoError(t, err)
+	ts := httptest.NewServer(NewHTTPHandler(srv, resolve))
+	t.Cleanup(ts.Close)
+	u, err := url.Parse(ts.URL + "/")
+	require.NoError(t, err)
+
+	grant := func(t *testing.T, issuer ucan.Signer) delegation.Delegation {
+		t.Helper()
+		d, err := delegation.Delegate(
+			issuer,
+			alice,
+			[]ucan.Capability[ucan.NoCaveats]{
+				ucan.NewCapability("clock/*", space.DID().String(), ucan.NoCaveats{}),
+			},
+		)
+		require.NoError(t, err)
+		return d
+	}
+
+	t.Run("authorized reader", func(t *testing.T) {
+		f := &httpBlockFetcher{u, alice, service.DID(), space.DID(), grant(t, space)}
+		b, err := f.Get(ctx, head[0])
+		require.NoError(t, err)
+		require.Equal(t, head[0], b.Link())
+		have, err := f.Has(ctx, head)
+		require.NoError(t, err)
+		require.Equal(t, head, have)
+	})
+
+	t.Run("unauthorized reader", func(t *testing.T) {
+		f := &httpBlockFetcher{u, alice, service.DID(), space.DID(), grant(t, testutil.NewSigner(t))}
+		_, err := f.Get(ctx, head[0])
+		require.ErrorContains(t, err, "unexpected status: 401")
+	})
+
+	t.Run("missing bearer token", func(t *testing.T) {
+		res, err := http.Get(u.JoinPath(space.DID().String(), "blocks", head[0].String()).String())
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+}
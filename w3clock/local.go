@@ -0,0 +1,77 @@
+package w3clock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/go-ucanto/core/delegation"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal"
+	"github.com/storacha/go-ucanto/server"
+)
+
+// LocalService is an in-process stand-in for a remote clock service. It runs
+// the same UCAN server as [NewServer] but invocations are passed to it
+// directly, without a network round trip. It is useful when working offline.
+type LocalService struct {
+	server  server.ServerView
+	resolve bucket.Resolver
+}
+
+// NewLocalService creates an in-process clock service for the replicas found by
+// the passed resolver.
+func NewLocalService(id principal.Signer, resolve bucket.Resolver, options ...server.Option) (*LocalService, error) {
+	srv, err := NewServer(id, resolve, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalService{srv, resolve}, nil
+}
+
+// ID is the DID of the service.
+func (s *LocalService) ID() did.DID {
+	return s.server.ID().DID()
+}
+
+// Dial returns a client for the given bucket that sends invocations to this
+// service.
+func (s *LocalService) Dial(ctx context.Context, id principal.Signer, bucket did.DID, proof delegation.Delegation) (*Client, error) {
+	return NewClient(id, bucket, proof, s.ID(), s.server, &replicaFetcher{s.resolve, bucket})
+}
+
+// replicaFetcher fetches blocks from the replica of a bucket.
+type replicaFetcher struct {
+	resolve bucket.Resolver
+	bucket  did.DID
+}
+
+func (f *replicaFetcher) Get(ctx context.Context, link ipld.Link) (block.Block, error) {
+	replica, err := f.resolve(ctx, f.bucket)
+	if err != nil {
+		return nil, fmt.Errorf("resolving bucket: %w", err)
+	}
+	return replica.Blocks().Get(ctx, link)
+}
+
+func (f *replicaFetcher) Has(ctx context.Context, links []ipld.Link) ([]ipld.Link, error) {
+	replica, err := f.resolve(ctx, f.bucket)
+	if err != nil {
+		return nil, fmt.Errorf("resolving bucket: %w", err)
+	}
+	var have []ipld.Link
+	for _, l := range links {
+		_, err := replica.Blocks().Get(ctx, l)
+		if err != nil {
+			if errors.Is(err, block.ErrNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("getting block: %w", err)
+		}
+		have = append(have, l)
+	}
+	return have, nil
+}
@@ -0,0 +1,133 @@
+package w3clock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/storacha/fam/block"
+	"github.com/storacha/fam/bucket"
+	"github.com/storacha/fam/capabilities/clock"
+	"github.com/storacha/go-ucanto/core/invocation"
+	"github.com/storacha/go-ucanto/core/receipt/fx"
+	"github.com/storacha/go-ucanto/did"
+	"github.com/storacha/go-ucanto/principal"
+	"github.com/storacha/go-ucanto/server"
+	"github.com/storacha/go-ucanto/ucan"
+)
+
+var log = logging.Logger("w3clock")
+
+// InvocationTimeout is the maximum time allowed to handle a single invocation.
+const InvocationTimeout = time.Minute
+
+// NewServer creates a UCAN clock service that handles `clock/head` and
+// `clock/advance` invocations for the replicas found by the passed resolver.
+//
+// Invocations of `clock/advance` must have the event, and any event and shard
+// blocks reachable from it that the replica does not have, attached.
+func NewServer(id principal.Signer, resolve bucket.Resolver, options ...server.Option) (server.ServerView, error) {
+	options = append([]server.Option{
+		server.WithServiceMethod(
+			clock.HeadAbility,
+			server.Provide(clock.Head, func(cap ucan.Capability[clock.HeadCaveats], inv invocation.Invocation, ictx server.InvocationContext) (clock.HeadOk, fx.Effects, error) {
+				ctx, cancel := context.WithTimeout(context.Background(), InvocationTimeout)
+				defer cancel()
+
+				replica, err := resolveReplica(ctx, resolve, ictx, cap.With(), inv)
+				if err != nil {
+					return clock.HeadOk{}, nil, err
+				}
+				head, err := replica.Head(ctx)
+				if err != nil {
+					return clock.HeadOk{}, nil, fmt.Errorf("getting head: %w", err)
+				}
+				return clock.HeadOk{Head: head}, nil, nil
+			}),
+		),
+		server.WithServiceMethod(
+			clock.AdvanceAbility,
+			server.Provide(clock.Advance, func(cap ucan.Capability[clock.AdvanceCaveats], inv invocation.Invocation, ictx server.InvocationContext) (clock.AdvanceOk, fx.Effects, error) {
+				ctx, cancel := context.WithTimeout(context.Background(), InvocationTimeout)
+				defer cancel()
+
+				if cap.Nb().Event == nil {
+					return clock.AdvanceOk{}, nil, errors.New("missing event")
+				}
+				replica, err := resolveReplica(ctx, resolve, ictx, cap.With(), inv)
+				if err != nil {
+					return clock.AdvanceOk{}, nil, err
+				}
+				head, err := advance(ctx, replica, cap.Nb().Event, inv)
+				if err != nil {
+					return clock.AdvanceOk{}, nil, err
+				}
+				return clock.AdvanceOk{Head: head}, nil, nil
+			}),
+		),
+	}, options...)
+	return server.NewServer(id, options...)
+}
+
+func resolveReplica(ctx context.Context, resolve bucket.Resolver, ictx server.InvocationContext, with string, inv invocation.Invocation) (bucket.Replica, error) {
+	if inv.Audience().DID() != ictx.ID().DID() {
+		return nil, fmt.Errorf("invocation audience %s is not this service %s", inv.Audience().DID(), ictx.ID().DID())
+	}
+	id, err := did.Parse(with)
+	if err != nil {
+		return nil, fmt.Errorf("parsing bucket DID: %w", err)
+	}
+	replica, err := resolve(ctx, id)
+	if err != nil {
+		if errors.Is(err, bucket.ErrNotFound) {
+			return nil, fmt.Errorf("bucket not found: %s", id)
+		}
+		return nil, fmt.Errorf("resolving bucket: %w", err)
+	}
+	return replica, nil
+}
+
+// advance stores the blocks attached to the invocation that are needed to
+// advance the replica with the passed event and then advances it.
+func advance(ctx context.Context, replica bucket.Replica, event ipld.Link, inv invocation.Invocation) ([]ipld.Link, error) {
+	attached := attachedFetcher{}
+	for b, err := range inv.Blocks() {
+		if err != nil {
+			return nil, fmt.Errorf("iterating invocation blocks: %w", err)
+		}
+		attached[b.Link()] = b
+	}
+
+	base, err := replica.Head(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting head: %w", err)
+	}
+	// only the attached blocks the replica does not have are verified and used
+	used, err := bucket.VerifyEvents(ctx, replica.Blocks(), attached, []ipld.Link{event}, base)
+	if err != nil {
+		return nil, fmt.Errorf("verifying events: %w", err)
+	}
+
+	// the attached blocks are written in the same batch the clock is advanced
+	// with, along with every new event they hold
+	log.Debugf("putting %d attached blocks", len(used))
+	head, err := bucket.AdvanceHead(ctx, replica, []ipld.Link{event}, used)
+	if err != nil {
+		return nil, fmt.Errorf("advancing clock: %w", err)
+	}
+	return head, nil
+}
+
+// attachedFetcher fetches the blocks attached to an invocation.
+type attachedFetcher map[ipld.Link]block.Block
+
+func (f attachedFetcher) Get(ctx context.Context, link ipld.Link) (block.Block, error) {
+	b, ok := f[link]
+	if !ok {
+		return nil, block.ErrNotFound
+	}
+	return b, nil
+}